@@ -3,7 +3,11 @@ package ast
 import (
 	"bytes"
 	"fmt"
+	"io"
+	"monkey/token"
+	"os"
 	"reflect"
+	"strings"
 )
 
 // The base Node interface
@@ -36,10 +40,37 @@ func Type(node Node) string {
 	return reflect.TypeOf(node).String()
 }
 
+// 構文エラーで欠けたノードは <?> と書く
+func nodeString(node Node) string {
+	if node == nil || reflect.ValueOf(node).IsNil() {
+		return "<?>"
+	}
+	return node.String()
+}
+
+// ノードのトークン（ノードはどれもTokenを持つ。Programはゼロ値）
+func NodeToken(node Node) token.Token {
+	v := reflect.ValueOf(node)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if f := v.FieldByName("Token"); f.IsValid() {
+		if t, ok := f.Interface().(token.Token); ok {
+			return t
+		}
+	}
+	return token.Token{}
+}
+
 /*
- * astツリーを表示する
+ * astツリーを標準出力に表示する
  */
 func PrintAST(node Node, indent string) {
+	FprintAST(os.Stdout, node, indent)
+}
+
+// astツリーをwに書く
+func FprintAST(w io.Writer, node Node, indent string) {
 
 	if node == nil {
 		return
@@ -49,67 +80,74 @@ func PrintAST(node Node, indent string) {
 	if t.Kind() == reflect.Ptr {
 		t = t.Elem()
 	}
-	fmt.Println(indent + "* " + t.Name())
+	fmt.Fprintln(w, indent+"* "+t.Name())
 
 	switch n := node.(type) {
 	case *Program:
 		for _, stmt := range n.Statements {
-			PrintAST(stmt, indent+"  ")
+			FprintAST(w, stmt, indent+"  ")
 		}
 
 	case *LetStatement:
-		PrintAST(n.Ident, indent+"  ")
-		PrintAST(n.Value, indent+"  ")
+		FprintAST(w, n.Ident, indent+"  ")
+		FprintAST(w, n.Value, indent+"  ")
 
 	case *ExpressionStatement:
-		fmt.Printf("%s %s\n", indent+"  ", n.Token.Type)
-		PrintAST(n.Expression, indent+"  ")
+		fmt.Fprintf(w, "%s %s\n", indent+"  ", n.Token.Type)
+		FprintAST(w, n.Expression, indent+"  ")
 
 	case *PrefixExpression:
-		fmt.Printf("%sOperator: %s\n", indent+"  ", n.Operator)
-		PrintAST(n.Right, indent+"  ")
+		fmt.Fprintf(w, "%sOperator: %s\n", indent+"  ", n.Operator)
+		FprintAST(w, n.Right, indent+"  ")
 
 	case *InfixExpression:
-		fmt.Printf("%s  [left]\n", indent)
-		PrintAST(n.Left, indent+"  ")
-		fmt.Printf("%s  [Operator]\n", indent)
-		fmt.Printf("%s  %s\n", indent, n.Operator)
-		fmt.Printf("%s  [right]\n", indent)
-		PrintAST(n.Right, indent+"  ")
+		fmt.Fprintf(w, "%s  [left]\n", indent)
+		FprintAST(w, n.Left, indent+"  ")
+		fmt.Fprintf(w, "%s  [Operator]\n", indent)
+		fmt.Fprintf(w, "%s  %s\n", indent, n.Operator)
+		fmt.Fprintf(w, "%s  [right]\n", indent)
+		FprintAST(w, n.Right, indent+"  ")
 
 	case *IntegerLiteral:
-		fmt.Printf("%s  %d\n", indent, n.Value)
+		fmt.Fprintf(w, "%s  %d\n", indent, n.Value)
 
 	case *StringLiteral:
-		fmt.Printf("%s  %s\n", indent, n.Value)
+		fmt.Fprintf(w, "%s  %s\n", indent, n.Value)
+
+	case *TemplateLiteral:
+		for i, v := range n.Values {
+			fmt.Fprintf(w, "%s  %s\n", indent, n.Strings[i])
+			FprintAST(w, v, indent+"  ")
+		}
+		fmt.Fprintf(w, "%s  %s\n", indent, n.Strings[len(n.Values)])
 
 	case *CallExpression:
-		fmt.Printf("%s  [function]\n", indent)
-		PrintAST(n.Function, indent+"  ")
-		fmt.Printf("%s  [arguments]\n", indent)
+		fmt.Fprintf(w, "%s  [function]\n", indent)
+		FprintAST(w, n.Function, indent+"  ")
+		fmt.Fprintf(w, "%s  [arguments]\n", indent)
 		for _, a := range n.Arguments {
-			PrintAST(a, indent+"  ")
+			FprintAST(w, a, indent+"  ")
 		}
 
 	case *FunctionLiteral:
-		fmt.Printf("%s  [parameters]\n", indent)
+		fmt.Fprintf(w, "%s  [parameters]\n", indent)
 		if len(n.Parameters) == 0 {
-			fmt.Printf("%s  None\n", indent)
+			fmt.Fprintf(w, "%s  None\n", indent)
 		} else {
 			for _, p := range n.Parameters {
-				PrintAST(p, indent+"  ")
+				FprintAST(w, p, indent+"  ")
 			}
 		}
-		fmt.Printf("%s  [return type]\n", indent)
+		fmt.Fprintf(w, "%s  [return type]\n", indent)
 		if n.ReturnType != nil {
-			fmt.Printf("%s  %s\n", indent, n.ReturnType.String())
+			fmt.Fprintf(w, "%s  %s\n", indent, n.ReturnType.String())
 		} else {
-			fmt.Printf("%s  ?\n", indent)
+			fmt.Fprintf(w, "%s  ?\n", indent)
 		}
 
-		fmt.Printf("%s  [block]\n", indent)
+		fmt.Fprintf(w, "%s  [block]\n", indent)
 		for _, s := range n.Body.Statements {
-			PrintAST(s, indent+"  ")
+			FprintAST(w, s, indent+"  ")
 		}
 
 	case *Identifier:
@@ -119,67 +157,125 @@ func PrintAST(node Node, indent string) {
 		} else {
 			t = "?"
 		}
-		fmt.Printf("%s  %s: %s\n", indent, n.Name, t)
+		fmt.Fprintf(w, "%s  %s: %s\n", indent, n.Name, t)
 
 	case *TypeLiteral:
-		fmt.Printf("%s  %s\n", indent, n.Value)
+		fmt.Fprintf(w, "%s  %s\n", indent, n.Value)
 
 	case *HashLiteral:
 		n.Pairs.Range(func(k Expression, v Expression) bool {
-			fmt.Printf("%s  [key]\n", indent)
-			PrintAST(k, indent+"  ")
-			fmt.Printf("%s  [value]\n", indent)
-			PrintAST(v, indent+"  ")
+			fmt.Fprintf(w, "%s  [key]\n", indent)
+			FprintAST(w, k, indent+"  ")
+			fmt.Fprintf(w, "%s  [value]\n", indent)
+			FprintAST(w, v, indent+"  ")
 			return true
 		})
 
 	case *ReturnStatement:
 		if n.ReturnValue != nil {
-			PrintAST(n.ReturnValue, indent+"  ")
+			FprintAST(w, n.ReturnValue, indent+"  ")
 		} else {
-			fmt.Printf("%s  None\n", indent)
+			fmt.Fprintf(w, "%s  None\n", indent)
 		}
 	case *CommentStatement:
 		for _, c := range n.Comments {
-			fmt.Printf("%s  %s\n", indent, c)
+			fmt.Fprintf(w, "%s  %s\n", indent, c)
 		}
 	case *IndexExpression:
-		fmt.Printf("%s  [left]\n", indent)
-		PrintAST(n.Left, indent+"  ")
-		fmt.Printf("%s  [index]\n", indent)
-		PrintAST(n.Index, indent+"  ")
+		fmt.Fprintf(w, "%s  [left]\n", indent)
+		FprintAST(w, n.Left, indent+"  ")
+		fmt.Fprintf(w, "%s  [index]\n", indent)
+		FprintAST(w, n.Index, indent+"  ")
 	case *DotExpression:
-		fmt.Printf("%s  [left]\n", indent)
-		PrintAST(n.Left, indent+"  ")
-		fmt.Printf("%s  [right]\n", indent)
-		PrintAST(n.Right, indent+"  ")
+		fmt.Fprintf(w, "%s  [left]\n", indent)
+		FprintAST(w, n.Left, indent+"  ")
+		fmt.Fprintf(w, "%s  [right]\n", indent)
+		FprintAST(w, n.Right, indent+"  ")
+	case *MetaExpression:
+		fmt.Fprintf(w, "%s  [left]\n", indent)
+		FprintAST(w, n.Left, indent+"  ")
+		fmt.Fprintf(w, "%s  [meta]\n", indent)
+		fmt.Fprintf(w, "%s  @%s\n", indent, n.Name)
+	case *YieldExpression:
+		if n.Value != nil {
+			fmt.Fprintf(w, "%s  [value]\n", indent)
+			FprintAST(w, n.Value, indent+"  ")
+		}
+	case *MatchExpression:
+		fmt.Fprintf(w, "%s  [subject]\n", indent)
+		FprintAST(w, n.Subject, indent+"  ")
+		for _, arm := range n.Arms {
+			fmt.Fprintf(w, "%s  [arm] %s\n", indent, arm.Pattern.String())
+			if arm.Guard != nil {
+				fmt.Fprintf(w, "%s  [guard]\n", indent)
+				FprintAST(w, arm.Guard, indent+"  ")
+			}
+			FprintAST(w, arm.Body, indent+"  ")
+		}
+	case *SwitchStatement:
+		fmt.Fprintf(w, "%s  [subject]\n", indent)
+		FprintAST(w, n.Subject, indent+"  ")
+		for _, c := range n.Cases {
+			if c.IsDefault() {
+				fmt.Fprintf(w, "%s  [default]\n", indent)
+			} else {
+				fmt.Fprintf(w, "%s  [case]\n", indent)
+				for _, v := range c.Values {
+					FprintAST(w, v, indent+"  ")
+				}
+			}
+			FprintAST(w, c.Body, indent+"  ")
+			if c.Fallthrough {
+				fmt.Fprintf(w, "%s  fallthrough\n", indent)
+			}
+		}
+	case *TypeStatement:
+		fmt.Fprintf(w, "%s  %s = %s\n", indent, n.Ident.Name, n.Value.String())
 	case *AssignStatement:
-		fmt.Printf("%s  [left]\n", indent)
-		PrintAST(n.Left, indent+"  ")
-		fmt.Printf("%s  [right]\n", indent)
-		PrintAST(n.Right, indent+"  ")
+		fmt.Fprintf(w, "%s  [left]\n", indent)
+		FprintAST(w, n.Left, indent+"  ")
+		fmt.Fprintf(w, "%s  [right]\n", indent)
+		FprintAST(w, n.Right, indent+"  ")
 	case *FloatLiteral:
-		fmt.Printf("%s  %f\n", indent, n.Value)
+		fmt.Fprintf(w, "%s  %f\n", indent, n.Value)
 	case *ComplexLiteral:
-		fmt.Printf("%s  %f\n", indent, n.Value)
+		fmt.Fprintf(w, "%s  %f\n", indent, n.Value)
 	case *LoopStatement:
-		fmt.Printf("%s  [bind]\n", indent)
-		PrintAST(n.Bind, indent+"  ")
-		fmt.Printf("%s  [block]\n", indent)
-		PrintAST(n.Block, indent+"  ")
+		fmt.Fprintf(w, "%s  [bind]\n", indent)
+		FprintAST(w, n.Bind, indent+"  ")
+		fmt.Fprintf(w, "%s  [block]\n", indent)
+		FprintAST(w, n.Block, indent+"  ")
+	case *DeferStatement:
+		FprintAST(w, n.Call, indent+"  ")
+	case *SpawnExpression:
+		FprintAST(w, n.Call, indent+"  ")
+	case *SelectStatement:
+		for _, c := range n.Cases {
+			if c.IsDefault() {
+				fmt.Fprintf(w, "%s  [default]\n", indent)
+			} else {
+				fmt.Fprintf(w, "%s  [case] %s\n", indent, strings.TrimSuffix(c.String(), c.Body.String()))
+			}
+			FprintAST(w, c.Body, indent+"  ")
+		}
 	case *BlockStatement:
-		fmt.Printf("%s  %s\n", indent, n.String())
+		fmt.Fprintf(w, "%s  %s\n", indent, n.String())
 	case *IfExpression:
-		fmt.Printf("%s  [confition]\n", indent)
-		PrintAST(n.Condition, indent+"  ")
-		fmt.Printf("%s  [consequence]\n", indent)
-		PrintAST(n.Consequence, indent+"  ")
+		fmt.Fprintf(w, "%s  [confition]\n", indent)
+		FprintAST(w, n.Condition, indent+"  ")
+		fmt.Fprintf(w, "%s  [consequence]\n", indent)
+		FprintAST(w, n.Consequence, indent+"  ")
+		for _, elif := range n.Elifs {
+			fmt.Fprintf(w, "%s  [elif]\n", indent)
+			FprintAST(w, elif.Condition, indent+"  ")
+			FprintAST(w, elif.Consequence, indent+"  ")
+		}
 		if n.Alternative != nil {
-			fmt.Printf("%s  [alternative]\n", indent)
-			PrintAST(n.Alternative, indent+"  ")
+			fmt.Fprintf(w, "%s  [alternative]\n", indent)
+			FprintAST(w, n.Alternative, indent+"  ")
 		}
 
 	default:
-		fmt.Printf("%sUnknown node: %T\n", indent, n)
+		fmt.Fprintf(w, "%sUnknown node: %T\n", indent, n)
 	}
 }
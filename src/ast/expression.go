@@ -20,7 +20,7 @@ func (pe *PrefixExpression) String() string {
 	var out bytes.Buffer
 	out.WriteString("(")
 	out.WriteString(pe.Operator)
-	out.WriteString(pe.Right.String())
+	out.WriteString(nodeString(pe.Right))
 	out.WriteString(")")
 	if pe.Token.Type == token.PARSE {
 		out.WriteString(";\n")
@@ -42,36 +42,53 @@ func (ie *InfixExpression) String() string {
 	var out bytes.Buffer
 
 	out.WriteString("(")
-	out.WriteString(ie.Left.String())
+	out.WriteString(nodeString(ie.Left))
 	out.WriteString(" " + ie.Operator + " ")
-	out.WriteString(ie.Right.String())
+	out.WriteString(nodeString(ie.Right))
 	out.WriteString(")")
 
 	return out.String()
 }
 
 // if式
+// elif（else if）はネストせずにElifsに並べる
 type IfExpression struct {
 	Token       token.Token // The 'if' token
 	Condition   Expression
 	Consequence *BlockStatement
+	Elifs       []*ElifClause
 	Alternative *BlockStatement
 }
 
+// elif節
+type ElifClause struct {
+	Token       token.Token // The 'elif' or 'else' token
+	Condition   Expression
+	Consequence *BlockStatement
+}
+
 func (ie *IfExpression) expressionNode()      {}
 func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
 func (ie *IfExpression) String() string {
 	var out bytes.Buffer
 
 	out.WriteString("if (")
-	out.WriteString(ie.Condition.String())
+	out.WriteString(nodeString(ie.Condition))
 	out.WriteString("){")
-	out.WriteString(ie.Consequence.String())
+	out.WriteString(nodeString(ie.Consequence))
 	out.WriteString("}")
 
+	for _, elif := range ie.Elifs {
+		out.WriteString(" elif (")
+		out.WriteString(nodeString(elif.Condition))
+		out.WriteString("){")
+		out.WriteString(nodeString(elif.Consequence))
+		out.WriteString("}")
+	}
+
 	if ie.Alternative != nil {
 		out.WriteString(" else{")
-		out.WriteString(ie.Alternative.String())
+		out.WriteString(nodeString(ie.Alternative))
 		out.WriteString("}")
 	}
 	out.WriteString("\n")
@@ -92,9 +109,9 @@ func (ie *IndexExpression) String() string {
 	var out bytes.Buffer
 
 	out.WriteString("(")
-	out.WriteString(ie.Left.String())
+	out.WriteString(nodeString(ie.Left))
 	out.WriteString("[")
-	out.WriteString(ie.Index.String())
+	out.WriteString(nodeString(ie.Index))
 	out.WriteString("])")
 
 	return out.String()
@@ -110,7 +127,21 @@ type DotExpression struct {
 func (de *DotExpression) expressionNode()      {}
 func (de *DotExpression) TokenLiteral() string { return de.Token.Literal }
 func (de *DotExpression) String() string {
-	return fmt.Sprintf("%s.%s", de.Left.String(), de.Right.String())
+	return fmt.Sprintf("%s.%s", nodeString(de.Left), nodeString(de.Right))
+}
+
+// メタプロパティ（x.@name）
+// オブジェクトの中身ではなくオブジェクト自身の情報を取り出す
+type MetaExpression struct {
+	Token token.Token // The '@' token
+	Left  Expression  // person
+	Name  string      // name
+}
+
+func (me *MetaExpression) expressionNode()      {}
+func (me *MetaExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MetaExpression) String() string {
+	return fmt.Sprintf("%s.@%s", nodeString(me.Left), me.Name)
 }
 
 // 関数呼び出し
@@ -127,10 +158,10 @@ func (ce *CallExpression) String() string {
 
 	args := []string{}
 	for _, a := range ce.Arguments {
-		args = append(args, a.String())
+		args = append(args, nodeString(a))
 	}
 
-	out.WriteString(ce.Function.String())
+	out.WriteString(nodeString(ce.Function))
 	//out.WriteString(Type(ce))
 	out.WriteString("(")
 	out.WriteString(strings.Join(args, ", "))
@@ -138,3 +169,30 @@ func (ce *CallExpression) String() string {
 
 	return out.String()
 }
+
+// yield（ジェネレータの値を1つ渡す）
+type YieldExpression struct {
+	Token token.Token // 'yield' トークン
+	Value Expression  // 渡す値（なければnil）
+}
+
+func (ye *YieldExpression) expressionNode()      {}
+func (ye *YieldExpression) TokenLiteral() string { return ye.Token.Literal }
+func (ye *YieldExpression) String() string {
+	if ye.Value == nil {
+		return "yield"
+	}
+	return "yield " + nodeString(ye.Value)
+}
+
+// spawn（関数呼び出しを別のタスクで実行する）
+type SpawnExpression struct {
+	Token token.Token // 'spawn' トークン
+	Call  *CallExpression
+}
+
+func (se *SpawnExpression) expressionNode()      {}
+func (se *SpawnExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SpawnExpression) String() string {
+	return "spawn " + nodeString(se.Call)
+}
@@ -0,0 +1,328 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"monkey/lib"
+	"reflect"
+	"unicode"
+	"unicode/utf8"
+)
+
+/*
+ * 木のJSON表現
+ * ノードは {"node": "型名", フィールド...} のオブジェクトにする
+ * フィールド名はGoのフィールド名の先頭を小文字にしたもの（returnValue, elementType など）
+ * トークンは {"type", "literal", "row", "col"}、nilはnull
+ * ハッシュの組は [{"key", "value"}]、複素数は {"real", "imag"}
+ * case/elif/matchの腕などノードでない構造体は "node" を持たない
+ */
+
+// JSONにするノードの型（"node" の値から型を引く）
+var nodeTypes = map[string]reflect.Type{}
+
+func init() {
+	for _, n := range []Node{
+		&Program{},
+		&LetStatement{}, &ExpressionStatement{}, &ReturnStatement{}, &BlockStatement{},
+		&CommentStatement{}, &AssignStatement{}, &DeriveStatement{}, &LoopStatement{},
+		&BreakStatement{}, &ContinueStatement{}, &TypeStatement{}, &SwitchStatement{},
+		&DeferStatement{}, &SelectStatement{},
+		&Identifier{}, &BooleanLiteral{}, &IntegerLiteral{}, &FloatLiteral{}, &ComplexLiteral{},
+		&StringLiteral{}, &TemplateLiteral{}, &ArrayLiteral{}, &HashLiteral{}, &FunctionLiteral{}, &TypeLiteral{},
+		&PrefixExpression{}, &InfixExpression{}, &IfExpression{}, &IndexExpression{},
+		&DotExpression{}, &MetaExpression{}, &CallExpression{}, &YieldExpression{},
+		&SpawnExpression{}, &MatchExpression{},
+		&WildcardPattern{}, &LiteralPattern{}, &RangePattern{}, &TypePattern{},
+		&BindingPattern{}, &ArrayPattern{}, &HashPattern{}, &OrPattern{},
+		&TypeNode{},
+	} {
+		t := reflect.TypeOf(n).Elem()
+		nodeTypes[t.Name()] = t
+	}
+}
+
+var (
+	nodeType  = reflect.TypeOf((*Node)(nil)).Elem()
+	pairsType = reflect.TypeOf((*lib.OrderedMap[Expression, Expression])(nil))
+)
+
+// ノードをJSONにする
+func ToJSON(node Node) ([]byte, error) {
+	v, err := encodeValue(reflect.ValueOf(node))
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// ノードを字下げしたJSONにする
+func ToJSONIndent(node Node, indent string) ([]byte, error) {
+	data, err := ToJSON(node)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, data, "", indent); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func encodeValue(v reflect.Value) (interface{}, error) {
+	switch v.Kind() {
+	case reflect.Invalid:
+		return nil, nil
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return encodeValue(v.Elem())
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil, nil
+		}
+		if v.Type() == pairsType {
+			return encodePairs(v.Interface().(*lib.OrderedMap[Expression, Expression]))
+		}
+		return encodeValue(v.Elem())
+	case reflect.Struct:
+		out := map[string]interface{}{}
+		if _, ok := nodeTypes[v.Type().Name()]; ok && reflect.PtrTo(v.Type()).Implements(nodeType) {
+			out["node"] = v.Type().Name()
+		}
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Type().Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			field, err := encodeValue(v.Field(i))
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %w", v.Type().Name(), f.Name, err)
+			}
+			out[fieldName(f.Name)] = field
+		}
+		return out, nil
+	case reflect.Slice:
+		list := make([]interface{}, v.Len())
+		for i := range list {
+			el, err := encodeValue(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			list[i] = el
+		}
+		return list, nil
+	case reflect.Complex128:
+		c := v.Complex()
+		return map[string]float64{"real": real(c), "imag": imag(c)}, nil
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool, reflect.Int, reflect.Int64, reflect.Float64:
+		return v.Interface(), nil
+	}
+	return nil, fmt.Errorf("cannot encode %s", v.Type())
+}
+
+func encodePairs(pairs *lib.OrderedMap[Expression, Expression]) (interface{}, error) {
+	list := []interface{}{}
+	var err error
+	pairs.Range(func(k, v Expression) bool {
+		var key, value interface{}
+		if key, err = encodeValue(reflect.ValueOf(k)); err != nil {
+			return false
+		}
+		if value, err = encodeValue(reflect.ValueOf(v)); err != nil {
+			return false
+		}
+		list = append(list, map[string]interface{}{"key": key, "value": value})
+		return true
+	})
+	return list, err
+}
+
+// ReturnValue → returnValue
+func fieldName(name string) string {
+	r, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToLower(r)) + name[size:]
+}
+
+/*
+ * JSONからノードを作る
+ * ToJSONの逆で、作ったノードはそのまま評価や整形に使える
+ */
+func FromJSON(data []byte) (Node, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var raw interface{}
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, err
+	}
+	v, err := decodeValue(raw, nodeType)
+	if err != nil {
+		return nil, err
+	}
+	if v.IsNil() {
+		return nil, fmt.Errorf("no node")
+	}
+	return v.Interface().(Node), nil
+}
+
+// ProgramのJSONを読む
+func ProgramFromJSON(data []byte) (*Program, error) {
+	node, err := FromJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	program, ok := node.(*Program)
+	if !ok {
+		return nil, fmt.Errorf("expected Program, got %s", reflect.TypeOf(node).Elem().Name())
+	}
+	return program, nil
+}
+
+func decodeValue(raw interface{}, t reflect.Type) (reflect.Value, error) {
+	if raw == nil {
+		return reflect.Zero(t), nil
+	}
+	switch t.Kind() {
+	case reflect.Interface:
+		obj, ok := raw.(map[string]interface{})
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("expected node object, got %T", raw)
+		}
+		name, _ := obj["node"].(string)
+		nt, ok := nodeTypes[name]
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("unknown node: %q", name)
+		}
+		if !reflect.PtrTo(nt).Implements(t) {
+			return reflect.Value{}, fmt.Errorf("%s is not a %s", name, t.Name())
+		}
+		v, err := decodeValue(raw, reflect.PtrTo(nt))
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		out := reflect.New(t).Elem()
+		out.Set(v)
+		return out, nil
+	case reflect.Ptr:
+		if t == pairsType {
+			return decodePairs(raw)
+		}
+		v, err := decodeValue(raw, t.Elem())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		p := reflect.New(t.Elem())
+		p.Elem().Set(v)
+		return p, nil
+	case reflect.Struct:
+		obj, ok := raw.(map[string]interface{})
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("expected %s object, got %T", t.Name(), raw)
+		}
+		if name, ok := obj["node"].(string); ok && name != t.Name() {
+			return reflect.Value{}, fmt.Errorf("expected %s, got %s", t.Name(), name)
+		}
+		v := reflect.New(t).Elem()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			field, err := decodeValue(obj[fieldName(f.Name)], f.Type)
+			if err != nil {
+				return reflect.Value{}, fmt.Errorf("%s.%s: %w", t.Name(), f.Name, err)
+			}
+			v.Field(i).Set(field)
+		}
+		return v, nil
+	case reflect.Slice:
+		list, ok := raw.([]interface{})
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("expected array, got %T", raw)
+		}
+		v := reflect.MakeSlice(t, len(list), len(list))
+		for i, el := range list {
+			e, err := decodeValue(el, t.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			v.Index(i).Set(e)
+		}
+		return v, nil
+	case reflect.Complex128:
+		obj, ok := raw.(map[string]interface{})
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("expected complex object, got %T", raw)
+		}
+		re, err1 := decodeValue(obj["real"], reflect.TypeOf(float64(0)))
+		im, err2 := decodeValue(obj["imag"], reflect.TypeOf(float64(0)))
+		if err1 != nil || err2 != nil {
+			return reflect.Value{}, fmt.Errorf("invalid complex number")
+		}
+		return reflect.ValueOf(complex(re.Float(), im.Float())).Convert(t), nil
+	case reflect.String:
+		s, ok := raw.(string)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("expected string, got %T", raw)
+		}
+		return reflect.ValueOf(s).Convert(t), nil
+	case reflect.Bool:
+		b, ok := raw.(bool)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("expected bool, got %T", raw)
+		}
+		return reflect.ValueOf(b), nil
+	case reflect.Int, reflect.Int64:
+		n, ok := raw.(json.Number)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("expected integer, got %T", raw)
+		}
+		i, err := n.Int64()
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(i).Convert(t), nil
+	case reflect.Float64:
+		n, ok := raw.(json.Number)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("expected number, got %T", raw)
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(f), nil
+	}
+	return reflect.Value{}, fmt.Errorf("cannot decode %s", t)
+}
+
+func decodePairs(raw interface{}) (reflect.Value, error) {
+	list, ok := raw.([]interface{})
+	if !ok {
+		return reflect.Value{}, fmt.Errorf("expected array of pairs, got %T", raw)
+	}
+	exprType := reflect.TypeOf((*Expression)(nil)).Elem()
+	pairs := lib.New[Expression, Expression]()
+	for _, el := range list {
+		obj, ok := el.(map[string]interface{})
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("expected pair object, got %T", el)
+		}
+		k, err := decodeValue(obj["key"], exprType)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		v, err := decodeValue(obj["value"], exprType)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		key, _ := k.Interface().(Expression)
+		value, _ := v.Interface().(Expression)
+		pairs.Set(key, value)
+	}
+	return reflect.ValueOf(pairs), nil
+}
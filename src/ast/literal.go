@@ -67,6 +67,26 @@ func (sl *StringLiteral) String() string {
 	return "\"" + sl.Token.Literal + "\""
 }
 
+// 式を埋め込んだ文字列 "a${x}b"
+// Stringsは式の前後の文字列で、Valuesより1つ多い
+type TemplateLiteral struct {
+	Token   token.Token // 最初の文字列のトークン
+	Strings []string
+	Values  []Expression
+}
+
+func (tl *TemplateLiteral) expressionNode()      {}
+func (tl *TemplateLiteral) TokenLiteral() string { return tl.Token.Literal }
+func (tl *TemplateLiteral) String() string {
+	var out bytes.Buffer
+	out.WriteString("\"" + tl.Strings[0])
+	for i, v := range tl.Values {
+		out.WriteString("${" + v.String() + "}" + tl.Strings[i+1])
+	}
+	out.WriteString("\"")
+	return out.String()
+}
+
 // 配列
 type ArrayLiteral struct {
 	Token    token.Token // the '[' token
@@ -79,7 +99,7 @@ func (al *ArrayLiteral) String() string {
 	var out bytes.Buffer
 	elements := []string{}
 	for _, el := range al.Elements {
-		elements = append(elements, el.String())
+		elements = append(elements, nodeString(el))
 	}
 	out.WriteString("[")
 	out.WriteString(strings.Join(elements, ", "))
@@ -89,8 +109,9 @@ func (al *ArrayLiteral) String() string {
 
 // マップというかハッシュというかのリテラル
 type HashLiteral struct {
-	Token token.Token // the '{' token
-	Pairs *lib.OrderedMap[Expression, Expression]
+	Token    token.Token // the '{' token
+	Pairs    *lib.OrderedMap[Expression, Expression]
+	Comments []*CommentStatement // メンバの間のコメント（整形で残すのに使う）
 }
 
 func (hl *HashLiteral) expressionNode()      {}
@@ -99,7 +120,7 @@ func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 	pairs := []string{}
 	hl.Pairs.Range(func(e1, e2 Expression) bool {
-		pairs = append(pairs, e1.String()+":"+e2.String())
+		pairs = append(pairs, nodeString(e1)+":"+nodeString(e2))
 		return true
 	})
 
@@ -118,6 +139,7 @@ type FunctionLiteral struct {
 	Parameters []*Identifier
 	Body       *BlockStatement
 	ReturnType *TypeNode
+	Generator  bool // 本体にyieldがあればジェネレータ
 }
 
 func (fl *FunctionLiteral) expressionNode()      {}
@@ -136,7 +158,7 @@ func (fl *FunctionLiteral) String() string {
 		out.WriteString(fl.ReturnType.String())
 	}
 	out.WriteString(" => ")
-	out.WriteString(fl.Body.String())
+	out.WriteString(nodeString(fl.Body))
 	return out.String()
 }
 
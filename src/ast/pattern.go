@@ -0,0 +1,171 @@
+package ast
+
+import (
+	"bytes"
+	"monkey/token"
+	"strings"
+)
+
+// match式のパターン
+type Pattern interface {
+	Node
+	patternNode()
+}
+
+/*
+ * match式
+ * match (値) { パターン if 条件 => 式, ... }
+ */
+type MatchExpression struct {
+	Token   token.Token // 'match' トークン
+	Subject Expression
+	Arms    []*MatchArm
+}
+
+func (me *MatchExpression) expressionNode()      {}
+func (me *MatchExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MatchExpression) String() string {
+	var out bytes.Buffer
+	arms := []string{}
+	for _, a := range me.Arms {
+		arms = append(arms, a.String())
+	}
+	out.WriteString("match(")
+	out.WriteString(nodeString(me.Subject))
+	out.WriteString("){")
+	out.WriteString(strings.Join(arms, ", "))
+	out.WriteString("}")
+	return out.String()
+}
+
+// matchの腕
+type MatchArm struct {
+	Token   token.Token // パターンの先頭のトークン
+	Pattern Pattern
+	Guard   Expression // if 条件（なければnil）
+	Body    *BlockStatement
+}
+
+func (ma *MatchArm) String() string {
+	var out bytes.Buffer
+	out.WriteString(nodeString(ma.Pattern))
+	if ma.Guard != nil {
+		out.WriteString(" if ")
+		out.WriteString(nodeString(ma.Guard))
+	}
+	out.WriteString(" => ")
+	out.WriteString(nodeString(ma.Body))
+	return out.String()
+}
+
+// _ なんにでも一致する
+type WildcardPattern struct {
+	Token token.Token
+}
+
+func (wp *WildcardPattern) patternNode()         {}
+func (wp *WildcardPattern) TokenLiteral() string { return wp.Token.Literal }
+func (wp *WildcardPattern) String() string       { return "_" }
+
+// 1, "a", true など == で比べる値
+type LiteralPattern struct {
+	Token token.Token
+	Value Expression
+}
+
+func (lp *LiteralPattern) patternNode()         {}
+func (lp *LiteralPattern) TokenLiteral() string { return lp.Token.Literal }
+func (lp *LiteralPattern) String() string       { return lp.Value.String() }
+
+// 1..10 両端を含む範囲
+type RangePattern struct {
+	Token token.Token
+	Low   Expression
+	High  Expression
+}
+
+func (rp *RangePattern) patternNode()         {}
+func (rp *RangePattern) TokenLiteral() string { return rp.Token.Literal }
+func (rp *RangePattern) String() string {
+	return rp.Low.String() + ".." + rp.High.String()
+}
+
+// number や string[] など型で判定する
+type TypePattern struct {
+	Token token.Token
+	Type  *TypeNode
+}
+
+func (tp *TypePattern) patternNode()         {}
+func (tp *TypePattern) TokenLiteral() string { return tp.Token.Literal }
+func (tp *TypePattern) String() string       { return tp.Type.String() }
+
+// n や n:number など値を名前に束縛する
+// 名前が _ なら束縛しない
+type BindingPattern struct {
+	Token token.Token
+	Name  *Identifier
+	Type  *TypeNode // 型の指定（なければnil）
+}
+
+func (bp *BindingPattern) patternNode()         {}
+func (bp *BindingPattern) TokenLiteral() string { return bp.Token.Literal }
+func (bp *BindingPattern) String() string {
+	if bp.Type != nil {
+		return bp.Name.Name + ":" + bp.Type.String()
+	}
+	return bp.Name.Name
+}
+
+// [a, b, ...rest]
+type ArrayPattern struct {
+	Token    token.Token // '[' トークン
+	Elements []Pattern
+	Rest     *Identifier // ...の後ろの名前（なければnil）
+}
+
+func (ap *ArrayPattern) patternNode()         {}
+func (ap *ArrayPattern) TokenLiteral() string { return ap.Token.Literal }
+func (ap *ArrayPattern) String() string {
+	elements := []string{}
+	for _, el := range ap.Elements {
+		elements = append(elements, el.String())
+	}
+	if ap.Rest != nil {
+		elements = append(elements, "..."+ap.Rest.Name)
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// {name: n, age} キーがあって値がパターンに一致する
+type HashPattern struct {
+	Token  token.Token // '{' トークン
+	Keys   []string
+	Values []Pattern
+}
+
+func (hp *HashPattern) patternNode()         {}
+func (hp *HashPattern) TokenLiteral() string { return hp.Token.Literal }
+func (hp *HashPattern) String() string {
+	pairs := []string{}
+	for i, k := range hp.Keys {
+		pairs = append(pairs, k+": "+hp.Values[i].String())
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// 1 | 2 | 3 どれかに一致する
+type OrPattern struct {
+	Token        token.Token // '|' トークン
+	Alternatives []Pattern
+}
+
+func (op *OrPattern) patternNode()         {}
+func (op *OrPattern) TokenLiteral() string { return op.Token.Literal }
+func (op *OrPattern) String() string {
+	alts := []string{}
+	for _, a := range op.Alternatives {
+		alts = append(alts, a.String())
+	}
+	return strings.Join(alts, " | ")
+}
@@ -11,18 +11,23 @@ import (
 /*
  * 変数の宣言ステートメント
  * イミュータブルとミュータブルがある
+ * const/shareは関数に属する静的な宣言（Tokenで区別する）
  */
 //
 type LetStatement struct {
-	Token token.Token // the token.LET token
-	Ident *Identifier // 識別子の名前
-	Value Expression  // 式
+	Token  token.Token // the token.LET token
+	Ident  *Identifier // 識別子の名前
+	Value  Expression  // 式
+	Public bool        // pubがついていればmutでも外から見える
 }
 
 func (ls *LetStatement) statementNode()       {}
 func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
+	if ls.Public {
+		out.WriteString("pub ")
+	}
 	out.WriteString(ls.TokenLiteral())
 	out.WriteString(" ")
 	out.WriteString(ls.Ident.String())
@@ -50,7 +55,7 @@ func (es *ExpressionStatement) statementNode()       {}
 func (es *ExpressionStatement) TokenLiteral() string { return es.Token.Literal }
 func (es *ExpressionStatement) String() string {
 	if es.Expression != nil {
-		return es.Expression.String()
+		return nodeString(es.Expression)
 	}
 	return ""
 }
@@ -69,7 +74,7 @@ func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
 	if rs.ReturnValue != nil {
 		out.WriteString("return ")
-		out.WriteString(rs.ReturnValue.String())
+		out.WriteString(nodeString(rs.ReturnValue))
 		out.WriteString(";\n")
 	}
 	return out.String()
@@ -89,12 +94,27 @@ func (bs *BlockStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString("{")
 	for _, s := range bs.Statements {
-		out.WriteString(s.String() + ";") // +1しない
+		out.WriteString(nodeString(s) + ";") // +1しない
 	}
 	out.WriteString("}")
 	return out.String()
 }
 
+// return this があるか（thisを返す関数はコンストラクタ）
+func (bs *BlockStatement) ReturnsThis() bool {
+	if bs == nil {
+		return false
+	}
+	for _, s := range bs.Statements {
+		if r, ok := s.(*ReturnStatement); ok {
+			if ident, ok := r.ReturnValue.(*Identifier); ok && ident != nil && ident.Name == "this" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 /*
  * コメントステートメント
  * リテラルに生コメントが入っている
@@ -131,7 +151,13 @@ func NewCommentStatement(t token.Token) *CommentStatement {
 	comments := []string{}
 	if prefix > 0 {
 		for _, line := range lines {
-			comments = append(comments, line[prefix:])
+			// " *" だけの行のように接頭辞より短い行は空行にする
+			if len(line) < prefix {
+				line = ""
+			} else {
+				line = line[prefix:]
+			}
+			comments = append(comments, line)
 		}
 	} else {
 		comments = lines
@@ -173,7 +199,7 @@ type AssignStatement struct {
 func (as *AssignStatement) statementNode()       {}
 func (as *AssignStatement) TokenLiteral() string { return as.Token.Literal }
 func (as *AssignStatement) String() string {
-	return fmt.Sprintf("%s = %s;", as.Left.String(), as.Right.String())
+	return fmt.Sprintf("%s = %s;", nodeString(as.Left), nodeString(as.Right))
 }
 
 type DeriveStatement struct {
@@ -184,7 +210,7 @@ type DeriveStatement struct {
 func (es *DeriveStatement) statementNode()       {}
 func (es *DeriveStatement) TokenLiteral() string { return es.Token.Literal }
 func (es *DeriveStatement) String() string {
-	return "..." + es.Right.String()
+	return "..." + nodeString(es.Right)
 }
 
 /*
@@ -192,40 +218,202 @@ func (es *DeriveStatement) String() string {
  */
 type LoopStatement struct {
 	Token token.Token     // 'for' トークン
+	Label *Identifier     // ラベル（なければnil）
 	Bind  *LetStatement   // forの括弧の中
 	Block *BlockStatement // ループする処理
 }
 
+// ループはbreakの値を返す式としても使える
 func (ls *LoopStatement) statementNode()       {}
+func (ls *LoopStatement) expressionNode()      {}
 func (ls *LoopStatement) TokenLiteral() string { return ls.Token.Literal }
 func (fs *LoopStatement) String() string {
 	var out bytes.Buffer
 
+	if fs.Label != nil {
+		out.WriteString(fs.Label.Name + ": ")
+	}
 	out.WriteString("loop(")
-	out.WriteString(fs.Bind.String())
+	out.WriteString(nodeString(fs.Bind))
 	out.WriteString(") ")
-	out.WriteString(fs.Block.String())
+	out.WriteString(nodeString(fs.Block))
 	return out.String()
 }
 
 /*
  * Break
+ * break ラベル 値
  */
 type BreakStatement struct {
 	Token token.Token
+	Label *Identifier // 抜けるループのラベル（なければnil）
+	Value Expression  // ループの値（なければnil）
 }
 
 func (bs *BreakStatement) statementNode()       {}
 func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
-func (bs *BreakStatement) String() string       { return "break" }
+func (bs *BreakStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("break")
+	if bs.Label != nil {
+		out.WriteString(" " + bs.Label.Name)
+	}
+	if bs.Value != nil {
+		out.WriteString(" " + nodeString(bs.Value))
+	}
+	return out.String()
+}
 
 /*
  * Continue
+ * continue ラベル
  */
 type ContinueStatement struct {
 	Token token.Token
+	Label *Identifier // 次に進むループのラベル（なければnil）
 }
 
 func (cs *ContinueStatement) statementNode()       {}
 func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
-func (cs *ContinueStatement) String() string       { return "continue" }
+func (cs *ContinueStatement) String() string {
+	if cs.Label != nil {
+		return "continue " + cs.Label.Name
+	}
+	return "continue"
+}
+
+/*
+ * 型の宣言
+ * type Sounds = { sound:(count:number)=>string }
+ */
+type TypeStatement struct {
+	Token token.Token // 'type' トークン
+	Ident *Identifier // 型の名前
+	Value *TypeNode   // 型
+}
+
+func (ts *TypeStatement) statementNode()       {}
+func (ts *TypeStatement) TokenLiteral() string { return ts.Token.Literal }
+func (ts *TypeStatement) String() string {
+	return fmt.Sprintf("type %s = %s;\n", ts.Ident.Name, ts.Value.String())
+}
+
+/*
+ * switch文
+ * 一致したcaseを実行してbreakかcaseの終わりで抜ける
+ */
+type SwitchStatement struct {
+	Token   token.Token // 'switch' トークン
+	Subject Expression
+	Cases   []*CaseClause
+}
+
+func (ss *SwitchStatement) statementNode()       {}
+func (ss *SwitchStatement) TokenLiteral() string { return ss.Token.Literal }
+func (ss *SwitchStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("switch(")
+	out.WriteString(nodeString(ss.Subject))
+	out.WriteString("){")
+	for _, c := range ss.Cases {
+		out.WriteString(c.String())
+	}
+	out.WriteString("}")
+	return out.String()
+}
+
+/*
+ * case節
+ * Valuesがなければdefault
+ */
+type CaseClause struct {
+	Token       token.Token // 'case' or 'default' トークン
+	Values      []Expression
+	Body        *BlockStatement
+	Fallthrough bool // 最後にfallthroughがあれば次のcaseも実行する
+}
+
+func (cc *CaseClause) IsDefault() bool { return cc.Token.Type == token.DEFAULT }
+func (cc *CaseClause) String() string {
+	var out bytes.Buffer
+	if cc.IsDefault() {
+		out.WriteString("default:")
+	} else {
+		values := []string{}
+		for _, v := range cc.Values {
+			values = append(values, nodeString(v))
+		}
+		out.WriteString("case " + strings.Join(values, ", ") + ":")
+	}
+	out.WriteString(nodeString(cc.Body))
+	if cc.Fallthrough {
+		out.WriteString("fallthrough;")
+	}
+	return out.String()
+}
+
+/*
+ * defer
+ * 関数の呼び出しが終わるときに実行する
+ */
+type DeferStatement struct {
+	Token token.Token // 'defer' トークン
+	Call  Expression  // 実行する式（ふつうは関数呼び出し）
+}
+
+func (ds *DeferStatement) statementNode()       {}
+func (ds *DeferStatement) TokenLiteral() string { return ds.Token.Literal }
+func (ds *DeferStatement) String() string {
+	return "defer " + nodeString(ds.Call)
+}
+
+/*
+ * select
+ * select { case v = ch.recv(): 文... case ch.send(x): 文... default: 文... }
+ */
+type SelectStatement struct {
+	Token token.Token // 'select' トークン
+	Cases []*SelectCase
+}
+
+func (ss *SelectStatement) statementNode()       {}
+func (ss *SelectStatement) TokenLiteral() string { return ss.Token.Literal }
+func (ss *SelectStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString("select{")
+	for _, c := range ss.Cases {
+		out.WriteString(c.String())
+	}
+	out.WriteString("}")
+	return out.String()
+}
+
+/*
+ * selectのcase節
+ * Channelがなければdefault
+ */
+type SelectCase struct {
+	Token   token.Token // 'case' or 'default' トークン
+	Binding *Identifier // 受け取った値を束縛する名前（なければnil）
+	Channel Expression  // チャンネル
+	Send    bool        // 送信ならtrue
+	Value   Expression  // 送信する値
+	Body    *BlockStatement
+}
+
+func (sc *SelectCase) IsDefault() bool { return sc.Token.Type == token.DEFAULT }
+func (sc *SelectCase) String() string {
+	var out bytes.Buffer
+	switch {
+	case sc.IsDefault():
+		out.WriteString("default:")
+	case sc.Send:
+		out.WriteString("case " + nodeString(sc.Channel) + ".send(" + nodeString(sc.Value) + "):")
+	case sc.Binding != nil:
+		out.WriteString("case " + sc.Binding.Name + " = " + nodeString(sc.Channel) + ".recv():")
+	default:
+		out.WriteString("case " + nodeString(sc.Channel) + ".recv():")
+	}
+	out.WriteString(nodeString(sc.Body))
+	return out.String()
+}
@@ -0,0 +1,173 @@
+package ast
+
+import "reflect"
+
+/*
+ * 木を深さ優先でたどる
+ * fがfalseを返したらそのノードの子はたどらない
+ * case/match/select/elifの節はノードではないので、その中身を直接たどる
+ */
+func Inspect(node Node, f func(Node) bool) {
+	// 構文エラーで欠けた木には型つきのnilが混ざることがある
+	if node == nil || reflect.ValueOf(node).IsNil() {
+		return
+	}
+	if !f(node) {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		for _, s := range n.Statements {
+			Inspect(s, f)
+		}
+	case *LetStatement:
+		inspectIdent(n.Ident, f)
+		inspect(n.Value, f)
+	case *ExpressionStatement:
+		inspect(n.Expression, f)
+	case *ReturnStatement:
+		inspect(n.ReturnValue, f)
+	case *BlockStatement:
+		for _, s := range n.Statements {
+			Inspect(s, f)
+		}
+	case *AssignStatement:
+		inspect(n.Left, f)
+		inspect(n.Right, f)
+	case *DeriveStatement:
+		inspect(n.Right, f)
+	case *LoopStatement:
+		if n.Bind != nil {
+			Inspect(n.Bind, f)
+		}
+		inspectBlock(n.Block, f)
+	case *BreakStatement:
+		inspect(n.Value, f)
+	case *TypeStatement:
+		inspectIdent(n.Ident, f)
+	case *SwitchStatement:
+		inspect(n.Subject, f)
+		for _, c := range n.Cases {
+			for _, v := range c.Values {
+				inspect(v, f)
+			}
+			inspectBlock(c.Body, f)
+		}
+	case *DeferStatement:
+		inspect(n.Call, f)
+	case *SelectStatement:
+		for _, c := range n.Cases {
+			inspectIdent(c.Binding, f)
+			inspect(c.Channel, f)
+			inspect(c.Value, f)
+			inspectBlock(c.Body, f)
+		}
+	case *ArrayLiteral:
+		for _, e := range n.Elements {
+			inspect(e, f)
+		}
+	case *HashLiteral:
+		if n.Pairs != nil {
+			n.Pairs.Range(func(k, v Expression) bool {
+				inspect(k, f)
+				inspect(v, f)
+				return true
+			})
+		}
+	case *FunctionLiteral:
+		for _, p := range n.Parameters {
+			inspectIdent(p, f)
+		}
+		inspectBlock(n.Body, f)
+	case *PrefixExpression:
+		inspect(n.Right, f)
+	case *InfixExpression:
+		inspect(n.Left, f)
+		inspect(n.Right, f)
+	case *TemplateLiteral:
+		for _, v := range n.Values {
+			inspect(v, f)
+		}
+	case *CallExpression:
+		inspect(n.Function, f)
+		for _, a := range n.Arguments {
+			inspect(a, f)
+		}
+	case *IndexExpression:
+		inspect(n.Left, f)
+		inspect(n.Index, f)
+	case *DotExpression:
+		inspect(n.Left, f)
+		inspectIdent(n.Right, f)
+	case *MetaExpression:
+		inspect(n.Left, f)
+	case *IfExpression:
+		inspect(n.Condition, f)
+		inspectBlock(n.Consequence, f)
+		for _, elif := range n.Elifs {
+			inspect(elif.Condition, f)
+			inspectBlock(elif.Consequence, f)
+		}
+		inspectBlock(n.Alternative, f)
+	case *MatchExpression:
+		inspect(n.Subject, f)
+		for _, arm := range n.Arms {
+			if arm.Pattern != nil {
+				Inspect(arm.Pattern, f)
+			}
+			inspect(arm.Guard, f)
+			inspectBlock(arm.Body, f)
+		}
+	case *YieldExpression:
+		inspect(n.Value, f)
+	case *SpawnExpression:
+		if n.Call != nil {
+			Inspect(n.Call, f)
+		}
+	case *LiteralPattern:
+		inspect(n.Value, f)
+	case *RangePattern:
+		inspect(n.Low, f)
+		inspect(n.High, f)
+	case *BindingPattern:
+		inspectIdent(n.Name, f)
+	case *ArrayPattern:
+		for _, e := range n.Elements {
+			if e != nil {
+				Inspect(e, f)
+			}
+		}
+		inspectIdent(n.Rest, f)
+	case *HashPattern:
+		for _, v := range n.Values {
+			if v != nil {
+				Inspect(v, f)
+			}
+		}
+	case *OrPattern:
+		for _, a := range n.Alternatives {
+			if a != nil {
+				Inspect(a, f)
+			}
+		}
+	}
+}
+
+func inspect(e Expression, f func(Node) bool) {
+	if e != nil {
+		Inspect(e, f)
+	}
+}
+
+func inspectIdent(ident *Identifier, f func(Node) bool) {
+	if ident != nil {
+		Inspect(ident, f)
+	}
+}
+
+func inspectBlock(b *BlockStatement, f func(Node) bool) {
+	if b != nil {
+		Inspect(b, f)
+	}
+}
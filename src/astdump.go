@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"monkey/ast"
+	"monkey/format"
+	"monkey/parser"
+	"os"
+)
+
+/*
+ * ast サブコマンド
+ * ファイルの構文木を標準出力に出す（ファイルがなければ標準入力）
+ * -json はJSONで、-tokens は構文木ではなくトークンの列を出す
+ * -decode は逆にJSONの構文木を読んで整形したソースを出す
+ */
+func runAST(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("ast", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	asJSON := flags.Bool("json", false, "print the tree as JSON")
+	tokens := flags.Bool("tokens", false, "print the tokens as JSON instead of the tree")
+	decode := flags.Bool("decode", false, "read a JSON tree and print it as formatted source")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 1 {
+		fmt.Fprintln(stderr, "ast: too many input files")
+		return 2
+	}
+
+	var src []byte
+	var err error
+	name := "<standard input>"
+	if flags.NArg() == 0 {
+		src, err = io.ReadAll(os.Stdin)
+	} else {
+		name = flags.Arg(0)
+		src, err = os.ReadFile(name)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "ast: %s\n", err)
+		return 1
+	}
+
+	if *decode {
+		program, err := ast.ProgramFromJSON(src)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %s\n", name, err)
+			return 1
+		}
+		fmt.Fprint(stdout, format.Program(program))
+		return 0
+	}
+
+	p := parser.NewParser(string(src))
+	program, ok := p.ParseProgram()
+	if *tokens {
+		out, _ := json.MarshalIndent(p.Tokens(), "", "  ")
+		fmt.Fprintln(stdout, string(out))
+		return 0
+	}
+	if !ok {
+		fmt.Fprintln(stderr, parser.FormatErrors(name, p.ErrorDetails()))
+		return 1
+	}
+	if !*asJSON {
+		ast.FprintAST(stdout, program, "")
+		return 0
+	}
+	out, err := ast.ToJSONIndent(program, "  ")
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %s\n", name, err)
+		return 1
+	}
+	fmt.Fprintln(stdout, string(out))
+	return 0
+}
@@ -0,0 +1,244 @@
+package cover
+
+import (
+	"errors"
+	"fmt"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/parser"
+	"sort"
+	"strings"
+)
+
+// 実行した回数つきの文
+type Statement struct {
+	Row   int
+	Col   int
+	Count int
+}
+
+/*
+ * 分岐のブロック
+ * 同じif/loop/switch/match/selectのブロックは同じGroupになる
+ */
+type Branch struct {
+	Row   int    // ブロックの { の行
+	Col   int    // ブロックの { の列
+	Kind  string // if/elif/else/loop/case/default/arm
+	Group int    // 分岐の番号（ファイルの中で出てきた順）
+	Line  int    // 分岐の構文の行
+	Count int
+}
+
+// 関数（本体を実行した回数が呼び出しの回数）
+type Function struct {
+	Name  string
+	Row   int
+	Count int
+}
+
+/*
+ * ファイルのカバレッジ
+ * 構文木の文と分岐に、評価器が記録した回数を合わせたもの
+ */
+type Profile struct {
+	File       string
+	Lines      []string // ソースの行
+	Statements []Statement
+	Branches   []Branch
+	Functions  []Function
+}
+
+/*
+ * ソースとカバレッジの記録からファイルのカバレッジを作る
+ * 記録は同じソースを評価したものでなければならない
+ */
+func Build(file string, src string, c *evaluator.Coverage) (*Profile, error) {
+	p := parser.NewParser(src)
+	program, ok := p.ParseProgram()
+	if !ok {
+		return nil, errors.New(parser.FormatErrors(file, p.ErrorDetails()))
+	}
+	if c == nil {
+		c = evaluator.NewCoverage()
+	}
+
+	profile := &Profile{File: file, Lines: strings.Split(src, "\n")}
+	names := functionNames(program)
+	binds := map[*ast.LetStatement]bool{}
+	seen := map[evaluator.Position]bool{}
+	group := 0
+
+	branch := func(kind string, line int, block *ast.BlockStatement) {
+		if block == nil {
+			return
+		}
+		pos := evaluator.Position{Row: block.Token.Row, Col: block.Token.Col}
+		profile.Branches = append(profile.Branches, Branch{
+			Row: pos.Row, Col: pos.Col, Kind: kind, Group: group, Line: line, Count: c.Blocks[pos],
+		})
+	}
+
+	ast.Inspect(program, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.IfExpression:
+			branch("if", n.Token.Row, n.Consequence)
+			for _, elif := range n.Elifs {
+				branch("elif", n.Token.Row, elif.Consequence)
+			}
+			branch("else", n.Token.Row, n.Alternative)
+			group++
+		case *ast.LoopStatement:
+			// ループの変数の宣言は文として評価しない
+			binds[n.Bind] = true
+			branch("loop", n.Token.Row, n.Block)
+			group++
+		case *ast.SwitchStatement:
+			for _, cc := range n.Cases {
+				kind := "case"
+				if cc.IsDefault() {
+					kind = "default"
+				}
+				branch(kind, n.Token.Row, cc.Body)
+			}
+			group++
+		case *ast.MatchExpression:
+			for _, arm := range n.Arms {
+				branch("arm", n.Token.Row, arm.Body)
+			}
+			group++
+		case *ast.SelectStatement:
+			for _, sc := range n.Cases {
+				kind := "case"
+				if sc.IsDefault() {
+					kind = "default"
+				}
+				branch(kind, n.Token.Row, sc.Body)
+			}
+			group++
+		case *ast.FunctionLiteral:
+			if n.Body != nil {
+				pos := evaluator.Position{Row: n.Body.Token.Row, Col: n.Body.Token.Col}
+				name := names[n]
+				if name == "" {
+					name = fmt.Sprintf("$unnamed:%d:%d", n.Token.Row, n.Token.Col)
+				}
+				profile.Functions = append(profile.Functions, Function{Name: name, Row: n.Token.Row, Count: c.Blocks[pos]})
+			}
+		}
+
+		switch n := n.(type) {
+		case *ast.BlockStatement, *ast.CommentStatement:
+		case ast.Statement:
+			if let, ok := n.(*ast.LetStatement); ok && binds[let] {
+				break
+			}
+			t := ast.NodeToken(n)
+			pos := evaluator.Position{Row: t.Row, Col: t.Col}
+			if !seen[pos] {
+				seen[pos] = true
+				profile.Statements = append(profile.Statements, Statement{Row: t.Row, Col: t.Col, Count: c.Statements[pos]})
+			}
+		}
+		return true
+	})
+
+	sort.SliceStable(profile.Statements, func(i, j int) bool {
+		a, b := profile.Statements[i], profile.Statements[j]
+		return a.Row < b.Row || a.Row == b.Row && a.Col < b.Col
+	})
+	return profile, nil
+}
+
+// 名前に束縛した関数リテラルの名前
+func functionNames(program *ast.Program) map[*ast.FunctionLiteral]string {
+	names := map[*ast.FunctionLiteral]string{}
+	ast.Inspect(program, func(n ast.Node) bool {
+		if let, ok := n.(*ast.LetStatement); ok && let.Ident != nil {
+			if fn, ok := let.Value.(*ast.FunctionLiteral); ok {
+				names[fn] = let.Ident.Name
+			}
+		}
+		return true
+	})
+	return names
+}
+
+// 実行した数と全体の数
+type Counts struct {
+	Statements, StatementsHit int
+	Branches, BranchesHit     int
+	Functions, FunctionsHit   int
+}
+
+func (p *Profile) Counts() Counts {
+	var c Counts
+	for _, s := range p.Statements {
+		c.Statements++
+		if s.Count > 0 {
+			c.StatementsHit++
+		}
+	}
+	for _, b := range p.Branches {
+		c.Branches++
+		if b.Count > 0 {
+			c.BranchesHit++
+		}
+	}
+	for _, f := range p.Functions {
+		c.Functions++
+		if f.Count > 0 {
+			c.FunctionsHit++
+		}
+	}
+	return c
+}
+
+func (c *Counts) add(o Counts) {
+	c.Statements += o.Statements
+	c.StatementsHit += o.StatementsHit
+	c.Branches += o.Branches
+	c.BranchesHit += o.BranchesHit
+	c.Functions += o.Functions
+	c.FunctionsHit += o.FunctionsHit
+}
+
+// 行の状態
+type LineStatus int
+
+const (
+	LineNone    LineStatus = iota // 文がない
+	LineCovered                   // 行の文をすべて実行した
+	LinePartial                   // 一部だけ実行した
+	LineMissed                    // 1つも実行していない
+)
+
+/*
+ * 行ごとの回数と状態
+ * 回数はその行で始まる文の回数の最大
+ */
+func (p *Profile) LineCounts() (map[int]int, map[int]LineStatus) {
+	counts := map[int]int{}
+	status := map[int]LineStatus{}
+	for _, s := range p.Statements {
+		if c, ok := counts[s.Row]; !ok || s.Count > c {
+			counts[s.Row] = s.Count
+		}
+		switch st := status[s.Row]; {
+		case st == LineNone && s.Count > 0:
+			status[s.Row] = LineCovered
+		case st == LineNone:
+			status[s.Row] = LineMissed
+		case st == LineCovered && s.Count == 0, st == LineMissed && s.Count > 0:
+			status[s.Row] = LinePartial
+		}
+	}
+	return counts, status
+}
+
+func percent(hit int, total int) float64 {
+	if total == 0 {
+		return 100
+	}
+	return float64(hit) * 100 / float64(total)
+}
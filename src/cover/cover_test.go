@@ -0,0 +1,109 @@
+package cover
+
+import (
+	"context"
+	"fmt"
+	"monkey/evaluator"
+	"monkey/object"
+	"monkey/parser"
+	"strings"
+	"testing"
+)
+
+var source = `imm classify = (n:number)=>{
+  if (n < 0) {
+    return "neg"
+  } elif (n == 0) {
+    return "zero"
+  }
+  mut total = 0
+  loop(imm i=[1, 2]){ total = total + i.v }
+  "pos"
+}
+imm unused = ()=>{ 1 }
+classify(1)
+classify(0)
+`
+
+// ソースを評価してカバレッジを作る
+func profile(t *testing.T, src string) *Profile {
+	t.Helper()
+	program, ok := parser.NewParser(src).ParseProgram()
+	if !ok {
+		t.Fatal("parse error")
+	}
+	coverage := evaluator.NewCoverage()
+	exec := evaluator.NewExecution(context.Background(), evaluator.Options{Observer: coverage})
+	exec.Eval(program, object.NewEnvironment())
+	exec.Close()
+	p, err := Build("c.kk", src, coverage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestBuild(t *testing.T) {
+	p := profile(t, source)
+	c := p.Counts()
+	want := Counts{Statements: 12, StatementsHit: 10, Branches: 3, BranchesHit: 2, Functions: 2, FunctionsHit: 1}
+	if c != want {
+		t.Errorf("got %+v, want %+v", c, want)
+	}
+
+	branches := []string{}
+	for _, b := range p.Branches {
+		branches = append(branches, fmt.Sprintf("%s:%d", b.Kind, b.Count))
+	}
+	if got := strings.Join(branches, " "); got != "if:0 elif:1 loop:2" {
+		t.Errorf("branches: %s", got)
+	}
+
+	counts, status := p.LineCounts()
+	tests := []struct {
+		row    int
+		count  int
+		status LineStatus
+	}{
+		{2, 2, LineCovered},
+		{3, 0, LineMissed},
+		{4, 0, LineNone},
+		{8, 2, LineCovered},
+		{11, 1, LinePartial},
+	}
+	for _, tt := range tests {
+		if counts[tt.row] != tt.count || status[tt.row] != tt.status {
+			t.Errorf("line %d: got %d/%d, want %d/%d", tt.row, counts[tt.row], status[tt.row], tt.count, tt.status)
+		}
+	}
+}
+
+func TestReports(t *testing.T) {
+	p := profile(t, source)
+	text := Text([]*Profile{p})
+	if !strings.Contains(text, "c.kk\tstatements  83.3% (10/12)\tbranches  66.7% (2/3)\tfunctions  50.0% (1/2)") {
+		t.Errorf("unexpected summary:\n%s", text)
+	}
+
+	lcov := LCOV([]*Profile{p})
+	for _, line := range []string{
+		"SF:c.kk", "FN:1,classify", "FNDA:2,classify", "FNDA:0,unused", "FNF:2", "FNH:1",
+		"BRDA:2,0,0,0", "BRDA:2,0,1,1", "BRDA:8,1,0,2", "BRF:3", "BRH:2",
+		"DA:3,0", "DA:8,2", "end_of_record",
+	} {
+		if !strings.Contains(lcov, line+"\n") {
+			t.Errorf("LCOV has no %q:\n%s", line, lcov)
+		}
+	}
+
+	page := HTML([]*Profile{p})
+	for _, want := range []string{
+		`<tr class="missed"><td class="row">3</td><td class="count">0</td><td>    return &#34;neg&#34;</td></tr>`,
+		`<tr class="partial"><td class="row">11</td>`,
+		`<tr><td class="row">4</td><td class="count"></td>`,
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("HTML has no %q", want)
+		}
+	}
+}
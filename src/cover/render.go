@@ -0,0 +1,128 @@
+package cover
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"sort"
+)
+
+/*
+ * テキストの要約
+ * ファイルごとに文・分岐・関数の割合を出し、最後に合計を出す
+ */
+func Text(profiles []*Profile) string {
+	var out bytes.Buffer
+	var total Counts
+	for _, p := range profiles {
+		c := p.Counts()
+		total.add(c)
+		fmt.Fprintf(&out, "%s\t%s\n", p.File, summary(c))
+	}
+	fmt.Fprintf(&out, "total\t%s\n", summary(total))
+	return out.String()
+}
+
+func summary(c Counts) string {
+	return fmt.Sprintf("statements %5.1f%% (%d/%d)\tbranches %5.1f%% (%d/%d)\tfunctions %5.1f%% (%d/%d)",
+		percent(c.StatementsHit, c.Statements), c.StatementsHit, c.Statements,
+		percent(c.BranchesHit, c.Branches), c.BranchesHit, c.Branches,
+		percent(c.FunctionsHit, c.Functions), c.FunctionsHit, c.Functions)
+}
+
+/*
+ * LCOVのトレースファイル
+ * 分岐はBRDA:行,分岐の番号,ブロックの番号,回数 にする
+ */
+func LCOV(profiles []*Profile) string {
+	var out bytes.Buffer
+	for _, p := range profiles {
+		c := p.Counts()
+		out.WriteString("TN:\n")
+		fmt.Fprintf(&out, "SF:%s\n", p.File)
+		for _, f := range p.Functions {
+			fmt.Fprintf(&out, "FN:%d,%s\n", f.Row, f.Name)
+		}
+		for _, f := range p.Functions {
+			fmt.Fprintf(&out, "FNDA:%d,%s\n", f.Count, f.Name)
+		}
+		fmt.Fprintf(&out, "FNF:%d\nFNH:%d\n", c.Functions, c.FunctionsHit)
+
+		index := map[int]int{} // 分岐の中のブロックの番号
+		for _, b := range p.Branches {
+			fmt.Fprintf(&out, "BRDA:%d,%d,%d,%d\n", b.Line, b.Group, index[b.Group], b.Count)
+			index[b.Group]++
+		}
+		fmt.Fprintf(&out, "BRF:%d\nBRH:%d\n", c.Branches, c.BranchesHit)
+
+		counts, _ := p.LineCounts()
+		rows := []int{}
+		for row := range counts {
+			rows = append(rows, row)
+		}
+		sort.Ints(rows)
+		hit := 0
+		for _, row := range rows {
+			fmt.Fprintf(&out, "DA:%d,%d\n", row, counts[row])
+			if counts[row] > 0 {
+				hit++
+			}
+		}
+		fmt.Fprintf(&out, "LF:%d\nLH:%d\n", len(rows), hit)
+		out.WriteString("end_of_record\n")
+	}
+	return out.String()
+}
+
+/*
+ * 注釈つきのHTML
+ * ファイルごとにソースを行番号と回数つきで出し、
+ * 実行した行、一部だけ実行した行、実行していない行を色分けする
+ */
+func HTML(profiles []*Profile) string {
+	var out bytes.Buffer
+	out.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>Coverage</title>\n")
+	out.WriteString("<style>\n" +
+		"table.source { border-collapse: collapse; font-family: monospace; }\n" +
+		"table.source td { padding: 0 8px; white-space: pre; }\n" +
+		"td.row, td.count { text-align: right; color: #888; }\n" +
+		"tr.covered { background: #dfd; }\n" +
+		"tr.partial { background: #ffd; }\n" +
+		"tr.missed { background: #fdd; }\n" +
+		"</style>\n</head>\n<body>\n<h1>Coverage</h1>\n")
+
+	out.WriteString("<table>\n<tr><th>File</th><th>Statements</th><th>Branches</th><th>Functions</th></tr>\n")
+	for i, p := range profiles {
+		c := p.Counts()
+		fmt.Fprintf(&out, "<tr><td><a href=\"#file%d\">%s</a></td><td>%.1f%%</td><td>%.1f%%</td><td>%.1f%%</td></tr>\n",
+			i, html.EscapeString(p.File),
+			percent(c.StatementsHit, c.Statements), percent(c.BranchesHit, c.Branches), percent(c.FunctionsHit, c.Functions))
+	}
+	out.WriteString("</table>\n")
+
+	for i, p := range profiles {
+		fmt.Fprintf(&out, "<h2 id=\"file%d\">%s</h2>\n", i, html.EscapeString(p.File))
+		out.WriteString("<table class=\"source\">\n")
+		counts, status := p.LineCounts()
+		for n, line := range p.Lines {
+			row := n + 1
+			class, count := "", ""
+			switch status[row] {
+			case LineCovered:
+				class = " class=\"covered\""
+			case LinePartial:
+				class = " class=\"partial\""
+			case LineMissed:
+				class = " class=\"missed\""
+			}
+			if status[row] != LineNone {
+				count = fmt.Sprint(counts[row])
+			}
+			fmt.Fprintf(&out, "<tr%s><td class=\"row\">%d</td><td class=\"count\">%s</td><td>%s</td></tr>\n",
+				class, row, count, html.EscapeString(line))
+		}
+		out.WriteString("</table>\n")
+	}
+	out.WriteString("</body>\n</html>\n")
+	return out.String()
+}
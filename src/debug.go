@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"monkey/debug"
+	"monkey/object"
+	"os"
+)
+
+/*
+ * debug サブコマンド
+ * ファイルを端末のデバッガで実行する（最初の文で止まる）
+ * -dap は標準入出力でDebug Adapter Protocolを話し、プログラムはlaunchで受け取る
+ */
+func runDebug(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("debug", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	dap := flags.Bool("dap", false, "speak the Debug Adapter Protocol on stdin/stdout")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if *dap {
+		if err := debug.NewDAPServer(stdin, stdout).Run(); err != nil {
+			fmt.Fprintf(stderr, "debug: %s\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	if flags.NArg() != 1 {
+		fmt.Fprintln(stderr, "debug: expected one input file")
+		return 2
+	}
+	path := flags.Arg(0)
+	src, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(stderr, "debug: %s\n", err)
+		return 1
+	}
+	session, err := debug.New(path, string(src), nil)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	result := debug.RunTerminal(session, stdin, stdout)
+	if result != nil && result.Type() == object.ERROR_OBJ && !session.Terminated() {
+		return 1
+	}
+	return 0
+}
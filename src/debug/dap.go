@@ -0,0 +1,430 @@
+package debug
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"monkey/lsp"
+	"monkey/object"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+/*
+ * Debug Adapter Protocolのメッセージ
+ * 使うものだけを定義する（行と列は1オリジン）
+ */
+
+// 受け取る要求
+type dapRequest struct {
+	Seq       int             `json:"seq"`
+	Type      string          `json:"type"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+}
+
+type dapResponse struct {
+	Seq        int         `json:"seq"`
+	Type       string      `json:"type"`
+	RequestSeq int         `json:"request_seq"`
+	Success    bool        `json:"success"`
+	Command    string      `json:"command"`
+	Message    string      `json:"message,omitempty"`
+	Body       interface{} `json:"body,omitempty"`
+}
+
+type dapEvent struct {
+	Seq   int         `json:"seq"`
+	Type  string      `json:"type"`
+	Event string      `json:"event"`
+	Body  interface{} `json:"body,omitempty"`
+}
+
+type launchArguments struct {
+	Program     string `json:"program"`
+	StopOnEntry bool   `json:"stopOnEntry"`
+}
+
+type sourceBreakpoint struct {
+	Line      int    `json:"line"`
+	Condition string `json:"condition,omitempty"`
+}
+
+type setBreakpointsArguments struct {
+	Breakpoints []sourceBreakpoint `json:"breakpoints"`
+}
+
+type dapBreakpoint struct {
+	ID       int    `json:"id,omitempty"`
+	Verified bool   `json:"verified"`
+	Line     int    `json:"line"`
+	Message  string `json:"message,omitempty"`
+}
+
+type dapSource struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+type dapStackFrame struct {
+	ID     int       `json:"id"`
+	Name   string    `json:"name"`
+	Source dapSource `json:"source"`
+	Line   int       `json:"line"`
+	Column int       `json:"column"`
+}
+
+type dapScope struct {
+	Name               string `json:"name"`
+	VariablesReference int    `json:"variablesReference"`
+	Expensive          bool   `json:"expensive"`
+}
+
+type dapVariable struct {
+	Name               string `json:"name"`
+	Value              string `json:"value"`
+	VariablesReference int    `json:"variablesReference"`
+}
+
+// 呼び出しの記録の番号（DAPでは1から、セッションでは0から）
+type frameArguments struct {
+	FrameID int `json:"frameId"`
+}
+
+type variablesArguments struct {
+	VariablesReference int `json:"variablesReference"`
+}
+
+type evaluateArguments struct {
+	Expression string `json:"expression"`
+	FrameID    int    `json:"frameId"`
+}
+
+// スレッドは1つだけ
+const threadID = 1
+
+/*
+ * デバッグアダプタ
+ * 要求は1つのgoroutineで順に処理し、止まった通知とputsの出力は評価の側から送る
+ * 書き込みとseqはmuで守る
+ * launchとconfigurationDoneの両方が来たらプログラムを始める
+ */
+type DAPServer struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	mu  sync.Mutex
+	seq int
+
+	session     *Session
+	breakpoints []sourceBreakpoint // launchの前に来たブレークポイント
+	stopOnEntry bool
+	configured  bool
+	started     bool
+	exited      chan struct{}
+	refs        map[int][]Variable // variablesReferenceごとの変数（再開したら捨てる）
+}
+
+func NewDAPServer(in io.Reader, out io.Writer) *DAPServer {
+	return &DAPServer{
+		in:     bufio.NewReader(in),
+		out:    out,
+		exited: make(chan struct{}),
+		refs:   map[int][]Variable{},
+	}
+}
+
+/*
+ * disconnectか入力の終わりまで要求を処理する
+ * 終わるときにプログラムが動いていれば止める
+ */
+func (d *DAPServer) Run() error {
+	defer d.shutdown()
+	for {
+		body, err := lsp.ReadMessage(d.in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var req dapRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			return err
+		}
+		if req.Type != "request" {
+			continue
+		}
+		result, err := d.handle(&req)
+		if err != nil {
+			err = d.reply(&req, false, err.Error(), nil)
+		} else {
+			err = d.reply(&req, true, "", result)
+		}
+		if err != nil {
+			return err
+		}
+		switch req.Command {
+		case "initialize":
+			if err := d.event("initialized", nil); err != nil {
+				return err
+			}
+		case "disconnect":
+			return nil
+		}
+	}
+}
+
+func (d *DAPServer) handle(req *dapRequest) (interface{}, error) {
+	switch req.Command {
+	case "initialize":
+		return map[string]interface{}{
+			"supportsConfigurationDoneRequest": true,
+			"supportsConditionalBreakpoints":   true,
+			"supportsEvaluateForHovers":        true,
+			"supportsTerminateRequest":         true,
+		}, nil
+	case "launch":
+		var args launchArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return nil, d.launch(args)
+	case "setBreakpoints":
+		var args setBreakpointsArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"breakpoints": d.setBreakpoints(args.Breakpoints)}, nil
+	case "setExceptionBreakpoints":
+		return map[string]interface{}{"breakpoints": []dapBreakpoint{}}, nil
+	case "configurationDone":
+		d.configured = true
+		d.start()
+		return nil, nil
+	case "threads":
+		return map[string]interface{}{
+			"threads": []map[string]interface{}{{"id": threadID, "name": "main"}},
+		}, nil
+	case "stackTrace":
+		return d.stackTrace()
+	case "scopes":
+		var args frameArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return d.scopes(args.FrameID)
+	case "variables":
+		var args variablesArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		vars := []dapVariable{}
+		for _, v := range d.refs[args.VariablesReference] {
+			vars = append(vars, dapVariable{Name: v.Name, Value: v.Value})
+		}
+		return map[string]interface{}{"variables": vars}, nil
+	case "evaluate":
+		var args evaluateArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		frameID := 0
+		if args.FrameID > 0 {
+			frameID = args.FrameID - 1
+		}
+		val, err := d.target().Evaluate(args.Expression, frameID)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"result": val, "variablesReference": 0}, nil
+	case "continue":
+		if err := d.resume(d.target().Continue); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"allThreadsContinued": true}, nil
+	case "next":
+		return nil, d.resume(d.target().StepOver)
+	case "stepIn":
+		return nil, d.resume(d.target().StepIn)
+	case "stepOut":
+		return nil, d.resume(d.target().StepOut)
+	case "pause":
+		d.target().Pause()
+		return nil, nil
+	case "terminate", "disconnect":
+		d.shutdown()
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unsupported request: %s", req.Command)
+}
+
+// プログラムを読んでセッションを作る
+// putsの出力はoutputの通知にする
+func (d *DAPServer) launch(args launchArguments) error {
+	if d.session != nil {
+		return fmt.Errorf("already launched")
+	}
+	src, err := os.ReadFile(args.Program)
+	if err != nil {
+		return err
+	}
+	env := object.NewEnvironment()
+	env.Set("puts", &object.Builtin{Fn: func(env *object.Environment, args ...object.Object) object.Object {
+		for _, arg := range args {
+			d.event("output", map[string]interface{}{"category": "stdout", "output": arg.Inspect() + "\n"})
+		}
+		return object.NULL
+	}})
+	session, err := New(args.Program, string(src), env)
+	if err != nil {
+		return err
+	}
+	d.session = session
+	d.stopOnEntry = args.StopOnEntry
+	d.applyBreakpoints(d.breakpoints)
+	d.start()
+	return nil
+}
+
+// launchとconfigurationDoneがそろったら始め、通知を送るgoroutineを動かす
+func (d *DAPServer) start() {
+	if d.session == nil || !d.configured || d.started {
+		return
+	}
+	d.started = true
+	d.session.Start(d.stopOnEntry)
+	go func() {
+		defer close(d.exited)
+		for ev := range d.session.Events() {
+			if !ev.Exited {
+				body := map[string]interface{}{
+					"reason": ev.Stop.Reason, "threadId": threadID, "allThreadsStopped": true,
+				}
+				if ev.Stop.Message != "" {
+					body["text"] = ev.Stop.Message
+				}
+				d.event("stopped", body)
+				continue
+			}
+			code := 0
+			if err, ok := ev.Result.(*object.Error); ok && !d.session.Terminated() {
+				code = 1
+				d.event("output", map[string]interface{}{
+					"category": "stderr", "output": fmt.Sprintf("%s: %s\n", err.KindName(), err.Detail()),
+				})
+			}
+			d.event("exited", map[string]interface{}{"exitCode": code})
+			d.event("terminated", nil)
+		}
+	}()
+}
+
+// 動いていればプログラムを止めて終わるのを待つ
+func (d *DAPServer) shutdown() {
+	if !d.started {
+		return
+	}
+	d.session.Terminate()
+	<-d.exited
+}
+
+// セッション（launchの前でも呼べるように、なければ止まっていない空のもの）
+func (d *DAPServer) target() *Session {
+	if d.session == nil {
+		return &Session{}
+	}
+	return d.session
+}
+
+func (d *DAPServer) resume(fn func() error) error {
+	d.refs = map[int][]Variable{}
+	return fn()
+}
+
+/*
+ * ブレークポイントはファイルごとに全部置き換える
+ * デバッグするファイルは1つなのでパスは見ない
+ */
+func (d *DAPServer) setBreakpoints(bps []sourceBreakpoint) []dapBreakpoint {
+	d.breakpoints = bps
+	if d.session != nil {
+		return d.applyBreakpoints(bps)
+	}
+	result := []dapBreakpoint{}
+	for _, bp := range bps {
+		r := dapBreakpoint{Verified: true, Line: bp.Line}
+		if bp.Condition != "" {
+			if _, err := parse(bp.Condition); err != nil {
+				r.Verified, r.Message = false, err.Error()
+			}
+		}
+		result = append(result, r)
+	}
+	return result
+}
+
+func (d *DAPServer) applyBreakpoints(bps []sourceBreakpoint) []dapBreakpoint {
+	d.session.ClearBreakpoints()
+	result := []dapBreakpoint{}
+	for _, bp := range bps {
+		set, err := d.session.SetBreakpoint(bp.Line, bp.Condition)
+		if err != nil {
+			result = append(result, dapBreakpoint{Verified: false, Line: bp.Line, Message: err.Error()})
+			continue
+		}
+		result = append(result, dapBreakpoint{ID: set.ID, Verified: true, Line: bp.Line})
+	}
+	return result
+}
+
+func (d *DAPServer) stackTrace() (interface{}, error) {
+	frames, err := d.target().Stack()
+	if err != nil {
+		return nil, err
+	}
+	source := dapSource{Name: filepath.Base(d.session.File), Path: d.session.File}
+	stack := []dapStackFrame{}
+	for _, f := range frames {
+		stack = append(stack, dapStackFrame{ID: f.ID + 1, Name: f.Name, Source: source, Line: f.Row, Column: f.Col})
+	}
+	return map[string]interface{}{"stackFrames": stack, "totalFrames": len(stack)}, nil
+}
+
+// 環境の段ごとに変数を取っておき、その番号を返す
+func (d *DAPServer) scopes(frameID int) (interface{}, error) {
+	scopes, err := d.target().Scopes(frameID - 1)
+	if err != nil {
+		return nil, err
+	}
+	result := []dapScope{}
+	for _, scope := range scopes {
+		ref := len(d.refs) + 1
+		d.refs[ref] = scope.Variables
+		result = append(result, dapScope{Name: scope.Name, VariablesReference: ref})
+	}
+	return map[string]interface{}{"scopes": result}, nil
+}
+
+/*
+ * 送る
+ */
+
+func (d *DAPServer) reply(req *dapRequest, success bool, message string, body interface{}) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.seq++
+	return lsp.WriteMessage(d.out, dapResponse{
+		Seq: d.seq, Type: "response", RequestSeq: req.Seq, Success: success,
+		Command: req.Command, Message: message, Body: body,
+	})
+}
+
+func (d *DAPServer) event(name string, body interface{}) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.seq++
+	return lsp.WriteMessage(d.out, dapEvent{Seq: d.seq, Type: "event", Event: name, Body: body})
+}
@@ -0,0 +1,653 @@
+package debug
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/object"
+	"monkey/parser"
+	"sort"
+	"strings"
+	"sync"
+)
+
+/*
+ * ブレークポイント
+ * Conditionがあれば、式が真になったときだけ止まる
+ */
+type Breakpoint struct {
+	ID        int
+	Row       int
+	Condition string
+	Hits      int // 止まった回数
+	cond      *ast.Program
+}
+
+/*
+ * 止まった場所
+ * Reasonは entry/breakpoint/step/pause のどれか
+ */
+type Stop struct {
+	Reason     string
+	Row        int
+	Col        int
+	Breakpoint *Breakpoint // ブレークポイントで止まったとき
+	Message    string      // 条件の評価に失敗したときのエラー
+}
+
+// 呼び出しの記録（0が止まっている関数、大きいほど呼び出し元）
+type Frame struct {
+	ID   int
+	Name string
+	Row  int // この関数で最後に評価を始めた文の位置
+	Col  int
+}
+
+// 変数と値の表示
+type Variable struct {
+	Name  string
+	Value string
+}
+
+// 環境の1段（内側から）
+type Scope struct {
+	Name      string // local/scope/global
+	Variables []Variable
+}
+
+// ウォッチ式と止まった場所での値
+type Watch struct {
+	Expr  string
+	Value string
+	Err   error
+}
+
+/*
+ * セッションからの通知
+ * 止まったときはStop、プログラムが終わったときはExitedとResultが入る
+ */
+type Event struct {
+	Stop   *Stop
+	Exited bool
+	Result object.Object
+}
+
+// 止まっていないときに止まっている間だけの操作をした
+var ErrNotStopped = errors.New("program is not stopped")
+
+// 再開のしかた
+type mode int
+
+const (
+	modeRun      mode = iota
+	modeStepIn        // 次の行で止まる
+	modeStepOver      // 同じ深さか呼び出し元の次の行で止まる
+	modeStepOut       // 呼び出し元に戻ったら止まる
+)
+
+// 関数の呼び出しごと（トップレベルはframeがnil）の最後に評価を始めた文
+type frameState struct {
+	frame *object.Frame
+	env   *object.Environment
+	row   int
+	col   int
+}
+
+/*
+ * デバッグのセッション
+ * プログラムは別のgoroutineで自分の実行として評価し、その実行を見るものとして文のたびに呼ばれる
+ * 止まっている間はフロントエンド（端末かDAP）からの要求を評価の側で実行する
+ * 呼び出しの記録は関数の呼び出しごとに覚えて、止まった文の呼び出し元をたどって並べる
+ */
+type Session struct {
+	File    string
+	Lines   []string
+	program *ast.Program
+	env     *object.Environment
+
+	events   chan Event
+	requests chan func() bool // 止まっている間の要求（trueを返したら再開する）
+	cancel   context.CancelFunc
+
+	mu          sync.Mutex
+	breakpoints map[int]*Breakpoint // 行ごと
+	nextID      int
+	watches     []string
+	mode        mode
+	reason      string
+	stopped     bool
+	terminated  bool
+
+	// 以下は評価の側だけが触る
+	frames     map[*object.Frame]*frameState
+	current    *object.Frame // 最後に評価を始めた文の関数呼び出し
+	start      *object.Frame // ステップを始めた関数呼び出し
+	lastRow    int
+	evaluating bool // 条件やウォッチの評価中は止まらない
+}
+
+/*
+ * ソースを構文解析してセッションを作る
+ * envがnilなら新しい環境で実行する
+ */
+func New(file string, src string, env *object.Environment) (*Session, error) {
+	p := parser.NewParser(src)
+	program, ok := p.ParseProgram()
+	if !ok {
+		return nil, errors.New(parser.FormatErrors(file, p.ErrorDetails()))
+	}
+	if env == nil {
+		env = object.NewEnvironment()
+	}
+	return &Session{
+		File:        file,
+		Lines:       strings.Split(src, "\n"),
+		program:     program,
+		env:         env,
+		events:      make(chan Event, 1),
+		requests:    make(chan func() bool),
+		breakpoints: map[int]*Breakpoint{},
+		frames:      map[*object.Frame]*frameState{},
+	}, nil
+}
+
+// 行のソース（範囲外なら空）
+func (s *Session) Line(row int) string {
+	if row < 1 || row > len(s.Lines) {
+		return ""
+	}
+	return s.Lines[row-1]
+}
+
+// 止まったときと終わったときの通知
+// 終わった通知の後で閉じる
+func (s *Session) Events() <-chan Event {
+	return s.events
+}
+
+/*
+ * プログラムの評価を始める
+ * stopOnEntryなら最初の文で止まる
+ */
+func (s *Session) Start(stopOnEntry bool) {
+	if stopOnEntry {
+		s.mu.Lock()
+		s.mode = modeStepIn
+		s.reason = "entry"
+		s.mu.Unlock()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	exec := evaluator.NewExecution(ctx, evaluator.Options{Observer: s})
+	go func() {
+		result := exec.Eval(s.program, s.env)
+		exec.Close()
+		cancel()
+		s.events <- Event{Exited: true, Result: result}
+		close(s.events)
+	}()
+}
+
+/*
+ * プログラムを止める
+ * 止まっていれば再開して、以後は止まらずにキャンセルのエラーで終わらせる
+ */
+func (s *Session) Terminate() {
+	s.mu.Lock()
+	s.terminated = true
+	stopped := s.stopped
+	s.mu.Unlock()
+	if s.cancel != nil {
+		s.cancel()
+	}
+	if stopped {
+		s.requests <- func() bool { return true }
+	}
+}
+
+// Terminateで止めたか
+func (s *Session) Terminated() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.terminated
+}
+
+/*
+ * ブレークポイント
+ */
+
+// 行にブレークポイントを置く（同じ行のものは置き換える）
+// 条件は空でなければ式として構文解析できなければならない
+func (s *Session) SetBreakpoint(row int, condition string) (*Breakpoint, error) {
+	bp := &Breakpoint{Row: row, Condition: condition}
+	if condition != "" {
+		program, err := parse(condition)
+		if err != nil {
+			return nil, err
+		}
+		bp.cond = program
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	bp.ID = s.nextID
+	s.breakpoints[row] = bp
+	return bp, nil
+}
+
+// 行のブレークポイントを消す（なければfalse）
+func (s *Session) ClearBreakpoint(row int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.breakpoints[row]
+	delete(s.breakpoints, row)
+	return ok
+}
+
+func (s *Session) ClearBreakpoints() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.breakpoints = map[int]*Breakpoint{}
+}
+
+// 行の順に返す
+func (s *Session) Breakpoints() []*Breakpoint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := []*Breakpoint{}
+	for _, bp := range s.breakpoints {
+		list = append(list, bp)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Row < list[j].Row })
+	return list
+}
+
+/*
+ * ウォッチ式
+ */
+
+func (s *Session) AddWatch(expr string) error {
+	if _, err := parse(expr); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.watches = append(s.watches, expr)
+	return nil
+}
+
+// i番目（0から）のウォッチ式を消す
+func (s *Session) RemoveWatch(i int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i < 0 || i >= len(s.watches) {
+		return false
+	}
+	s.watches = append(s.watches[:i], s.watches[i+1:]...)
+	return true
+}
+
+// 止まっている場所でウォッチ式を評価する
+func (s *Session) Watches() ([]Watch, error) {
+	s.mu.Lock()
+	exprs := append([]string{}, s.watches...)
+	s.mu.Unlock()
+
+	watches := []Watch{}
+	err := s.do(func() {
+		for _, expr := range exprs {
+			val, err := s.eval(expr, s.frameEnv(0))
+			watches = append(watches, Watch{Expr: expr, Value: val, Err: err})
+		}
+	})
+	return watches, err
+}
+
+/*
+ * 再開
+ */
+
+func (s *Session) Continue() error { return s.resume(modeRun) }
+func (s *Session) StepIn() error   { return s.resume(modeStepIn) }
+func (s *Session) StepOver() error { return s.resume(modeStepOver) }
+func (s *Session) StepOut() error  { return s.resume(modeStepOut) }
+
+// 動いているプログラムを次の文で止める
+func (s *Session) Pause() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.stopped {
+		s.mode = modeStepIn
+		s.reason = "pause"
+	}
+}
+
+func (s *Session) resume(m mode) error {
+	if !s.isStopped() {
+		return ErrNotStopped
+	}
+	s.requests <- func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.mode = m
+		s.reason = "step"
+		s.start = s.current
+		return true
+	}
+	return nil
+}
+
+/*
+ * 止まっている間の調べもの
+ */
+
+// 呼び出しの記録を内側から返す
+func (s *Session) Stack() ([]Frame, error) {
+	frames := []Frame{}
+	err := s.do(func() {
+		for _, state := range s.stack() {
+			name := "<top>"
+			if state.frame != nil {
+				name = state.frame.Function.DisplayName()
+			}
+			frames = append(frames, Frame{ID: len(frames), Name: name, Row: state.row, Col: state.col})
+		}
+	})
+	return frames, err
+}
+
+/*
+ * 呼び出しの記録の環境を内側から1段ずつ返す
+ * 関数の中ならいちばん内側の先頭にthisを入れる
+ */
+func (s *Session) Scopes(frameID int) ([]Scope, error) {
+	scopes := []Scope{}
+	err := s.do(func() {
+		env := s.frameEnv(frameID)
+		if env == nil {
+			return
+		}
+		for e := env; e != nil; e = e.Outer() {
+			scope := Scope{Name: "scope", Variables: []Variable{}}
+			switch {
+			case e == env:
+				scope.Name = "local"
+				if env.Function() != nil {
+					scope.Variables = append(scope.Variables, Variable{"this", display(env.Get("this"))})
+				}
+			case e.Outer() == nil:
+				scope.Name = "global"
+			}
+			for _, name := range e.Names() {
+				// 差し替えた組み込み関数（DAPのputsなど）は出さない
+				val, _ := e.GetLocal(name)
+				if _, ok := val.(*object.Builtin); ok {
+					continue
+				}
+				scope.Variables = append(scope.Variables, Variable{name, display(val)})
+			}
+			if len(scope.Variables) > 0 || scope.Name != "scope" {
+				scopes = append(scopes, scope)
+			}
+		}
+	})
+	return scopes, err
+}
+
+// 止まっている場所（frameIDの関数）の環境で式を評価する
+func (s *Session) Evaluate(expr string, frameID int) (string, error) {
+	var val string
+	var evalErr error
+	err := s.do(func() {
+		env := s.frameEnv(frameID)
+		if env == nil {
+			evalErr = fmt.Errorf("unknown frame: %d", frameID)
+			return
+		}
+		val, evalErr = s.eval(expr, env)
+	})
+	if err != nil {
+		return "", err
+	}
+	return val, evalErr
+}
+
+func (s *Session) isStopped() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stopped
+}
+
+// 評価の側で処理を実行して終わるのを待つ
+func (s *Session) do(fn func()) error {
+	if !s.isStopped() {
+		return ErrNotStopped
+	}
+	done := make(chan struct{})
+	s.requests <- func() bool {
+		fn()
+		close(done)
+		return false
+	}
+	<-done
+	return nil
+}
+
+/*
+ * 止まっている文から呼び出し元をたどって、評価を始めた文のある記録を内側から返す
+ * トップレベルの記録は最後になる（評価の側で呼ぶ）
+ */
+func (s *Session) stack() []*frameState {
+	states := []*frameState{}
+	frame := s.current
+	for {
+		if state := s.frames[frame]; state != nil {
+			states = append(states, state)
+		}
+		if frame == nil {
+			return states
+		}
+		frame = frame.Parent
+	}
+}
+
+// 呼び出しの記録の環境（評価の側で呼ぶ）
+func (s *Session) frameEnv(frameID int) *object.Environment {
+	if states := s.stack(); frameID >= 0 && frameID < len(states) {
+		return states[frameID].env
+	}
+	return nil
+}
+
+/*
+ * 実行を見るもの
+ */
+
+// 評価の側でノードの前に呼ばれる
+// 文（ブロックとコメントを除く）で止まるかを調べる
+func (s *Session) Node(node ast.Node, env *object.Environment) {
+	stmt, ok := node.(ast.Statement)
+	if !ok || s.evaluating {
+		return
+	}
+	switch stmt.(type) {
+	case *ast.BlockStatement, *ast.CommentStatement:
+		return
+	}
+	t := ast.NodeToken(stmt)
+	frame := env.Frame()
+	s.frames[frame] = &frameState{frame: frame, env: env, row: t.Row, col: t.Col}
+
+	// 同じ行の続きの文では止まらない
+	newLine := t.Row != s.lastRow || frame != s.current
+	s.lastRow, s.current = t.Row, frame
+	if !newLine {
+		return
+	}
+
+	if stop := s.check(t.Row, frame, env); stop != nil {
+		stop.Row, stop.Col = t.Row, t.Col
+		s.pause(stop)
+	}
+}
+
+// 関数から戻ったら記録を消す
+func (s *Session) Leave(frame *object.Frame) {
+	delete(s.frames, frame)
+}
+
+func (s *Session) Allocate(int) {}
+
+/*
+ * 止まるならその理由を返す
+ * ステップで止まる行でも、ブレークポイントの条件が合えばブレークポイントで止まったことにする
+ */
+func (s *Session) check(row int, frame *object.Frame, env *object.Environment) *Stop {
+	s.mu.Lock()
+	if s.terminated {
+		s.mu.Unlock()
+		return nil
+	}
+	m, reason := s.mode, s.reason
+	bp := s.breakpoints[row]
+	s.mu.Unlock()
+
+	if stop := s.hit(bp, env); stop != nil {
+		return stop
+	}
+	// 同じ深さのほかのタスクで止まらないように、呼び出しの記録そのものを比べる
+	switch {
+	case m == modeStepIn,
+		m == modeStepOver && (frame == s.start || callerOf(frame, s.start)),
+		m == modeStepOut && callerOf(frame, s.start):
+		return &Stop{Reason: reason}
+	}
+	return nil
+}
+
+// callerがframeの呼び出し元（何段上でも）か（トップレベルはnil）
+func callerOf(caller *object.Frame, frame *object.Frame) bool {
+	for frame != nil {
+		frame = frame.Parent
+		if frame == caller {
+			return true
+		}
+	}
+	return false
+}
+
+// ブレークポイントで止まるか（条件を評価できなければ止まってエラーを知らせる）
+func (s *Session) hit(bp *Breakpoint, env *object.Environment) *Stop {
+	if bp == nil {
+		return nil
+	}
+	stop := &Stop{Reason: "breakpoint", Breakpoint: bp}
+	if bp.cond != nil {
+		val, err := s.evalProgram(bp.cond, env)
+		if err != nil {
+			stop.Message = "condition: " + err.Error()
+		} else if !truthy(val) {
+			return nil
+		}
+	}
+	s.mu.Lock()
+	bp.Hits++
+	s.mu.Unlock()
+	return stop
+}
+
+// 止まって、再開の要求が来るまで要求を処理する
+func (s *Session) pause(stop *Stop) {
+	s.mu.Lock()
+	if s.terminated {
+		s.mu.Unlock()
+		return
+	}
+	s.mode = modeRun
+	s.stopped = true
+	s.mu.Unlock()
+
+	s.events <- Event{Stop: stop}
+	for req := range s.requests {
+		if req() {
+			break
+		}
+	}
+
+	s.mu.Lock()
+	s.stopped = false
+	s.mu.Unlock()
+}
+
+/*
+ * 式の評価
+ */
+
+func parse(src string) (*ast.Program, error) {
+	p := parser.NewParser(src)
+	program, ok := p.ParseProgram()
+	if !ok {
+		return nil, errors.New(strings.Join(p.Errors(), "\n"))
+	}
+	if len(program.Statements) == 0 {
+		return nil, errors.New("empty expression")
+	}
+	return program, nil
+}
+
+// 文字列の式を評価して表示用の文字列にする
+func (s *Session) eval(src string, env *object.Environment) (string, error) {
+	program, err := parse(src)
+	if err != nil {
+		return "", err
+	}
+	val, err := s.evalProgram(program, env)
+	if err != nil {
+		return "", err
+	}
+	return display(val), nil
+}
+
+/*
+ * 止まっている環境で文を順に評価して最後の値を返す
+ * ロックはフックの呼び出し元が持っているのでProgramとしては評価しない
+ */
+func (s *Session) evalProgram(program *ast.Program, env *object.Environment) (object.Object, error) {
+	s.evaluating = true
+	defer func() { s.evaluating = false }()
+
+	var result object.Object = object.NULL
+	for _, stmt := range program.Statements {
+		result = evaluator.Eval(stmt, env)
+		if rv, ok := result.(*object.ReturnValue); ok {
+			result = rv.Value
+		}
+		if err, ok := result.(*object.Error); ok {
+			return nil, fmt.Errorf("%s: %s", err.KindName(), err.Message)
+		}
+	}
+	if result == nil {
+		result = object.NULL
+	}
+	return result, nil
+}
+
+// ifと同じくnullとfalseだけが偽
+func truthy(obj object.Object) bool {
+	return obj != object.NULL && obj != object.FALSE
+}
+
+// 文字列は引用符をつけ、関数は名前だけにする
+func display(obj object.Object) string {
+	switch o := obj.(type) {
+	case nil:
+		return "null"
+	case *object.String:
+		return `"` + o.Value + `"`
+	case *object.Function:
+		return "fn " + o.DisplayName()
+	}
+	return obj.Inspect()
+}
@@ -0,0 +1,453 @@
+package debug
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"monkey/lsp"
+	"monkey/object"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const program = `imm add = (a:number, b:number)=>{
+  imm s = a + b
+  return s
+}
+mut total = 0
+loop(imm i=[1, 2, 3]){
+  total = add(total, i.v)
+}
+total
+`
+
+func newSession(t *testing.T, src string) *Session {
+	t.Helper()
+	s, err := New("d.kk", src, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// 次の通知を待つ
+func next(t *testing.T, s *Session) Event {
+	t.Helper()
+	select {
+	case ev := <-s.Events():
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an event")
+		return Event{}
+	}
+}
+
+func expectStop(t *testing.T, s *Session, reason string, row int) {
+	t.Helper()
+	ev := next(t, s)
+	if ev.Stop == nil {
+		t.Fatalf("expected a stop at line %d, got exit with %v", row, ev.Result)
+	}
+	if ev.Stop.Reason != reason || ev.Stop.Row != row {
+		t.Fatalf("expected %s at line %d, got %s at line %d", reason, row, ev.Stop.Reason, ev.Stop.Row)
+	}
+}
+
+func expectExit(t *testing.T, s *Session) object.Object {
+	t.Helper()
+	ev := next(t, s)
+	if !ev.Exited {
+		t.Fatalf("expected exit, got a stop at line %d", ev.Stop.Row)
+	}
+	return ev.Result
+}
+
+func evaluate(t *testing.T, s *Session, expr string) string {
+	t.Helper()
+	val, err := s.Evaluate(expr, 0)
+	if err != nil {
+		t.Fatalf("evaluate %s: %s", expr, err)
+	}
+	return val
+}
+
+func TestBreakpoints(t *testing.T) {
+	s := newSession(t, program)
+	if _, err := s.SetBreakpoint(2, ""); err != nil {
+		t.Fatal(err)
+	}
+	s.Start(false)
+	for _, want := range []string{"1", "2", "3"} {
+		expectStop(t, s, "breakpoint", 2)
+		if got := evaluate(t, s, "b"); got != want {
+			t.Errorf("b: expected %s, got %s", want, got)
+		}
+		if err := s.Continue(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if result := expectExit(t, s); result.Inspect() != "6" {
+		t.Errorf("expected 6, got %s", result.Inspect())
+	}
+	if hits := s.Breakpoints()[0].Hits; hits != 3 {
+		t.Errorf("expected 3 hits, got %d", hits)
+	}
+}
+
+func TestConditionalBreakpoint(t *testing.T) {
+	s := newSession(t, program)
+	if _, err := s.SetBreakpoint(7, "i.v == 3"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SetBreakpoint(3, "1 +"); err == nil {
+		t.Error("expected an error for an invalid condition")
+	}
+	s.Start(false)
+	expectStop(t, s, "breakpoint", 7)
+	if got := evaluate(t, s, "total"); got != "3" {
+		t.Errorf("total: expected 3, got %s", got)
+	}
+	s.Continue()
+	expectExit(t, s)
+}
+
+func TestStepping(t *testing.T) {
+	s := newSession(t, program)
+	s.SetBreakpoint(7, "")
+	s.Start(true)
+	expectStop(t, s, "entry", 1)
+
+	s.Continue()
+	expectStop(t, s, "breakpoint", 7)
+	s.StepIn()
+	expectStop(t, s, "step", 2)
+	frames, err := s.Stack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 2 || frames[0].Name != "add" || frames[1].Name != "<top>" || frames[1].Row != 7 {
+		t.Errorf("unexpected stack: %+v", frames)
+	}
+
+	s.StepOver()
+	expectStop(t, s, "step", 3)
+	s.StepOut()
+	// 呼び出し元に戻った次の文は次の周回の呼び出し
+	expectStop(t, s, "breakpoint", 7)
+	if got := evaluate(t, s, "total"); got != "1" {
+		t.Errorf("total: expected 1, got %s", got)
+	}
+
+	s.ClearBreakpoint(7)
+	s.StepOver()
+	expectStop(t, s, "step", 7)
+	s.StepOver()
+	expectStop(t, s, "step", 9)
+	s.Continue()
+	expectExit(t, s)
+}
+
+// ほかのタスクが同じ深さの文を評価しても、ステップは呼び出しの記録で判断する
+func TestSteppingWithTasks(t *testing.T) {
+	s := newSession(t, `imm work = ()=>{
+  imm w = 1
+  w + 1
+}
+imm f = ()=>{
+  imm r = await spawn work()
+  r * 10
+}
+f()
+`)
+	s.SetBreakpoint(6, "")
+	s.Start(false)
+	expectStop(t, s, "breakpoint", 6)
+	s.StepOver()
+	expectStop(t, s, "step", 7)
+	frames, err := s.Stack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 2 || frames[0].Name != "f" || frames[1].Row != 9 {
+		t.Errorf("unexpected stack: %+v", frames)
+	}
+	s.Continue()
+	if result := expectExit(t, s); result.Inspect() != "20" {
+		t.Errorf("expected 20, got %s", result.Inspect())
+	}
+
+	// セッションはいくつでも同時に動かせる
+	a, b := newSession(t, program), newSession(t, program)
+	a.SetBreakpoint(2, "")
+	b.SetBreakpoint(3, "")
+	a.Start(false)
+	b.Start(false)
+	expectStop(t, a, "breakpoint", 2)
+	expectStop(t, b, "breakpoint", 3)
+	a.Terminate()
+	b.Terminate()
+	expectExit(t, a)
+	expectExit(t, b)
+}
+
+func TestScopesAndWatches(t *testing.T) {
+	s := newSession(t, program)
+	s.SetBreakpoint(3, "")
+	if err := s.AddWatch("s * 10"); err != nil {
+		t.Fatal(err)
+	}
+	s.AddWatch("nothing")
+	s.Start(false)
+	expectStop(t, s, "breakpoint", 3)
+
+	scopes, err := s.Scopes(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scopes[0].Name != "local" || scopes[len(scopes)-1].Name != "global" {
+		t.Fatalf("unexpected scopes: %+v", scopes)
+	}
+	local := map[string]string{}
+	for _, v := range scopes[0].Variables {
+		local[v.Name] = v.Value
+	}
+	if local["a"] != "0" || local["b"] != "1" || local["s"] != "1" || !strings.Contains(local["this"], "a: 0") {
+		t.Errorf("unexpected local scope: %v", local)
+	}
+	global := scopes[len(scopes)-1].Variables
+	if len(global) != 2 || global[0].Name != "add" || global[0].Value != "fn add" || global[1].Name != "total" {
+		t.Errorf("unexpected global scope: %+v", global)
+	}
+
+	// 呼び出し元の環境
+	scopes, _ = s.Scopes(1)
+	if scopes[0].Variables[0].Name != "i" {
+		t.Errorf("unexpected caller scope: %+v", scopes[0])
+	}
+
+	watches, err := s.Watches()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if watches[0].Value != "10" || watches[1].Err == nil {
+		t.Errorf("unexpected watches: %+v", watches)
+	}
+
+	// 評価中は止まらない
+	if got := evaluate(t, s, "add(2, 3)"); got != "5" {
+		t.Errorf("add(2, 3): expected 5, got %s", got)
+	}
+	s.Terminate()
+	expectExit(t, s)
+	if _, err := s.Evaluate("1", 0); err != ErrNotStopped {
+		t.Errorf("expected ErrNotStopped, got %v", err)
+	}
+}
+
+func TestTerminal(t *testing.T) {
+	s := newSession(t, program)
+	input := strings.Join([]string{
+		"break 2 if a > 0",
+		"watch total",
+		"c",
+		"p a + b",
+		"bt",
+		"o",
+		"bl",
+		"delete 2",
+		"c",
+	}, "\n")
+	var out strings.Builder
+	result := RunTerminal(s, strings.NewReader(input), &out)
+	if result.Inspect() != "6" {
+		t.Errorf("expected 6, got %s", result.Inspect())
+	}
+	for _, want := range []string{
+		"stopped (entry) at d.kk:1:1",
+		"breakpoint 1 at line 2",
+		"breakpoint 1 at d.kk:2:3",
+		"  1: total = 1\n",
+		"(debug) 3\n",
+		"#0 add at d.kk:2:3\n#1 <top> at d.kk:7:9\n",
+		"1: line 2 if a > 0 (hits 1)",
+		"program exited",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output does not contain %q:\n%s", want, out.String())
+		}
+	}
+}
+
+/*
+ * パイプ越しにアダプタと話すクライアント
+ * アダプタは応答の後に通知を書くので、読むのは別のgoroutineで行う
+ */
+type dapClient struct {
+	t        *testing.T
+	w        io.Writer
+	messages chan dapMessage
+	seq      int
+}
+
+func newDAPClient(t *testing.T, w io.Writer, r io.Reader) *dapClient {
+	c := &dapClient{t: t, w: w, messages: make(chan dapMessage, 64)}
+	go func() {
+		defer close(c.messages)
+		in := bufio.NewReader(r)
+		for {
+			body, err := lsp.ReadMessage(in)
+			if err != nil {
+				return
+			}
+			var msg dapMessage
+			if json.Unmarshal(body, &msg) == nil {
+				c.messages <- msg
+			}
+		}
+	}()
+	return c
+}
+
+type dapMessage struct {
+	Type       string          `json:"type"`
+	RequestSeq int             `json:"request_seq"`
+	Success    bool            `json:"success"`
+	Message    string          `json:"message"`
+	Event      string          `json:"event"`
+	Body       json.RawMessage `json:"body"`
+}
+
+func (c *dapClient) send(command string, args interface{}) int {
+	c.seq++
+	msg := map[string]interface{}{"seq": c.seq, "type": "request", "command": command, "arguments": args}
+	if err := lsp.WriteMessage(c.w, msg); err != nil {
+		c.t.Fatal(err)
+	}
+	return c.seq
+}
+
+func (c *dapClient) read() dapMessage {
+	select {
+	case msg, ok := <-c.messages:
+		if !ok {
+			c.t.Fatal("adapter closed the connection")
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("timed out waiting for a message")
+		return dapMessage{}
+	}
+}
+
+// 要求を送って応答の本体を読む（途中の通知は捨てる）
+func (c *dapClient) call(command string, args interface{}, body interface{}) {
+	seq := c.send(command, args)
+	for {
+		msg := c.read()
+		if msg.Type != "response" || msg.RequestSeq != seq {
+			continue
+		}
+		if !msg.Success {
+			c.t.Fatalf("%s failed: %s", command, msg.Message)
+		}
+		if body != nil {
+			json.Unmarshal(msg.Body, body)
+		}
+		return
+	}
+}
+
+// 通知を待つ
+func (c *dapClient) wait(event string) dapMessage {
+	for {
+		if msg := c.read(); msg.Type == "event" && msg.Event == event {
+			return msg
+		}
+	}
+}
+
+func TestDAP(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "d.kk")
+	if err := os.WriteFile(path, []byte(program+"puts(total)\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+	c := newDAPClient(t, clientOut, clientIn)
+	done := make(chan error, 1)
+	go func() {
+		done <- NewDAPServer(serverIn, serverOut).Run()
+		serverOut.Close()
+	}()
+
+	c.call("initialize", map[string]interface{}{"adapterID": "kuroko"}, nil)
+	c.call("launch", map[string]interface{}{"program": path}, nil)
+	var bps struct {
+		Breakpoints []dapBreakpoint `json:"breakpoints"`
+	}
+	c.call("setBreakpoints", map[string]interface{}{
+		"source":      map[string]interface{}{"path": path},
+		"breakpoints": []map[string]interface{}{{"line": 2, "condition": "a == 1"}, {"line": 3, "condition": "("}},
+	}, &bps)
+	if len(bps.Breakpoints) != 2 || !bps.Breakpoints[0].Verified || bps.Breakpoints[1].Verified {
+		t.Fatalf("unexpected breakpoints: %+v", bps.Breakpoints)
+	}
+	c.call("configurationDone", nil, nil)
+
+	var stopped struct {
+		Reason string `json:"reason"`
+	}
+	json.Unmarshal(c.wait("stopped").Body, &stopped)
+	if stopped.Reason != "breakpoint" {
+		t.Errorf("expected breakpoint, got %s", stopped.Reason)
+	}
+
+	var stack struct {
+		StackFrames []dapStackFrame `json:"stackFrames"`
+	}
+	c.call("stackTrace", map[string]interface{}{"threadId": threadID}, &stack)
+	if len(stack.StackFrames) != 2 || stack.StackFrames[0].Name != "add" || stack.StackFrames[0].Line != 2 {
+		t.Fatalf("unexpected stack: %+v", stack.StackFrames)
+	}
+
+	var scopes struct {
+		Scopes []dapScope `json:"scopes"`
+	}
+	c.call("scopes", map[string]interface{}{"frameId": stack.StackFrames[0].ID}, &scopes)
+	var vars struct {
+		Variables []dapVariable `json:"variables"`
+	}
+	c.call("variables", map[string]interface{}{"variablesReference": scopes.Scopes[0].VariablesReference}, &vars)
+	names := []string{}
+	for _, v := range vars.Variables {
+		names = append(names, v.Name+"="+v.Value)
+	}
+	if got := strings.Join(names[1:], " "); got != "a=1 b=2" {
+		t.Errorf("unexpected variables: %s", got)
+	}
+
+	var result struct {
+		Result string `json:"result"`
+	}
+	c.call("evaluate", map[string]interface{}{"expression": "total", "frameId": stack.StackFrames[1].ID}, &result)
+	if result.Result != "1" {
+		t.Errorf("total: expected 1, got %s", result.Result)
+	}
+
+	c.call("continue", map[string]interface{}{"threadId": threadID}, nil)
+	var output struct {
+		Output string `json:"output"`
+	}
+	json.Unmarshal(c.wait("output").Body, &output)
+	if output.Output != "6\n" {
+		t.Errorf("expected output 6, got %q", output.Output)
+	}
+	c.wait("terminated")
+	c.call("disconnect", nil, nil)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,222 @@
+package debug
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"monkey/object"
+	"strconv"
+	"strings"
+)
+
+const terminalHelp = `commands:
+  break ROW [if EXPR]  set a breakpoint (b)
+  delete ROW           remove a breakpoint (d)
+  breakpoints          list breakpoints (bl)
+  continue             run until the next breakpoint (c)
+  step                 step into calls (s)
+  next                 step over calls (n)
+  out                  run until the current function returns (o)
+  print EXPR           evaluate EXPR in the current scope (p)
+  watch EXPR           evaluate EXPR at every stop (w)
+  unwatch N            remove the Nth watch expression
+  env                  show the environment chain and this (e)
+  stack                show the call stack (bt)
+  list                 show the source around the current line (l)
+  quit                 stop the program (q)
+`
+
+/*
+ * 端末のデバッガ
+ * 最初の文で止まり、止まるたびに場所とウォッチ式を出してコマンドを読む
+ * 入力が終わったらプログラムを止める
+ * プログラムの結果（エラーのこともある）を返す
+ */
+func RunTerminal(s *Session, in io.Reader, out io.Writer) object.Object {
+	t := &terminal{s: s, in: bufio.NewScanner(in), out: out}
+	s.Start(true)
+	for ev := range s.Events() {
+		if ev.Exited {
+			if err, ok := ev.Result.(*object.Error); ok && s.Terminated() {
+				fmt.Fprintln(out, "program terminated")
+			} else if ok {
+				fmt.Fprintf(out, "program exited with %s: %s\n", err.KindName(), err.Detail())
+			} else {
+				fmt.Fprintln(out, "program exited")
+			}
+			return ev.Result
+		}
+		t.stopped(ev.Stop)
+		t.prompt()
+	}
+	return nil
+}
+
+type terminal struct {
+	s   *Session
+	in  *bufio.Scanner
+	out io.Writer
+	row int // 止まっている行
+}
+
+// 止まった場所とウォッチ式を出す
+func (t *terminal) stopped(stop *Stop) {
+	t.row = stop.Row
+	switch {
+	case stop.Breakpoint != nil:
+		fmt.Fprintf(t.out, "breakpoint %d at %s:%d:%d\n", stop.Breakpoint.ID, t.s.File, stop.Row, stop.Col)
+	default:
+		fmt.Fprintf(t.out, "stopped (%s) at %s:%d:%d\n", stop.Reason, t.s.File, stop.Row, stop.Col)
+	}
+	if stop.Message != "" {
+		fmt.Fprintf(t.out, "  %s\n", stop.Message)
+	}
+	fmt.Fprintf(t.out, "%4d  %s\n", stop.Row, t.s.Line(stop.Row))
+
+	watches, _ := t.s.Watches()
+	for i, w := range watches {
+		t.watch(i+1, w)
+	}
+}
+
+// 評価できなければエラーを <> で囲んで出す
+func (t *terminal) watch(n int, w Watch) {
+	if w.Err != nil {
+		fmt.Fprintf(t.out, "  %d: %s = <%s>\n", n, w.Expr, w.Err)
+	} else {
+		fmt.Fprintf(t.out, "  %d: %s = %s\n", n, w.Expr, w.Value)
+	}
+}
+
+// 再開するコマンドが来るまで読む
+func (t *terminal) prompt() {
+	for {
+		fmt.Fprint(t.out, "(debug) ")
+		if !t.in.Scan() {
+			fmt.Fprintln(t.out)
+			t.s.Terminate()
+			return
+		}
+		cmd, arg, _ := strings.Cut(strings.TrimSpace(t.in.Text()), " ")
+		arg = strings.TrimSpace(arg)
+		if t.command(cmd, arg) {
+			return
+		}
+	}
+}
+
+// コマンドを1つ実行する（再開したらtrue）
+func (t *terminal) command(cmd string, arg string) bool {
+	var err error
+	switch cmd {
+	case "":
+	case "c", "continue":
+		err = t.s.Continue()
+		return err == nil
+	case "s", "step":
+		err = t.s.StepIn()
+		return err == nil
+	case "n", "next":
+		err = t.s.StepOver()
+		return err == nil
+	case "o", "out":
+		err = t.s.StepOut()
+		return err == nil
+	case "q", "quit":
+		t.s.Terminate()
+		return true
+	case "b", "break":
+		err = t.setBreakpoint(arg)
+	case "d", "delete":
+		row, convErr := strconv.Atoi(arg)
+		switch {
+		case convErr != nil:
+			err = fmt.Errorf("usage: delete ROW")
+		case !t.s.ClearBreakpoint(row):
+			err = fmt.Errorf("no breakpoint at line %d", row)
+		}
+	case "bl", "breakpoints":
+		for _, bp := range t.s.Breakpoints() {
+			fmt.Fprintf(t.out, "%d: line %d", bp.ID, bp.Row)
+			if bp.Condition != "" {
+				fmt.Fprintf(t.out, " if %s", bp.Condition)
+			}
+			fmt.Fprintf(t.out, " (hits %d)\n", bp.Hits)
+		}
+	case "p", "print":
+		var val string
+		if val, err = t.s.Evaluate(arg, 0); err == nil {
+			fmt.Fprintln(t.out, val)
+		}
+	case "w", "watch":
+		if err = t.s.AddWatch(arg); err == nil {
+			if watches, _ := t.s.Watches(); len(watches) > 0 {
+				t.watch(len(watches), watches[len(watches)-1])
+			}
+		}
+	case "unwatch":
+		n, convErr := strconv.Atoi(arg)
+		if convErr != nil || !t.s.RemoveWatch(n-1) {
+			err = fmt.Errorf("no watch expression %s", arg)
+		}
+	case "e", "env":
+		var scopes []Scope
+		if scopes, err = t.s.Scopes(0); err == nil {
+			for _, scope := range scopes {
+				fmt.Fprintf(t.out, "%s:\n", scope.Name)
+				for _, v := range scope.Variables {
+					fmt.Fprintf(t.out, "  %s = %s\n", v.Name, v.Value)
+				}
+			}
+		}
+	case "bt", "stack":
+		var frames []Frame
+		if frames, err = t.s.Stack(); err == nil {
+			for _, f := range frames {
+				fmt.Fprintf(t.out, "#%d %s at %s:%d:%d\n", f.ID, f.Name, t.s.File, f.Row, f.Col)
+			}
+		}
+	case "l", "list":
+		for row := t.row - 3; row <= t.row+3; row++ {
+			if row < 1 || row > len(t.s.Lines) {
+				continue
+			}
+			mark := " "
+			if row == t.row {
+				mark = ">"
+			}
+			fmt.Fprintf(t.out, "%s%4d  %s\n", mark, row, t.s.Line(row))
+		}
+	case "h", "help":
+		fmt.Fprint(t.out, terminalHelp)
+	default:
+		err = fmt.Errorf("unknown command: %s (type help)", cmd)
+	}
+	if err != nil {
+		fmt.Fprintf(t.out, "error: %s\n", err)
+	}
+	return false
+}
+
+// ROW か ROW if EXPR
+func (t *terminal) setBreakpoint(arg string) error {
+	rowText, cond, _ := strings.Cut(arg, " ")
+	cond = strings.TrimSpace(cond)
+	if cond != "" {
+		rest, ok := strings.CutPrefix(cond, "if ")
+		if !ok {
+			return fmt.Errorf("usage: break ROW [if EXPR]")
+		}
+		cond = strings.TrimSpace(rest)
+	}
+	row, err := strconv.Atoi(rowText)
+	if err != nil {
+		return fmt.Errorf("usage: break ROW [if EXPR]")
+	}
+	bp, err := t.s.SetBreakpoint(row, cond)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(t.out, "breakpoint %d at line %d\n", bp.ID, bp.Row)
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"monkey/doc"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/*
+ * doc サブコマンド
+ * ファイルごとにリファレンスページを作って標準出力に出す
+ * -html はHTMLで出し、-o はページを指定したディレクトリに書き出す
+ */
+func runDoc(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("doc", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	asHTML := flags.Bool("html", false, "render HTML instead of Markdown")
+	outDir := flags.String("o", "", "write one page per file into this directory")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		fmt.Fprintln(stderr, "doc: no input files")
+		return 2
+	}
+
+	status := 0
+	for _, path := range flags.Args() {
+		if err := docFile(path, *asHTML, *outDir, stdout); err != nil {
+			fmt.Fprintf(stderr, "%s: %s\n", path, err)
+			status = 1
+		}
+	}
+	return status
+}
+
+func docFile(path string, asHTML bool, outDir string, stdout io.Writer) error {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	file, err := doc.Source(filepath.Base(path), string(src))
+	if err != nil {
+		return err
+	}
+	page, ext := doc.Markdown(file), ".md"
+	if asHTML {
+		page, ext = doc.HTML(file), ".html"
+	}
+	if outDir == "" {
+		fmt.Fprint(stdout, page)
+		return nil
+	}
+	if err := os.MkdirAll(outDir, 0o755); err != nil {
+		return err
+	}
+	base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	return os.WriteFile(filepath.Join(outDir, base+ext), []byte(page), 0o644)
+}
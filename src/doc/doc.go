@@ -0,0 +1,259 @@
+package doc
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/parser"
+	"monkey/token"
+	"strings"
+)
+
+// 宣言の種類
+const (
+	KindConstructor = "constructor" // 本体でメンバを宣言する関数
+	KindFunction    = "function"
+	KindValue       = "value"
+	KindType        = "type"
+)
+
+/*
+ * 1つのファイルのリファレンス
+ * トップレベルの宣言を書かれた順に並べる
+ */
+type File struct {
+	Name    string
+	Entries []*Entry
+}
+
+/*
+ * 宣言1つ分
+ * 直前のコメントを説明として持つ
+ */
+type Entry struct {
+	Name    string
+	Kind    string
+	Decl    string   // imm/mut/const/share/type
+	Public  bool     // pub がついているか
+	Type    string   // 宣言された型（なければ空）
+	Comment []string // 直前のコメントの行
+	Params  []Param  // 関数の引数
+	Returns string   // 関数の戻り値の型（なければ空）
+	Derives []string // コンストラクタが ... で取り込むもの
+	Members []*Entry // コンストラクタの本体で宣言されたメンバ
+	Row     int
+}
+
+// 関数の引数
+type Param struct {
+	Name string
+	Type string // 型の指定がなければ空
+}
+
+/*
+ * ソースを解析してリファレンスを作る
+ */
+func Source(name string, src string) (*File, error) {
+	p := parser.NewParser(src)
+	program, ok := p.ParseProgram()
+	if !ok {
+		return nil, fmt.Errorf("%s", strings.Join(p.Errors(), "\n"))
+	}
+	return Extract(name, program), nil
+}
+
+/*
+ * ASTからリファレンスを作る
+ */
+func Extract(name string, program *ast.Program) *File {
+	return &File{Name: name, Entries: entries(program.Statements, false)}
+}
+
+/*
+ * 文の並びから宣言を取り出す
+ * membersがtrueならコンストラクタの本体（メンバの一覧）
+ */
+func entries(stmts []ast.Statement, members bool) []*Entry {
+	list := []*Entry{}
+	for i, stmt := range stmts {
+		var e *Entry
+		switch s := stmt.(type) {
+		case *ast.LetStatement:
+			e = letEntry(s, members)
+		case *ast.TypeStatement:
+			if members {
+				continue
+			}
+			e = &Entry{Name: s.Ident.Name, Kind: KindType, Decl: "type", Type: s.Value.String(), Row: s.Token.Row}
+		default:
+			continue
+		}
+		e.Comment = docComment(stmts[:i], e.Row)
+		list = append(list, e)
+	}
+	return list
+}
+
+func letEntry(s *ast.LetStatement, member bool) *Entry {
+	e := &Entry{
+		Name:   s.Ident.Name,
+		Kind:   KindValue,
+		Decl:   s.Token.Literal,
+		Public: s.Public,
+		Row:    s.Token.Row,
+	}
+	if s.Ident.Type != nil {
+		e.Type = s.Ident.Type.String()
+	}
+	fn, ok := s.Value.(*ast.FunctionLiteral)
+	if !ok {
+		return e
+	}
+	e.Kind = KindFunction
+	for _, p := range fn.Parameters {
+		param := Param{Name: p.Name}
+		if p.Type != nil {
+			param.Type = p.Type.String()
+		}
+		e.Params = append(e.Params, param)
+	}
+	if fn.ReturnType != nil {
+		e.Returns = fn.ReturnType.String()
+	}
+	// メンバの中の関数はメソッドなので、さらにメンバは探さない
+	if member {
+		return e
+	}
+	for _, stmt := range fn.Body.Statements {
+		if d, ok := stmt.(*ast.DeriveStatement); ok {
+			e.Derives = append(e.Derives, derived(d.Right))
+		}
+	}
+	e.Members = entries(fn.Body.Statements, true)
+	if len(e.Members) > 0 || len(e.Derives) > 0 {
+		e.Kind = KindConstructor
+	}
+	return e
+}
+
+// ...Base(x) の Base
+func derived(e ast.Expression) string {
+	if call, ok := e.(*ast.CallExpression); ok {
+		e = call.Function
+	}
+	if ident, ok := e.(*ast.Identifier); ok {
+		return ident.Name
+	}
+	return e.String()
+}
+
+/*
+ * 宣言の説明になるコメント
+ * 宣言のすぐ上の行で終わるコメントで、前の文の行末のコメントは除く
+ */
+func docComment(before []ast.Statement, row int) []string {
+	if len(before) == 0 {
+		return nil
+	}
+	c, ok := before[len(before)-1].(*ast.CommentStatement)
+	if !ok {
+		return nil
+	}
+	end := c.Token.Row + strings.Count(c.Token.Literal, "\n")
+	if row-end > 1 {
+		return nil
+	}
+	comments := c.Comments
+	// 続けて書いた // は1つのコメントになるので、前の文の行末の分だけ除く
+	if len(before) > 1 && statementEndRow(before[len(before)-2]) == c.Token.Row {
+		if c.Token.Type == token.BLOCK_COMMENT {
+			return nil
+		}
+		comments = comments[1:]
+	}
+	return trimBlank(comments)
+}
+
+// 文の最後の行（分からなければ0）
+func statementEndRow(stmt ast.Statement) int {
+	switch s := stmt.(type) {
+	case *ast.LetStatement:
+		if fn, ok := s.Value.(*ast.FunctionLiteral); ok {
+			return lastRow(fn.Body, s.Token.Row)
+		}
+		return s.Token.Row
+	case *ast.TypeStatement:
+		return s.Token.Row
+	case *ast.ExpressionStatement:
+		return s.Token.Row
+	case *ast.AssignStatement:
+		return s.Token.Row
+	case *ast.DeriveStatement:
+		return s.Token.Row
+	case *ast.ReturnStatement:
+		return s.Token.Row
+	}
+	return 0
+}
+
+// ブロックの最後の文の行（閉じかっこの行は分からないので近い値）
+func lastRow(b *ast.BlockStatement, row int) int {
+	if b == nil || len(b.Statements) == 0 {
+		return row
+	}
+	if last := statementEndRow(b.Statements[len(b.Statements)-1]); last > row {
+		return last
+	}
+	return row
+}
+
+// 前後の空行を除く
+func trimBlank(lines []string) []string {
+	start, end := 0, len(lines)
+	for start < end && strings.TrimSpace(lines[start]) == "" {
+		start++
+	}
+	for end > start && strings.TrimSpace(lines[end-1]) == "" {
+		end--
+	}
+	if start == end {
+		return nil
+	}
+	return lines[start:end]
+}
+
+/*
+ * 宣言の見出しに出すシグネチャ
+ * imm Point = (x:number, y:number):Point
+ */
+func (e *Entry) Signature() string {
+	var out strings.Builder
+	if e.Public {
+		out.WriteString("pub ")
+	}
+	out.WriteString(e.Decl + " " + e.Name)
+	if e.Kind == KindType {
+		return out.String() + " = " + e.Type
+	}
+	if e.Type != "" {
+		out.WriteString(":" + e.Type)
+	}
+	if e.Kind == KindFunction || e.Kind == KindConstructor {
+		params := make([]string, len(e.Params))
+		for i, p := range e.Params {
+			params[i] = p.Name
+			if p.Type != "" {
+				params[i] += ":" + p.Type
+			}
+		}
+		out.WriteString(" = (" + strings.Join(params, ", ") + ")")
+		if e.Returns != "" {
+			out.WriteString(":" + e.Returns)
+		}
+	}
+	return out.String()
+}
+
+// 外から見えるメンバか（immとpubは公開、mutは非公開）
+func (e *Entry) Exported() bool {
+	return e.Public || e.Decl != "mut"
+}
@@ -0,0 +1,145 @@
+package doc
+
+import (
+	"strings"
+	"testing"
+)
+
+var source = `
+/*
+ * 2次元の点
+ *
+ * 原点からの距離を求められる
+ */
+imm Point = (x:number, y:number):Point=>{
+    // x座標
+    imm px:number = x
+    mut py = y // 非公開
+    pub mut label:string = "p"
+    const ORIGIN = 0
+    // 原点からの距離の2乗
+    imm norm = ():number=>{ px * px + py * py }
+    return this
+}
+
+imm Point3 = (x:number, y:number, z:number)=>{
+    ...Point(x, y)
+    imm pz = z
+}
+
+imm a = 1 // aの説明ではない
+// 足し算
+imm add = (a:int, b)=>{ a + b }
+
+// 離れたコメント
+
+type Shape = { area: (n:number) => number }
+mut count:int = 0
+`
+
+func TestExtract(t *testing.T) {
+	f, err := Source("shape.kk", source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, e := range f.Entries {
+		names = append(names, e.Name+":"+e.Kind)
+	}
+	want := "Point:constructor Point3:constructor a:value add:function Shape:type count:value"
+	if got := strings.Join(names, " "); got != want {
+		t.Fatalf("entries wrong.\ngot:  %s\nwant: %s", got, want)
+	}
+
+	point := f.Entries[0]
+	if got := strings.Join(point.Comment, "\n"); got != "2次元の点\n\n原点からの距離を求められる" {
+		t.Errorf("comment wrong. got=%q", got)
+	}
+	if got := point.Signature(); got != "imm Point = (x:number, y:number):Point" {
+		t.Errorf("signature wrong. got=%q", got)
+	}
+	members := []string{}
+	for _, m := range point.Members {
+		members = append(members, m.Name+"|"+memberKind(m)+"|"+memberType(m)+"|"+strings.Join(m.Comment, " "))
+	}
+	wantMembers := []string{
+		"px|public imm|number|x座標",
+		"py|private mut|any|",
+		"label|public mut|string|",
+		"ORIGIN|static const|any|",
+		"norm|public imm|() => number|原点からの距離の2乗",
+	}
+	if strings.Join(members, "\n") != strings.Join(wantMembers, "\n") {
+		t.Errorf("members wrong.\ngot:\n%s\nwant:\n%s", strings.Join(members, "\n"), strings.Join(wantMembers, "\n"))
+	}
+
+	if got := strings.Join(f.Entries[1].Derives, ","); got != "Point" {
+		t.Errorf("derives wrong. got=%q", got)
+	}
+	if f.Entries[2].Comment != nil {
+		t.Errorf("trailing comment attached to next declaration: %q", f.Entries[2].Comment)
+	}
+	add := f.Entries[3]
+	if got := strings.Join(add.Comment, "\n"); got != "足し算" {
+		t.Errorf("comment wrong. got=%q", got)
+	}
+	if len(add.Params) != 2 || add.Params[0] != (Param{"a", "int"}) || add.Params[1] != (Param{"b", ""}) {
+		t.Errorf("params wrong. got=%v", add.Params)
+	}
+	if f.Entries[4].Comment != nil {
+		t.Errorf("separated comment attached: %q", f.Entries[4].Comment)
+	}
+	if got := f.Entries[4].Signature(); got != "type Shape = { area: (n:number) => number }" {
+		t.Errorf("signature wrong. got=%q", got)
+	}
+	if got := f.Entries[5].Signature(); got != "mut count:int" {
+		t.Errorf("signature wrong. got=%q", got)
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	f, err := Source("shape.kk", source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := Markdown(f)
+	for _, want := range []string{
+		"# shape.kk\n",
+		"- [Point](#point) constructor\n",
+		"## Point\n\n```\nimm Point = (x:number, y:number):Point\n```\n\n2次元の点\n\n原点からの距離を求められる\n",
+		"| x | number |\n",
+		"Returns: `Point`\n",
+		"| norm | public imm | `() => number` | 原点からの距離の2乗 |\n",
+		"Derives: Point\n",
+		"| b | any |\n",
+	} {
+		if !strings.Contains(md, want) {
+			t.Errorf("markdown does not contain %q\n%s", want, md)
+		}
+	}
+}
+
+func TestHTML(t *testing.T) {
+	f, err := Source("<x>.kk", "// a < b & c\nimm lt = (a:number, b:number):boolean=>{ a < b }")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := HTML(f)
+	for _, want := range []string{
+		"<title>&lt;x&gt;.kk</title>",
+		"<h2 id=\"lt\">lt</h2>",
+		"<pre><code>imm lt = (a:number, b:number):boolean</code></pre>",
+		"<p>a &lt; b &amp; c</p>",
+		"<p>Returns: <code>boolean</code></p>",
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("html does not contain %q\n%s", want, page)
+		}
+	}
+}
+
+func TestSourceError(t *testing.T) {
+	if _, err := Source("x.kk", "imm = 1"); err == nil {
+		t.Errorf("no error for invalid source")
+	}
+}
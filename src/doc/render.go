@@ -0,0 +1,148 @@
+package doc
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"strings"
+)
+
+/*
+ * Markdownのリファレンスページ
+ * 目次、宣言ごとのシグネチャ、説明、引数、メンバの順に出す
+ */
+func Markdown(f *File) string {
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "# %s\n", f.Name)
+	if len(f.Entries) == 0 {
+		return out.String()
+	}
+
+	out.WriteString("\n")
+	for _, e := range f.Entries {
+		fmt.Fprintf(&out, "- [%s](#%s) %s\n", e.Name, anchor(e.Name), e.Kind)
+	}
+	for _, e := range f.Entries {
+		fmt.Fprintf(&out, "\n## %s\n\n", e.Name)
+		fmt.Fprintf(&out, "```\n%s\n```\n", e.Signature())
+		if len(e.Comment) > 0 {
+			out.WriteString("\n" + strings.Join(e.Comment, "\n") + "\n")
+		}
+		if len(e.Derives) > 0 {
+			fmt.Fprintf(&out, "\nDerives: %s\n", strings.Join(e.Derives, ", "))
+		}
+		if len(e.Params) > 0 {
+			out.WriteString("\n| Parameter | Type |\n| --- | --- |\n")
+			for _, p := range e.Params {
+				fmt.Fprintf(&out, "| %s | %s |\n", p.Name, orAny(p.Type))
+			}
+		}
+		if e.Returns != "" {
+			fmt.Fprintf(&out, "\nReturns: `%s`\n", e.Returns)
+		}
+		if len(e.Members) > 0 {
+			out.WriteString("\n| Member | Kind | Type | Description |\n| --- | --- | --- | --- |\n")
+			for _, m := range e.Members {
+				fmt.Fprintf(&out, "| %s | %s | `%s` | %s |\n",
+					m.Name, memberKind(m), memberType(m), tableCell(strings.Join(m.Comment, " ")))
+			}
+		}
+	}
+	return out.String()
+}
+
+/*
+ * HTMLのリファレンスページ
+ * Markdownと同じ構成で、値はすべてエスケープする
+ */
+func HTML(f *File) string {
+	var out bytes.Buffer
+	name := html.EscapeString(f.Name)
+	out.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n")
+	fmt.Fprintf(&out, "<title>%s</title>\n</head>\n<body>\n<h1>%s</h1>\n", name, name)
+	if len(f.Entries) > 0 {
+		out.WriteString("<ul>\n")
+		for _, e := range f.Entries {
+			fmt.Fprintf(&out, "<li><a href=\"#%s\">%s</a> %s</li>\n", anchor(e.Name), html.EscapeString(e.Name), e.Kind)
+		}
+		out.WriteString("</ul>\n")
+	}
+	for _, e := range f.Entries {
+		fmt.Fprintf(&out, "<h2 id=\"%s\">%s</h2>\n", anchor(e.Name), html.EscapeString(e.Name))
+		fmt.Fprintf(&out, "<pre><code>%s</code></pre>\n", html.EscapeString(e.Signature()))
+		if len(e.Comment) > 0 {
+			fmt.Fprintf(&out, "<p>%s</p>\n", strings.ReplaceAll(html.EscapeString(strings.Join(e.Comment, "\n")), "\n", "<br>\n"))
+		}
+		if len(e.Derives) > 0 {
+			fmt.Fprintf(&out, "<p>Derives: %s</p>\n", html.EscapeString(strings.Join(e.Derives, ", ")))
+		}
+		if len(e.Params) > 0 {
+			out.WriteString("<table>\n<tr><th>Parameter</th><th>Type</th></tr>\n")
+			for _, p := range e.Params {
+				fmt.Fprintf(&out, "<tr><td>%s</td><td><code>%s</code></td></tr>\n", html.EscapeString(p.Name), html.EscapeString(orAny(p.Type)))
+			}
+			out.WriteString("</table>\n")
+		}
+		if e.Returns != "" {
+			fmt.Fprintf(&out, "<p>Returns: <code>%s</code></p>\n", html.EscapeString(e.Returns))
+		}
+		if len(e.Members) > 0 {
+			out.WriteString("<table>\n<tr><th>Member</th><th>Kind</th><th>Type</th><th>Description</th></tr>\n")
+			for _, m := range e.Members {
+				fmt.Fprintf(&out, "<tr><td>%s</td><td>%s</td><td><code>%s</code></td><td>%s</td></tr>\n",
+					html.EscapeString(m.Name), memberKind(m), html.EscapeString(memberType(m)), html.EscapeString(strings.Join(m.Comment, " ")))
+			}
+			out.WriteString("</table>\n")
+		}
+	}
+	out.WriteString("</body>\n</html>\n")
+	return out.String()
+}
+
+// 見出しへのリンク名（英数字以外は - にする）
+func anchor(name string) string {
+	var out strings.Builder
+	for _, c := range strings.ToLower(name) {
+		if c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_' {
+			out.WriteRune(c)
+		} else {
+			out.WriteRune('-')
+		}
+	}
+	return out.String()
+}
+
+// メンバの公開範囲と宣言
+func memberKind(m *Entry) string {
+	switch {
+	case m.Decl == "const" || m.Decl == "share":
+		return "static " + m.Decl
+	case m.Exported():
+		return "public " + m.Decl
+	}
+	return "private " + m.Decl
+}
+
+// メンバの型（関数なら引数と戻り値）
+func memberType(m *Entry) string {
+	if m.Kind != KindFunction {
+		return orAny(m.Type)
+	}
+	params := make([]string, len(m.Params))
+	for i, p := range m.Params {
+		params[i] = p.Name + ":" + orAny(p.Type)
+	}
+	return "(" + strings.Join(params, ", ") + ") => " + orAny(m.Returns)
+}
+
+func orAny(t string) string {
+	if t == "" {
+		return "any"
+	}
+	return t
+}
+
+// 表のセルに入れられるように | をエスケープする
+func tableCell(s string) string {
+	return strings.ReplaceAll(s, "|", "\\|")
+}
@@ -0,0 +1,175 @@
+package evaluator
+
+import (
+	"monkey/object"
+)
+
+/*
+ * テストの組み込み関数
+ * assert(cond, msg)は条件が偽なら、assertEq(actual, expected, msg)は値が違えば失敗する
+ * assertThrows(fn, kind)はfnの呼び出しがエラーにならなければ失敗し、エラーを値として返す
+ * 失敗はAssertionErrorで、呼び出しの位置がつく
+ */
+func init() {
+	builtins["assert"] = &object.Builtin{Fn: func(env *object.Environment, args ...object.Object) object.Object {
+		if len(args) < 1 || len(args) > 2 {
+			return newKindError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=1 or 2", len(args))
+		}
+		if isTruthy(args[0]) {
+			return object.NULL
+		}
+		return assertionError(args[1:], "assertion failed")
+	}}
+	builtins["assertEq"] = &object.Builtin{Fn: func(env *object.Environment, args ...object.Object) object.Object {
+		if len(args) < 2 || len(args) > 3 {
+			return newKindError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=2 or 3", len(args))
+		}
+		if Equal(args[0], args[1]) {
+			return object.NULL
+		}
+		return assertionError(args[2:], "expected %s, got %s", inspect(args[1]), inspect(args[0]))
+	}}
+	builtins["assertThrows"] = &object.Builtin{Fn: func(env *object.Environment, args ...object.Object) object.Object {
+		if len(args) < 1 || len(args) > 2 {
+			return newKindError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=1 or 2", len(args))
+		}
+		switch args[0].(type) {
+		case *object.Function, *object.Builtin:
+		default:
+			return newKindError(object.TYPE_ERROR, "argument to `assertThrows` must be FUNCTION, got %s", args[0].Type())
+		}
+		result := applyFunction(args[0], nil, env)
+		err := errorOf(result)
+		if err == nil {
+			return newKindError(object.ASSERTION_ERROR, "expected an error, got %s", inspect(result))
+		}
+		if isStopError(err) {
+			return err
+		}
+		if len(args) == 2 {
+			// 種類はisと同じく文字列かエラークラス
+			matched := builtins["is"].Fn(env, &object.ErrorValue{Err: err}, args[1])
+			if isError(matched) {
+				return matched
+			}
+			if matched != object.TRUE {
+				return newKindError(object.ASSERTION_ERROR, "expected %s, got %s: %s",
+					inspect(args[1]), err.KindName(), err.Message)
+			}
+		}
+		return &object.ErrorValue{Err: err}
+	}}
+}
+
+// 失敗のメッセージ（msgが渡されていれば前につける）
+func assertionError(msg []object.Object, format string, a ...interface{}) *object.Error {
+	err := newKindError(object.ASSERTION_ERROR, format, a...)
+	if len(msg) > 0 {
+		err.Message = msg[0].Inspect() + ": " + err.Message
+	}
+	return err
+}
+
+// 文字列は引用符をつけて表示する
+func inspect(obj object.Object) string {
+	switch o := obj.(type) {
+	case *object.String:
+		return `"` + o.Value + `"`
+	case *object.Function:
+		return o.DisplayName()
+	}
+	return obj.Inspect()
+}
+
+/*
+ * 値が等しいか
+ * 配列とハッシュは要素を、クラスはコンストラクタとメンバを再帰的に比べる
+ * 関数は同じ関数リテラルから作られたか、ほかの値は同じものかどうか
+ * 自分を含む値は、比べている途中の組にもう一度来たら等しいとみなす
+ */
+func Equal(a object.Object, b object.Object) bool {
+	return equal(a, b, map[[2]object.Object]bool{})
+}
+
+// visitingは比べている途中の配列・ハッシュ・クラスの組
+func equal(a object.Object, b object.Object, visiting map[[2]object.Object]bool) bool {
+	if a == b {
+		return true
+	}
+	switch a.(type) {
+	case *object.Array, *object.Hash, *object.Class:
+		pair := [2]object.Object{a, b}
+		if visiting[pair] {
+			return true
+		}
+		visiting[pair] = true
+		defer delete(visiting, pair)
+	}
+	switch x := a.(type) {
+	case *object.Integer:
+		y, ok := b.(*object.Integer)
+		return ok && x.Value == y.Value
+	case *object.Float:
+		y, ok := b.(*object.Float)
+		return ok && x.Value == y.Value
+	case *object.Complex:
+		y, ok := b.(*object.Complex)
+		return ok && x.Value == y.Value
+	case *object.String:
+		y, ok := b.(*object.String)
+		return ok && x.Value == y.Value
+	case *object.Boolean:
+		y, ok := b.(*object.Boolean)
+		return ok && x.Value == y.Value
+	case *object.Type:
+		y, ok := b.(*object.Type)
+		return ok && x.Name == y.Name
+	case *object.Array:
+		y, ok := b.(*object.Array)
+		if !ok || len(x.Elements) != len(y.Elements) {
+			return false
+		}
+		for i := range x.Elements {
+			if !equal(x.Elements[i], y.Elements[i], visiting) {
+				return false
+			}
+		}
+		return true
+	case *object.Hash:
+		y, ok := b.(*object.Hash)
+		return ok && hashEqual(x, y, visiting)
+	case *object.Class:
+		y, ok := b.(*object.Class)
+		if !ok || x.Constructor() != y.Constructor() {
+			return false
+		}
+		return hashEqual(&x.Hash, &y.Hash, visiting)
+	case *object.Function:
+		// メソッドはインスタンスごとに作られるので、同じ関数リテラルなら等しい
+		y, ok := b.(*object.Function)
+		return ok && x.Body == y.Body
+	case *object.ErrorValue:
+		y, ok := b.(*object.ErrorValue)
+		return ok && x.Err.KindName() == y.Err.KindName() && x.Err.Message == y.Err.Message
+	}
+	return false
+}
+
+func hashEqual(x *object.Hash, y *object.Hash, visiting map[[2]object.Object]bool) bool {
+	size := 0
+	same := true
+	x.Range(func(key *object.Object, val *object.Object) bool {
+		size++
+		other, err := y.Get(*key)
+		same = err == nil && equal(*val, other, visiting)
+		return same
+	})
+	if !same {
+		return false
+	}
+	y.Range(func(*object.Object, *object.Object) bool {
+		size--
+		return true
+	})
+	return size == 0
+}
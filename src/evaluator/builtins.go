@@ -3,12 +3,13 @@ package evaluator
 import (
 	"fmt"
 	"monkey/object"
+	"sort"
 )
 
 var builtins = map[string]*object.Builtin{
-	"len": &object.Builtin{Fn: func(args ...object.Object) object.Object {
+	"len": &object.Builtin{Fn: func(env *object.Environment, args ...object.Object) object.Object {
 		if len(args) != 1 {
-			return newError("wrong number of arguments. got=%d, want=1",
+			return newKindError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=1",
 				len(args))
 		}
 
@@ -18,27 +19,31 @@ var builtins = map[string]*object.Builtin{
 		case *object.String:
 			return &object.Integer{Value: int64(len(arg.Value))}
 		default:
-			return newError("argument to `len` not supported, got %s",
+			return newKindError(object.TYPE_ERROR, "argument to `len` not supported, got %s",
 				args[0].Type())
 		}
 	},
 	},
 	"puts": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
 			for _, arg := range args {
-				fmt.Println(arg.Inspect())
+				line := arg.Inspect()
+				if err := executionOf(env).write(len(line) + 1); err != nil {
+					return err
+				}
+				fmt.Println(line)
 			}
 			return object.NULL
 		},
 	},
 	"first": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
 			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1",
+				return newKindError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=1",
 					len(args))
 			}
 			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `first` must be ARRAY, got %s",
+				return newKindError(object.TYPE_ERROR, "argument to `first` must be ARRAY, got %s",
 					args[0].Type())
 			}
 
@@ -51,13 +56,13 @@ var builtins = map[string]*object.Builtin{
 		},
 	},
 	"last": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
 			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1",
+				return newKindError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=1",
 					len(args))
 			}
 			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `last` must be ARRAY, got %s",
+				return newKindError(object.TYPE_ERROR, "argument to `last` must be ARRAY, got %s",
 					args[0].Type())
 			}
 
@@ -71,13 +76,13 @@ var builtins = map[string]*object.Builtin{
 		},
 	},
 	"rest": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
 			if len(args) != 1 {
-				return newError("wrong number of arguments. got=%d, want=1",
+				return newKindError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=1",
 					len(args))
 			}
 			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `rest` must be ARRAY, got %s",
+				return newKindError(object.TYPE_ERROR, "argument to `rest` must be ARRAY, got %s",
 					args[0].Type())
 			}
 
@@ -93,19 +98,22 @@ var builtins = map[string]*object.Builtin{
 		},
 	},
 	"push": &object.Builtin{
-		Fn: func(args ...object.Object) object.Object {
+		Fn: func(env *object.Environment, args ...object.Object) object.Object {
 			if len(args) != 2 {
-				return newError("wrong number of arguments. got=%d, want=2",
+				return newKindError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=2",
 					len(args))
 			}
 			if args[0].Type() != object.ARRAY_OBJ {
-				return newError("argument to `push` must be ARRAY, got %s",
+				return newKindError(object.TYPE_ERROR, "argument to `push` must be ARRAY, got %s",
 					args[0].Type())
 			}
 
 			arr := args[0].(*object.Array)
 			length := len(arr.Elements)
 
+			if err := executionOf(env).allocate(length + 2); err != nil {
+				return err
+			}
 			newElements := make([]object.Object, length+1, length+1)
 			copy(newElements, arr.Elements)
 			newElements[length] = args[1]
@@ -114,3 +122,13 @@ var builtins = map[string]*object.Builtin{
 		},
 	},
 }
+
+// 組み込み関数の名前を辞書順で返す（エディタの補完に使う）
+func BuiltinNames() []string {
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
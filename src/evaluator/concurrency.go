@@ -0,0 +1,428 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+	"reflect"
+	"runtime"
+	"time"
+)
+
+/*
+ * インタプリタのロック
+ * 実行ごとに1つあり、環境やハッシュはロックを持っているgoroutineだけが触る
+ * タスクはチャンネルやawaitで待つ間と、何回かの関数呼び出しごとにロックを手放す
+ * 別の実行は別のロックなので、入れ子の評価や並行したEvalContextは待たない
+ */
+
+// ロックを取る
+// 待っている間に実行が止められたら取らずにfalseを返す
+func (e *Execution) lock() bool {
+	select {
+	case e.locked <- struct{}{}:
+		return true
+	case <-e.done():
+		return false
+	}
+}
+
+func (e *Execution) unlock() { <-e.locked }
+
+// 待つ処理の間だけロックを手放す
+// waitには実行が止められたときに閉じるチャンネルを渡す
+// 止められていても後始末のためにロックは取り直す
+func (e *Execution) blocking(wait func(done <-chan struct{})) {
+	e.unlock()
+	defer func() { e.locked <- struct{}{} }()
+	wait(e.done())
+}
+
+// 他のタスクに順番を回す関数呼び出しの間隔
+const yieldInterval = 1000
+
+// 関数呼び出しのたびに呼び、ときどき他のタスクに順番を回す
+func (e *Execution) yieldToTasks() {
+	e.calls++
+	if e.calls%yieldInterval == 0 {
+		e.blocking(func(<-chan struct{}) { runtime.Gosched() })
+	}
+}
+
+/*
+ * デッドロックの検出
+ * すべてのタスクがチャンネルやタスクを待っていたら、どれも進めない
+ * 起こされたタスクが待ち終わったと数えるまでには少し間があるので、
+ * しばらく待ち終わりがないのを確かめてから進めなくなったことにする
+ * 評価と評価の間は次の評価が送るかもしれないので、トップレベルを評価している間だけ調べる
+ * そのときはstalledを閉じて、待っているタスクすべてにdeadlockのエラーを返す
+ */
+
+// 進めなくなったと決めるまでに待ち終わりを待つ時間
+const stallDelay = 10 * time.Millisecond
+
+// タスクを始めたときと終えたときに呼ぶ
+// topはトップレベルの評価のとき
+func (e *Execution) started(top bool) {
+	e.waits.Lock()
+	defer e.waits.Unlock()
+	e.running++
+	if top {
+		e.evaluating = true
+	}
+}
+
+func (e *Execution) finished(top bool) {
+	e.waits.Lock()
+	defer e.waits.Unlock()
+	e.running--
+	if top {
+		e.evaluating = false
+	}
+	e.checkStall()
+}
+
+// 進めなくなっているかもしれない
+// waitsを持って呼ぶ
+func (e *Execution) stuck() bool {
+	return e.evaluating && e.waiting == e.running
+}
+
+// waitsを持って呼ぶ
+func (e *Execution) checkStall() {
+	if e.stuck() && !e.watching {
+		e.watching = true
+		go e.watchStall(e.wakes)
+	}
+}
+
+func (e *Execution) watchStall(wakes uint64) {
+	for {
+		time.Sleep(stallDelay)
+		e.waits.Lock()
+		if !e.stuck() {
+			e.watching = false
+			e.waits.Unlock()
+			return
+		}
+		if e.wakes == wakes {
+			close(e.stalled)
+			e.watching = false
+			e.waits.Unlock()
+			return
+		}
+		wakes = e.wakes
+		e.waits.Unlock()
+	}
+}
+
+// チャンネルやタスクを待つ間だけロックを手放す
+// waitは待ち終わったらfalse、doneかstalledが閉じてやめたらtrueを返す
+// 実行が止められたらCanceled、進めなくなったらdeadlockのエラーを返す
+func (e *Execution) wait(wait func(done, stalled <-chan struct{}) bool) *object.Error {
+	e.waits.Lock()
+	e.waiting++
+	stalled := e.stalled
+	e.checkStall()
+	e.waits.Unlock()
+
+	stopped := false
+	e.blocking(func(done <-chan struct{}) {
+		stopped = wait(done, stalled)
+		// ロックを取り直す前に数え直す
+		e.waits.Lock()
+		defer e.waits.Unlock()
+		e.waiting--
+		e.wakes++
+		// 待っているタスクすべてに知らせたら、次に待つときのために作り直す
+		select {
+		case <-e.stalled:
+			if e.waiting == 0 {
+				e.stalled = make(chan struct{})
+			}
+		default:
+		}
+	})
+	if !stopped {
+		return nil
+	}
+	if e.ctx.Err() != nil {
+		return e.canceled()
+	}
+	return newError("deadlock: all tasks are waiting")
+}
+
+/*
+ * spawn
+ * 関数と引数はここで評価して、呼び出しは別のgoroutineで行う
+ */
+func evalSpawnExpression(node *ast.SpawnExpression, env *object.Environment) object.Object {
+	function := Eval(node.Call.Function, env)
+	if isError(function) {
+		return function
+	}
+	args := evalExpressions(node.Call.Arguments, env)
+	if len(args) == 1 && isError(args[0]) {
+		return args[0]
+	}
+
+	name := "$unnamed"
+	switch fn := function.(type) {
+	case *object.Function:
+		name = fn.DisplayName()
+	case *object.Builtin:
+		name = "builtin"
+	default:
+		return newKindError(object.TYPE_ERROR, "not a function: %s", function.Type())
+	}
+
+	// タスクは呼び出し元と同じ実行で動き、実行が終わるときに止められる
+	// 呼び出しの深さはタスクごとに数えるので、呼び出し元の環境とは別の環境から呼ぶ
+	exec := executionOf(env)
+	taskEnv := object.NewEnvironment()
+	taskEnv.SetRuntime(exec)
+	task := object.NewTask(name)
+	exec.tasks.Add(1)
+	exec.started(false)
+	go func() {
+		defer exec.tasks.Done()
+		defer exec.finished(false)
+		if !exec.lock() {
+			task.Finish(canceledError(exec.ctx))
+			return
+		}
+		defer exec.unlock()
+		result := applyFunction(function, args, taskEnv)
+		if result == nil {
+			result = object.NULL
+		}
+		task.Finish(result)
+	}()
+	return task
+}
+
+// タスクの終わりを待って結果を返す
+func awaitTask(exec *Execution, obj object.Object) object.Object {
+	task, ok := obj.(*object.Task)
+	if !ok {
+		return newError("await requires a task, got %s", obj.Type())
+	}
+	if err := exec.wait(func(done, stalled <-chan struct{}) bool {
+		select {
+		case <-task.Done():
+			return false
+		case <-done:
+		case <-stalled:
+		}
+		return true
+	}); err != nil {
+		return err
+	}
+	return task.Result()
+}
+
+// チャンネルに送る
+func channelSend(exec *Execution, ch *object.Channel, val object.Object) object.Object {
+	if ch.IsClosed() {
+		return newError("send on closed channel")
+	}
+	var result object.Object = object.NULL
+	if err := exec.wait(func(done, stalled <-chan struct{}) (stopped bool) {
+		// 待っている間に閉じられることもある
+		defer func() {
+			if recover() != nil {
+				result = newError("send on closed channel")
+			}
+		}()
+		select {
+		case ch.Chan() <- val:
+			return false
+		case <-done:
+		case <-stalled:
+		}
+		return true
+	}); err != nil {
+		return err
+	}
+	return result
+}
+
+// チャンネルから受け取る
+// 閉じられていて値がなければfalse
+// 待っている間に実行が止められたらエラーを値として返す
+func channelRecv(exec *Execution, ch *object.Channel) (object.Object, bool) {
+	var val object.Object
+	var ok bool
+	if err := exec.wait(func(done, stalled <-chan struct{}) bool {
+		select {
+		case val, ok = <-ch.Chan():
+			return false
+		case <-done:
+		case <-stalled:
+		}
+		return true
+	}); err != nil {
+		return err, true
+	}
+	return val, ok
+}
+
+/*
+ * チャンネルのメソッド
+ * recv()は閉じられたチャンネルからはundefinedを返す
+ */
+func channelMethod(ch *object.Channel, name string) object.Object {
+	switch name {
+	case "send":
+		return &object.Builtin{Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newKindError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=1", len(args))
+			}
+			return channelSend(executionOf(env), ch, args[0])
+		}}
+	case "recv":
+		return &object.Builtin{Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if val, ok := channelRecv(executionOf(env), ch); ok {
+				return val
+			}
+			return object.UNDEFINED
+		}}
+	case "close":
+		return &object.Builtin{Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			if !ch.Close() {
+				return newError("close of closed channel")
+			}
+			return object.NULL
+		}}
+	}
+	return newError("unknown channel method: %s", name)
+}
+
+/*
+ * select
+ * 準備のできたcaseを1つ実行する。なければdefaultか、どれかの準備ができるまで待つ
+ * breakはselectを抜けるだけ
+ */
+func evalSelectStatement(node *ast.SelectStatement, env *object.Environment) object.Object {
+	cases := []reflect.SelectCase{}
+	clauses := []*ast.SelectCase{}
+	var defaultClause *ast.SelectCase
+
+	for _, c := range node.Cases {
+		if c.IsDefault() {
+			defaultClause = c
+			continue
+		}
+		val := Eval(c.Channel, env)
+		if isError(val) {
+			return val
+		}
+		ch, ok := val.(*object.Channel)
+		if !ok {
+			return newError("select requires a channel, got %s", val.Type())
+		}
+		sc := reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch.Chan())}
+		if c.Send {
+			if ch.IsClosed() {
+				return newError("send on closed channel")
+			}
+			sent := Eval(c.Value, env)
+			if isError(sent) {
+				return sent
+			}
+			sc.Dir = reflect.SelectSend
+			sc.Send = reflect.ValueOf(&sent).Elem()
+		}
+		cases = append(cases, sc)
+		clauses = append(clauses, c)
+	}
+	if defaultClause != nil {
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectDefault})
+	}
+	if len(cases) == 0 {
+		return newError("select with no cases")
+	}
+
+	var chosen int
+	var received reflect.Value
+	var ok bool
+	var closedErr object.Object
+	exec := executionOf(env)
+	err := exec.wait(func(done, stalled <-chan struct{}) bool {
+		defer func() {
+			if recover() != nil {
+				closedErr = newError("send on closed channel")
+			}
+		}()
+		// 最後の2つのcaseは実行が止められたときと進めなくなったとき
+		cases = append(cases,
+			reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(done)},
+			reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(stalled)})
+		chosen, received, ok = reflect.Select(cases)
+		return chosen >= len(cases)-2
+	})
+	if closedErr != nil {
+		return closedErr
+	}
+	if err != nil {
+		return err
+	}
+
+	clause := defaultClause
+	blockEnv := object.NewBlockEnvironment(env)
+	if chosen < len(clauses) {
+		clause = clauses[chosen]
+		if clause.Binding != nil {
+			var val object.Object = object.UNDEFINED
+			if ok {
+				val = received.Interface().(object.Object)
+			}
+			blockEnv.Set(clause.Binding.Name, val)
+		}
+	}
+
+	result := Eval(clause.Body, blockEnv)
+	if brk, ok := result.(*object.Break); ok && brk.Label == "" {
+		return nil
+	}
+	return result
+}
+
+/*
+ * 並行処理の組み込み関数
+ */
+func init() {
+	builtins["channel"] = &object.Builtin{Fn: func(env *object.Environment, args ...object.Object) object.Object {
+		if len(args) > 1 {
+			return newKindError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=0 or 1", len(args))
+		}
+		size := int64(0)
+		if len(args) == 1 {
+			n, ok := args[0].(*object.Integer)
+			if !ok || n.Value < 0 {
+				return newKindError(object.TYPE_ERROR, "argument to `channel` must be a non-negative INTEGER, got %s", args[0].Inspect())
+			}
+			size = n.Value
+		}
+		return object.NewChannel(int(size))
+	}}
+	// すべてのタスクを待って結果を配列で返す（エラーがあれば最初のエラー）
+	builtins["join"] = &object.Builtin{Fn: func(env *object.Environment, args ...object.Object) object.Object {
+		if len(args) == 1 {
+			if arr, ok := args[0].(*object.Array); ok {
+				args = arr.Elements
+			}
+		}
+		results := make([]object.Object, len(args))
+		var firstErr object.Object
+		for i, arg := range args {
+			results[i] = awaitTask(executionOf(env), arg)
+			if isError(results[i]) && firstErr == nil {
+				firstErr = results[i]
+			}
+		}
+		if firstErr != nil {
+			return firstErr
+		}
+		return &object.Array{Elements: results}
+	}}
+}
@@ -0,0 +1,42 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+)
+
+// ソースの位置（トークンの行と列）
+type Position struct {
+	Row int
+	Col int
+}
+
+/*
+ * カバレッジの記録
+ * 実行した文と、実行したブロック（if/elif/elseの本体、ループの本体、switchのcase、
+ * matchの腕、selectのcase、関数の本体）の回数をトークンの位置ごとに数える
+ * ブロックの位置は { の位置
+ * 実行を見るものとしてOptionsに渡す
+ */
+type Coverage struct {
+	Statements map[Position]int
+	Blocks     map[Position]int
+}
+
+func NewCoverage() *Coverage {
+	return &Coverage{Statements: map[Position]int{}, Blocks: map[Position]int{}}
+}
+
+func (c *Coverage) Node(node ast.Node, env *object.Environment) {
+	switch node := node.(type) {
+	case *ast.BlockStatement:
+		c.Blocks[Position{node.Token.Row, node.Token.Col}]++
+	case *ast.CommentStatement:
+	case ast.Statement:
+		t := ast.NodeToken(node)
+		c.Statements[Position{t.Row, t.Col}]++
+	}
+}
+
+func (c *Coverage) Leave(*object.Frame) {}
+func (c *Coverage) Allocate(int)        {}
@@ -12,6 +12,24 @@ func newError(format string, a ...interface{}) *object.Error {
 	return &object.Error{Message: fmt.Sprintf(format, a...)}
 }
 
+// 種類つきのエラーオブジェクトを返す
+func newKindError(kind string, format string, a ...interface{}) *object.Error {
+	return &object.Error{Kind: kind, Message: fmt.Sprintf(format, a...)}
+}
+
+// ハッシュや環境の操作の失敗をエラーオブジェクトにする
+func hashError(err *object.HashError) *object.Error {
+	switch {
+	case err.Is(object.NotFound):
+		return newKindError(object.NAME_ERROR, "%s", err.Error())
+	case err.Is(object.ReadOnly):
+		return newKindError(object.ACCESS_ERROR, "%s", err.Error())
+	case err.Is(object.InvalidKey):
+		return newKindError(object.TYPE_ERROR, "%s", err.Error())
+	}
+	return newError("%s", err.Error())
+}
+
 /*
  * エラーオブジェクトかどうか調べる
  */
@@ -21,3 +39,144 @@ func isError(obj object.Object) bool {
 	}
 	return false
 }
+
+// 値としてのエラーかエラーから中身を取り出す（エラーでなければnil）
+func errorOf(obj object.Object) *object.Error {
+	switch o := obj.(type) {
+	case *object.ErrorValue:
+		return o.Err
+	case *object.Error:
+		return o
+	}
+	return nil
+}
+
+// エラーか包まれた元のエラーがクラスのインスタンスか
+func errorInstanceOf(err *object.Error, fn *object.Function) bool {
+	return err.Is(func(e *object.Error) bool {
+		return e.Class != nil && e.Class.InstanceOf(fn)
+	})
+}
+
+/*
+ * 値としてのエラーのプロパティ
+ * kind, message, cause, deferredのほかはエラークラスのメンバ（なければnil）
+ */
+func errorMember(ev *object.ErrorValue, name string) object.Object {
+	switch name {
+	case "kind":
+		return &object.String{Value: ev.Err.KindName()}
+	case "message":
+		return &object.String{Value: ev.Err.Message}
+	case "cause":
+		if ev.Err.Cause == nil {
+			return object.NULL
+		}
+		return &object.ErrorValue{Err: ev.Err.Cause}
+	case "deferred":
+		errs := make([]object.Object, len(ev.Err.Deferred))
+		for i, err := range ev.Err.Deferred {
+			errs[i] = &object.ErrorValue{Err: err}
+		}
+		return &object.Array{Elements: errs}
+	}
+	return nil
+}
+
+/*
+ * エラーの組み込み関数
+ * error(kind, msg)で作り、wrap(err, msg)で包み、is(err, kind)で調べる
+ * try(fn, ...)は呼び出しのエラーを値として返し、throw(err)は値をエラーとして投げる
+ */
+func init() {
+	builtins["error"] = &object.Builtin{Fn: func(env *object.Environment, args ...object.Object) object.Object {
+		if len(args) < 1 || len(args) > 2 {
+			return newKindError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=1 or 2", len(args))
+		}
+		err := &object.Error{}
+		switch kind := args[0].(type) {
+		case *object.String:
+			err.Kind = kind.Value
+		case *object.Class:
+			// エラークラスのインスタンス。メッセージは message メンバから取る
+			err.Kind = kind.ClassName()
+			err.Class = kind
+			if msg, e := kind.Hash.Get(&object.String{Value: "message"}); e == nil {
+				if s, ok := msg.(*object.String); ok {
+					err.Message = s.Value
+				}
+			}
+		default:
+			return newKindError(object.TYPE_ERROR, "argument to `error` must be STRING or CLASS, got %s", args[0].Type())
+		}
+		if len(args) == 2 {
+			msg, ok := args[1].(*object.String)
+			if !ok {
+				return newKindError(object.TYPE_ERROR, "argument to `error` must be STRING, got %s", args[1].Type())
+			}
+			err.Message = msg.Value
+		}
+		return &object.ErrorValue{Err: err}
+	}}
+	builtins["wrap"] = &object.Builtin{Fn: func(env *object.Environment, args ...object.Object) object.Object {
+		if len(args) != 2 {
+			return newKindError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=2", len(args))
+		}
+		cause := errorOf(args[0])
+		if cause == nil {
+			return newKindError(object.TYPE_ERROR, "argument to `wrap` must be ERROR_VALUE, got %s", args[0].Type())
+		}
+		msg, ok := args[1].(*object.String)
+		if !ok {
+			return newKindError(object.TYPE_ERROR, "argument to `wrap` must be STRING, got %s", args[1].Type())
+		}
+		// 種類は元のエラーのものを引き継ぐ
+		return &object.ErrorValue{Err: &object.Error{
+			Kind:    cause.Kind,
+			Message: msg.Value + ": " + cause.Message,
+			Cause:   cause,
+		}}
+	}}
+	builtins["is"] = &object.Builtin{Fn: func(env *object.Environment, args ...object.Object) object.Object {
+		if len(args) != 2 {
+			return newKindError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=2", len(args))
+		}
+		err := errorOf(args[0])
+		if err == nil {
+			return object.FALSE
+		}
+		switch target := args[1].(type) {
+		case *object.String:
+			// Errorはすべてのエラーに当てはまる
+			return evalBoolLiteral(target.Value == object.ERROR || err.Is(func(e *object.Error) bool {
+				return e.Kind == target.Value
+			}))
+		case *object.Function:
+			return evalBoolLiteral(errorInstanceOf(err, target))
+		case *object.ErrorValue:
+			return evalBoolLiteral(err.Is(func(e *object.Error) bool { return e == target.Err }))
+		}
+		return newKindError(object.TYPE_ERROR, "argument to `is` must be STRING, FUNCTION or ERROR_VALUE, got %s", args[1].Type())
+	}}
+	builtins["try"] = &object.Builtin{Fn: func(env *object.Environment, args ...object.Object) object.Object {
+		if len(args) < 1 {
+			return newKindError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=1 or more", len(args))
+		}
+		result := applyFunction(args[0], args[1:], env)
+		// 制限やcontextで止められたときは止まったままにする
+		if err, ok := result.(*object.Error); ok && !isStopError(err) {
+			return &object.ErrorValue{Err: err}
+		}
+		return result
+	}}
+	builtins["throw"] = &object.Builtin{Fn: func(env *object.Environment, args ...object.Object) object.Object {
+		if len(args) != 1 {
+			return newKindError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=1", len(args))
+		}
+		ev, ok := args[0].(*object.ErrorValue)
+		if !ok {
+			return newKindError(object.TYPE_ERROR, "argument to `throw` must be ERROR_VALUE, got %s", args[0].Type())
+		}
+		return ev.Err
+	}}
+}
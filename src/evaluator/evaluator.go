@@ -1,22 +1,20 @@
 package evaluator
 
 import (
-	"math/rand"
 	"monkey/ast"
 	"monkey/object"
 )
 
-const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-
-func RandString(n int) string {
-	b := make([]byte, n)
-	for i := range b {
-		b[i] = letters[rand.Intn(len(letters))]
+func Eval(node ast.Node, env *object.Environment) object.Object {
+	// 実行の制限を調べる
+	exec := executionOf(env)
+	if err := exec.step(); err != nil {
+		return err
+	}
+	if exec.observer != nil {
+		exec.observer.Node(node, env)
 	}
-	return string(b)
-}
 
-func Eval(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 
 	//
@@ -32,16 +30,26 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return Eval(node.Expression, env)
 
 	case *ast.ReturnStatement:
+		if call, ok := node.ReturnValue.(*ast.CallExpression); ok &&
+			env.Frame() != nil && env.Yield() == nil && !env.HasDefers() {
+			val := evalTailCall(call, env)
+			if isError(val) {
+				return val
+			}
+			return &object.ReturnValue{Value: val}
+		}
 		val := Eval(node.ReturnValue, env)
 		if isError(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
 
+	case *ast.DeferStatement:
+		return evalDeferStatement(node, env)
 	case *ast.BreakStatement:
-		return &object.Break{}
+		return evalBreakStatement(node, env)
 	case *ast.ContinueStatement:
-		return &object.Continue{}
+		return &object.Continue{Label: labelName(node.Label)}
 	case *ast.LetStatement:
 		return evalLetStatement(node, env)
 	case *ast.DeriveStatement:
@@ -50,6 +58,10 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return evalAssignStatement(node, env)
 	case *ast.LoopStatement:
 		return evalLoopStatement(node, env)
+	case *ast.TypeStatement:
+		return evalTypeStatement(node, env)
+	case *ast.SwitchStatement:
+		return evalSwitchStatement(node, env)
 
 	//
 	// Literal
@@ -69,24 +81,28 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
 
+	case *ast.TemplateLiteral:
+		return evalTemplateLiteral(node, env)
+
 	case *ast.BooleanLiteral:
 		return evalBoolLiteral(node.Value)
 
 	case *ast.FunctionLiteral:
-		params := node.Parameters
-		body := node.Body
-		name := "function-" + RandString(16)
-		return &object.Function{
-			Parameters: params,
-			Env:        env,
-			Body:       body,
-			Name:       name,
+		// 名前は束縛されたときにつく
+		if err := executionOf(env).allocate(1); err != nil {
+			return err
 		}
+		fn := object.NewFunction(node.Parameters, node.Body, env)
+		fn.Generator = node.Generator
+		return fn
 	case *ast.ArrayLiteral:
 		elements := evalExpressions(node.Elements, env)
 		if len(elements) == 1 && isError(elements[0]) {
 			return elements[0]
 		}
+		if err := executionOf(env).allocate(len(elements) + 1); err != nil {
+			return err
+		}
 		return &object.Array{Elements: elements}
 
 	case *ast.HashLiteral:
@@ -100,7 +116,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		if isError(right) {
 			return right
 		}
-		return evalPrefixExpression(node.Operator, right)
+		return evalPrefixExpression(node.Operator, right, env)
 
 	case *ast.InfixExpression:
 		return evalInfixExpression(node, env)
@@ -111,12 +127,24 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.IfExpression:
 		return evalIfExpression(node, env)
 
+	case *ast.SpawnExpression:
+		return evalSpawnExpression(node, env)
+	case *ast.SelectStatement:
+		return evalSelectStatement(node, env)
+	case *ast.YieldExpression:
+		return evalYieldExpression(node, env)
+	case *ast.MatchExpression:
+		return evalMatchExpression(node, env)
+
 	case *ast.CallExpression:
 		return evalCallExpression(node, env)
 
 	case *ast.DotExpression:
 		return evalDotExpression(node, env)
 
+	case *ast.MetaExpression:
+		return evalMetaExpression(node, env)
+
 	//
 	// identifier
 	//
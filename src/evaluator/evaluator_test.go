@@ -2,11 +2,15 @@ package evaluator
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"monkey/ast"
 	"monkey/object"
 	"monkey/parser"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestEvaluator(t *testing.T) {
@@ -200,3 +204,1122 @@ func TestEvaluator(t *testing.T) {
 		fmt.Printf("%s", out.String())
 	}
 }
+
+// 入力を評価して結果を返す
+func testEval(t *testing.T, input string) object.Object {
+	t.Helper()
+	p := parser.NewParser(input)
+	program, ok := p.ParseProgram()
+	if !ok {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return Eval(program, object.NewEnvironment())
+}
+
+// 評価結果を文字列で比較する
+func testInspect(t *testing.T, input string, expected string) {
+	t.Helper()
+	result := testEval(t, input)
+	if result == nil {
+		t.Fatalf("result is nil. want=%q", expected)
+	}
+	if result.Inspect() != expected {
+		t.Errorf("result wrong. got=%q, want=%q", result.Inspect(), expected)
+	}
+}
+
+func TestStaticMembers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// constは最初の一回だけ評価される
+		{`
+		mut count = 0;
+		imm A = ()=>{
+			count = count + 1;
+			const HOGE = count;
+			return this;
+		}
+		A(); A(); A();
+		[A.HOGE, count]
+		`, "[1, 3]"},
+		// shareは全インスタンスで共有される
+		{`
+		imm A = ()=>{
+			share total = 0;
+			total = total + 1;
+			imm get = ()=>{ return total; }
+			return this;
+		}
+		imm a = A();
+		imm b = A();
+		[a.get(), b.get(), A.total]
+		`, "[2, 2, 2]"},
+		// 外から書き換えたshareはインスタンスからも見える
+		{`
+		imm A = ()=>{
+			share total = 0;
+			imm get = ()=>{ return total; }
+			return this;
+		}
+		imm a = A();
+		A.total = 10;
+		a.get()
+		`, "10"},
+		// 静的メンバはインスタンスのメンバにならない
+		{`
+		imm A = ()=>{
+			const HOGE = 1;
+			return this;
+		}
+		A().HOGE
+		`, "undefined"},
+		{`
+		imm A = ()=>{
+			const HOGE = 1;
+			return this;
+		}
+		A();
+		A.HOGE = 2;
+		`, "ERROR: cannot assign to immutable: HOGE"},
+		{`
+		imm A = ()=>{
+			const HOGE = 1;
+			HOGE = 2;
+			return this;
+		}
+		A();
+		`, "ERROR: cannot assign to immutable: HOGE"},
+		{`imm a = 1; a = 2;`, "ERROR: cannot assign to immutable: a"},
+		{`const HOGE = 1;`, "ERROR: const declaration outside of a function: HOGE on line 1 col 1"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, tt.input, tt.expected)
+	}
+}
+
+func TestMemberVisibility(t *testing.T) {
+	class := `
+	imm A = ()=>{
+		mut count = 0;
+		pub mut label = "a";
+		imm name = "A";
+		imm inc = ()=>{
+			count = count + 1;
+			return count;
+		}
+		imm peek = (other:any)=>{
+			return other.count;
+		}
+		return this;
+	}
+	imm a = A();
+	`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// immは公開
+		{`a.name`, "A"},
+		// mutはメソッド経由なら変更できる
+		{`a.inc(); a.inc()`, "2"},
+		// 外からmutは読めないし書けない
+		{`a.count`, "ERROR: cannot access private member: A.count"},
+		{`a.count = 3;`, "ERROR: cannot access private member: A.count"},
+		// immは外から書けない
+		{`a.name = "B";`, "ERROR: cannot assign to immutable: name"},
+		// pubをつけたmutは外から読み書きできる
+		{`a.label = "b"; a.label`, "b"},
+		// 別のインスタンスのmutは内側からでも見えない
+		{`a.peek(A())`, "ERROR: cannot access private member: A.count"},
+		{`a.peek(a)`, "0"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, class+tt.input, tt.expected)
+	}
+}
+
+func TestReflection(t *testing.T) {
+	classes := `
+	imm A = ()=>{
+		mut a:number = 1;
+		return this;
+	}
+	imm D = ()=>{
+		imm d = 1;
+		return this;
+	}
+	imm B = ()=>{
+		...A();
+		pub mut b:string = "x";
+		return this;
+	}
+	imm E = ()=>{
+		...B();
+		...D();
+		return this;
+	}
+	imm e = E();
+	`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`e.@name == E.@name`, "true"},
+		{`e.@constructor == E`, "true"},
+		{`e.@parent == B`, "true"},
+		// 派生した順（近いものから）
+		{`[e.@parents[0] == B, e.@parents[1] == A, e.@parents[2] == D]`, "[true, true, true]"},
+		{`e.@parents[0] == e.@parent`, "true"},
+		{`e.@parents[1].@name`, "A"},
+		// 名前のない関数はクラスと同じく$unnamed
+		{`[E.@name, (()=>{ 1 }).@name, (()=>{ return this })().@name]`, "[E, $unnamed, $unnamed]"},
+		{`A().@parents`, "[]"},
+		{`A().@parent`, "undefined"},
+		{`e.@members`, "[" +
+			"{name: a, mutable: true, public: false, type: number}, " +
+			"{name: b, mutable: true, public: true, type: string}, " +
+			"{name: d, mutable: false, public: true, type: undefined}]"},
+		{`[1.@type, "a".@type, e.@type, E.@type]`, "[integer, string, class, function]"},
+		{`e.@foo`, "ERROR: unknown meta property: class.@foo"},
+		{`1.@name`, "ERROR: unknown meta property: integer.@name"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, classes+tt.input, tt.expected)
+	}
+}
+
+func TestClassIdentity(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// 関数の名前は束縛した名前になる
+		{`imm ClassA = ()=>{ return this; }; ClassA.@name`, "ClassA"},
+		{`imm ClassA = ()=>{ imm a = 1; return this; }; ClassA()`, "ClassA{a: 1}from ()"},
+		// 別名で束縛しても名前は変わらない
+		{`imm ClassA = ()=>{ return this; }; imm b = ClassA; b().@name`, "ClassA"},
+		{`imm f = ()=>{ return this; }(); f.@name`, "$unnamed"},
+		// 派生元も名前で表示される
+		{`
+		imm ClassA = ()=>{ return this; }
+		imm ClassB = ()=>{ ...ClassA(); return this; }
+		ClassB()
+		`, "ClassB{}from (ClassA)"},
+		// 同じ名前でも別の関数なら別のクラス
+		{`
+		imm make = ()=>{
+			imm Same = ()=>{ return this; }
+			return Same;
+		}
+		imm A = make();
+		imm B = make();
+		[A().@name == B().@name, A() instanceof A, A() instanceof B]
+		`, "[true, true, false]"},
+		// 作られたインスタンスを返すだけの関数はクラスを変えない
+		{`
+		imm ClassA = ()=>{ return this; }
+		imm factory = ()=>{ return ClassA(); }
+		imm a = factory();
+		[a.@name, a instanceof ClassA, a instanceof factory]
+		`, "[ClassA, true, false]"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, tt.input, tt.expected)
+	}
+}
+
+func TestAbstractMembersAndImplements(t *testing.T) {
+	classes := `
+	type Sounds = { sound:(count:number)=>string }
+	type Named = { name:string, sounds:Sounds[] }
+	imm Animal = ()=>{
+		imm sound:(count:number)=>string;
+		imm legs = 4;
+		return this;
+	}
+	imm Duck = ()=>{
+		...Animal();
+		imm sound = (count:number)=>{ return "quack"; }
+		return this;
+	}
+	imm Stone = ()=>{
+		...Animal();
+		return this;
+	}
+	`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// 抽象メンバを実装していればインスタンスを作れる
+		{`Duck().legs`, "4"},
+		{`Animal()`, "ERROR: cannot create Animal: abstract member sound is not implemented"},
+		{`Stone()`, "ERROR: cannot create Stone: abstract member sound is not implemented"},
+		// 作るときのエラーなのでtryで受け取れる
+		{`imm r = try(Animal); [r.kind, r.message]`, "[TypeError, cannot create Animal: abstract member sound is not implemented]"},
+		{`imm make = ()=>{ return Stone() }; try(make).kind`, "TypeError"},
+		{`imm ok = try(Duck); ok.legs`, "4"},
+		// 構造的な型で判定する
+		{`Duck() implements Sounds`, "true"},
+		{`{sound:(count:number)=>{ return ""; }} implements Sounds`, "true"},
+		{`{sound:(a:number, b:number)=>{ return ""; }} implements Sounds`, "false"},
+		{`{sound:(count:string)=>{ return ""; }} implements Sounds`, "false"},
+		{`{sound:1} implements Sounds`, "false"},
+		{`{} implements Sounds`, "false"},
+		{`{name:"zoo", sounds:[Duck()]} implements Named`, "true"},
+		{`{name:"zoo", sounds:[Duck(), 1]} implements Named`, "false"},
+		{`imm r = [1 implements number, 1.5 implements number, "a" implements number]; r`, "[true, true, false]"},
+		{`1 implements Duck`, "ERROR: right operand of implements must be a type, got FUNCTION"},
+		// 値のない宣言はundefined
+		{`mut a; a`, "undefined"},
+		// typeは型の宣言の始めでなければただの名前
+		{`imm h = {type: "duck"}; h.type`, "duck"},
+		{`imm h = {
+			type: 1
+		}
+		h.type + 1`, "2"},
+		{`mut type = 1; type = type + 1; type`, "2"},
+		{`imm h = {}; h.type = "x"; type T = number; [h.type, 1 implements T]`, "[x, true]"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, classes+tt.input, tt.expected)
+	}
+}
+
+func TestIfElifChain(t *testing.T) {
+	f := `
+	imm f = (x:number)=>{
+		if (x == 1) { return "one" } elif (x == 2) { return "two" } else if (x == 3) { return "three" } else { return "many" }
+	}
+	`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`f(1)`, "one"},
+		{`f(2)`, "two"},
+		{`f(3)`, "three"},
+		{`f(4)`, "many"},
+		{`if (false) 1 elif (false) 2`, "null"},
+		{`if (false) 1 elif (x) 2`, "ERROR: identifier not found: x"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, f+tt.input, tt.expected)
+	}
+}
+
+func TestTemplateLiteral(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`imm h = {a: "A"}; "x${h.a}y"`, "xAy"},
+		{`imm s = "b"; "${s}${s + "c"}"`, "bbc"},
+		// 埋め込んだ式は外側の演算子と結びつかない
+		{`imm s = "b"; len("a${s}c") * 2`, "6"},
+		{`imm s = "b"; "a${s == "b"}"`, "ERROR: type mismatch: STRING + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, tt.input, tt.expected)
+	}
+}
+
+func TestSwitchStatement(t *testing.T) {
+	f := `
+	imm f = (x:any)=>{
+		mut out = "";
+		switch (x) {
+		case 1, 2:
+			out = "small";
+		case 3:
+			out = "three";
+			fallthrough;
+		case 4:
+			out = out + "+four";
+			break;
+			out = "never";
+		default:
+			out = "other";
+		}
+		return out;
+	}
+	`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// 複数の値
+		{`f(1)`, "small"},
+		{`f(2)`, "small"},
+		// fallthroughは明示したときだけ
+		{`f(3)`, "three+four"},
+		// breakでswitchを抜ける
+		{`f(4)`, "+four"},
+		{`f(9)`, "other"},
+		// == と同じ比較をする
+		{`f("1")`, "other"},
+		{`f(1.0)`, "small"},
+		// breakはswitchだけを抜けてcontinueはループに伝わる
+		{`
+		mut seen = "";
+		loop(imm i = {a:1, b:2, c:3, d:4}){
+			switch (i.v) {
+			case 2:
+				continue;
+			case 3:
+				break;
+			default:
+				seen = seen + i.k;
+			}
+			seen = seen + "|";
+		}
+		seen
+		`, "a||d|"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, f+tt.input, tt.expected)
+	}
+}
+
+func TestMatchExpression(t *testing.T) {
+	f := `
+	imm Point = (x:number, y:number)=>{
+		return this;
+	}
+	imm Secret = ()=>{
+		mut code = 1;
+		return this;
+	}
+	imm describe = (v:any)=>{
+		return match (v) {
+			0 => "zero",
+			1 | 2 | 3 => "small",
+			-10..-1 => "negative",
+			n:number if n > 100 => "big " + "number",
+			4..100 => "medium",
+			"hello" => "greeting",
+			s:string => "string " + s,
+			[] => "empty",
+			[x] => "one",
+			[first, ...rest] => {
+				imm count = len(rest);
+				"many"
+			},
+			{x: 0, y} => "on y axis",
+			p:Point => "point",
+			{kind: "circle", r: r:number} => "circle",
+			{code} => "leaked",
+			_ => "unknown",
+		}
+	}
+	`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`describe(0)`, "zero"},
+		{`describe(2)`, "small"},
+		{`describe(-5)`, "negative"},
+		{`describe(50)`, "medium"},
+		{`describe(500)`, "big number"},
+		{`describe(4.5)`, "medium"},
+		{`describe("hello")`, "greeting"},
+		{`describe("abc")`, "string abc"},
+		{`describe([])`, "empty"},
+		{`describe([1])`, "one"},
+		{`describe([1, 2, 3])`, "many"},
+		{`describe({x: 0, y: 3})`, "on y axis"},
+		// 引数はmutのメンバなので外からは見えない
+		{`describe(Point(0, 3))`, "point"},
+		{`describe({kind: "circle", r: 2})`, "circle"},
+		{`describe({kind: "circle", r: "2"})`, "unknown"},
+		// 外から見えないメンバには一致しない
+		{`describe(Secret())`, "unknown"},
+		{`describe(true)`, "unknown"},
+		// 束縛した値を使う
+		{`match ([1, 2, 3]) { [a, ...rest] => rest }`, "[2, 3]"},
+		{`match ({name: "kuroko", age: 3}) { {name, age: a} => name + a.@type }`, "kurokointeger"},
+		// 束縛は腕の外に漏れない
+		{`match (1) { n => n }; n`, "ERROR: identifier not found: n"},
+		// コンストラクタや型の名前だけなら束縛でなく型の判定
+		{`match (1) { Point => "pt", _ => "other" }`, "other"},
+		{`match (Point(1, 2)) { Secret => "secret", Point => "pt", _ => "other" }`, "pt"},
+		{`type Num = number; match ("a") { Num => "num", s => s }`, "a"},
+		// コンストラクタでない関数の名前は束縛し直す
+		{`match (1) { describe => describe + 1 }`, "2"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, f+tt.input, tt.expected)
+	}
+	testInspect(t, `match (5) { 1 => "one" }`, "ERROR: no match arm for 5 on line 1 col 1")
+}
+
+func TestBlockScope(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// ループの中のクロージャはその回の値を持つ
+		{`
+		mut fs = [];
+		loop(imm i = [10, 20, 30]){
+			imm x = i.v * 2;
+			fs = push(fs, ()=>{ i.k + i.v + x });
+		}
+		fs[0]() + fs[2]()
+		`, "122"},
+		{`
+		mut fs = [];
+		loop(imm i = {a:1, b:2}){
+			fs = push(fs, ()=>{ i.k });
+		}
+		fs[0]() + fs[1]()
+		`, "ab"},
+		// 反復変数は回ごとに別のもの
+		{`
+		mut seen = [];
+		loop(imm i = [1, 2]){ seen = push(seen, i) }
+		[seen[0].v, seen[1].v]
+		`, "[1, 2]"},
+		// ループの中の宣言は外から見えない
+		{`loop(imm i = [1]){ imm inner = 1 }; inner`, "ERROR: identifier not found: inner"},
+		{`loop(imm i = [1]){ 1 }; i`, "ERROR: identifier not found: i"},
+		// ifのブロックは外側を隠せるが書き換えない
+		{`mut y = 1; if (true) { imm y = 2; y } `, "2"},
+		{`mut y = 1; if (true) { imm y = 2 }; y`, "1"},
+		{`if (false) { 1 } elif (true) { imm z = 1 } else { imm w = 2 }; z`, "ERROR: identifier not found: z"},
+		// 外側の変数への代入は届く
+		{`mut y = 1; if (true) { y = 2 }; y`, "2"},
+		// 裸のブロック
+		{`mut y = 1; { imm t = 5; y = t }; y`, "5"},
+		{`{ imm t = 5 }; t`, "ERROR: identifier not found: t"},
+		// ブロックの中の宣言はメンバにならない
+		{`
+		imm user = ()=>{
+			pub mut color;
+			{
+				imm col = 3;
+				color = col;
+			}
+			return this;
+		}
+		imm u = user();
+		[u.color, u.col]
+		`, "[3, undefined]"},
+		// ブロックの中のthisは関数のもの
+		{`imm f = ()=>{ imm a = 1; if (true) { return this.a } }; f()`, "1"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, tt.input, tt.expected)
+	}
+}
+
+func TestErrorValues(t *testing.T) {
+	f := `
+	imm NotFound = (name:string)=>{ imm message = "not found: " + name; imm code = 404; return this }
+	imm Missing = (name:string)=>{ ...NotFound(name); return this }
+	imm e = error(NotFound("x"));
+	imm w = wrap(e, "load");
+	`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// error()は値を返すだけで評価は止まらない
+		{`imm v = error("Custom", "boom"); [v.kind, v.message]`, "[Custom, boom]"},
+		{`error("Custom", "boom")`, "error(Custom: boom)"},
+		{`error(1)`, "ERROR: argument to `error` must be STRING or CLASS, got INTEGER"},
+		// エラークラス
+		{`[e.kind, e.message, e.code, e.other]`, "[NotFound, not found: x, 404, undefined]"},
+		{`e.name`, "ERROR: cannot access private member: NotFound.name"},
+		{`e instanceof NotFound`, "true"},
+		{`error(Missing("y")) instanceof NotFound`, "true"},
+		{`error("Other", "z") instanceof NotFound`, "false"},
+		// wrapは元のエラーをcauseに持つ
+		{`[w.kind, w.message]`, "[NotFound, load: not found: x]"},
+		{`w.cause`, "error(NotFound: not found: x)"},
+		{`e.cause`, "null"},
+		{`w instanceof NotFound`, "true"},
+		// isは包まれたエラーもたどる
+		{`[is(w, "NotFound"), is(w, NotFound), is(w, e), is(w, "Error")]`, "[true, true, true, true]"},
+		{`[is(w, "NameError"), is(e, w), is(1, "Error")]`, "[false, false, false]"},
+		// tryは実行時のエラーを種類つきの値にする
+		{`imm r = try(()=>{ nothing }); [r.kind, is(r, "NameError")]`, "[NameError, true]"},
+		// 見つからない名前には近い名前の候補がつく
+		{`imm value = 1; valeu + 1`, "ERROR: identifier not found: valeu; did you mean value?"},
+		{`imm f = (count:number)=>{ cuont }; f(1)`, "ERROR: identifier not found: cuont; did you mean count?"},
+		{`lenn([1])`, "ERROR: identifier not found: lenn; did you mean len?"},
+		{`try((a:int)=>{ a + "s" }, 1).kind`, "TypeError"},
+		{`try(()=>{ len(1, 2) }).kind`, "ArgumentError"},
+		{`mut a = [1]; try(()=>{ a[3] = 1 }).kind`, "IndexError"},
+		{`try(()=>{ imm x = 1; x = 2 }).kind`, "AccessError"},
+		{`try(()=>{ 1 })`, "1"},
+		// throwで値をエラーとして投げる
+		{`imm f = ()=>{ throw(w); 1 }; f()`, "ERROR: load: not found: x"},
+		{`imm f = ()=>{ throw(w) }; try(f) instanceof NotFound`, "true"},
+		{`throw("x")`, "ERROR: argument to `throw` must be ERROR_VALUE, got STRING"},
+		// deferのエラーは元のエラーの種類やクラスを変えずに添える
+		{`imm f = ()=>{ defer nothing; throw(error(NotFound("d"))) }; imm r = try(f); [r instanceof NotFound, r.kind, r.message, is(r, NotFound)]`,
+			"[true, NotFound, not found: d, true]"},
+		{`imm f = ()=>{ defer nothing; throw(w) }; imm r = try(f); [r.cause, r.deferred[0].kind]`, "[error(NotFound: not found: x), NameError]"},
+		{`imm f = ()=>{ defer nothing; throw(e) }; f()`, "ERROR: not found: x (deferred: identifier not found: nothing)"},
+		{`imm f = ()=>{ defer nothing; 1 }; is(try(f), "NameError")`, "true"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, f+tt.input, tt.expected)
+	}
+
+	// 見つからない名前のエラーには識別子の位置がつく
+	err, ok := testEval(t, "imm value = 1\nimm f = ()=>{\n  1 + valeu\n}\nf()").(*object.Error)
+	if !ok || err.Kind != object.NAME_ERROR || err.Row != 3 || err.Col != 7 {
+		t.Errorf("unexpected error: %#v", err)
+	}
+}
+
+func TestLabeledLoop(t *testing.T) {
+	f := `
+	imm h = {a:1, b:2, c:3};
+	`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// ラベルで外側のループを続ける・抜ける
+		{`
+		mut s = "";
+		outer: loop(imm i = h){
+			loop(imm j = h){
+				if (j.v == 2) continue outer
+				if (i.v == 3) break outer
+				s = s + i.k + j.k + ",";
+			}
+			s = s + "never";
+		}
+		s
+		`, "aa,ba,"},
+		// break の値がループの値になる
+		{`imm found = loop(imm i = h){ if (i.v > 1) break i.k }; found`, "b"},
+		{`imm none = loop(imm i = h){ if (i.v > 5) break i.k }; none`, "undefined"},
+		// 内側のループからラベル付きで値を返す
+		{`
+		imm pair = outer: loop(imm i = h){
+			loop(imm j = h){
+				if (i.v * j.v == 6) break outer i.k + j.k
+			}
+		};
+		pair
+		`, "bc"},
+		// switchの中のラベル付きbreakはループに届く
+		{`
+		imm r = outer: loop(imm i = h){
+			switch (i.v) {
+			case 2:
+				break outer "two";
+			}
+		};
+		r
+		`, "two"},
+		// ループの中のreturn
+		{`imm g = (x:int)=>{ loop(imm i = h){ if (i.v == x) return i.k }; "none" }; g(3) + g(9)`, "cnone"},
+		// ループの中のエラーは止まる
+		{`loop(imm i = h){ nothing }`, "ERROR: identifier not found: nothing"},
+		// ループの外のbreak/continue
+		{`imm g = (x:int)=>{ break }; g(1)`, "ERROR: break outside of loop"},
+		{`continue`, "ERROR: continue outside of loop"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, f+tt.input, tt.expected)
+	}
+}
+
+func TestGenerators(t *testing.T) {
+	f := `
+	imm count = (from:int)=>{
+		yield from
+		yield from + 1
+		yield from + 2
+	}
+	imm naturals = (n:int)=>{
+		yield n
+		loop(imm x = naturals(n + 1)){ yield x.v }
+	}
+	imm counter = (limit:int)=>{
+		mut i = 0;
+		imm next = ()=>{ i = i + 1; return {value: i, done: i > limit} };
+		return this;
+	}
+	`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`collect(count(1))`, "[1, 2, 3]"},
+		// loopのkは何番目か
+		{`mut s = []; loop(imm x = count(5)){ s = push(s, [x.k, x.v]) }; s`, "[[0, 5], [1, 6], [2, 7]]"},
+		{`loop(imm x = [1, 2, 3]){ if (x.v == 2) break x.k }`, "1"},
+		// next()は{value, done}を返す
+		{`imm g = count(1); g.next(); g.next(); g.next(); g.next()`, "{value: undefined, done: true}"},
+		{`imm g = count(1); g.next()`, "{value: 1, done: false}"},
+		// next()を持つオブジェクトも反復できる
+		{`collect(counter(3))`, "[1, 2, 3]"},
+		// 無限のジェネレータも必要な分だけ
+		{`collect(take(naturals(1), 4))`, "[1, 2, 3, 4]"},
+		{`collect(take(skip(naturals(1), 2), 3))`, "[3, 4, 5]"},
+		{`collect(map(filter([1, 2, 3, 4, 5], (x:int)=>{ x > 2 }), (x:int)=>{ x * 10 }))`, "[30, 40, 50]"},
+		{`collect(chain([1], count(2), counter(1)))`, "[1, 2, 3, 4, 1]"},
+		// 展開と分割
+		{`;[0, ...count(1), ...[9]]`, "[0, 1, 2, 3, 9]"},
+		{`match (naturals(7)) { [a, b, ...rest] => [a, b, collect(take(rest, 2))] }`, "[7, 8, [9, 10]]"},
+		// 要素が余れば一致しない（反復子は読み進められる）
+		{`match (count(1)) { [a, b] => "two", _ => "more" }`, "more"},
+		// エラー
+		{`imm bad = ()=>{ yield 1; nothing }; collect(bad())`, "ERROR: identifier not found: nothing"},
+		{`yield 1`, "ERROR: yield outside of generator on line 16 col 2"},
+		{`loop(imm x = 1){ x }`, "ERROR: not iterable: INTEGER"},
+		{`take([1], "a")`, "ERROR: argument to `take` must be INTEGER, got STRING"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, f+tt.input, tt.expected)
+	}
+
+	// 途中でやめたジェネレータのgoroutineは残らない
+	before := runtime.NumGoroutine()
+	testInspect(t, f+`collect(take(naturals(1), 20)); loop(imm x = naturals(1)){ if (x.v > 5) break }; 1`, "1")
+	for i := 0; i < 100 && runtime.NumGoroutine() > before; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if runtime.NumGoroutine() > before {
+		t.Errorf("generator goroutines leaked. before=%d, after=%d", before, runtime.NumGoroutine())
+	}
+
+	// 最後まで読まないジェネレータも、実行が終われば閉じる
+	before = runtime.NumGoroutine()
+	testInspect(t, f+`
+	mut gens = [];
+	loop(imm i = count(1)){ imm g = naturals(1); g.next(); gens = push(gens, g) }
+	match (naturals(1)) { [a, ...rest] => collect(take(rest, 1)) }
+	`, "[2]")
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("undrained generator goroutines leaked. before=%d, after=%d", before, after)
+	}
+}
+
+func TestDeferStatement(t *testing.T) {
+	f := `
+	mut log = [];
+	imm note = (s:string)=>{ log = push(log, s) };
+	imm f = (x:int)=>{
+		defer note("first")
+		mut v = "arg";
+		defer note(v)
+		v = "changed";
+		loop(imm i = [1, 2]){ defer note("loop") }
+		if (x == 1) { return "ret" }
+		if (x == 2) { nothing }
+		"end"
+	}
+	imm gen = ()=>{
+		defer note("gen")
+		yield 1
+		yield 2
+	}
+	`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// 後に登録したものから、引数はdeferのときの値で
+		{`f(0); log`, "[loop, loop, arg, first]"},
+		{`f(1)`, "ret"},
+		{`f(1); log`, "[loop, loop, arg, first]"},
+		{`f(2)`, "ERROR: identifier not found: nothing"},
+		// エラーで抜けても実行して、deferのエラーは元のエラーとまとめる
+		{`imm g = ()=>{ defer nothing1; defer nothing2; 1 }; g()`,
+			"ERROR: deferred: identifier not found: nothing2; identifier not found: nothing1"},
+		{`imm g = ()=>{ defer nothing1; nothing0 }; g()`,
+			"ERROR: identifier not found: nothing0 (deferred: identifier not found: nothing1)"},
+		// 途中でやめたジェネレータでも実行する
+		{`collect(take(gen(), 1)); log`, "[gen]"},
+		{`collect(gen()); log`, "[gen]"},
+		// トップレベルはプログラムの終わりに
+		{`defer note("top"); log`, "[]"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, f+tt.input, tt.expected)
+	}
+}
+
+func TestTailCallAndCallDepth(t *testing.T) {
+	f := `
+	imm sum = (n:int, acc:int)=>{
+		if (n == 0) { return acc }
+		return sum(n - 1, acc + n)
+	}
+	imm even = (n:int)=>{ if (n == 0) { return true }; return odd(n - 1) }
+	imm odd = (n:int)=>{ if (n == 0) { return false }; return even(n - 1) }
+	imm deep = (n:int)=>{ if (n == 0) { return 0 }; return 1 + deep(n - 1) }
+	imm deferred = (n:int)=>{
+		defer len([])
+		if (n == 0) { return 0 }
+		return deferred(n - 1)
+	}
+	`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// 末尾呼び出しは深さが増えない
+		{`sum(50, 0)`, "1275"},
+		{`sum(5000, 0)`, "12502500"},
+		{`even(5001)`, "false"},
+		{`deep(10)`, "10"},
+		{`return len([1, 2])`, "2"},
+		// 深すぎるとエラー（スタックは内側から）
+		{`deep(30)`, "ERROR: stack overflow: maximum call depth 20 exceeded" + strings.Repeat("\n\tat deep", 10)},
+		// deferがあると末尾呼び出しにならない
+		{`deferred(30)`, "ERROR: stack overflow: maximum call depth 20 exceeded" + strings.Repeat("\n\tat deferred", 10)},
+	}
+
+	for _, tt := range tests {
+		p := parser.NewParser(f + tt.input)
+		program, ok := p.ParseProgram()
+		if !ok {
+			t.Fatalf("parser errors: %v", p.Errors())
+		}
+		result := EvalContext(context.Background(), program, object.NewEnvironment(), Limits{MaxCallDepth: 20})
+		if result.Inspect() != tt.expected {
+			t.Errorf("%s: result wrong. got=%q, want=%q", tt.input, result.Inspect(), tt.expected)
+		}
+	}
+
+	// 指定しなければ既定の深さ
+	testInspect(t, f+`deep(10001)`,
+		"ERROR: stack overflow: maximum call depth 10000 exceeded"+strings.Repeat("\n\tat deep", 10))
+}
+
+func TestConcurrency(t *testing.T) {
+	f := `
+	imm square = (n:int)=>{ n * n }
+	imm produce = (c:any, n:int)=>{
+		loop(imm i = [1, 2, 3]){ c.send(i.v * n) }
+		c.close()
+	}
+	imm fail = ()=>{ nothing }
+	mut shared = 0;
+	imm add = (n:int)=>{ shared = shared + n }
+	`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`await spawn square(5)`, "25"},
+		{`join([spawn square(2), spawn square(3)])`, "[4, 9]"},
+		{`join(spawn square(2), spawn square(4))`, "[4, 16]"},
+		{`join(spawn square(2), spawn fail())`, "ERROR: identifier not found: nothing"},
+		{`await 1`, "ERROR: await requires a task, got INTEGER"},
+		{`spawn square(1)`, "task(square)"},
+		// タスクは同じ環境を触れる
+		{`join(spawn add(1), spawn add(2), spawn add(3)); shared`, "6"},
+		// チャンネルは閉じられるまで反復できる
+		{`imm ch = channel(); spawn produce(ch, 10); collect(ch)`, "[10, 20, 30]"},
+		{`imm ch = channel(1); ch.send(1); ch.recv()`, "1"},
+		{`imm ch = channel(1); ch.close(); ch.recv()`, "undefined"},
+		{`imm ch = channel(1); ch.close(); ch.send(1)`, "ERROR: send on closed channel"},
+		{`imm ch = channel(1); ch.close(); ch.close()`, "ERROR: close of closed channel"},
+		{`channel(-1)`, "ERROR: argument to `channel` must be a non-negative INTEGER, got -1"},
+		// select
+		{`
+		imm a = channel(1);
+		imm b = channel(1);
+		b.send("bee");
+		mut got = "";
+		select {
+		case v = a.recv():
+			got = "a";
+		case v = b.recv():
+			got = v;
+		}
+		got
+		`, "bee"},
+		{`
+		imm a = channel(1);
+		mut got = "";
+		select {
+		case v = a.recv():
+			got = "a";
+		default:
+			got = "none";
+			break;
+			got = "never";
+		}
+		got
+		`, "none"},
+		{`
+		imm a = channel(1);
+		select {
+		case a.send(7):
+		}
+		a.recv()
+		`, "7"},
+		{`
+		imm a = channel(1);
+		a.close();
+		mut got = 0;
+		select {
+		case v = a.recv():
+			got = v;
+		}
+		got
+		`, "undefined"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, f+tt.input, tt.expected)
+	}
+}
+
+func TestExecutionLimits(t *testing.T) {
+	f := `
+	imm forever = ()=>{
+		imm next = ()=>{ return {value: 1, done: false} };
+		return this;
+	}
+	imm cleanup = ()=>{
+		defer len([])
+		loop(imm x = forever()){ x }
+	}
+	`
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	timeout := func() context.Context {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		t.Cleanup(cancel)
+		return ctx
+	}
+
+	tests := []struct {
+		input    string
+		ctx      func() context.Context
+		limits   Limits
+		kind     string
+		expected string
+	}{
+		{`loop(imm x = forever()){ x }`, nil, Limits{MaxSteps: 1000}, object.LIMIT_EXCEEDED, "step limit exceeded: 1000"},
+		{`mut a = []; loop(imm x = forever()){ a = push(a, x.v) }`, nil, Limits{MaxAllocations: 1000}, object.LIMIT_EXCEEDED, "allocation limit exceeded: 1000"},
+		{`loop(imm x = forever()){ puts("hello") }`, nil, Limits{MaxOutput: 20}, object.LIMIT_EXCEEDED, "output limit exceeded: 20"},
+		// deferのエラーとまとめない
+		{`cleanup()`, nil, Limits{MaxSteps: 1000}, object.LIMIT_EXCEEDED, "step limit exceeded: 1000"},
+		{`1`, func() context.Context { return canceled }, Limits{}, object.CANCELED, "context canceled"},
+		// 時間切れ（待っているチャンネルやタスクも止める）
+		// 動いているタスクがあればデッドロックにはならない
+		{`loop(imm x = forever()){ x }`, timeout, Limits{}, object.CANCELED, "context deadline exceeded"},
+		{`imm spin = ()=>{ loop(imm x = forever()){ x } }; spawn spin(); channel().recv()`, timeout, Limits{}, object.CANCELED, "context deadline exceeded"},
+		{`imm spin = ()=>{ loop(imm x = forever()){ x } }; await spawn spin()`, timeout, Limits{}, object.CANCELED, "context deadline exceeded"},
+		{`imm spin = ()=>{ loop(imm x = forever()){ x } }; spawn spin(); imm ch = channel(); select { case v = ch.recv(): v }`, timeout, Limits{}, object.CANCELED, "context deadline exceeded"},
+	}
+
+	for _, tt := range tests {
+		ctx := context.Background()
+		if tt.ctx != nil {
+			ctx = tt.ctx()
+		}
+		p := parser.NewParser(f + tt.input)
+		program, ok := p.ParseProgram()
+		if !ok {
+			t.Fatalf("parser errors: %v", p.Errors())
+		}
+		result := EvalContext(ctx, program, object.NewEnvironment(), tt.limits)
+		err, ok := result.(*object.Error)
+		if !ok {
+			t.Errorf("%s: not an error. got=%v", tt.input, result)
+			continue
+		}
+		if err.Kind != tt.kind || err.Message != tt.expected {
+			t.Errorf("%s: error wrong. got=%s %q, want=%s %q", tt.input, err.Kind, err.Message, tt.kind, tt.expected)
+		}
+	}
+
+	// 制限がなければ普通に実行する
+	p := parser.NewParser(`imm a = [1, 2, 3]; puts(a); len(a)`)
+	program, _ := p.ParseProgram()
+	result := EvalContext(context.Background(), program, object.NewEnvironment(), Limits{MaxSteps: 100, MaxAllocations: 10, MaxOutput: 10})
+	if result.Inspect() != "3" {
+		t.Errorf("result wrong. got=%s", result.Inspect())
+	}
+}
+
+// ロックは実行ごとにあり、別の実行は待たずに評価できる
+func TestOverlappingExecutions(t *testing.T) {
+	parse := func(input string) *ast.Program {
+		p := parser.NewParser(input)
+		program, ok := p.ParseProgram()
+		if !ok {
+			t.Fatalf("parser errors: %v", p.Errors())
+		}
+		return program
+	}
+	spin := parse(`
+	imm forever = ()=>{
+		imm next = ()=>{ return {value: 1, done: false} };
+		return this;
+	}
+	loop(imm x = forever()){ x }
+	`)
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan object.Object)
+	go func() {
+		first <- EvalContext(ctx, spin, object.NewEnvironment(), Limits{})
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	timeout, stop := context.WithTimeout(context.Background(), time.Second)
+	defer stop()
+	one := parse(`1`)
+	second := make(chan object.Object)
+	go func() {
+		second <- EvalContext(timeout, one, object.NewEnvironment(), Limits{})
+	}()
+	if result := <-second; result.Inspect() != "1" {
+		t.Errorf("second result wrong. got=%s", result.Inspect())
+	}
+
+	cancel()
+	if err, ok := (<-first).(*object.Error); !ok || err.Kind != object.CANCELED {
+		t.Errorf("first execution was not canceled")
+	}
+
+	// 評価の途中から別のプログラムを評価しても止まらない
+	env := object.NewEnvironment()
+	env.Set("nested", &object.Builtin{Fn: func(*object.Environment, ...object.Object) object.Object {
+		return Eval(one, object.NewEnvironment())
+	}})
+	if result := Eval(parse(`nested() + 1`), env); result.Inspect() != "2" {
+		t.Errorf("nested result wrong. got=%s", result.Inspect())
+	}
+}
+
+// 実行が終わったら、終わっていないタスクは止められる
+func TestTaskLifetime(t *testing.T) {
+	before := runtime.NumGoroutine()
+	testInspect(t, `
+	imm forever = ()=>{
+		imm next = ()=>{ return {value: 1, done: false} };
+		return this;
+	}
+	imm spin = ()=>{ loop(imm x = forever()){ x } }
+	imm wait = ()=>{ channel().recv() }
+	spawn spin();
+	spawn wait();
+	1
+	`, "1")
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("tasks still running. before=%d, after=%d", before, after)
+	}
+
+	// 同じ実行なら評価をまたいでタスクを待てる
+	exec := NewExecution(context.Background(), Options{})
+	env := object.NewEnvironment()
+	var result object.Object
+	for _, input := range []string{`imm ch = channel(); imm t = spawn ch.recv()`, `ch.send(5); await t`} {
+		p := parser.NewParser(input)
+		program, _ := p.ParseProgram()
+		result = exec.Eval(program, env)
+	}
+	exec.Close()
+	if result.Inspect() != "5" {
+		t.Errorf("result wrong. got=%s", result.Inspect())
+	}
+}
+
+// すべてのタスクが待っていたら、待っているところでエラーにする
+func TestDeadlock(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`channel(0).recv()`, "ERROR: deadlock: all tasks are waiting"},
+		{`imm ch = channel(1); ch.send(1); ch.send(2)`, "ERROR: deadlock: all tasks are waiting"},
+		{`imm ch = channel(); imm t = spawn ch.recv(); await t`, "ERROR: deadlock: all tasks are waiting"},
+		{`imm ch = channel(); select { case v = ch.recv(): v }`, "ERROR: deadlock: all tasks are waiting"},
+		{`
+		imm a = channel();
+		imm b = channel();
+		imm relay = ()=>{ b.send(a.recv()) }
+		spawn relay();
+		b.recv()
+		`, "ERROR: deadlock: all tasks are waiting"},
+		// tryで受け止められる
+		{`try(()=>{ channel().recv() }).message`, "deadlock: all tasks are waiting"},
+		// 他のタスクが送るまで待つのはデッドロックではない
+		{`
+		imm a = channel();
+		imm b = channel();
+		imm relay = ()=>{ b.send(a.recv() * 2) }
+		spawn relay();
+		a.send(21);
+		b.recv()
+		`, "42"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, tt.input, tt.expected)
+	}
+}
+
+func TestAssertBuiltins(t *testing.T) {
+	f := `
+	imm Point = (x:number)=>{ imm px = x; imm norm = ()=>{ px * px }; return this }
+	`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`assert(1 < 2)`, "null"},
+		{`assert(false)`, "ERROR: assertion failed"},
+		{`assert(0 > 1, "must be set")`, "ERROR: must be set: assertion failed"},
+		// assertEqは配列・ハッシュ・クラスの中身を比べる
+		{`assertEq([1, {a: "x"}], [1, {a: "x"}])`, "null"},
+		{`assertEq(Point(1), Point(1))`, "null"},
+		{`try(()=>{ assertEq(Point(1), Point(2)) }).kind`, "AssertionError"},
+		{`assertEq({a: 1}, {a: 1, b: 2})`, "ERROR: expected {a: 1, b: 2}, got {a: 1}"},
+		{`assertEq("a", "b", "name")`, `ERROR: name: expected "b", got "a"`},
+		{`assertEq(1, 1.0)`, "ERROR: expected 1, got 1"},
+		// 自分を含む値も比べられる
+		{`imm a = {n: 1}; a.s = a; imm b = {n: 1}; b.s = b; assertEq(a, b)`, "null"},
+		{`imm a = {n: 1}; a.xs = [a]; imm b = {n: 1}; b.xs = [b]; assertEq(a, b)`, "null"},
+		{`imm a = {n: 1}; a.s = a; imm b = {n: 2}; b.s = b; assertEq(a, b)`, "ERROR: expected {n: 2, s: {...}}, got {n: 1, s: {...}}"},
+		{`imm a = {n: 1}; imm b = {n: 1}; a.s = b; b.s = a; assertEq(a, b)`, "null"},
+		// assertThrowsは投げられたエラーを値として返す
+		{`assertThrows(()=>{ nothing }).kind`, "NameError"},
+		{`assertThrows(()=>{ 1 + "a" }, "TypeError").kind`, "TypeError"},
+		{`assertThrows(()=>{ 1 + "a" }, "NameError")`, "ERROR: expected \"NameError\", got TypeError: type mismatch: INTEGER + STRING"},
+		{`assertThrows(()=>{ 1 })`, "ERROR: expected an error, got 1"},
+		{`assertThrows(1)`, "ERROR: argument to `assertThrows` must be FUNCTION, got INTEGER"},
+	}
+
+	for _, tt := range tests {
+		testInspect(t, f+tt.input, tt.expected)
+	}
+
+	// 失敗には呼び出しの位置がつく
+	err, ok := testEval(t, "imm f = ()=>{\n  assert(false)\n}\nf()").(*object.Error)
+	if !ok || err.Kind != object.ASSERTION_ERROR || err.Row != 2 || err.Col != 3 {
+		t.Errorf("unexpected error: %#v", err)
+	}
+}
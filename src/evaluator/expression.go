@@ -13,6 +13,15 @@ func evalExpressions(
 	var result []object.Object
 
 	for _, e := range exps {
+		// ...で反復できる値を展開する
+		if spread, ok := e.(*ast.PrefixExpression); ok && spread.Operator == "..." {
+			values, err := evalSpread(spread, env)
+			if err != nil {
+				return []object.Object{err}
+			}
+			result = append(result, values...)
+			continue
+		}
 		evaluated := Eval(e, env)
 		if isError(evaluated) {
 			return []object.Object{evaluated}
@@ -26,14 +35,16 @@ func evalExpressions(
 /*
  * 単項演算子
  */
-func evalPrefixExpression(operator string, right object.Object) object.Object {
+func evalPrefixExpression(operator string, right object.Object, env *object.Environment) object.Object {
 	switch operator {
 	case "!":
 		return evalBangOperatorExpression(right)
+	case "await":
+		return awaitTask(executionOf(env), right)
 	case "-":
 		return evalMinusPrefixOperatorExpression(right)
 	default:
-		return newError("unknown operator: %s%s", operator, right.Type())
+		return newKindError(object.TYPE_ERROR, "unknown operator: %s%s", operator, right.Type())
 	}
 }
 
@@ -52,7 +63,7 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
 	if right.Type() != object.INTEGER_OBJ {
-		return newError("unknown operator: -%s", right.Type())
+		return newKindError(object.TYPE_ERROR, "unknown operator: -%s", right.Type())
 	}
 
 	value := right.(*object.Integer).Value
@@ -78,11 +89,20 @@ func evalInfixExpression(
 		return right
 	}
 
+	return evalInfix(operator, left, right, env)
+}
+
+// 評価済みの値に二項演算子を適用する
+func evalInfix(
+	operator string,
+	left, right object.Object,
+	env *object.Environment,
+) object.Object {
 	switch {
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(operator, left, right)
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
-		return evalStringInfixExpression(operator, left, right)
+		return evalStringInfixExpression(operator, left, right, env)
 	case left.Type() == object.FLOAT_OBJ && right.Type() == object.FLOAT_OBJ:
 		return evalFloatInfixExpression(operator, left, right)
 	case left.Type() == object.COMPLEX_OBJ && right.Type() == object.COMPLEX_OBJ:
@@ -118,11 +138,13 @@ func evalInfixExpression(
 		return evalBoolLiteral(left != right)
 	case operator == "instanceof":
 		return evalInstanceOfExpression(left, right)
+	case operator == "implements":
+		return evalImplementsExpression(left, right, env)
 	case left.Type() != right.Type():
-		return newError("type mismatch: %s %s %s",
+		return newKindError(object.TYPE_ERROR, "type mismatch: %s %s %s",
 			left.Type(), operator, right.Type())
 	default:
-		return newError("unknown operator: %s %s %s",
+		return newKindError(object.TYPE_ERROR, "unknown operator: %s %s %s",
 			left.Type(), operator, right.Type())
 	}
 }
@@ -152,7 +174,7 @@ func evalIntegerInfixExpression(
 	case "!=":
 		return evalBoolLiteral(leftVal != rightVal)
 	default:
-		return newError("unknown operator: %s %s %s",
+		return newKindError(object.TYPE_ERROR, "unknown operator: %s %s %s",
 			left.Type(), operator, right.Type())
 	}
 }
@@ -182,7 +204,7 @@ func evalFloatInfixExpression(
 	case "!=":
 		return evalBoolLiteral(leftVal != rightVal)
 	default:
-		return newError("unknown operator: %s %s %s",
+		return newKindError(object.TYPE_ERROR, "unknown operator: %s %s %s",
 			left.Type(), operator, right.Type())
 	}
 }
@@ -212,7 +234,7 @@ func evalComplexInfixExpression(
 	case "!=":
 		return evalBoolLiteral(leftVal != rightVal)
 	default:
-		return newError("unknown operator: %s %s %s",
+		return newKindError(object.TYPE_ERROR, "unknown operator: %s %s %s",
 			left.Type(), operator, right.Type())
 	}
 }
@@ -220,17 +242,21 @@ func evalComplexInfixExpression(
 func evalStringInfixExpression(
 	operator string,
 	left, right object.Object,
+	env *object.Environment,
 ) object.Object {
 
 	leftVal := left.(*object.String).Value
 	rightVal := right.(*object.String).Value
 	switch operator {
 	case "+":
+		if err := executionOf(env).allocate(1); err != nil {
+			return err
+		}
 		return &object.String{Value: leftVal + rightVal}
 	case "==":
 		return evalBoolLiteral(leftVal == rightVal)
 	default:
-		return newError("unknown operator: %s %s %s",
+		return newKindError(object.TYPE_ERROR, "unknown operator: %s %s %s",
 			left.Type(), operator, right.Type())
 	}
 }
@@ -247,28 +273,41 @@ func evalIfExpression(
 		return condition
 	}
 
-	isTruthy := func(obj object.Object) bool {
-		switch obj {
-		case object.NULL:
-			return false
-		case object.TRUE:
-			return true
-		case object.FALSE:
-			return false
-		default:
-			return true
+	if isTruthy(condition) {
+		return evalScopedBlock(ie.Consequence, env)
+	}
+	for _, elif := range ie.Elifs {
+		condition := Eval(elif.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+		if isTruthy(condition) {
+			return evalScopedBlock(elif.Consequence, env)
 		}
 	}
-
-	if isTruthy(condition) {
-		return Eval(ie.Consequence, env)
-	} else if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
+	if ie.Alternative != nil {
+		return evalScopedBlock(ie.Alternative, env)
 	} else {
 		return object.NULL
 	}
 }
 
+/*
+ * 条件として真か
+ */
+func isTruthy(obj object.Object) bool {
+	switch obj {
+	case object.NULL:
+		return false
+	case object.TRUE:
+		return true
+	case object.FALSE:
+		return false
+	default:
+		return true
+	}
+}
+
 /*
  * インデックスアクセス
  */
@@ -304,14 +343,14 @@ func evalIndexExpression(node *ast.IndexExpression, env *object.Environment) obj
 		case err == nil:
 			return val
 		case err.Is(object.InvalidKey):
-			return newError("%s", err.Error())
+			return hashError(err)
 		case err.Is(object.NotFound):
 			return object.UNDEFINED
 		default:
 			return newError("evalIndexExpression:Unreachable")
 		}
 	default:
-		return newError("index operator not supported: %s", left.Type())
+		return newKindError(object.TYPE_ERROR, "index operator not supported: %s", left.Type())
 	}
 }
 
@@ -322,12 +361,48 @@ func evalDotExpression(node *ast.DotExpression, env *object.Environment) object.
 	// 左辺はハッシュ
 	// 右辺はenvからGetできない識別子なので名前を取得する。
 	left := Eval(node.Left, env)
+	if isError(left) {
+		return left
+	}
 	right := &object.String{Value: node.Right.Name}
 
-	// ハッシュかどうかチェック
-	hashObj, ok := left.(*object.Hash)
-	if !ok {
-		return newError("not a hash: %s", left.Type())
+	// 関数なら静的メンバ（const/share）を参照する
+	if fn, ok := left.(*object.Function); ok {
+		if val, ok := fn.Statics().GetLocal(right.Value); ok {
+			return val
+		}
+		return object.UNDEFINED
+	}
+
+	// 反復子とチャンネルのメソッド
+	switch l := left.(type) {
+	case *object.Iterator:
+		return iteratorMethod(l, right.Value)
+	case *object.Channel:
+		return channelMethod(l, right.Value)
+	case *object.ErrorValue:
+		if val := errorMember(l, right.Value); val != nil {
+			return val
+		}
+		if l.Err.Class == nil {
+			return object.UNDEFINED
+		}
+		// エラークラスのメンバ
+		left = l.Err.Class
+	}
+
+	// ハッシュかどうかチェック（クラスはハッシュを持っている）
+	var hashObj *object.Hash
+	switch l := left.(type) {
+	case *object.Hash:
+		hashObj = l
+	case *object.Class:
+		if err := checkMemberAccess(l, right.Value, env); err != nil {
+			return err
+		}
+		hashObj = &l.Hash
+	default:
+		return newKindError(object.TYPE_ERROR, "not a hash: %s", left.Type())
 	}
 
 	// ハッシュオブジェクトから名前で値を取得
@@ -336,7 +411,7 @@ func evalDotExpression(node *ast.DotExpression, env *object.Environment) object.
 	case err == nil:
 		return val
 	case err.Is(object.InvalidKey):
-		return newError("%s", err.Error())
+		return hashError(err)
 	case err.Is(object.NotFound):
 		return object.UNDEFINED
 	default:
@@ -345,12 +420,36 @@ func evalDotExpression(node *ast.DotExpression, env *object.Environment) object.
 }
 
 /*
- * 関数呼び出し
+ * クラスのメンバへのアクセス権を調べる
+ * mutのメンバはクラスの内側（コンストラクタとその中で作られた関数）からしか触れない
  */
+func checkMemberAccess(
+	class *object.Class,
+	name string,
+	env *object.Environment,
+) *object.Error {
+	if _, err := class.Get(&object.String{Value: name}); err != nil {
+		return nil
+	}
+	if class.IsPublic(name) || env.IsInside(class) {
+		return nil
+	}
+	return newKindError(object.ACCESS_ERROR, "cannot access private member: %s.%s", class.ClassName(), name)
+}
+
+// 関数呼び出し
 func evalCallExpression(
 	ce *ast.CallExpression,
 	env *object.Environment,
+) object.Object {
+	return evalCall(ce, env, false)
+}
 
+// derivingなら ...f() の派生元としての呼び出し
+func evalCall(
+	ce *ast.CallExpression,
+	env *object.Environment,
+	deriving bool,
 ) object.Object {
 
 	function := Eval(ce.Function, env)
@@ -363,44 +462,155 @@ func evalCallExpression(
 		return args[0]
 	}
 
-	switch fn := function.(type) {
+	if _, ok := function.(*object.Builtin); ok {
+		return atCall(ce, applyFunction(function, args, env))
+	}
+	return callFunction(function, args, env, deriving)
+}
+
+// 組み込み関数が返したエラーに呼び出しの位置をつける
+func atCall(ce *ast.CallExpression, result object.Object) object.Object {
+	err, ok := result.(*object.Error)
+	if !ok || err.Row != 0 {
+		return result
+	}
+	t := ce.Token
+	if ident, ok := ce.Function.(*ast.Identifier); ok {
+		t = ident.Token
+	}
+	err.Row, err.Col = t.Row, t.Col
+	return err
+}
 
-	case *object.Function:
-		// 関数の実行環境を拡張する
-		extendedEnv := object.NewEnclosedEnvironment(fn.Env)
-		for paramIdx, param := range fn.Parameters {
-			extendedEnv.Set(param.Name, args[paramIdx])
-		}
-		evaluated := Eval(fn.Body, extendedEnv)
-		// 戻り値を取得する
-		if returnValue, ok := evaluated.(*object.ReturnValue); ok {
-			result := returnValue.Value
-			if class, ok := result.(*object.Class); ok {
-				if !class.SetClassName(fn.Name) {
-					return newError("class name already initialized.")
+// stack overflow のエラーに載せるスタックの数（内側から）
+const maxStackTrace = 10
+
+/*
+ * 関数を引数で呼び出す
+ * ジェネレータなら本体は実行せずに反復子を返す
+ * callerは呼び出し元の環境（組み込み関数からは組み込み関数の呼び出し元の環境）
+ * 関数は呼び出し元と同じ実行で動く
+ */
+func applyFunction(function object.Object, args []object.Object, caller *object.Environment) object.Object {
+	return callFunction(function, args, caller, false)
+}
+
+/*
+ * 返ってきたインスタンスに抽象メンバが残っていたらエラー
+ * derivingなら派生元として呼ばれたので、抽象メンバは派生先で実装されればよい
+ */
+func callFunction(function object.Object, args []object.Object, caller *object.Environment, deriving bool) object.Object {
+	exec := executionOf(caller)
+	parent := caller.Frame()
+
+	// 末尾呼び出しは同じ深さのまま繰り返す
+	for {
+		switch fn := function.(type) {
+
+		case *object.Function:
+			exec.yieldToTasks()
+			// 呼び出しごとに環境を1つ作る
+			if err := exec.allocate(1); err != nil {
+				return err
+			}
+			if len(args) < len(fn.Parameters) {
+				return newKindError(object.ARGUMENT_ERROR, "wrong number of arguments to %s. got=%d, want=%d",
+					fn.DisplayName(), len(args), len(fn.Parameters))
+			}
+			frame := object.NewFrame(fn, parent)
+			if depth := exec.maxCallDepth(); frame.Depth > depth {
+				return stackOverflowError(frame, depth)
+			}
+			// 関数の実行環境を拡張する
+			extendedEnv := object.NewCallEnvironment(fn, frame)
+			extendedEnv.SetRuntime(exec)
+			for paramIdx, param := range fn.Parameters {
+				extendedEnv.Set(param.Name, args[paramIdx])
+			}
+			if fn.Generator {
+				return newGenerator(fn, extendedEnv)
+			}
+			evaluated := runDeferred(extendedEnv, Eval(fn.Body, extendedEnv))
+			if exec.observer != nil {
+				exec.observer.Leave(frame)
+			}
+			// 戻り値を取得する
+			if returnValue, ok := evaluated.(*object.ReturnValue); ok {
+				result := returnValue.Value
+				if tail, ok := result.(*object.TailCall); ok {
+					function, args = tail.Function, tail.Args
+					continue
+				}
+				if class, ok := result.(*object.Class); ok {
+					class.SetConstructor(fn)
+					if name, ok := class.AbstractMember(); ok && !deriving {
+						return newKindError(object.TYPE_ERROR, "cannot create %s: abstract member %s is not implemented",
+							class.ClassName(), name)
+					}
 				}
+				return result
+			}
+			if err := strayJumpError(evaluated); err != nil {
+				return err
 			}
-			return result
+			return evaluated
+
+		case *object.Builtin:
+			return fn.Fn(caller, args...)
+
+		default:
+			return newKindError(object.TYPE_ERROR, "not a function: %s", fn.Type())
 		}
-		return evaluated
+	}
+}
 
-	case *object.Builtin:
-		return fn.Fn(args...)
+// 呼び出しが深すぎるときのエラー
+func stackOverflowError(frame *object.Frame, depth int) *object.Error {
+	err := newKindError(object.STACK_OVERFLOW, "stack overflow: maximum call depth %d exceeded", depth)
+	stack := frame.Stack()
+	if len(stack) > maxStackTrace {
+		stack = stack[:maxStackTrace]
+	}
+	err.Stack = stack
+	return err
+}
 
-	default:
-		return newError("not a function: %s", fn.Type())
+/*
+ * return f(...) の末尾呼び出し
+ * 関数と引数だけ評価して、呼び出しは呼び出し元のapplyFunctionで行う
+ * deferがあるときとジェネレータの中では普通に呼び出す
+ */
+func evalTailCall(call *ast.CallExpression, env *object.Environment) object.Object {
+	function := Eval(call.Function, env)
+	if isError(function) {
+		return function
 	}
+	args := evalExpressions(call.Arguments, env)
+	if len(args) == 1 && isError(args[0]) {
+		return args[0]
+	}
+	// 組み込み関数はスタックを使わないのでここで呼ぶ
+	if builtin, ok := function.(*object.Builtin); ok {
+		return atCall(call, builtin.Fn(env, args...))
+	}
+	return &object.TailCall{Function: function, Args: args}
 }
 
 func evalInstanceOfExpression(left object.Object, right object.Object) object.Object {
 
 	switch l := left.(type) {
+	case *object.ErrorValue:
+		// 包まれた元のエラーも調べる
+		if fn, ok := right.(*object.Function); ok {
+			return evalBoolLiteral(errorInstanceOf(l.Err, fn))
+		}
+		return newError("right operand of instanceof must be a primitive, got %s", right.Type())
 	case *object.Class:
 		// fmt.Printf("%T", right)
 		switch r := right.(type) {
 		case *object.Function:
-			//	名前が一致したら真なのでTRUEオブジェクトを返す
-			if l.InstanceOf(r.Name) {
+			//	識別子が一致したら真なのでTRUEオブジェクトを返す
+			if l.InstanceOf(r) {
 				return evalBoolLiteral(true)
 			}
 			return evalBoolLiteral(false)
@@ -3,6 +3,9 @@ package evaluator
 import (
 	"monkey/ast"
 	"monkey/object"
+	"monkey/parser"
+	"monkey/token"
+	"sort"
 )
 
 func evalIdentifier(
@@ -17,5 +20,27 @@ func evalIdentifier(
 		return builtin
 	}
 
-	return newError("identifier not found: %s", node.Name)
+	err := newKindError(object.NAME_ERROR, "identifier not found: %s", node.Name)
+	err.Row, err.Col = node.Token.Row, node.Token.Col
+	if name := suggestName(node.Name, env); name != "" {
+		err.Message += "; did you mean " + name + "?"
+	}
+	return err
+}
+
+// 見つからない名前に近い、見えている名前か組み込み関数か予約語
+func suggestName(name string, env *object.Environment) string {
+	candidates := []string{}
+	for e := env; e != nil; e = e.Outer() {
+		candidates = append(candidates, e.Names()...)
+	}
+	others := []string{}
+	for n := range builtins {
+		others = append(others, n)
+	}
+	for keyword := range token.Reserved {
+		others = append(others, keyword)
+	}
+	sort.Strings(others)
+	return parser.Suggest(name, append(candidates, others...))
 }
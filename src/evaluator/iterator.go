@@ -0,0 +1,423 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+)
+
+// ジェネレータを途中でやめるときにyieldが返すエラー
+// これで本体の実行を打ち切る
+var errGeneratorClosed = &object.Error{Message: "generator closed"}
+
+// ジェネレータの1回分の結果
+type generatorStep struct {
+	value object.Object
+	ok    bool // 値があるか
+	last  bool // 本体の実行が終わったか
+}
+
+/*
+ * ジェネレータ
+ * 本体は別のgoroutineで実行して、yieldのたびに呼び出し側と交代する
+ * どちらか片方しか動かないので環境を同時に触ることはない
+ * 始めてから終わるまでは実行に登録しておき、最後まで読まれなければ実行の終わりに閉じる
+ */
+func newGenerator(fn *object.Function, env *object.Environment) *object.Iterator {
+	resume := make(chan bool) // trueなら続ける、falseならやめる
+	steps := make(chan generatorStep)
+	started, finished, closing := false, false, false
+	exec := executionOf(env)
+	it := &object.Iterator{Name: fn.DisplayName()}
+
+	env.SetYield(func(val object.Object) object.Object {
+		if closing {
+			return errGeneratorClosed
+		}
+		steps <- generatorStep{value: val, ok: true}
+		if !<-resume {
+			closing = true
+			return errGeneratorClosed
+		}
+		return object.NULL
+	})
+
+	run := func() {
+		result := runDeferred(env, Eval(fn.Body, env))
+		// 呼び出しは本体が終わったときに戻ったことにする
+		if exec.observer != nil {
+			exec.observer.Leave(env.Frame())
+		}
+		if err := strayJumpError(result); err != nil {
+			result = err
+		}
+		if isError(result) && result != errGeneratorClosed {
+			steps <- generatorStep{value: result, ok: true, last: true}
+			return
+		}
+		steps <- generatorStep{last: true}
+	}
+
+	// 次のyieldか本体の終わりまで進める
+	step := func(proceed bool) generatorStep {
+		if !started {
+			started = true
+			exec.generators[it] = true
+			go run()
+		} else {
+			resume <- proceed
+		}
+		s := <-steps
+		if s.last {
+			finished = true
+			delete(exec.generators, it)
+		}
+		return s
+	}
+
+	it.NextFn = func() (object.Object, bool) {
+		if finished {
+			return nil, false
+		}
+		s := step(true)
+		return s.value, s.ok
+	}
+	it.CloseFn = func() {
+		if started && !finished {
+			step(false)
+		}
+		finished = true
+	}
+	return it
+}
+
+/*
+ * yield
+ * ジェネレータの呼び出し側に値を渡して、次に値を求められるまで止まる
+ */
+func evalYieldExpression(node *ast.YieldExpression, env *object.Environment) object.Object {
+	yield := env.Yield()
+	if yield == nil {
+		return newError("yield outside of generator on line %d col %d", node.Token.Row, node.Token.Col)
+	}
+	var val object.Object = object.NULL
+	if node.Value != nil {
+		val = Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+	}
+	return yield(val)
+}
+
+/*
+ * 反復できる値を反復子にする
+ * 配列、反復子、{value, done}を返すnext()を持つオブジェクト
+ * envは反復子の中で関数を呼ぶときの呼び出し元
+ */
+func toIterator(obj object.Object, env *object.Environment) (*object.Iterator, *object.Error) {
+	switch o := obj.(type) {
+	case *object.Iterator:
+		return o, nil
+	case *object.Channel:
+		// 閉じられるまで受け取る
+		return &object.Iterator{
+			Name: "channel",
+			NextFn: func() (object.Object, bool) {
+				return channelRecv(executionOf(env), o)
+			},
+		}, nil
+	case *object.Array:
+		i := 0
+		return &object.Iterator{
+			Name: "array",
+			NextFn: func() (object.Object, bool) {
+				if i >= len(o.Elements) {
+					return nil, false
+				}
+				i++
+				return o.Elements[i-1], true
+			},
+		}, nil
+	}
+	if hash := hashOf(obj); hash != nil {
+		if next, err := hash.Get(&object.String{Value: "next"}); err == nil {
+			switch next.(type) {
+			case *object.Function, *object.Builtin:
+				return protocolIterator(next, env), nil
+			}
+		}
+	}
+	if obj == nil {
+		return nil, newKindError(object.TYPE_ERROR, "not iterable: nil")
+	}
+	return nil, newKindError(object.TYPE_ERROR, "not iterable: %s", obj.Type())
+}
+
+// next()で値を取り出すオブジェクトの反復子
+func protocolIterator(next object.Object, env *object.Environment) *object.Iterator {
+	valueKey := &object.String{Value: "value"}
+	doneKey := &object.String{Value: "done"}
+	return &object.Iterator{
+		Name: "next",
+		NextFn: func() (object.Object, bool) {
+			result := applyFunction(next, nil, env)
+			if isError(result) {
+				return result, true
+			}
+			hash := hashOf(result)
+			if hash == nil {
+				return newError("next() must return {value, done}, got %s", result.Type()), true
+			}
+			if done, err := hash.Get(doneKey); err == nil && isTruthy(done) {
+				return nil, false
+			}
+			value, err := hash.Get(valueKey)
+			if err != nil {
+				value = object.UNDEFINED
+			}
+			return value, true
+		},
+	}
+}
+
+// 反復子の残りをすべて取り出す
+func collectIterator(it *object.Iterator) ([]object.Object, *object.Error) {
+	values := []object.Object{}
+	for {
+		val, ok := it.Next()
+		if !ok {
+			return values, nil
+		}
+		if err, isErr := val.(*object.Error); isErr {
+			it.Close()
+			return nil, err
+		}
+		values = append(values, val)
+	}
+}
+
+/*
+ * ...値 を展開する（配列リテラルと引数）
+ */
+func evalSpread(node *ast.PrefixExpression, env *object.Environment) ([]object.Object, object.Object) {
+	right := Eval(node.Right, env)
+	if isError(right) {
+		return nil, right
+	}
+	it, err := toIterator(right, env)
+	if err != nil {
+		return nil, err
+	}
+	values, err := collectIterator(it)
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+/*
+ * 反復子のメソッド
+ * next()は{value, done}を返す
+ */
+func iteratorMethod(it *object.Iterator, name string) object.Object {
+	switch name {
+	case "next":
+		return &object.Builtin{Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			val, ok := it.Next()
+			if isError(val) {
+				return val
+			}
+			result := object.NewHash()
+			if !ok {
+				val = object.UNDEFINED
+			}
+			result.Set(&object.String{Value: "value"}, val)
+			result.Set(&object.String{Value: "done"}, evalBoolLiteral(!ok))
+			return result
+		}}
+	case "close":
+		return &object.Builtin{Fn: func(env *object.Environment, args ...object.Object) object.Object {
+			it.Close()
+			return object.NULL
+		}}
+	}
+	return newError("unknown iterator method: %s", name)
+}
+
+/*
+ * 反復子の組み込み関数
+ * take/skip/map/filter/chainは値を必要になったときに1つずつ作る
+ * builtinsから関数を呼び出すので初期化はinitで行う
+ */
+func init() {
+	builtins["iter"] = &object.Builtin{Fn: func(env *object.Environment, args ...object.Object) object.Object {
+		if len(args) != 1 {
+			return newKindError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=1", len(args))
+		}
+		it, err := toIterator(args[0], env)
+		if err != nil {
+			return err
+		}
+		return it
+	}}
+	builtins["collect"] = &object.Builtin{Fn: func(env *object.Environment, args ...object.Object) object.Object {
+		if len(args) != 1 {
+			return newKindError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=1", len(args))
+		}
+		it, err := toIterator(args[0], env)
+		if err != nil {
+			return err
+		}
+		values, err := collectIterator(it)
+		if err != nil {
+			return err
+		}
+		if err := executionOf(env).allocate(len(values) + 1); err != nil {
+			return err
+		}
+		return &object.Array{Elements: values}
+	}}
+	builtins["take"] = &object.Builtin{Fn: func(env *object.Environment, args ...object.Object) object.Object {
+		src, n, err := iteratorAndCount("take", args, env)
+		if err != nil {
+			return err
+		}
+		count := int64(0)
+		return &object.Iterator{
+			Name: "take",
+			NextFn: func() (object.Object, bool) {
+				// 必要な数だけ取ったら元はもう使わない
+				if count >= n {
+					src.Close()
+					return nil, false
+				}
+				count++
+				return src.Next()
+			},
+			CloseFn: src.Close,
+		}
+	}}
+	builtins["skip"] = &object.Builtin{Fn: func(env *object.Environment, args ...object.Object) object.Object {
+		src, n, err := iteratorAndCount("skip", args, env)
+		if err != nil {
+			return err
+		}
+		skipped := false
+		return &object.Iterator{
+			Name: "skip",
+			NextFn: func() (object.Object, bool) {
+				for ; !skipped && n > 0; n-- {
+					val, ok := src.Next()
+					if !ok || isError(val) {
+						return val, ok
+					}
+				}
+				skipped = true
+				return src.Next()
+			},
+			CloseFn: src.Close,
+		}
+	}}
+	builtins["map"] = &object.Builtin{Fn: func(env *object.Environment, args ...object.Object) object.Object {
+		src, fn, err := iteratorAndFunction("map", args, env)
+		if err != nil {
+			return err
+		}
+		return &object.Iterator{
+			Name: "map",
+			NextFn: func() (object.Object, bool) {
+				val, ok := src.Next()
+				if !ok || isError(val) {
+					return val, ok
+				}
+				return applyFunction(fn, []object.Object{val}, env), true
+			},
+			CloseFn: src.Close,
+		}
+	}}
+	builtins["filter"] = &object.Builtin{Fn: func(env *object.Environment, args ...object.Object) object.Object {
+		src, fn, err := iteratorAndFunction("filter", args, env)
+		if err != nil {
+			return err
+		}
+		return &object.Iterator{
+			Name: "filter",
+			NextFn: func() (object.Object, bool) {
+				for {
+					val, ok := src.Next()
+					if !ok || isError(val) {
+						return val, ok
+					}
+					keep := applyFunction(fn, []object.Object{val}, env)
+					if isError(keep) {
+						return keep, true
+					}
+					if isTruthy(keep) {
+						return val, true
+					}
+				}
+			},
+			CloseFn: src.Close,
+		}
+	}}
+	builtins["chain"] = &object.Builtin{Fn: func(env *object.Environment, args ...object.Object) object.Object {
+		sources := make([]*object.Iterator, len(args))
+		for i, arg := range args {
+			it, err := toIterator(arg, env)
+			if err != nil {
+				return err
+			}
+			sources[i] = it
+		}
+		return &object.Iterator{
+			Name: "chain",
+			NextFn: func() (object.Object, bool) {
+				for len(sources) > 0 {
+					if val, ok := sources[0].Next(); ok {
+						return val, true
+					}
+					sources = sources[1:]
+				}
+				return nil, false
+			},
+			CloseFn: func() {
+				for _, it := range sources {
+					it.Close()
+				}
+			},
+		}
+	}}
+}
+
+// take/skipの引数（反復できる値と個数）
+func iteratorAndCount(name string, args []object.Object, env *object.Environment) (*object.Iterator, int64, *object.Error) {
+	if len(args) != 2 {
+		return nil, 0, newKindError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=2", len(args))
+	}
+	n, ok := args[1].(*object.Integer)
+	if !ok {
+		return nil, 0, newKindError(object.TYPE_ERROR, "argument to `%s` must be INTEGER, got %s", name, args[1].Type())
+	}
+	it, err := toIterator(args[0], env)
+	if err != nil {
+		return nil, 0, err
+	}
+	return it, n.Value, nil
+}
+
+// map/filterの引数（反復できる値と関数）
+func iteratorAndFunction(name string, args []object.Object, env *object.Environment) (*object.Iterator, object.Object, *object.Error) {
+	if len(args) != 2 {
+		return nil, nil, newKindError(object.ARGUMENT_ERROR, "wrong number of arguments. got=%d, want=2", len(args))
+	}
+	switch args[1].(type) {
+	case *object.Function, *object.Builtin:
+	default:
+		return nil, nil, newKindError(object.TYPE_ERROR, "argument to `%s` must be FUNCTION, got %s", name, args[1].Type())
+	}
+	it, err := toIterator(args[0], env)
+	if err != nil {
+		return nil, nil, err
+	}
+	return it, args[1], nil
+}
@@ -0,0 +1,202 @@
+package evaluator
+
+import (
+	"context"
+	"fmt"
+	"monkey/ast"
+	"monkey/object"
+	"sync"
+)
+
+/*
+ * 実行の制限
+ * 0なら制限しない（呼び出しの深さだけは0なら DefaultMaxCallDepth）
+ * 呼び出しの深さを越えたら stack overflow のエラーにする
+ */
+type Limits struct {
+	MaxSteps       int64 // 評価するノードの数
+	MaxAllocations int64 // 作る値の数（配列やハッシュは要素の数も数える）
+	MaxOutput      int64 // putsで出力するバイト数
+	MaxCallDepth   int   // 関数呼び出しの深さ（タスクごとに数える）
+}
+
+// 関数呼び出しの深さの上限の既定値
+const DefaultMaxCallDepth = 10000
+
+/*
+ * 実行
+ * プログラムの評価と、そこから始めたタスクをまとめたもの
+ * 制限とcontextとインタプリタのロックは実行ごとにあり、タスクも同じものを使う
+ * 評価する環境に載せて、そこから作る環境に引き継ぐ
+ * 関数呼び出しの環境には呼び出し元の実行を載せ直す
+ */
+type Execution struct {
+	ctx         context.Context
+	cancel      context.CancelFunc
+	locked      chan struct{}             // インタプリタのロック（値が入っていれば誰かが持っている）
+	tasks       sync.WaitGroup            // 終わっていないタスク
+	generators  map[*object.Iterator]bool // 始めて終わっていないジェネレータ
+	observer    Observer
+	limits      Limits
+	steps       int64
+	allocations int64
+	output      int64
+	calls       uint64        // 関数呼び出しの数（他のタスクに順番を回すのに使う）
+	waits       sync.Mutex    // 下の6つを守る
+	evaluating  bool          // トップレベルを評価している途中か
+	running     int           // 動いているタスクの数（トップレベルの評価も数える）
+	waiting     int           // チャンネルやタスクを待っているタスクの数
+	wakes       uint64        // 待ち終わった回数
+	watching    bool          // 進めなくなったかを確かめている途中か
+	stalled     chan struct{} // すべてのタスクが待っていて進めなくなったら閉じる
+	err         *object.Error // 一度制限を越えたら以後は同じエラーを返す
+}
+
+// Closeするまでは続けて評価できる
+func NewExecution(ctx context.Context, opts Options) *Execution {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Execution{
+		ctx:        ctx,
+		cancel:     cancel,
+		locked:     make(chan struct{}, 1),
+		stalled:    make(chan struct{}),
+		generators: map[*object.Iterator]bool{},
+		observer:   opts.Observer,
+		limits:     opts.Limits,
+	}
+}
+
+/*
+ * 実行を終える
+ * 終わっていないタスクを止めて、終わるまで待ってから
+ * 最後まで読まれていないジェネレータを閉じる
+ * 止めた後なので、ジェネレータのdeferは途中で止められることがある
+ * 以後の評価はCanceledのエラーになる
+ */
+func (e *Execution) Close() {
+	e.cancel()
+	e.tasks.Wait()
+
+	e.locked <- struct{}{}
+	defer e.unlock()
+	// 閉じるときに本体が別のジェネレータを始めることもある
+	for len(e.generators) > 0 {
+		for it := range e.generators {
+			delete(e.generators, it)
+			it.Close()
+		}
+	}
+}
+
+// 環境の実行を返す
+// 実行を載せていない環境なら制限のない実行を載せる
+func executionOf(env *object.Environment) *Execution {
+	if exec, ok := env.Runtime().(*Execution); ok {
+		return exec
+	}
+	exec := NewExecution(context.Background(), Options{})
+	env.SetRuntime(exec)
+	return exec
+}
+
+// contextを調べる間隔（ノードの数）
+const contextCheckInterval = 64
+
+/*
+ * contextと制限をつけてプログラムを実行する
+ * 制限を越えたりcontextが終わったりしたら、KindがLimitExceededかCanceledのエラーを返す
+ */
+func EvalContext(
+	ctx context.Context,
+	program *ast.Program,
+	env *object.Environment,
+	limits Limits,
+) object.Object {
+	exec := NewExecution(ctx, Options{Limits: limits})
+	defer exec.Close()
+	return exec.Eval(program, env)
+}
+
+// ノードを1つ評価する前に呼ぶ
+func (e *Execution) step() *object.Error {
+	e.steps++
+	if e.limits.MaxSteps > 0 && e.steps > e.limits.MaxSteps {
+		return e.fail(newLimitError("step limit exceeded: %d", e.limits.MaxSteps))
+	}
+	if e.steps%contextCheckInterval == 0 {
+		return e.check()
+	}
+	return e.err
+}
+
+// contextが終わっていないか、制限を越えていないか
+func (e *Execution) check() *object.Error {
+	if e.err != nil {
+		return e.err
+	}
+	select {
+	case <-e.ctx.Done():
+		return e.canceled()
+	default:
+		return nil
+	}
+}
+
+// 値をn個作る
+func (e *Execution) allocate(n int) *object.Error {
+	e.allocations += int64(n)
+	if e.observer != nil {
+		e.observer.Allocate(n)
+	}
+	if e.limits.MaxAllocations > 0 && e.allocations > e.limits.MaxAllocations {
+		return e.fail(newLimitError("allocation limit exceeded: %d", e.limits.MaxAllocations))
+	}
+	return e.err
+}
+
+func (e *Execution) maxCallDepth() int {
+	if e.limits.MaxCallDepth > 0 {
+		return e.limits.MaxCallDepth
+	}
+	return DefaultMaxCallDepth
+}
+
+// nバイト出力する
+func (e *Execution) write(n int) *object.Error {
+	e.output += int64(n)
+	if e.limits.MaxOutput > 0 && e.output > e.limits.MaxOutput {
+		return e.fail(newLimitError("output limit exceeded: %d", e.limits.MaxOutput))
+	}
+	return e.err
+}
+
+func (e *Execution) fail(err *object.Error) *object.Error {
+	if e.err == nil {
+		e.err = err
+	}
+	return e.err
+}
+
+// 待っている処理をやめるためのチャンネル
+func (e *Execution) done() <-chan struct{} {
+	return e.ctx.Done()
+}
+
+// 待っている間にcontextが終わったときのエラー
+func (e *Execution) canceled() *object.Error {
+	return e.fail(canceledError(e.ctx))
+}
+
+func canceledError(ctx context.Context) *object.Error {
+	return &object.Error{Kind: object.CANCELED, Message: ctx.Err().Error()}
+}
+
+func newLimitError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Kind: object.LIMIT_EXCEEDED, Message: fmt.Sprintf(format, a...)}
+}
+
+// 制限かcontextで止められたエラーか
+func isStopError(obj object.Object) bool {
+	err, ok := obj.(*object.Error)
+	return ok && (err.Kind == object.LIMIT_EXCEEDED || err.Kind == object.CANCELED)
+}
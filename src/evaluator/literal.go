@@ -13,10 +13,36 @@ func evalBoolLiteral(input bool) *object.Boolean {
 	return object.FALSE
 }
 
+// 埋め込んだ式は前から順に + でつなぐ
+func evalTemplateLiteral(
+	node *ast.TemplateLiteral,
+	env *object.Environment,
+) object.Object {
+	var result object.Object = &object.String{Value: node.Strings[0]}
+	for i, v := range node.Values {
+		val := Eval(v, env)
+		if isError(val) {
+			return val
+		}
+		result = evalInfix("+", result, val, env)
+		if isError(result) {
+			return result
+		}
+		result = evalInfix("+", result, &object.String{Value: node.Strings[i+1]}, env)
+		if isError(result) {
+			return result
+		}
+	}
+	return result
+}
+
 func evalHashLiteral(
 	node *ast.HashLiteral,
 	env *object.Environment,
 ) object.Object {
+	if err := executionOf(env).allocate(node.Pairs.Len() + 1); err != nil {
+		return err
+	}
 	hash := object.NewHash()
 
 	var err object.Object = nil
@@ -36,7 +62,7 @@ func evalHashLiteral(
 		// ハッシュを保存
 		e := hash.Set(key, value)
 		if err != nil {
-			err = newError("%s", e.Error())
+			err = hashError(e)
 			return false
 		}
 		return true
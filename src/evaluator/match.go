@@ -0,0 +1,213 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+)
+
+/*
+ * match式
+ * 上から順にパターンを試して最初に一致した腕の値を返す
+ * どれにも一致しなければエラー
+ */
+func evalMatchExpression(node *ast.MatchExpression, env *object.Environment) object.Object {
+	subject := Eval(node.Subject, env)
+	if isError(subject) {
+		return subject
+	}
+
+	for _, arm := range node.Arms {
+		// 束縛は腕の中だけで有効
+		armEnv := object.NewBlockEnvironment(env)
+		matched, err := matchPattern(arm.Pattern, subject, armEnv)
+		if err != nil {
+			return err
+		}
+		if !matched {
+			continue
+		}
+		if arm.Guard != nil {
+			guard := Eval(arm.Guard, armEnv)
+			if isError(guard) {
+				return guard
+			}
+			if !isTruthy(guard) {
+				continue
+			}
+		}
+		result := Eval(arm.Body, armEnv)
+		if result == nil {
+			return object.NULL
+		}
+		return result
+	}
+	return newError("no match arm for %s on line %d col %d",
+		subject.Inspect(), node.Token.Row, node.Token.Col)
+}
+
+// 値がパターンに一致するか調べて、一致したら名前を束縛する
+func matchPattern(pattern ast.Pattern, value object.Object, env *object.Environment) (bool, object.Object) {
+	switch p := pattern.(type) {
+	case *ast.WildcardPattern:
+		return true, nil
+
+	case *ast.BindingPattern:
+		// 型やコンストラクタの名前だけなら束縛せずにその型かを調べる
+		if p.Type == nil && namesType(p.Name.Name, env) {
+			return simpleTypeMatches(value, p.Name.Name, env), nil
+		}
+		if p.Type != nil && !typeMatches(value, p.Type, env) {
+			return false, nil
+		}
+		if p.Name.Name != "_" {
+			env.Set(p.Name.Name, value)
+		}
+		return true, nil
+
+	case *ast.TypePattern:
+		return typeMatches(value, p.Type, env), nil
+
+	case *ast.LiteralPattern:
+		literal := Eval(p.Value, env)
+		if isError(literal) {
+			return false, literal
+		}
+		matched := evalInfix("==", value, literal, env)
+		if isError(matched) {
+			return false, matched
+		}
+		return matched == object.TRUE, nil
+
+	case *ast.RangePattern:
+		return matchRange(p, value, env)
+
+	case *ast.ArrayPattern:
+		if it, ok := value.(*object.Iterator); ok {
+			return matchIteratorPattern(p, it, env)
+		}
+		arr, ok := value.(*object.Array)
+		if !ok {
+			return false, nil
+		}
+		if len(arr.Elements) < len(p.Elements) || (p.Rest == nil && len(arr.Elements) != len(p.Elements)) {
+			return false, nil
+		}
+		for i, el := range p.Elements {
+			matched, err := matchPattern(el, arr.Elements[i], env)
+			if err != nil || !matched {
+				return matched, err
+			}
+		}
+		if p.Rest != nil && p.Rest.Name != "_" {
+			rest := make([]object.Object, len(arr.Elements)-len(p.Elements))
+			copy(rest, arr.Elements[len(p.Elements):])
+			env.Set(p.Rest.Name, &object.Array{Elements: rest})
+		}
+		return true, nil
+
+	case *ast.HashPattern:
+		hash := hashOf(value)
+		if hash == nil {
+			return false, nil
+		}
+		class, _ := value.(*object.Class)
+		for i, key := range p.Keys {
+			// 外から見えないメンバは無いものとして扱う
+			if class != nil && checkMemberAccess(class, key, env) != nil {
+				return false, nil
+			}
+			val, err := hash.Get(&object.String{Value: key})
+			if err != nil {
+				return false, nil
+			}
+			matched, e := matchPattern(p.Values[i], val, env)
+			if e != nil || !matched {
+				return matched, e
+			}
+		}
+		return true, nil
+
+	case *ast.OrPattern:
+		for _, alt := range p.Alternatives {
+			matched, err := matchPattern(alt, value, env)
+			if err != nil || matched {
+				return matched, err
+			}
+		}
+		return false, nil
+	}
+	return false, newError("unknown pattern: %s", pattern.String())
+}
+
+// 範囲（両端を含む）
+// 数値でなければ一致しない
+func matchRange(p *ast.RangePattern, value object.Object, env *object.Environment) (bool, object.Object) {
+	switch value.Type() {
+	case object.INTEGER_OBJ, object.FLOAT_OBJ:
+	default:
+		return false, nil
+	}
+	low := Eval(p.Low, env)
+	if isError(low) {
+		return false, low
+	}
+	high := Eval(p.High, env)
+	if isError(high) {
+		return false, high
+	}
+	below := evalInfix("<", value, low, env)
+	if isError(below) {
+		return false, below
+	}
+	above := evalInfix(">", value, high, env)
+	if isError(above) {
+		return false, above
+	}
+	return below == object.FALSE && above == object.FALSE, nil
+}
+
+/*
+ * 反復子の配列パターン
+ * 必要な数だけ取り出して、...restには残りの反復子をそのまま束縛する
+ */
+func matchIteratorPattern(p *ast.ArrayPattern, it *object.Iterator, env *object.Environment) (bool, object.Object) {
+	for _, el := range p.Elements {
+		val, ok := it.Next()
+		if !ok {
+			return false, nil
+		}
+		if isError(val) {
+			return false, val
+		}
+		matched, err := matchPattern(el, val, env)
+		if err != nil || !matched {
+			return matched, err
+		}
+	}
+	if p.Rest == nil {
+		// 要素が余っていたら一致しない
+		if _, ok := it.Next(); ok {
+			it.Close()
+			return false, nil
+		}
+		return true, nil
+	}
+	// 残りを使わないならここで閉じる（束縛したものは実行の終わりに閉じる）
+	if p.Rest.Name == "_" {
+		it.Close()
+	} else {
+		env.Set(p.Rest.Name, it)
+	}
+	return true, nil
+}
+
+// 名前がtypeで宣言した型かコンストラクタ（thisを返す関数）を指しているか
+func namesType(name string, env *object.Environment) bool {
+	switch t := env.Get(name).(type) {
+	case *object.Type:
+		return true
+	case *object.Function:
+		return t.Body.ReturnsThis()
+	}
+	return false
+}
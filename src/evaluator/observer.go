@@ -0,0 +1,24 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+)
+
+/*
+ * 評価を見るもの（デバッガ、カバレッジ、プロファイラ）
+ * 実行ごとに1つ持たせて、インタプリタのロックの中から呼ぶ
+ * Nodeはノードを評価する前、Leaveは関数から戻ったとき、Allocateは値をn個作ったとき
+ * Nodeが戻るまで評価は止まる
+ */
+type Observer interface {
+	Node(node ast.Node, env *object.Environment)
+	Leave(frame *object.Frame)
+	Allocate(n int)
+}
+
+// 実行のオプション
+type Options struct {
+	Limits   Limits
+	Observer Observer // nilなら見ない
+}
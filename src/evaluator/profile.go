@@ -0,0 +1,161 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+	"time"
+)
+
+// 関数（名前と定義の位置で区別する、位置は本体の { の位置）
+type ProfileFunction struct {
+	Name string
+	Row  int
+	Col  int
+}
+
+// トップレベルの文は関数の外にある
+var TopLevel = ProfileFunction{Name: "$top"}
+
+/*
+ * 呼び出しのスタックの1段
+ * 親からの道のりがスタックで、Rowはこの段の関数で評価していた行
+ * 値はこの段がいちばん内側だったときのもの（自分の分だけ）
+ */
+type ProfileNode struct {
+	Parent      *ProfileNode // 根ならnil（根は値を持たない）
+	Function    ProfileFunction
+	Row         int
+	Statements  int64         // 評価を始めた文の数
+	Time        time.Duration // 使った時間
+	Allocations int64         // 作った値の数（制限と同じ数え方）
+	children    map[profileKey]*ProfileNode
+}
+
+type profileKey struct {
+	fn  ProfileFunction
+	row int
+}
+
+// 同じスタックには同じ段を返す
+func (n *ProfileNode) child(fn ProfileFunction, row int, p *Profile) *ProfileNode {
+	key := profileKey{fn, row}
+	if c, ok := n.children[key]; ok {
+		return c
+	}
+	c := &ProfileNode{Parent: n, Function: fn, Row: row, children: map[profileKey]*ProfileNode{}}
+	n.children[key] = c
+	p.nodes = append(p.nodes, c)
+	return c
+}
+
+/*
+ * プロファイルの記録
+ * 文の評価を始めるときと関数から戻るときに、前からの時間をそれまでの場所に足す
+ * 場所は呼び出しのスタックと行で、値を作った数も作ったときの場所に足す
+ * 段は呼び出しの記録ごとに覚えるので、ジェネレータやタスクも呼び出し元の下に入る
+ * 実行を見るものとしてOptionsに渡す
+ */
+type Profile struct {
+	Start    time.Time
+	Duration time.Duration
+	root     *ProfileNode                   // スタックの根（値は持たない）
+	nodes    []*ProfileNode                 // 作った順
+	open     map[*object.Frame]*ProfileNode // 呼び出しごとにいま評価している段（トップレベルはnil）
+	current  *ProfileNode                   // いま評価している場所
+	last     time.Time
+}
+
+func NewProfile() *Profile {
+	now := time.Now()
+	return &Profile{
+		Start: now,
+		root:  &ProfileNode{children: map[profileKey]*ProfileNode{}},
+		open:  map[*object.Frame]*ProfileNode{},
+		last:  now,
+	}
+}
+
+// 記録したスタックの段を作った順に返す
+func (p *Profile) Nodes() []*ProfileNode {
+	return p.nodes
+}
+
+// 最後の場所までの時間を足して記録を終える
+func (p *Profile) Stop() {
+	p.charge()
+	p.current = nil
+	p.Duration = time.Since(p.Start)
+}
+
+// 前からの時間をいまの場所に足す
+func (p *Profile) charge() {
+	now := time.Now()
+	if p.current != nil {
+		p.current.Time += now.Sub(p.last)
+	}
+	p.last = now
+}
+
+func (p *Profile) Node(node ast.Node, env *object.Environment) {
+	switch node.(type) {
+	case *ast.BlockStatement, *ast.CommentStatement:
+		return
+	case ast.Statement:
+	default:
+		return
+	}
+	p.charge()
+
+	frame := env.Frame()
+	fn := TopLevel
+	if frame != nil {
+		fn = profileFunction(frame.Function)
+	}
+	// 同じ呼び出しの続きなら同じ親、初めてなら呼び出し元のいまの段の下
+	parent := p.root
+	if prev, ok := p.open[frame]; ok {
+		parent = prev.Parent
+	} else if frame != nil {
+		parent = p.caller(frame)
+	}
+	n := parent.child(fn, ast.NodeToken(node).Row, p)
+	p.open[frame] = n
+	n.Statements++
+	p.current = n
+}
+
+// 呼び出し元をたどって、まだ戻っていないものの段（なければ根）
+func (p *Profile) caller(frame *object.Frame) *ProfileNode {
+	for f := frame.Parent; ; f = f.Parent {
+		if n, ok := p.open[f]; ok {
+			return n
+		}
+		if f == nil {
+			return p.root
+		}
+	}
+}
+
+// 関数から戻ったら呼び出し元の行に戻す
+func (p *Profile) Leave(frame *object.Frame) {
+	p.charge()
+	delete(p.open, frame)
+	p.current = p.caller(frame)
+	if p.current == p.root {
+		p.current = nil
+	}
+}
+
+func (p *Profile) Allocate(n int) {
+	if p.current != nil {
+		p.current.Allocations += int64(n)
+	}
+}
+
+func profileFunction(fn *object.Function) ProfileFunction {
+	f := ProfileFunction{Name: fn.DisplayName()}
+	if fn.Body != nil {
+		f.Row, f.Col = fn.Body.Token.Row, fn.Body.Token.Col
+	}
+	return f
+}
@@ -1,27 +1,75 @@
 package evaluator
 
 import (
+	"context"
 	"monkey/ast"
 	"monkey/object"
 )
 
 /*
- *
+ * プログラムはそれだけで1つの実行になる
+ * 評価を終えたら、残ったタスクを止める
  */
 func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+	exec := NewExecution(context.Background(), Options{})
+	defer exec.Close()
+	return exec.Eval(program, env)
+}
+
+/*
+ * この実行でプログラムを評価する
+ * 前の評価で始めたタスクはCloseまで動き続ける
+ */
+func (e *Execution) Eval(program *ast.Program, env *object.Environment) object.Object {
+	// トップレベルの実行もタスクの1つとしてロックを持つ
+	if !e.lock() {
+		return e.canceled()
+	}
+	defer e.unlock()
+	e.started(true)
+	defer e.finished(true)
+
+	// 環境に実行を載せて、そこから作る環境に引き継ぐ
+	saved := env.Runtime()
+	env.SetRuntime(e)
+	defer env.SetRuntime(saved)
+	if err := e.check(); err != nil {
+		return err
+	}
 
 	var result object.Object
 
+statements:
 	for _, statement := range program.Statements {
-		result = Eval(statement, env)
+		result = evalStatement(statement, env)
 
-		switch result := result.(type) {
+		switch r := result.(type) {
 		case *object.ReturnValue:
-			return result.Value
+			result = r.Value
+			break statements
 		case *object.Error:
-			return result
+			break statements
+		case *object.Break, *object.Continue:
+			result = strayJumpError(r)
+			break statements
 		}
 	}
 
-	return result
+	// トップレベルのdeferを実行する
+	return runDeferred(env, result)
+}
+
+/*
+ * この実行でトップレベルから関数を呼び出す
+ * プログラムの評価が終わった後で、宣言された関数を呼ぶのに使う（テストなど）
+ */
+func (e *Execution) Call(fn object.Object, args ...object.Object) object.Object {
+	if !e.lock() {
+		return e.canceled()
+	}
+	defer e.unlock()
+
+	env := object.NewEnvironment()
+	env.SetRuntime(e)
+	return applyFunction(fn, args, env)
 }
@@ -0,0 +1,83 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+	"strings"
+)
+
+/*
+ * メタプロパティ（x.@name）
+ * シリアライズやデバッグのためにオブジェクト自身の情報を返す
+ */
+func evalMetaExpression(node *ast.MetaExpression, env *object.Environment) object.Object {
+	left := Eval(node.Left, env)
+	if isError(left) {
+		return left
+	}
+
+	// どのオブジェクトでも使える
+	typeName := strings.ToLower(string(left.Type()))
+	if node.Name == "type" {
+		return &object.String{Value: typeName}
+	}
+
+	switch obj := left.(type) {
+	case *object.Class:
+		if val := evalClassMeta(obj, node.Name); val != nil {
+			return val
+		}
+	case *object.Function:
+		if node.Name == "name" {
+			return &object.String{Value: obj.DisplayName()}
+		}
+	}
+	return newError("unknown meta property: %s.@%s", typeName, node.Name)
+}
+
+// クラスのメタプロパティ
+func evalClassMeta(class *object.Class, name string) object.Object {
+	switch name {
+	case "name":
+		return &object.String{Value: class.ClassName()}
+	case "constructor":
+		if fn := class.Constructor(); fn != nil {
+			return fn
+		}
+		return object.UNDEFINED
+	case "parent":
+		if ancestors := class.Ancestors(); len(ancestors) > 0 {
+			return ancestors[0]
+		}
+		return object.UNDEFINED
+	case "parents":
+		parents := []object.Object{}
+		for _, fn := range class.Ancestors() {
+			parents = append(parents, fn)
+		}
+		return &object.Array{Elements: parents}
+	case "members":
+		members := []object.Object{}
+		for _, n := range class.MemberNames() {
+			members = append(members, memberInfo(class, n))
+		}
+		return &object.Array{Elements: members}
+	}
+	return nil
+}
+
+// メンバの情報をハッシュにする
+// {name:"a", mutable:true, public:false, type:"number"}
+func memberInfo(class *object.Class, name string) *object.Hash {
+	m := class.Member(name)
+	info := object.NewHash()
+	info.Set(&object.String{Value: "name"}, &object.String{Value: name})
+	info.Set(&object.String{Value: "mutable"}, evalBoolLiteral(m.Mutable))
+	info.Set(&object.String{Value: "public"}, evalBoolLiteral(class.IsPublic(name)))
+	if m.Type != nil {
+		info.Set(&object.String{Value: "type"}, &object.String{Value: m.Type.String()})
+	} else {
+		info.Set(&object.String{Value: "type"}, object.UNDEFINED)
+	}
+	return info
+}
@@ -3,6 +3,8 @@ package evaluator
 import (
 	"monkey/ast"
 	"monkey/object"
+	"monkey/token"
+	"strings"
 )
 
 /*
@@ -15,7 +17,7 @@ func evalBlockStatement(
 	var result object.Object
 
 	for _, statement := range block.Statements {
-		result = Eval(statement, env)
+		result = evalStatement(statement, env)
 		// エラーじゃなかったら
 		if result != nil {
 			// ループを抜けて終了するパターン
@@ -34,6 +36,22 @@ func evalBlockStatement(
 	return result
 }
 
+/*
+ * 文を1つ実行する
+ * 文として書かれた {} はブロックなので、中の宣言はその中だけで有効にする
+ */
+func evalStatement(statement ast.Statement, env *object.Environment) object.Object {
+	if block, ok := statement.(*ast.BlockStatement); ok {
+		return evalScopedBlock(block, env)
+	}
+	return Eval(statement, env)
+}
+
+// ブロック用の環境を作ってブロックを実行する
+func evalScopedBlock(block *ast.BlockStatement, env *object.Environment) object.Object {
+	return Eval(block, object.NewBlockEnvironment(env))
+}
+
 /*
  * 派生
  */
@@ -42,7 +60,13 @@ func evalDeriveStatment(
 	env *object.Environment,
 ) object.Object {
 
-	right := Eval(node.Right, env)
+	// 派生元は派生先で実装される抽象メンバを持っていてよい
+	var right object.Object
+	if call, ok := node.Right.(*ast.CallExpression); ok {
+		right = evalCall(call, env, true)
+	} else {
+		right = Eval(node.Right, env)
+	}
 	if isError(right) {
 		return right
 	}
@@ -67,11 +91,80 @@ func evalDeriveStatment(
  * 変数束縛
  */
 func evalLetStatement(node *ast.LetStatement, env *object.Environment) object.Object {
+	if node.Token.Type == token.CONST || node.Token.Type == token.SHARE {
+		return evalStaticStatement(node, env)
+	}
+	// 値のない宣言はundefined
+	// 型だけ宣言されていたら抽象メンバ
+	if node.Value == nil {
+		env.DeclareMember(node.Ident.Name, object.UNDEFINED, &object.Member{
+			Mutable:  node.Token.Type != token.IMM,
+			Public:   node.Public,
+			Type:     node.Ident.Type,
+			Abstract: node.Ident.Type != nil,
+		})
+		return nil
+	}
+	val := Eval(node.Value, env)
+	switch val.(type) {
+	case *object.Error, *object.ReturnValue, *object.Break, *object.Continue:
+		// ループの中のreturnなどは外に伝える
+		return val
+	case nil:
+		// 値を返さずに終わったループ
+		val = object.UNDEFINED
+	}
+	nameFunction(val, node.Ident.Name)
+	env.DeclareMember(node.Ident.Name, val, &object.Member{
+		Mutable: node.Token.Type != token.IMM,
+		Public:  node.Public,
+		Type:    node.Ident.Type,
+	})
+	return nil
+}
+
+/*
+ * 型の宣言
+ */
+func evalTypeStatement(node *ast.TypeStatement, env *object.Environment) object.Object {
+	env.Declare(node.Ident.Name, &object.Type{Name: node.Ident.Name, Node: node.Value}, false)
+	return nil
+}
+
+/*
+ * 名前のない関数に束縛先の名前をつける
+ * imm ClassA = ()=>{} なら ClassA になる
+ */
+func nameFunction(val object.Object, name string) {
+	if fn, ok := val.(*object.Function); ok && fn.Name == "" {
+		fn.Name = name
+	}
+}
+
+/*
+ * 静的メンバの束縛（const/share）
+ * 値はコンストラクタ関数に置かれ、全インスタンスで共有される。
+ * 最初に実行されたときに一度だけ評価する。
+ */
+func evalStaticStatement(node *ast.LetStatement, env *object.Environment) object.Object {
+	fn := env.Function()
+	if fn == nil {
+		return newError("%s declaration outside of a function: %s on line %d col %d",
+			node.Token.Literal, node.Ident.Name, node.Token.Row, node.Token.Col)
+	}
+	statics := fn.Statics()
+	if _, ok := statics.GetLocal(node.Ident.Name); ok {
+		return nil
+	}
 	val := Eval(node.Value, env)
 	if isError(val) {
 		return val
 	}
-	env.Set(node.Ident.Name, val)
+	nameFunction(val, node.Ident.Name)
+	statics.DeclareMember(node.Ident.Name, val, &object.Member{
+		Mutable: node.Token.Type == token.SHARE,
+		Type:    node.Ident.Type,
+	})
 	return nil
 }
 
@@ -91,11 +184,9 @@ func evalAssignStatement(
 
 	// 変数再代入
 	case *ast.Identifier:
-		result := env.Get(nameExpr.Name)
-		if result == nil {
-			return newError("identifier not found: %s", nameExpr.Name)
+		if err := env.Assign(nameExpr.Name, right); err != nil {
+			return hashError(err)
 		}
-		env.Set(nameExpr.Name, right)
 		return right
 
 	// アクセス演算子
@@ -111,6 +202,22 @@ func evalAssignStatement(
 			key := &object.String{Value: index.Name}
 			leftObj.Set(key, right)
 			return right
+		case *object.Class:
+			if err := checkMemberAccess(leftObj, index.Name, env); err != nil {
+				return err
+			}
+			if !leftObj.IsMutable(index.Name) {
+				return newKindError(object.ACCESS_ERROR, "cannot assign to immutable: %s", index.Name)
+			}
+			key := &object.String{Value: index.Name}
+			leftObj.Set(key, right)
+			return right
+		// 静的メンバ（Ctor.NAME = ...）
+		case *object.Function:
+			if err := leftObj.Statics().AssignLocal(index.Name, right); err != nil {
+				return hashError(err)
+			}
+			return right
 		default:
 			return newError("assignment target not assignable: %s", left.Type())
 		}
@@ -129,10 +236,10 @@ func evalAssignStatement(
 		case *object.Array:
 			idx, ok := index.(*object.Integer)
 			if !ok {
-				return newError("array index is not integer: %s", index.Type())
+				return newKindError(object.TYPE_ERROR, "array index is not integer: %s", index.Type())
 			}
 			if idx.Value < 0 || idx.Value >= int64(len(leftObj.Elements)) {
-				return newError("index out of range")
+				return newKindError(object.INDEX_ERROR, "index out of range")
 			}
 			leftObj.Elements[idx.Value] = right
 			return right
@@ -140,7 +247,7 @@ func evalAssignStatement(
 		case *object.Hash:
 			err := leftObj.Set(index, right)
 			if err != nil {
-				return newError("%s", err.Error())
+				return hashError(err)
 			}
 			return right
 
@@ -161,35 +268,254 @@ func evalLoopStatement(
 		return val
 	}
 	key := node.Bind.Ident.Name
-	exEnv := object.NewEnclosedEnvironment(env)
-	iter := object.NewHash()
 	index := int64(0)
 	kk := &object.String{Value: "k"}
 	kv := &object.String{Value: "v"}
 	ki := &object.String{Value: "i"}
 
-	switch hash := val.(type) {
-	case *object.Hash:
-		var ret object.Object = nil
-		hash.Range(func(k *object.Object, v *object.Object) bool {
-			iter.Set(kk, *k)
-			iter.Set(kv, *v)
-			iter.Set(ki, &object.Integer{Value: index})
-			exEnv.Set(key, iter)
-			evaluated := Eval(node.Block, exEnv)
-			switch evaluated.(type) {
-			case *object.Break:
-				return false
-			case *object.Continue:
-				return true
-			case *object.ReturnValue:
+	label := labelName(node.Label)
+	var ret object.Object = nil
+
+	// 1回分の繰り返し。続けるならtrueを返す
+	step := func(k object.Object, v object.Object) bool {
+		if err := executionOf(env).check(); err != nil {
+			ret = err
+			return false
+		}
+		// 繰り返しごとに環境と反復変数を作り直す
+		// ループの中で作ったクロージャはその回の値を持ち続ける
+		iter := object.NewHash()
+		iter.Set(kk, k)
+		iter.Set(kv, v)
+		iter.Set(ki, &object.Integer{Value: index})
+		iterEnv := object.NewBlockEnvironment(env)
+		iterEnv.Set(key, iter)
+		index++
+		evaluated := Eval(node.Block, iterEnv)
+		switch evaluated := evaluated.(type) {
+		case *object.Break:
+			// 他のループ宛てのbreakは外に伝える
+			if evaluated.Label == "" || evaluated.Label == label {
+				ret = evaluated.Value
+			} else {
 				ret = evaluated
-				return false
 			}
-			index++
-			return true
+			return false
+		case *object.Continue:
+			if evaluated.Label == "" || evaluated.Label == label {
+				return true
+			}
+			ret = evaluated
+			return false
+		case *object.ReturnValue, *object.Error:
+			ret = evaluated
+			return false
+		}
+		return true
+	}
+
+	if hash, ok := val.(*object.Hash); ok {
+		hash.Range(func(k *object.Object, v *object.Object) bool {
+			return step(*k, *v)
 		})
 		return ret
 	}
+
+	// ハッシュ以外は反復子で回す（kは何番目か）
+	it, err := toIterator(val, env)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	for {
+		v, ok := it.Next()
+		if !ok {
+			break
+		}
+		if isError(v) {
+			return v
+		}
+		if !step(&object.Integer{Value: index}, v) {
+			break
+		}
+	}
+	return ret
+}
+
+/*
+ * break
+ * 値はbreakしたときに評価してループの値にする
+ */
+func evalBreakStatement(
+	node *ast.BreakStatement,
+	env *object.Environment,
+) object.Object {
+	brk := &object.Break{Label: labelName(node.Label)}
+	if node.Value != nil {
+		brk.Value = Eval(node.Value, env)
+		if isError(brk.Value) {
+			return brk.Value
+		}
+	}
+	return brk
+}
+
+// ラベルの名前（なければ空文字）
+func labelName(label *ast.Identifier) string {
+	if label == nil {
+		return ""
+	}
+	return label.Name
+}
+
+/*
+ * ループの外に出てしまったbreak/continueをエラーにする
+ * それ以外はnilを返す
+ */
+func strayJumpError(obj object.Object) *object.Error {
+	switch obj := obj.(type) {
+	case *object.Break:
+		if obj.Label != "" {
+			return newError("label not found: %s", obj.Label)
+		}
+		return newError("break outside of loop")
+	case *object.Continue:
+		if obj.Label != "" {
+			return newError("label not found: %s", obj.Label)
+		}
+		return newError("continue outside of loop")
+	}
 	return nil
 }
+
+/*
+ * switch文
+ * caseの値とは == と同じ比較をする
+ * breakはswitchを抜けるだけで外のループには伝えない
+ */
+func evalSwitchStatement(
+	node *ast.SwitchStatement,
+	env *object.Environment,
+) object.Object {
+	subject := Eval(node.Subject, env)
+	if isError(subject) {
+		return subject
+	}
+
+	// 実行を始めるcaseを探す
+	start := -1
+	for i, c := range node.Cases {
+		for _, v := range c.Values {
+			value := Eval(v, env)
+			if isError(value) {
+				return value
+			}
+			matched := evalInfix("==", subject, value, env)
+			if isError(matched) {
+				return matched
+			}
+			if matched == object.TRUE {
+				start = i
+				break
+			}
+		}
+		if start >= 0 {
+			break
+		}
+	}
+	// 一致しなければdefault
+	if start < 0 {
+		for i, c := range node.Cases {
+			if c.IsDefault() {
+				start = i
+				break
+			}
+		}
+	}
+	if start < 0 {
+		return nil
+	}
+
+	var result object.Object
+	for i := start; i < len(node.Cases); i++ {
+		c := node.Cases[i]
+		result = Eval(c.Body, env)
+		switch result.(type) {
+		case *object.Break:
+			// ラベル付きのbreakはループに伝える
+			if result.(*object.Break).Label == "" {
+				return nil
+			}
+			return result
+		case *object.Error, *object.ReturnValue, *object.Continue:
+			return result
+		}
+		if !c.Fallthrough {
+			break
+		}
+	}
+	return result
+}
+
+/*
+ * defer
+ * 関数と引数はここで評価して、呼び出しは関数の終わりに行う
+ * 関数呼び出しでない式は終わりに評価する
+ */
+func evalDeferStatement(
+	node *ast.DeferStatement,
+	env *object.Environment,
+) object.Object {
+	call, ok := node.Call.(*ast.CallExpression)
+	if !ok {
+		env.Defer(func() object.Object {
+			return Eval(node.Call, env)
+		})
+		return nil
+	}
+
+	function := Eval(call.Function, env)
+	if isError(function) {
+		return function
+	}
+	args := evalExpressions(call.Arguments, env)
+	if len(args) == 1 && isError(args[0]) {
+		return args[0]
+	}
+	env.Defer(func() object.Object {
+		return applyFunction(function, args, env)
+	})
+	return nil
+}
+
+/*
+ * 関数の終わりにdeferを後に登録したものから実行する
+ * 元の結果がエラーなら、種類や原因はそのままでdeferのエラーを添える
+ * そうでなければdeferのエラーが結果になる（最初のエラーを原因にする）
+ */
+func runDeferred(env *object.Environment, result object.Object) object.Object {
+	defers := env.TakeDefers()
+	var failed []*object.Error
+	for i := len(defers) - 1; i >= 0; i-- {
+		// 止められた実行ではdeferも同じエラーになるのでまとめない
+		if err, ok := defers[i]().(*object.Error); ok && !isStopError(err) {
+			failed = append(failed, err)
+		}
+	}
+	if len(failed) == 0 {
+		return result
+	}
+	if err, ok := result.(*object.Error); ok {
+		// 元のエラーは他からも参照されているかもしれないので写してから添える
+		with := *err
+		with.Deferred = append(append([]*object.Error{}, err.Deferred...), failed...)
+		return &with
+	}
+	messages := make([]string, len(failed))
+	for i, err := range failed {
+		messages[i] = err.Message
+	}
+	deferred := newError("deferred: %s", strings.Join(messages, "; "))
+	deferred.Cause = failed[0]
+	return deferred
+}
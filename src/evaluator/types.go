@@ -0,0 +1,154 @@
+package evaluator
+
+import (
+	"monkey/ast"
+	"monkey/object"
+)
+
+/*
+ * implements演算子
+ * オブジェクトが型（typeで宣言した構造的な型）を満たしているか調べる
+ */
+func evalImplementsExpression(
+	left object.Object,
+	right object.Object,
+	env *object.Environment,
+) object.Object {
+	t, ok := right.(*object.Type)
+	if !ok {
+		return newError("right operand of implements must be a type, got %s", right.Type())
+	}
+	node := t.Node
+	if node == nil {
+		// string や number などの組み込みの型
+		node = &ast.TypeNode{Kind: ast.TypeSimple, Name: t.Name}
+	}
+	return evalBoolLiteral(typeMatches(left, node, env))
+}
+
+// 値が型に合っているか
+func typeMatches(obj object.Object, node *ast.TypeNode, env *object.Environment) bool {
+	if node == nil {
+		return true
+	}
+	switch node.Kind {
+	case ast.TypeSimple:
+		return simpleTypeMatches(obj, node.Name, env)
+
+	case ast.TypeArray:
+		arr, ok := obj.(*object.Array)
+		if !ok {
+			return false
+		}
+		for _, el := range arr.Elements {
+			if !typeMatches(el, node.ElementType, env) {
+				return false
+			}
+		}
+		return true
+
+	case ast.TypeMap:
+		hash := hashOf(obj)
+		if hash == nil {
+			return false
+		}
+		matched := true
+		hash.Range(func(k *object.Object, v *object.Object) bool {
+			matched = typeMatches(*k, node.KeyType, env) && typeMatches(*v, node.ValueType, env)
+			return matched
+		})
+		return matched
+
+	case ast.TypeObject:
+		hash := hashOf(obj)
+		if hash == nil {
+			return false
+		}
+		class, _ := obj.(*object.Class)
+		for _, prop := range node.Properties {
+			val, err := hash.Get(&object.String{Value: prop.Name})
+			if err != nil {
+				return false
+			}
+			// クラスは外から見える実装済みのメンバだけが対象
+			if class != nil {
+				m := class.Member(prop.Name)
+				if m.Abstract || !class.IsPublic(prop.Name) {
+					return false
+				}
+			}
+			if !typeMatches(val, prop.Type, env) {
+				return false
+			}
+		}
+		return true
+
+	case ast.TypeFunction:
+		switch fn := obj.(type) {
+		case *object.Builtin:
+			return true
+		case *object.Function:
+			if len(fn.Parameters) != len(node.Parameters) {
+				return false
+			}
+			// 両方で型が宣言されている引数だけ比べる
+			for i, p := range fn.Parameters {
+				want := node.Parameters[i].Type
+				if p.Type != nil && want != nil && p.Type.String() != want.String() {
+					return false
+				}
+			}
+			return true
+		}
+		return false
+	}
+	return false
+}
+
+// 名前で書かれた型
+// 組み込みの型名でなければ環境から型かコンストラクタを探す
+func simpleTypeMatches(obj object.Object, name string, env *object.Environment) bool {
+	switch name {
+	case "any":
+		return true
+	case "number":
+		switch obj.Type() {
+		case object.INTEGER_OBJ, object.FLOAT_OBJ, object.COMPLEX_OBJ:
+			return true
+		}
+		return false
+	case "string":
+		return obj.Type() == object.STRING_OBJ
+	case "boolean":
+		return obj.Type() == object.BOOLEAN_OBJ
+	case "array":
+		return obj.Type() == object.ARRAY_OBJ
+	case "object":
+		return hashOf(obj) != nil
+	case "void":
+		return obj == object.NULL || obj == object.UNDEFINED
+	}
+
+	switch t := env.Get(name).(type) {
+	case *object.Type:
+		if t.Node != nil {
+			return typeMatches(obj, t.Node, env)
+		}
+	case *object.Function:
+		if class, ok := obj.(*object.Class); ok {
+			return class.InstanceOf(t)
+		}
+	}
+	return false
+}
+
+// ハッシュとして扱えるならハッシュを返す
+func hashOf(obj object.Object) *object.Hash {
+	switch o := obj.(type) {
+	case *object.Hash:
+		return o
+	case *object.Class:
+		return &o.Hash
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"monkey/format"
+	"os"
+)
+
+/*
+ * fmt サブコマンド
+ * ファイルを整形して標準出力に出す（ファイルがなければ標準入力）
+ * -w は整形結果でファイルを書き換え、-d は差分だけを出す
+ */
+func runFormat(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	write := flags.Bool("w", false, "write result to the source file instead of stdout")
+	diff := flags.Bool("d", false, "display diffs instead of rewriting files")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() == 0 {
+		if *write {
+			fmt.Fprintln(stderr, "fmt: cannot use -w with standard input")
+			return 2
+		}
+		src, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(stderr, "fmt: %s\n", err)
+			return 1
+		}
+		if err := formatFile("<standard input>", src, false, *diff, stdout); err != nil {
+			fmt.Fprintf(stderr, "%s\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	status := 0
+	for _, path := range flags.Args() {
+		src, err := os.ReadFile(path)
+		if err == nil {
+			err = formatFile(path, src, *write, *diff, stdout)
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %s\n", path, err)
+			status = 1
+		}
+	}
+	return status
+}
+
+func formatFile(path string, src []byte, write bool, diff bool, stdout io.Writer) error {
+	out, err := format.Source(string(src))
+	if err != nil {
+		return err
+	}
+	if diff {
+		fmt.Fprint(stdout, format.Diff(path, string(src), out))
+	}
+	if write {
+		if out == string(src) {
+			return nil
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(path, []byte(out), info.Mode().Perm())
+	}
+	if !diff {
+		fmt.Fprint(stdout, out)
+	}
+	return nil
+}
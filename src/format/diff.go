@@ -0,0 +1,130 @@
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// 差分の前後に出す変わっていない行の数
+const diffContext = 3
+
+// 行ごとの編集
+type edit struct {
+	op   byte // ' ' そのまま, '-' 削除, '+' 追加
+	line string
+}
+
+/*
+ * 整形前と整形後の差分をunified形式で返す
+ * 同じなら空文字列
+ */
+func Diff(name string, before string, after string) string {
+	if before == after {
+		return ""
+	}
+	edits := diffLines(splitLines(before), splitLines(after))
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "--- %s.orig\n+++ %s\n", name, name)
+	for start := 0; start < len(edits); {
+		// 次の変更を探す
+		first := start
+		for first < len(edits) && edits[first].op == ' ' {
+			first++
+		}
+		if first == len(edits) {
+			break
+		}
+		// 変更の間が前後の文脈の2倍以下ならひとつのまとまりにする
+		last := first
+		for i := first; i < len(edits); i++ {
+			if edits[i].op != ' ' {
+				last = i
+			} else if i-last > 2*diffContext {
+				break
+			}
+		}
+		from := max(first-diffContext, 0)
+		to := min(last+diffContext+1, len(edits))
+		writeHunk(&out, edits, from, to)
+		start = to
+	}
+	return out.String()
+}
+
+func writeHunk(out *bytes.Buffer, edits []edit, from int, to int) {
+	// まとまりの先頭の行番号を数える
+	oldLine, newLine := 1, 1
+	for _, e := range edits[:from] {
+		if e.op != '+' {
+			oldLine++
+		}
+		if e.op != '-' {
+			newLine++
+		}
+	}
+	oldCount, newCount := 0, 0
+	for _, e := range edits[from:to] {
+		if e.op != '+' {
+			oldCount++
+		}
+		if e.op != '-' {
+			newCount++
+		}
+	}
+	fmt.Fprintf(out, "@@ -%d,%d +%d,%d @@\n", oldLine, oldCount, newLine, newCount)
+	for _, e := range edits[from:to] {
+		out.WriteString(string(e.op) + e.line + "\n")
+	}
+}
+
+func splitLines(s string) []string {
+	lines := strings.Split(s, "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// 最長共通部分列で行の編集を求める
+func diffLines(a []string, b []string) []edit {
+	// lcs[i][j] は a[i:] と b[j:] の共通部分列の長さ
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	edits := []edit{}
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			edits = append(edits, edit{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			edits = append(edits, edit{'-', a[i]})
+			i++
+		default:
+			edits = append(edits, edit{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		edits = append(edits, edit{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		edits = append(edits, edit{'+', b[j]})
+	}
+	return edits
+}
@@ -0,0 +1,326 @@
+package format
+
+import (
+	"bytes"
+	"monkey/ast"
+	"monkey/parser"
+	"monkey/token"
+	"strings"
+)
+
+// 式の結びつきの強さ
+// かっこがなくても同じ木に読まれるかをこれで調べる
+func precedence(e ast.Expression) int {
+	switch e := e.(type) {
+	case *ast.InfixExpression:
+		return parser.Precedence(e.Token.Type)
+	case *ast.PrefixExpression, *ast.SpawnExpression:
+		return parser.PREFIX
+	case *ast.YieldExpression:
+		return parser.LOWEST
+	}
+	// 後置の演算子（呼び出し、インデックス、ドット）とリテラル
+	return parser.DOT
+}
+
+// 優先順位がminより低ければかっこで囲む
+func (f *formatter) operand(e ast.Expression, min int) string {
+	text := f.expression(e)
+	if precedence(e) < min {
+		return "(" + text + ")"
+	}
+	return text
+}
+
+func (f *formatter) expressions(list []ast.Expression) string {
+	items := make([]string, len(list))
+	for i, e := range list {
+		items[i] = f.expression(e)
+	}
+	return strings.Join(items, ", ")
+}
+
+/*
+ * 式
+ */
+func (f *formatter) expression(e ast.Expression) string {
+	switch e := e.(type) {
+	case *ast.Identifier:
+		return e.Name
+	case *ast.IntegerLiteral:
+		return e.Token.Literal
+	case *ast.FloatLiteral:
+		return e.Token.Literal
+	case *ast.ComplexLiteral:
+		return e.Token.Literal
+	case *ast.BooleanLiteral:
+		return e.Token.Literal
+	case *ast.StringLiteral:
+		return quote(e.Value)
+	case *ast.TemplateLiteral:
+		return f.template(e)
+	case *ast.TypeLiteral:
+		return e.Value
+	case *ast.ArrayLiteral:
+		return "[" + f.expressions(e.Elements) + "]"
+	case *ast.HashLiteral:
+		return f.hash(e)
+	case *ast.FunctionLiteral:
+		return f.function(e)
+	case *ast.PrefixExpression:
+		return f.prefix(e)
+	case *ast.InfixExpression:
+		// 左結合なので右は同じ優先順位でもかっこが要る
+		prec := parser.Precedence(e.Token.Type)
+		return f.operand(e.Left, prec) + " " + e.Operator + " " + f.operand(e.Right, prec+1)
+	case *ast.CallExpression:
+		callee := f.operand(e.Function, parser.CALL)
+		if _, ok := e.Function.(*ast.FunctionLiteral); ok {
+			callee = "(" + callee + ")"
+		}
+		return callee + "(" + f.expressions(e.Arguments) + ")"
+	case *ast.IndexExpression:
+		return f.operand(e.Left, parser.CALL) + "[" + f.expression(e.Index) + "]"
+	case *ast.DotExpression:
+		return f.operand(e.Left, parser.CALL) + "." + e.Right.Name
+	case *ast.MetaExpression:
+		return f.operand(e.Left, parser.CALL) + ".@" + e.Name
+	case *ast.IfExpression:
+		return f.ifExpression(e)
+	case *ast.MatchExpression:
+		return f.match(e)
+	case *ast.LoopStatement:
+		return f.loop(e)
+	case *ast.YieldExpression:
+		if e.Value == nil {
+			return "yield"
+		}
+		return "yield " + f.expression(e.Value)
+	case *ast.SpawnExpression:
+		return "spawn " + f.expression(e.Call)
+	case nil:
+		return ""
+	}
+	return e.String()
+}
+
+// 文字列はエスケープしてダブルクォートで囲む
+func quote(s string) string {
+	r := strings.NewReplacer("\"", "\\\"", "\n", "\\n", "\r", "\\r", "\t", "\\t")
+	return "\"" + r.Replace(s) + "\""
+}
+
+// 埋め込んだ式は ${ } の中に書いたまま残す
+func (f *formatter) template(e *ast.TemplateLiteral) string {
+	var out strings.Builder
+	out.WriteString(strings.TrimSuffix(quote(e.Strings[0]), "\""))
+	for i, v := range e.Values {
+		out.WriteString("${" + f.expression(v) + "}")
+		out.WriteString(strings.TrimSuffix(strings.TrimPrefix(quote(e.Strings[i+1]), "\""), "\""))
+	}
+	out.WriteString("\"")
+	return out.String()
+}
+
+func (f *formatter) prefix(e *ast.PrefixExpression) string {
+	// 前置演算子が重なるときは - -x が --x にならないようにかっこで囲む
+	right := f.operand(e.Right, parser.PREFIX)
+	if _, ok := e.Right.(*ast.PrefixExpression); ok {
+		right = "(" + right + ")"
+	}
+	if e.Token.Type == token.AWAIT {
+		return e.Operator + " " + right
+	}
+	return e.Operator + right
+}
+
+// キーが識別子として書ければそのまま書く
+// メンバの間にコメントがあれば1メンバ1行にして、コメントを元の位置に残す
+func (f *formatter) hash(e *ast.HashLiteral) string {
+	if len(e.Comments) > 0 {
+		f.depth++
+	}
+	keys := []ast.Expression{}
+	pairs := []string{}
+	e.Pairs.Range(func(k, v ast.Expression) bool {
+		key := f.expression(k)
+		if s, ok := k.(*ast.StringLiteral); ok && isIdentifier(s.Value) {
+			key = s.Value
+		}
+		keys = append(keys, k)
+		pairs = append(pairs, key+": "+f.expression(v))
+		return true
+	})
+	if len(e.Comments) == 0 {
+		return "{" + strings.Join(pairs, ", ") + "}"
+	}
+
+	var out bytes.Buffer
+	out.WriteString("{")
+	c := 0
+	for i := 0; i <= len(pairs); i++ {
+		// i番目のメンバより前にあるコメント
+		for ; c < len(e.Comments) && (i == len(pairs) || before(e.Comments[c].Token, ast.NodeToken(keys[i]))); c++ {
+			first, rest := commentLines(e.Comments[c])
+			if i > 0 && f.codeBefore(e.Comments[c]) {
+				out.WriteString(" " + first)
+			} else {
+				out.WriteString("\n" + f.indent() + first)
+			}
+			for _, line := range rest {
+				out.WriteString("\n" + f.indent() + line)
+			}
+		}
+		if i < len(pairs) {
+			out.WriteString("\n" + f.indent() + pairs[i])
+			if i < len(pairs)-1 {
+				out.WriteString(",")
+			}
+		}
+	}
+	f.depth--
+	out.WriteString("\n" + f.indent() + "}")
+	return out.String()
+}
+
+// 元のソースでaがbより前にあるか
+func before(a, b token.Token) bool {
+	return a.Row < b.Row || a.Row == b.Row && a.Col < b.Col
+}
+
+// 識別子として読める名前か（予約語と型名は除く）
+func isIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	if _, reserved := token.Reserved[s]; reserved || token.Types[s] {
+		return false
+	}
+	for i, c := range s {
+		switch {
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		case i > 0 && c >= '0' && c <= '9':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// (名前:型, ...):戻り値の型=>{ ... }
+func (f *formatter) function(e *ast.FunctionLiteral) string {
+	var out bytes.Buffer
+	params := make([]string, len(e.Parameters))
+	for i, p := range e.Parameters {
+		params[i] = p.Name
+		if p.Type != nil {
+			params[i] += ":" + p.Type.String()
+		}
+	}
+	out.WriteString("(" + strings.Join(params, ", ") + ")")
+	if e.ReturnType != nil {
+		out.WriteString(":" + e.ReturnType.String())
+	}
+	out.WriteString("=>" + f.block(e.Body))
+	return out.String()
+}
+
+// ifの本体はいつも{}で囲む
+func (f *formatter) ifExpression(e *ast.IfExpression) string {
+	var out bytes.Buffer
+	out.WriteString("if (" + f.expression(e.Condition) + ") " + f.block(e.Consequence))
+	for _, elif := range e.Elifs {
+		// else if と書かれていればそのまま
+		if elif.Token.Type == token.ELSE {
+			out.WriteString(" else if (")
+		} else {
+			out.WriteString(" elif (")
+		}
+		out.WriteString(f.expression(elif.Condition) + ") " + f.block(elif.Consequence))
+	}
+	if e.Alternative != nil {
+		out.WriteString(" else " + f.block(e.Alternative))
+	}
+	return out.String()
+}
+
+/*
+ * match
+ * 腕は1行に1つ。本体が式1つなら{}を省く
+ */
+func (f *formatter) match(e *ast.MatchExpression) string {
+	var out bytes.Buffer
+	out.WriteString("match (" + f.expression(e.Subject) + ") {")
+	f.depth++
+	for _, arm := range e.Arms {
+		out.WriteString("\n" + f.indent() + f.pattern(arm.Pattern))
+		if arm.Guard != nil {
+			out.WriteString(" if " + f.expression(arm.Guard))
+		}
+		out.WriteString(" => " + f.armBody(arm.Body) + ",")
+	}
+	f.depth--
+	out.WriteString("\n" + f.indent() + "}")
+	return out.String()
+}
+
+func (f *formatter) armBody(body *ast.BlockStatement) string {
+	if len(body.Statements) == 1 {
+		if es, ok := body.Statements[0].(*ast.ExpressionStatement); ok {
+			// ハッシュリテラルは{}で囲まないとブロックに読まれる
+			if _, isHash := es.Expression.(*ast.HashLiteral); !isHash {
+				return f.expression(es.Expression)
+			}
+		}
+	}
+	return f.block(body)
+}
+
+func (f *formatter) pattern(p ast.Pattern) string {
+	switch p := p.(type) {
+	case *ast.WildcardPattern:
+		return "_"
+	case *ast.LiteralPattern:
+		return f.expression(p.Value)
+	case *ast.RangePattern:
+		return f.expression(p.Low) + ".." + f.expression(p.High)
+	case *ast.TypePattern:
+		return p.Type.String()
+	case *ast.BindingPattern:
+		if p.Type != nil {
+			return p.Name.Name + ":" + p.Type.String()
+		}
+		return p.Name.Name
+	case *ast.ArrayPattern:
+		items := []string{}
+		for _, el := range p.Elements {
+			items = append(items, f.pattern(el))
+		}
+		if p.Rest != nil {
+			items = append(items, "..."+p.Rest.Name)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case *ast.HashPattern:
+		pairs := []string{}
+		for i, k := range p.Keys {
+			key := k
+			if !isIdentifier(k) {
+				key = quote(k)
+			}
+			// {name} は {name: name} と同じ
+			if b, ok := p.Values[i].(*ast.BindingPattern); ok && b.Type == nil && b.Name.Name == k && isIdentifier(k) {
+				pairs = append(pairs, key)
+				continue
+			}
+			pairs = append(pairs, key+": "+f.pattern(p.Values[i]))
+		}
+		return "{" + strings.Join(pairs, ", ") + "}"
+	case *ast.OrPattern:
+		alts := []string{}
+		for _, a := range p.Alternatives {
+			alts = append(alts, f.pattern(a))
+		}
+		return strings.Join(alts, " | ")
+	}
+	return p.String()
+}
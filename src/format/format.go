@@ -0,0 +1,347 @@
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"monkey/ast"
+	"monkey/parser"
+	"monkey/token"
+	"strings"
+)
+
+// 1段のインデント
+const indentUnit = "    "
+
+/*
+ * ソースを整形する
+ * 構文エラーがあれば整形せずにエラーを返す
+ */
+func Source(src string) (string, error) {
+	p := parser.NewParser(src)
+	program, ok := p.ParseProgram()
+	if !ok {
+		return "", fmt.Errorf("%s", strings.Join(p.Errors(), "\n"))
+	}
+	f := &formatter{lines: strings.Split(src, "\n")}
+	return f.program(program), nil
+}
+
+/*
+ * ASTをソースに戻す
+ * 元のソースがないので空行は残らない
+ */
+func Program(program *ast.Program) string {
+	f := &formatter{}
+	return f.program(program)
+}
+
+type formatter struct {
+	lines []string // 元のソース（空行を残すのに使う）
+	depth int      // 今のインデントの深さ
+}
+
+func (f *formatter) program(program *ast.Program) string {
+	out := f.statements(program.Statements)
+	if out == "" {
+		return ""
+	}
+	return out + "\n"
+}
+
+func (f *formatter) indent() string {
+	return strings.Repeat(indentUnit, f.depth)
+}
+
+/*
+ * 文を並べる
+ * 1文1行で、閉じかっこで終わらない文にはセミコロンをつける
+ * 同じ行の後ろにあったコメントはその行に残す
+ * 続けて書いた // は1つのコメントになっているので、2行目からは次の行に書く
+ */
+func (f *formatter) statements(stmts []ast.Statement) string {
+	texts := make([]string, len(stmts))
+	for i, stmt := range stmts {
+		texts[i] = f.statement(stmt)
+	}
+
+	var out bytes.Buffer
+	for i, stmt := range stmts {
+		text := texts[i]
+		row := statementRow(stmt)
+
+		if c, ok := stmt.(*ast.CommentStatement); ok {
+			first, rest := commentLines(c)
+			if i > 0 && f.codeBefore(c) {
+				out.WriteString(" " + first)
+			} else {
+				if i > 0 {
+					out.WriteString("\n")
+					if f.blankBefore(row) {
+						out.WriteString("\n")
+					}
+				}
+				out.WriteString(f.indent() + first)
+			}
+			for _, line := range rest {
+				out.WriteString("\n" + f.indent() + line)
+			}
+			continue
+		}
+		if i > 0 {
+			out.WriteString("\n")
+			if f.blankBefore(row) {
+				out.WriteString("\n")
+			}
+		}
+		out.WriteString(f.indent() + text)
+		if needsSemicolon(stmt, text, nextStatement(stmts[i+1:], texts[i+1:])) {
+			out.WriteString(";")
+		}
+	}
+	return out.String()
+}
+
+// コメントを飛ばして次の文を返す
+func nextStatement(stmts []ast.Statement, texts []string) string {
+	for i, stmt := range stmts {
+		if _, ok := stmt.(*ast.CommentStatement); !ok {
+			return texts[i]
+		}
+	}
+	return ""
+}
+
+// 元のソースでコメントの前に同じ行のコードがあるか
+// あれば前の文（複数行なら最後の行）の後ろにつける
+func (f *formatter) codeBefore(c *ast.CommentStatement) bool {
+	row, col := c.Token.Row, c.Token.Col
+	if row < 1 || row > len(f.lines) {
+		return false
+	}
+	line := f.lines[row-1]
+	return strings.TrimSpace(line[:min(col-1, len(line))]) != ""
+}
+
+// コメントの1行目と続きの行に分ける（ブロックコメントは分けない）
+func commentLines(c *ast.CommentStatement) (string, []string) {
+	text := comment(c)
+	if c.Token.Type == token.BLOCK_COMMENT {
+		return text, nil
+	}
+	lines := strings.Split(text, "\n")
+	return lines[0], lines[1:]
+}
+
+// 元のソースで文の前が空行だったか
+func (f *formatter) blankBefore(row int) bool {
+	if row < 2 || row-2 >= len(f.lines) {
+		return false
+	}
+	return strings.TrimSpace(f.lines[row-2]) == ""
+}
+
+/*
+ * 文の後ろにセミコロンが要るか
+ * 閉じかっこで終わる文は、次の文が続けて読まれてしまうときだけつける
+ */
+func needsSemicolon(stmt ast.Statement, text string, next string) bool {
+	switch stmt.(type) {
+	case *ast.CommentStatement, *ast.BlockStatement, *ast.LoopStatement,
+		*ast.SwitchStatement, *ast.SelectStatement:
+		return false
+	}
+	if !strings.HasSuffix(text, "}") {
+		return true
+	}
+	// 式の後ろの ( [ - は呼び出しや二項演算子として読まれる
+	return strings.HasPrefix(next, "(") || strings.HasPrefix(next, "[") || strings.HasPrefix(next, "-")
+}
+
+// 文の先頭の行
+func statementRow(stmt ast.Statement) int {
+	switch s := stmt.(type) {
+	case *ast.LetStatement:
+		return s.Token.Row
+	case *ast.ExpressionStatement:
+		return s.Token.Row
+	case *ast.ReturnStatement:
+		return s.Token.Row
+	case *ast.BlockStatement:
+		return s.Token.Row
+	case *ast.CommentStatement:
+		return s.Token.Row
+	case *ast.AssignStatement:
+		return s.Token.Row
+	case *ast.DeriveStatement:
+		return s.Token.Row
+	case *ast.LoopStatement:
+		if s.Label != nil {
+			return s.Label.Token.Row
+		}
+		return s.Token.Row
+	case *ast.BreakStatement:
+		return s.Token.Row
+	case *ast.ContinueStatement:
+		return s.Token.Row
+	case *ast.TypeStatement:
+		return s.Token.Row
+	case *ast.SwitchStatement:
+		return s.Token.Row
+	case *ast.DeferStatement:
+		return s.Token.Row
+	case *ast.SelectStatement:
+		return s.Token.Row
+	}
+	return 0
+}
+
+/*
+ * 文
+ * セミコロンと前後の改行はstatementsでつける
+ */
+func (f *formatter) statement(stmt ast.Statement) string {
+	switch s := stmt.(type) {
+	case *ast.LetStatement:
+		return f.let(s)
+	case *ast.ExpressionStatement:
+		return f.expression(s.Expression)
+	case *ast.ReturnStatement:
+		return "return " + f.expression(s.ReturnValue)
+	case *ast.BlockStatement:
+		return f.block(s)
+	case *ast.CommentStatement:
+		return comment(s)
+	case *ast.AssignStatement:
+		return f.expression(s.Left) + " = " + f.expression(s.Right)
+	case *ast.DeriveStatement:
+		return "..." + f.expression(s.Right)
+	case *ast.LoopStatement:
+		return f.loop(s)
+	case *ast.BreakStatement:
+		out := "break"
+		if s.Label != nil {
+			out += " " + s.Label.Name
+		}
+		if s.Value != nil {
+			out += " " + f.expression(s.Value)
+		}
+		return out
+	case *ast.ContinueStatement:
+		if s.Label != nil {
+			return "continue " + s.Label.Name
+		}
+		return "continue"
+	case *ast.TypeStatement:
+		return "type " + s.Ident.Name + " = " + s.Value.String()
+	case *ast.SwitchStatement:
+		return f.switchStatement(s)
+	case *ast.DeferStatement:
+		return "defer " + f.expression(s.Call)
+	case *ast.SelectStatement:
+		return f.selectStatement(s)
+	}
+	return stmt.String()
+}
+
+// 宣言（型の指定は名前:型）
+func (f *formatter) let(s *ast.LetStatement) string {
+	var out bytes.Buffer
+	if s.Public {
+		out.WriteString("pub ")
+	}
+	out.WriteString(s.Token.Literal + " " + s.Ident.Name)
+	if s.Ident.Type != nil {
+		out.WriteString(":" + s.Ident.Type.String())
+	}
+	if s.Value != nil {
+		out.WriteString(" = " + f.expression(s.Value))
+	}
+	return out.String()
+}
+
+// コメントは書かれたとおりに出す
+func comment(s *ast.CommentStatement) string {
+	if s.Token.Type == token.BLOCK_COMMENT {
+		return "/*" + s.Token.Literal + "*/"
+	}
+	lines := strings.Split(s.Token.Literal, "\n")
+	for i, line := range lines {
+		lines[i] = "//" + strings.TrimRight(line, " \t\r")
+	}
+	return strings.Join(lines, "\n")
+}
+
+/*
+ * ブロック
+ * 空なら{}、そうでなければ1文1行でインデントする
+ */
+func (f *formatter) block(b *ast.BlockStatement) string {
+	if len(b.Statements) == 0 {
+		return "{}"
+	}
+	f.depth++
+	body := f.statements(b.Statements)
+	f.depth--
+	return "{\n" + body + "\n" + f.indent() + "}"
+}
+
+func (f *formatter) loop(s *ast.LoopStatement) string {
+	var out bytes.Buffer
+	if s.Label != nil {
+		out.WriteString(s.Label.Name + ": ")
+	}
+	out.WriteString("loop(" + f.let(s.Bind) + ") ")
+	out.WriteString(f.block(s.Block))
+	return out.String()
+}
+
+// caseの中身はcaseより1段深くする
+func (f *formatter) caseBody(body *ast.BlockStatement) string {
+	if len(body.Statements) == 0 {
+		return ""
+	}
+	f.depth++
+	out := "\n" + f.statements(body.Statements)
+	f.depth--
+	return out
+}
+
+func (f *formatter) switchStatement(s *ast.SwitchStatement) string {
+	var out bytes.Buffer
+	out.WriteString("switch (" + f.expression(s.Subject) + ") {")
+	for _, c := range s.Cases {
+		out.WriteString("\n" + f.indent())
+		if c.IsDefault() {
+			out.WriteString("default:")
+		} else {
+			out.WriteString("case " + f.expressions(c.Values) + ":")
+		}
+		out.WriteString(f.caseBody(c.Body))
+		if c.Fallthrough {
+			out.WriteString("\n" + f.indent() + indentUnit + "fallthrough")
+		}
+	}
+	out.WriteString("\n" + f.indent() + "}")
+	return out.String()
+}
+
+func (f *formatter) selectStatement(s *ast.SelectStatement) string {
+	var out bytes.Buffer
+	out.WriteString("select {")
+	for _, c := range s.Cases {
+		out.WriteString("\n" + f.indent())
+		switch {
+		case c.IsDefault():
+			out.WriteString("default:")
+		case c.Send:
+			out.WriteString("case " + f.operand(c.Channel, parser.DOT) + ".send(" + f.expression(c.Value) + "):")
+		case c.Binding != nil:
+			out.WriteString("case " + c.Binding.Name + " = " + f.operand(c.Channel, parser.DOT) + ".recv():")
+		default:
+			out.WriteString("case " + f.operand(c.Channel, parser.DOT) + ".recv():")
+		}
+		out.WriteString(f.caseBody(c.Body))
+	}
+	out.WriteString("\n" + f.indent() + "}")
+	return out.String()
+}
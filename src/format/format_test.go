@@ -0,0 +1,232 @@
+package format
+
+import (
+	"monkey/parser"
+	"strings"
+	"testing"
+)
+
+// いろいろな構文を含むソース
+var corpus = `
+// 先頭のコメント
+imm a=1 // 後ろのコメント
+mut b:int;
+
+
+/*
+ * ブロックコメント
+ */
+pub mut c:string[] = ["x", "y\t\"z\""]
+imm f=(x:int,y:string):string=>{ if(x>1){return y} else if (x==0) {   return "zero"} else { return "neg" }
+}
+imm g = ()=>{ yield 1; yield }
+loop(imm i=[1,2,3]){ if(i.v==2) continue
+b=b+i.v*(2+3)-(4-1)
+}
+imm found = outer: loop(imm i = {a:1, "b c":2}){ loop(imm j = [1]){ break outer i.k } }
+switch(a){ case 1,2: puts("x"); fallthrough
+case 3: puts("y")
+default: }
+imm m = match (a) { 1|2 => "small", -5..5 => "near", [x, ...rest] if x > 0 => { puts(x); x }, {name, age: n:int} => n, string[] => 0, _ => { {a:1} } }
+{ imm col = 1; b = col }
+imm k = ((x:int)=>{ x })(3) - -a
+imm t = spawn f(1, "s");
+await t
+select { case v = ch.recv(): puts(v) case ch.send(1): default: puts("none") }
+defer puts(!(!true))
+...base(1)
+type T = { a: number, b: (x:number) => string }
+imm h = f(a)[0].b.@type
+imm cond = (a instanceof string) == (1 < 2)
+imm msg = "p${h.a + 1}q${"r"}"
+`
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`imm x=1`, "imm x = 1;\n"},
+		{`mut x:int;mut y;`, "mut x:int;\nmut y;\n"},
+		// かっこは必要なところだけ
+		{`(1+2)*3; 1+(2*3); 1-(2-3); (1-2)-3`, "(1 + 2) * 3;\n1 + 2 * 3;\n1 - (2 - 3);\n1 - 2 - 3;\n"},
+		{`-(1+2); (-f)(1); -f(1)`, "-(1 + 2);\n(-f)(1);\n-f(1);\n"},
+		// ブロックは1文1行でインデントする
+		{`imm f=(x:int)=>{ x*2 }`, "imm f = (x:int)=>{\n    x * 2;\n}\n"},
+		{`imm f=()=>{}`, "imm f = ()=>{}\n"},
+		{`if (a) b`, "if (a) {\n    b;\n}\n"},
+		// 閉じかっこの後ろに ( が続くときはセミコロンで区切る
+		{`if (a) { b }; ((x:int)=>{ x })(1)`, "if (a) {\n    b;\n};\n((x:int)=>{\n    x;\n})(1);\n"},
+		{`if (a) { b }; [1]`, "if (a) {\n    b;\n};\n[1];\n"},
+		{`if (a) { b }
+c`, "if (a) {\n    b;\n}\nc;\n"},
+		// ハッシュのキーは識別子として書ければそのまま
+		{`{"a":1, "b c":2, 3:4}`, "{a: 1, \"b c\": 2, 3: 4}\n"},
+		// 空行は1つにまとめる
+		{"a\n\n\n\nb", "a;\n\nb;\n"},
+		// コメントはそのまま残す
+		{"a // x  \n// y\nb /* z */", "a; // x\n// y\nb; /* z */\n"},
+		// 文字列に埋め込んだ式は書いたまま残す
+		{`"x${h.a}y"`, "\"x${h.a}y\";\n"},
+		{`puts("a\t${f(1,2)+1}${b}\"c")`, "puts(\"a\\t${f(1, 2) + 1}${b}\\\"c\");\n"},
+		{`match (x) { 1 => "a", _ => { b; c } }`, "match (x) {\n    1 => \"a\",\n    _ => {\n        b;\n        c;\n    },\n}\n"},
+	}
+
+	for _, tt := range tests {
+		out, err := Source(tt.input)
+		if err != nil {
+			t.Fatalf("%q: %s", tt.input, err)
+		}
+		if out != tt.expected {
+			t.Errorf("%q: result wrong.\ngot:\n%s\nwant:\n%s", tt.input, out, tt.expected)
+		}
+	}
+}
+
+// 整形しても同じ木になり、もう一度整形しても変わらない
+func TestFormatIdempotent(t *testing.T) {
+	inputs := []string{corpus}
+	for _, line := range strings.Split(corpus, "\n") {
+		if _, err := Source(line); err == nil {
+			inputs = append(inputs, line)
+		}
+	}
+
+	for _, input := range inputs {
+		once, err := Source(input)
+		if err != nil {
+			t.Fatalf("%q: %s", input, err)
+		}
+		twice, err := Source(once)
+		if err != nil {
+			t.Fatalf("formatted source does not parse: %s\n%s", err, once)
+		}
+		if once != twice {
+			t.Errorf("not idempotent.\nonce:\n%s\ntwice:\n%s", once, twice)
+		}
+		if want, got := parse(t, input), parse(t, once); want != got {
+			t.Errorf("tree changed.\nwant: %s\ngot:  %s", want, got)
+		}
+	}
+}
+
+// 続けて書いたコメントはどの行もブロックのインデントにそろえる
+func TestFormatComments(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`imm f = ()=>{
+  if (a) {
+  // one
+      // two
+    b // trailing
+    // under
+    c
+  }
+}`, `imm f = ()=>{
+    if (a) {
+        // one
+        // two
+        b; // trailing
+        // under
+        c;
+    }
+}
+`},
+		// 複数行のメンバの後ろのコメントは閉じかっこの後ろに残す
+		{`imm C = ()=>{
+  pub mut x = 1 // note
+  imm f = ()=>{ x } // getter
+  pub imm g = (a:number)=>{
+    a
+  } // after g
+  return this
+}`, `imm C = ()=>{
+    pub mut x = 1; // note
+    imm f = ()=>{
+        x;
+    } // getter
+    pub imm g = (a:number)=>{
+        a;
+    } // after g
+    return this;
+}
+`},
+		// ハッシュのメンバの間のコメント
+		{`imm h = {
+  // first
+  a: 1, // one
+  // about b
+  b: {c: 2, /* two */ d: 3},
+  e: ()=>{ 1 } // fn
+}`, `imm h = {
+    // first
+    a: 1, // one
+    // about b
+    b: {
+        c: 2, /* two */
+        d: 3
+    },
+    e: ()=>{
+        1;
+    } // fn
+}
+`},
+	}
+
+	for _, tt := range tests {
+		once, err := Source(tt.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if once != tt.want {
+			t.Errorf("result wrong.\ngot:\n%s\nwant:\n%s", once, tt.want)
+		}
+		twice, err := Source(once)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if once != twice {
+			t.Errorf("not idempotent.\nonce:\n%s\ntwice:\n%s", once, twice)
+		}
+	}
+}
+
+func TestFormatProgram(t *testing.T) {
+	p := parser.NewParser("imm a = 1\n\nputs(a)")
+	program, ok := p.ParseProgram()
+	if !ok {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	// 元のソースがなければ空行は残らない
+	if out := Program(program); out != "imm a = 1;\nputs(a);\n" {
+		t.Errorf("result wrong. got=%q", out)
+	}
+}
+
+func TestFormatError(t *testing.T) {
+	if _, err := Source(`imm = 1`); err == nil {
+		t.Errorf("no error for invalid source")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	if d := Diff("a.kk", "x\n", "x\n"); d != "" {
+		t.Errorf("diff of same text. got=%q", d)
+	}
+	d := Diff("a.kk", "a\nb\nc\n", "a\nB\nc\nd\n")
+	want := "--- a.kk.orig\n+++ a.kk\n@@ -1,3 +1,4 @@\n a\n-b\n+B\n c\n+d\n"
+	if d != want {
+		t.Errorf("diff wrong.\ngot:\n%s\nwant:\n%s", d, want)
+	}
+}
+
+func parse(t *testing.T, src string) string {
+	p := parser.NewParser(src)
+	program, ok := p.ParseProgram()
+	if !ok {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return program.String()
+}
@@ -2,7 +2,6 @@ module monkey
 
 go 1.24.3
 
-require (
-	github.com/mattn/go-runewidth v0.0.16 // indirect
-	github.com/rivo/uniseg v0.2.0 // indirect
-)
+require github.com/mattn/go-runewidth v0.0.16
+
+require github.com/rivo/uniseg v0.2.0 // indirect
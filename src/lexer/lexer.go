@@ -1,7 +1,6 @@
 package lexer
 
 import (
-	"fmt"
 	"monkey/token"
 	"regexp"
 
@@ -51,9 +50,46 @@ func GetTokens(input string) []*token.Token {
 	}
 	l.tokenizeNormal(ROOT_MODE)
 	l.addToken(token.EOF, "", l.row, l.col)
+	l.contextualKeywords()
 	return l.tokens
 }
 
+/*
+ * 文脈でだけキーワードになる名前
+ * type は文の始めで「type 名前 =」と続くときだけ型の宣言のキーワードで、
+ * それ以外（{type: 1} や h.type など）はただの識別子にする
+ */
+func (l *Lexer) contextualKeywords() {
+	significant := []int{}
+	for i, t := range l.tokens {
+		if t.Type != token.LINE_COMMENT && t.Type != token.BLOCK_COMMENT {
+			significant = append(significant, i)
+		}
+	}
+	for k, i := range significant {
+		t := l.tokens[i]
+		if t.Type != token.TYPEDEF {
+			continue
+		}
+		start := k == 0
+		if k > 0 {
+			prev := l.tokens[significant[k-1]]
+			switch prev.Type {
+			case token.SEMICOLON, token.LBRACE, token.RBRACE, token.PUB:
+				start = true
+			default:
+				start = prev.Row < t.Row
+			}
+		}
+		declares := k+2 < len(significant) &&
+			l.tokens[significant[k+1]].Type == token.IDENT &&
+			l.tokens[significant[k+2]].Type == token.ASSIGN
+		if !start || !declares {
+			t.Type = token.IDENT
+		}
+	}
+}
+
 // これくらいないのかよ関数その１
 func MinInt(a, b int) int {
 	if a < b {
@@ -344,16 +380,15 @@ func (l *Lexer) tokenizeString(parentMode LexerMode) {
 				str += "\""
 			case "${":
 				l.addToken(token.STRING, str, r, c) // STRING
-				l.addToken(token.PLUS, "+", row, col)
+				l.addToken(token.INLINE_OPEN, ope, row, col)
 				l.tokenizeNormal(STRING_MODE)
-				l.addToken(token.PLUS, "+", l.row, l.col-1) // }
+				l.addToken(token.INLINE_CLOSE, "}", l.row, l.col-1)
 				c = l.col
 				r = l.row
 				str = ""
 				continue
 			// 文字列の終了を検知したのでstrをtokenにする
 			case "\"":
-				fmt.Printf("%d::%d - %d::%d\n", r, c, l.row, l.col-1)
 				l.addToken(token.STRING, str, r, c)
 				return
 			}
@@ -158,21 +158,21 @@ desu"}"
 		{token.IDENT, "foo", 17, 35},
 
 		{token.STRING, "hogeがぶhoge", 18, 3},
-		{token.PLUS, "+", 18, 15},
+		{token.INLINE_OPEN, "${", 18, 15},
 		{token.IDENT, "foo", 18, 17},
 		{token.PLUS, "+", 18, 20},
 		{token.STRING, "hoge", 18, 22},
 		{token.PLUS, "+", 18, 27},
 		{token.IDENT, "bar", 18, 28},
-		{token.PLUS, "+", 18, 31},
+		{token.INLINE_CLOSE, "}", 18, 31},
 		{token.STRING, "return", 18, 32},
-		{token.PLUS, "+", 18, 38},
+		{token.INLINE_OPEN, "${", 18, 38},
 		{token.IDENT, "baz", 18, 40},
-		{token.PLUS, "+", 18, 43},
+		{token.INLINE_CLOSE, "}", 18, 43},
 		{token.STRING, "", 18, 44},
-		{token.PLUS, "+", 18, 44},
+		{token.INLINE_OPEN, "${", 18, 44},
 		{token.IDENT, "qux", 18, 46},
-		{token.PLUS, "+", 18, 49},
+		{token.INLINE_CLOSE, "}", 18, 49},
 		{token.STRING, "", 18, 50},
 		{token.PLUS, "+", 18, 52},
 		{token.IDENT, "quux", 18, 54},
@@ -184,13 +184,13 @@ desu"}"
 		{token.IDENT, "foo", 23, 2},
 		{token.PLUS, "+", 23, 6},
 		{token.STRING, "bar", 23, 9},
-		{token.PLUS, "+", 23, 12},
+		{token.INLINE_OPEN, "${", 23, 12},
 		{token.STRING, "foo\nbar\nbaz\nがぶ", 23, 15},
-		{token.PLUS, "+", 26, 6},
+		{token.INLINE_CLOSE, "}", 26, 6},
 		{token.STRING, "baz", 26, 7},
-		{token.PLUS, "+", 26, 10},
+		{token.INLINE_OPEN, "${", 26, 10},
 		{token.STRING, "です\nデス\ndesu", 26, 13},
-		{token.PLUS, "+", 28, 6},
+		{token.INLINE_CLOSE, "}", 28, 6},
 		{token.STRING, "", 28, 7},
 
 		{token.EOF, "", 29, 1},
@@ -216,3 +216,29 @@ desu"}"
 	}
 
 }
+
+func TestContextualType(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []token.TokenType
+	}{
+		{`type T = number`, []token.TokenType{token.TYPEDEF, token.IDENT, token.ASSIGN, token.TYPE}},
+		{`pub type T = number`, []token.TokenType{token.PUB, token.TYPEDEF, token.IDENT, token.ASSIGN, token.TYPE}},
+		{"x\n/* 型 */ type T = number", []token.TokenType{token.IDENT, token.BLOCK_COMMENT, token.TYPEDEF, token.IDENT, token.ASSIGN, token.TYPE}},
+		{`{type: 1}`, []token.TokenType{token.LBRACE, token.IDENT, token.COLON, token.INTEGER, token.RBRACE}},
+		{`h.type`, []token.TokenType{token.IDENT, token.ACCESS, token.IDENT}},
+		{`type = 1`, []token.TokenType{token.IDENT, token.ASSIGN, token.INTEGER}},
+		{`x type T = number`, []token.TokenType{token.IDENT, token.IDENT, token.IDENT, token.ASSIGN, token.TYPE}},
+	}
+
+	for _, tt := range tests {
+		tokens := GetTokens(tt.input)
+		got := []token.TokenType{}
+		for _, tok := range tokens[:len(tokens)-1] {
+			got = append(got, tok.Type)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.expected) {
+			t.Errorf("%q: expected %v, got=%v", tt.input, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"monkey/lint"
+	"os"
+	"strings"
+)
+
+/*
+ * lint サブコマンド
+ * 見つけた問題を1行ずつ出し、問題があれば1で終わる
+ * -json はJSONの配列で出し、-config は設定ファイル、-disable は止めるルール
+ * -rules はルールの一覧を出す
+ */
+func runLint(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("lint", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	asJSON := flags.Bool("json", false, "print findings as JSON")
+	configPath := flags.String("config", "", "read rule severities from this JSON file")
+	disable := flags.String("disable", "", "comma separated rules to turn off")
+	listRules := flags.Bool("rules", false, "list the rules and exit")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *listRules {
+		for _, rule := range lint.Rules {
+			fmt.Fprintf(stdout, "%-28s %-8s %s\n", rule.ID, rule.Severity, rule.Description)
+		}
+		return 0
+	}
+	if flags.NArg() == 0 {
+		fmt.Fprintln(stderr, "lint: no input files")
+		return 2
+	}
+
+	config := &lint.Config{}
+	if *configPath != "" {
+		data, err := os.ReadFile(*configPath)
+		if err == nil {
+			config, err = lint.ParseConfig(data)
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %s\n", *configPath, err)
+			return 2
+		}
+	}
+	for _, id := range strings.Split(*disable, ",") {
+		if id = strings.TrimSpace(id); id == "" {
+			continue
+		}
+		if err := config.Set(id, lint.SeverityOff); err != nil {
+			fmt.Fprintf(stderr, "lint: %s\n", err)
+			return 2
+		}
+	}
+
+	status := 0
+	findings := []lint.Finding{}
+	for _, path := range flags.Args() {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %s\n", path, err)
+			status = 2
+			continue
+		}
+		findings = append(findings, lint.Source(path, string(src), config)...)
+	}
+
+	if *asJSON {
+		out, _ := json.MarshalIndent(findings, "", "  ")
+		fmt.Fprintln(stdout, string(out))
+	} else {
+		for _, f := range findings {
+			fmt.Fprintln(stdout, f)
+		}
+	}
+	if status == 0 && len(findings) > 0 {
+		status = 1
+	}
+	return status
+}
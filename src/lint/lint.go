@@ -0,0 +1,242 @@
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/resolve"
+	"monkey/token"
+	"sort"
+	"strings"
+)
+
+// 重大度
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+	SeverityInfo    Severity = "info"
+	SeverityOff     Severity = "off" // ルールを使わない
+)
+
+// 構文エラーのルール（止めることはできない）
+const SyntaxRule = "syntax"
+
+/*
+ * 見つかった問題
+ * 行と列は1オリジン（列は字句解析器と同じ表示幅）
+ */
+type Finding struct {
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+	File     string   `json:"file"`
+	Line     int      `json:"line"`
+	Column   int      `json:"column"`
+}
+
+// file:行:列: 重大度: メッセージ (ルール)
+func (f Finding) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s: %s (%s)", f.File, f.Line, f.Column, f.Severity, f.Message, f.Rule)
+}
+
+/*
+ * 設定
+ * ルールごとに重大度を変えたり（offで）止めたりする
+ */
+type Config struct {
+	Rules map[string]Severity `json:"rules"`
+}
+
+// JSONの設定を読む（知らないルールや重大度はエラー）
+func ParseConfig(data []byte) (*Config, error) {
+	config := &Config{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, err
+	}
+	for id, severity := range config.Rules {
+		if err := config.Set(id, severity); err != nil {
+			return nil, err
+		}
+	}
+	return config, nil
+}
+
+// ルールの重大度を変える
+func (c *Config) Set(id string, severity Severity) error {
+	if findRule(id) == nil {
+		return fmt.Errorf("unknown rule: %s", id)
+	}
+	switch severity {
+	case SeverityError, SeverityWarning, SeverityInfo, SeverityOff:
+	default:
+		return fmt.Errorf("unknown severity for %s: %s", id, severity)
+	}
+	if c.Rules == nil {
+		c.Rules = map[string]Severity{}
+	}
+	c.Rules[id] = severity
+	return nil
+}
+
+// ルールの重大度（設定がなければルールの既定）
+func (c *Config) severity(rule *Rule) Severity {
+	if c != nil {
+		if s, ok := c.Rules[rule.ID]; ok {
+			return s
+		}
+	}
+	return rule.Severity
+}
+
+/*
+ * ソースを検査する
+ * 構文エラーがあればそれだけを返す
+ * configがnilならすべてのルールを既定の重大度で使う
+ */
+func Source(name string, src string, config *Config) []Finding {
+	p := parser.NewParser(src)
+	program, ok := p.ParseProgram()
+	if !ok {
+		findings := []Finding{}
+		for _, e := range p.ErrorDetails() {
+			findings = append(findings, Finding{
+				Rule: SyntaxRule, Severity: SeverityError, Message: e.Message,
+				File: name, Line: e.Token.Row, Column: e.Token.Col,
+			})
+		}
+		return findings
+	}
+
+	tokens := lexer.GetTokens(src)
+	c := &checker{
+		file:    name,
+		program: program,
+		info:    resolve.Program(program, tokens),
+		refs:    map[resolve.Pos]*resolve.Reference{},
+	}
+	for _, ref := range c.info.Refs {
+		c.refs[resolve.TokenPos(ref.Token)] = ref
+	}
+	for _, rule := range Rules {
+		severity := config.severity(rule)
+		if severity == SeverityOff {
+			continue
+		}
+		c.rule, c.severity = rule, severity
+		rule.check(c)
+	}
+
+	suppressed := suppressions(strings.Split(src, "\n"), tokens)
+	findings := []Finding{}
+	for _, f := range c.findings {
+		if !suppressed.match(f) {
+			findings = append(findings, f)
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].Line != findings[j].Line {
+			return findings[i].Line < findings[j].Line
+		}
+		return findings[i].Column < findings[j].Column
+	})
+	return findings
+}
+
+// ルールが検査に使う情報
+type checker struct {
+	file     string
+	program  *ast.Program
+	info     *resolve.Info
+	refs     map[resolve.Pos]*resolve.Reference // 名前の位置から参照
+	rule     *Rule
+	severity Severity
+	findings []Finding
+}
+
+func (c *checker) report(t token.Token, format string, a ...interface{}) {
+	c.findings = append(c.findings, Finding{
+		Rule:     c.rule.ID,
+		Severity: c.severity,
+		Message:  fmt.Sprintf(format, a...),
+		File:     c.file,
+		Line:     t.Row,
+		Column:   t.Col,
+	})
+}
+
+// 名前の参照が指す束縛（なければnil）
+func (c *checker) binding(ident *ast.Identifier) *resolve.Binding {
+	if ref, ok := c.refs[resolve.TokenPos(ident.Token)]; ok {
+		return ref.Binding
+	}
+	return nil
+}
+
+/*
+ * 抑制コメント
+ * // lint:ignore rule ... は同じ行か、コメントだけの行なら次の行の問題を消す
+ * // lint:file-ignore rule ... はファイル全体
+ * ルールを書かなければすべてのルール
+ */
+type suppression struct {
+	lines map[int][]string // 行ごとのルール
+	file  []string
+}
+
+func suppressions(lines []string, tokens []*token.Token) *suppression {
+	s := &suppression{lines: map[int][]string{}}
+	for _, t := range tokens {
+		if t.Type != token.LINE_COMMENT {
+			continue
+		}
+		// 続けて書いた // は1つのトークンになっているので行ごとに探す
+		row := t.Row
+		for _, part := range strings.Split(t.Literal, "\n") {
+			for row <= len(lines) && !strings.Contains(lines[row-1], "//"+part) {
+				row++
+			}
+			if row > len(lines) {
+				break
+			}
+			line := lines[row-1]
+			fields := strings.Fields(strings.ReplaceAll(part, ",", " "))
+			switch {
+			case len(fields) == 0:
+			case fields[0] == "lint:file-ignore":
+				s.file = append(s.file, rules(fields[1:])...)
+			case fields[0] == "lint:ignore":
+				target := row
+				if strings.TrimSpace(line[:strings.Index(line, "//"+part)]) == "" {
+					target = row + 1
+				}
+				s.lines[target] = append(s.lines[target], rules(fields[1:])...)
+			}
+			row++
+		}
+	}
+	return s
+}
+
+// ルールの指定がなければすべて
+func rules(ids []string) []string {
+	if len(ids) == 0 {
+		return []string{"all"}
+	}
+	return ids
+}
+
+func (s *suppression) match(f Finding) bool {
+	if f.Rule == SyntaxRule {
+		return false
+	}
+	for _, id := range append(s.file, s.lines[f.Line]...) {
+		if id == "all" || id == f.Rule {
+			return true
+		}
+	}
+	return false
+}
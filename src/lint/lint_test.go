@@ -0,0 +1,161 @@
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// 問題を「行:列 ルール」の並びにする
+func summary(findings []Finding) string {
+	out := []string{}
+	for _, f := range findings {
+		out = append(out, fmt.Sprintf("%d:%d %s", f.Line, f.Column, f.Rule))
+	}
+	return strings.Join(out, "\n")
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"unused-imm", `
+imm a = 1
+imm b = 2
+imm _c = 3
+b`, "2:5 unused-imm"},
+		{"unused member", `
+imm Point = ()=>{
+  imm x = 1
+  return this
+}
+Point()`, ""},
+		{"shadow", `
+imm x = 1
+imm f = (x:number)=>{ x }
+f(x)`, "3:10 shadow"},
+		{"shadow pattern", `
+imm Point = ()=>{ return this }
+imm f = ()=>{ 1 }
+match (1) { Point => 1, f => f }`, "3:5 unused-imm\n4:25 shadow"},
+		{"mut-never-reassigned", `
+mut a = 1
+mut b = 2
+pub mut c = 3
+b = a + c
+mut d = 0
+++d`, "2:5 mut-never-reassigned"},
+		{"unreachable", `
+imm f = ()=>{
+  return 1
+  // コメントは数えない
+  f()
+  f()
+}
+f()`, "5:3 unreachable"},
+		{"unreachable break", `
+loop(imm x=[1, 2]){
+  break
+  x
+}`, "4:3 unreachable"},
+		{"arg-count", `
+imm f = (a:number, b:number)=>{ a + b }
+f(1)
+f(1, 2)
+f(1, 2, 3)
+imm xs = [1, 2]
+f(...xs)`, "3:1 arg-count\n5:1 arg-count"},
+		{"arg-count reassigned", `
+mut f = (a:number)=>{ a }
+f = ()=>{ 0 }
+f()`, ""},
+		{"instanceof", `
+imm Point = ()=>{ return this }
+imm f = ()=>{ 1 }
+imm n = 3
+type T = number
+imm p = Point()
+p instanceof Point
+p instanceof T
+p instanceof f
+p instanceof n
+p instanceof "s"
+p instanceof len`, "9:14 instanceof-non-constructor\n10:14 instanceof-non-constructor\n11:3 instanceof-non-constructor\n12:14 instanceof-non-constructor"},
+		{"no-puts", `
+puts(1)
+imm f = (puts:number)=>{ puts(1) }
+f(1)`, "2:1 no-puts"},
+	}
+	for _, tt := range tests {
+		got := summary(Source("t.kk", tt.input, nil))
+		if got != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSuppression(t *testing.T) {
+	input := `
+// lint:file-ignore no-puts
+imm a = 1 // lint:ignore unused-imm
+// lint:ignore unused-imm, mut-never-reassigned
+mut b = 2
+// lint:ignore
+imm c = 3
+imm d = 4 // lint:ignore shadow
+puts(1)`
+	if got, want := summary(Source("t.kk", input, nil)), "8:5 unused-imm"; got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	config, err := ParseConfig([]byte(`{"rules": {"no-puts": "off", "unused-imm": "error"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	findings := Source("t.kk", "imm a = 1\nputs(2)", config)
+	if len(findings) != 1 || findings[0].Rule != "unused-imm" || findings[0].Severity != SeverityError {
+		t.Errorf("unexpected findings: %v", findings)
+	}
+
+	for _, bad := range []string{`{"rules": {"nope": "off"}}`, `{"rules": {"no-puts": "loud"}}`, `{`} {
+		if _, err := ParseConfig([]byte(bad)); err == nil {
+			t.Errorf("%s: expected error", bad)
+		}
+	}
+}
+
+func TestFindingOutput(t *testing.T) {
+	findings := Source("t.kk", "puts(1)", nil)
+	if len(findings) != 1 {
+		t.Fatalf("got %d findings", len(findings))
+	}
+	want := "t.kk:1:1: warning: puts call left in the script (no-puts)"
+	if got := findings[0].String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	out, err := json.Marshal(findings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = `[{"rule":"no-puts","severity":"warning","message":"puts call left in the script","file":"t.kk","line":1,"column":1}]`
+	if string(out) != want {
+		t.Errorf("got %s, want %s", out, want)
+	}
+}
+
+func TestSyntaxError(t *testing.T) {
+	findings := Source("t.kk", "imm = 1 // lint:ignore", nil)
+	if len(findings) == 0 {
+		t.Fatal("expected syntax findings")
+	}
+	for _, f := range findings {
+		if f.Rule != SyntaxRule || f.Severity != SeverityError {
+			t.Errorf("unexpected finding: %v", f)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package lint
+
+import (
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/resolve"
+	"monkey/token"
+	"strings"
+)
+
+/*
+ * ルール
+ * IDは設定と抑制コメントで使う
+ */
+type Rule struct {
+	ID          string
+	Severity    Severity // 既定の重大度
+	Description string
+	check       func(c *checker)
+}
+
+// すべてのルール（この順に検査する）
+var Rules = []*Rule{
+	{"unused-imm", SeverityWarning, "imm binding that is never used", checkUnusedImm},
+	{"shadow", SeverityWarning, "binding that shadows a name from an outer scope", checkShadow},
+	{"mut-never-reassigned", SeverityWarning, "mut binding that is never reassigned", checkMutNeverReassigned},
+	{"unreachable", SeverityWarning, "statement after return, break or continue", checkUnreachable},
+	{"arg-count", SeverityError, "call with the wrong number of arguments to a known function", checkArgCount},
+	{"instanceof-non-constructor", SeverityError, "instanceof against something that is not a constructor or type", checkInstanceOf},
+	{"no-puts", SeverityWarning, "puts left in the script", checkNoPuts},
+}
+
+func findRule(id string) *Rule {
+	for _, rule := range Rules {
+		if rule.ID == id {
+			return rule
+		}
+	}
+	return nil
+}
+
+// _ で始まる名前は使わないことを示す
+func ignored(name string) bool {
+	return strings.HasPrefix(name, "_")
+}
+
+// thisを返す関数はコンストラクタ
+func isConstructor(fn *ast.FunctionLiteral) bool {
+	return fn != nil && fn.Body.ReturnsThis()
+}
+
+// コンストラクタのメンバ（外から使うかもしれない）
+func isMember(b *resolve.Binding) bool {
+	return isConstructor(b.Scope.Function) && b.Decl != "param"
+}
+
+// ループで束縛した変数
+func isLoopBinding(b *resolve.Binding) bool {
+	loop := b.Scope.Loop
+	return loop != nil && loop.Bind != nil && loop.Bind.Ident != nil && loop.Bind.Ident.Token == b.Token
+}
+
+/*
+ * 使わないimm
+ */
+func checkUnusedImm(c *checker) {
+	for _, b := range c.info.Bindings {
+		if b.Decl != "imm" || len(b.Refs) > 0 || ignored(b.Name) || isMember(b) || isLoopBinding(b) {
+			continue
+		}
+		c.report(b.Token, "%s is declared but never used", b.Name)
+	}
+}
+
+/*
+ * 外側のスコープの名前を隠す束縛
+ */
+func checkShadow(c *checker) {
+	for _, b := range c.info.Bindings {
+		if b.Decl == "type" || ignored(b.Name) {
+			continue
+		}
+		if outer := b.Scope.Outer(b.Name); outer != nil {
+			c.report(b.Token, "%s shadows the declaration at line %d", b.Name, outer.Token.Row)
+		}
+	}
+}
+
+/*
+ * 代入しないmut
+ * pub mutとコンストラクタのメンバは外から代入するかもしれない
+ */
+func checkMutNeverReassigned(c *checker) {
+	for _, b := range c.info.Bindings {
+		if b.Decl != "mut" || b.Public || b.Assigned() || ignored(b.Name) || isMember(b) || isLoopBinding(b) {
+			continue
+		}
+		c.report(b.Token, "%s is never reassigned; use imm", b.Name)
+	}
+}
+
+/*
+ * return/break/continueの後ろの文
+ * 文の並びごとに最初の1つだけ報告する
+ */
+func checkUnreachable(c *checker) {
+	ast.Inspect(c.program, func(n ast.Node) bool {
+		var stmts []ast.Statement
+		switch n := n.(type) {
+		case *ast.Program:
+			stmts = n.Statements
+		case *ast.BlockStatement:
+			stmts = n.Statements
+		default:
+			return true
+		}
+		exited := false
+		for _, stmt := range stmts {
+			switch stmt.(type) {
+			case *ast.CommentStatement:
+				continue
+			case *ast.ReturnStatement, *ast.BreakStatement, *ast.ContinueStatement:
+				if !exited {
+					exited = true
+					continue
+				}
+			}
+			if exited {
+				c.report(ast.NodeToken(stmt), "unreachable code")
+				break
+			}
+		}
+		return true
+	})
+}
+
+/*
+ * 引数の数が合わない呼び出し
+ * 代入しない名前に束縛した関数リテラルの呼び出しだけを調べる
+ * ...で展開した引数があれば数は分からない
+ */
+func checkArgCount(c *checker) {
+	ast.Inspect(c.program, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpression)
+		if !ok {
+			return true
+		}
+		ident, ok := call.Function.(*ast.Identifier)
+		if !ok {
+			return true
+		}
+		b := c.binding(ident)
+		if b == nil || b.Function() == nil || b.Assigned() {
+			return true
+		}
+		for _, arg := range call.Arguments {
+			if p, ok := arg.(*ast.PrefixExpression); ok && p.Token.Type == token.PARSE {
+				return true
+			}
+		}
+		want, got := len(b.Function().Parameters), len(call.Arguments)
+		if want != got {
+			c.report(ident.Token, "%s expects %d %s, got %d", ident.Name, want, plural(want, "argument"), got)
+		}
+		return true
+	})
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return word
+	}
+	return word + "s"
+}
+
+/*
+ * コンストラクタでも型でもないものに対するinstanceof
+ */
+func checkInstanceOf(c *checker) {
+	ast.Inspect(c.program, func(n ast.Node) bool {
+		infix, ok := n.(*ast.InfixExpression)
+		if !ok || infix.Operator != "instanceof" {
+			return true
+		}
+		switch right := infix.Right.(type) {
+		case *ast.Identifier:
+			b := c.binding(right)
+			switch {
+			case b == nil && isBuiltin(right.Name):
+				c.report(right.Token, "%s is a builtin function, not a constructor", right.Name)
+			case b == nil || b.Assigned():
+			case b.Function() != nil && !isConstructor(b.Function()):
+				c.report(right.Token, "%s is a function that does not return this, not a constructor", right.Name)
+			case isValueLiteral(b.Value):
+				c.report(right.Token, "%s is not a constructor or type", right.Name)
+			}
+		case *ast.FunctionLiteral:
+			if !isConstructor(right) {
+				c.report(right.Token, "right operand of instanceof is not a constructor")
+			}
+		default:
+			if isValueLiteral(right) {
+				c.report(infix.Token, "right operand of instanceof is not a constructor or type")
+			}
+		}
+		return true
+	})
+}
+
+// 関数でも型でもないリテラル
+func isValueLiteral(e ast.Expression) bool {
+	switch e.(type) {
+	case *ast.BooleanLiteral, *ast.IntegerLiteral, *ast.FloatLiteral, *ast.ComplexLiteral,
+		*ast.StringLiteral, *ast.TemplateLiteral, *ast.ArrayLiteral, *ast.HashLiteral:
+		return true
+	}
+	return false
+}
+
+func isBuiltin(name string) bool {
+	for _, b := range evaluator.BuiltinNames() {
+		if b == name {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ * 残ったputs
+ */
+func checkNoPuts(c *checker) {
+	ast.Inspect(c.program, func(n ast.Node) bool {
+		if call, ok := n.(*ast.CallExpression); ok {
+			if ident, ok := call.Function.(*ast.Identifier); ok && ident.Name == "puts" && c.binding(ident) == nil {
+				c.report(ident.Token, "puts call left in the script")
+			}
+		}
+		return true
+	})
+}
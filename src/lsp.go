@@ -0,0 +1,19 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"monkey/lsp"
+)
+
+/*
+ * lsp サブコマンド
+ * 標準入出力でLanguage Server Protocolを話す
+ */
+func runLSP(stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	if err := lsp.NewServer(stdin, stdout).Run(); err != nil {
+		fmt.Fprintf(stderr, "lsp: %s\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,68 @@
+package lsp
+
+import (
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/resolve"
+	"monkey/token"
+	"strings"
+)
+
+/*
+ * 開いているドキュメントを解析した結果
+ * 構文エラーがあっても解析できたところまでの木を使う
+ */
+type document struct {
+	uri     string
+	text    string
+	lines   []string
+	tokens  []*token.Token
+	program *ast.Program
+	errors  []parser.ErrorDetail
+	info    *resolve.Info
+}
+
+func analyze(uri string, text string) *document {
+	d := &document{
+		uri:    uri,
+		text:   text,
+		lines:  strings.Split(text, "\n"),
+		tokens: lexer.GetTokens(text),
+	}
+	p := parser.NewParser(text)
+	d.program, _ = p.ParseProgram()
+	d.errors = p.ErrorDetails()
+	d.info = resolve.Program(d.program, d.tokens)
+	return d
+}
+
+// 関数の本体の終わり
+func (d *document) functionEnd(fn *ast.FunctionLiteral) resolve.Pos {
+	for _, s := range d.info.Scopes {
+		if s.Function == fn {
+			return s.End
+		}
+	}
+	return d.info.Root.End
+}
+
+// 位置にある名前の束縛か参照
+func (d *document) identAt(p resolve.Pos) (*resolve.Binding, *resolve.Reference) {
+	for _, b := range d.info.Bindings {
+		if onToken(b.Token, p) {
+			return b, nil
+		}
+	}
+	for _, ref := range d.info.Refs {
+		if onToken(ref.Token, p) {
+			return nil, ref
+		}
+	}
+	return nil, nil
+}
+
+// 位置がトークンの上か（直後も含める）
+func onToken(t token.Token, p resolve.Pos) bool {
+	return t.Row == p.Row && t.Col <= p.Col && p.Col <= t.Col+displayWidth(t.Literal)
+}
@@ -0,0 +1,240 @@
+package lsp
+
+import (
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/resolve"
+	"monkey/token"
+	"strings"
+)
+
+/*
+ * 構文エラーの診断
+ * 構文解析器がつけたエラーの範囲を示す
+ */
+func (d *document) diagnostics() []Diagnostic {
+	diags := []Diagnostic{}
+	for _, e := range d.errors {
+		r := Range{
+			Start: d.toPosition(resolve.TokenPos(e.Token)),
+			End:   d.toPosition(resolve.Pos{Row: e.EndRow, Col: e.EndCol}),
+		}
+		diags = append(diags, Diagnostic{Range: r, Severity: SeverityError, Source: "monkey", Message: e.Message})
+	}
+	return diags
+}
+
+/*
+ * ホバー
+ * 束縛の宣言と型を表示する
+ */
+func (d *document) hover(p Position) *Hover {
+	at := d.fromPosition(p)
+	b, ref := d.identAt(at)
+	var text string
+	var t token.Token
+	switch {
+	case b != nil:
+		text, t = signature(b), b.Token
+	case ref != nil && ref.Binding != nil:
+		text, t = signature(ref.Binding), ref.Token
+	case ref != nil && isBuiltin(ref.Token.Literal):
+		text, t = "builtin "+ref.Token.Literal, ref.Token
+	default:
+		return nil
+	}
+	r := d.tokenRange(t)
+	return &Hover{
+		Contents: MarkupContent{Kind: "markdown", Value: "```monkey\n" + text + "\n```"},
+		Range:    &r,
+	}
+}
+
+// 束縛の宣言を1行で表す
+func signature(b *resolve.Binding) string {
+	var out strings.Builder
+	switch b.Decl {
+	case "type":
+		out.WriteString("type " + b.Name)
+		if b.Type != nil {
+			out.WriteString(" = " + b.Type.String())
+		}
+		return out.String()
+	case "param", "pattern", "select":
+		out.WriteString("(" + b.Decl + ") ")
+	default:
+		if b.Public {
+			out.WriteString("pub ")
+		}
+		out.WriteString(b.Decl + " ")
+	}
+	out.WriteString(b.Name)
+	if b.Type != nil {
+		out.WriteString(":" + b.Type.String())
+	}
+	if fn := b.Function(); fn != nil {
+		out.WriteString(" = " + functionType(fn))
+	}
+	return out.String()
+}
+
+// (名前:型, ...):戻り値の型
+func functionType(fn *ast.FunctionLiteral) string {
+	params := make([]string, len(fn.Parameters))
+	for i, p := range fn.Parameters {
+		params[i] = p.Name
+		if p.Type != nil {
+			params[i] += ":" + p.Type.String()
+		}
+	}
+	out := "(" + strings.Join(params, ", ") + ")"
+	if fn.ReturnType != nil {
+		out += ":" + fn.ReturnType.String()
+	}
+	return out
+}
+
+func isBuiltin(name string) bool {
+	for _, b := range evaluator.BuiltinNames() {
+		if b == name {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ * 定義へ移動
+ * 名前を束縛した宣言の位置を返す
+ */
+func (d *document) definition(p Position) *Location {
+	b, ref := d.identAt(d.fromPosition(p))
+	if ref != nil {
+		b = ref.Binding
+	}
+	if b == nil {
+		return nil
+	}
+	return &Location{URI: d.uri, Range: d.tokenRange(b.Token)}
+}
+
+/*
+ * ドキュメントのシンボル
+ * トップレベルの宣言と、コンストラクタの本体で宣言したメンバ
+ */
+func (d *document) symbols() []DocumentSymbol {
+	list := []DocumentSymbol{}
+	if d.program == nil {
+		return list
+	}
+	for _, stmt := range d.program.Statements {
+		switch s := stmt.(type) {
+		case *ast.LetStatement:
+			if s.Ident == nil {
+				continue
+			}
+			sym := d.letSymbol(s, false)
+			if fn, ok := s.Value.(*ast.FunctionLiteral); ok && fn.Body != nil {
+				for _, member := range fn.Body.Statements {
+					if m, ok := member.(*ast.LetStatement); ok && m.Ident != nil {
+						sym.Children = append(sym.Children, d.letSymbol(m, true))
+					}
+				}
+				if len(sym.Children) > 0 {
+					sym.Kind = SymbolClass
+				}
+			}
+			list = append(list, sym)
+		case *ast.TypeStatement:
+			if s.Ident == nil || s.Value == nil {
+				continue
+			}
+			list = append(list, DocumentSymbol{
+				Name:           s.Ident.Name,
+				Detail:         s.Value.String(),
+				Kind:           SymbolInterface,
+				Range:          d.lineRange(s.Token),
+				SelectionRange: d.tokenRange(s.Ident.Token),
+			})
+		}
+	}
+	return list
+}
+
+func (d *document) letSymbol(s *ast.LetStatement, member bool) DocumentSymbol {
+	sym := DocumentSymbol{
+		Name:           s.Ident.Name,
+		Detail:         s.Token.Literal,
+		Kind:           SymbolVariable,
+		Range:          d.lineRange(s.Token),
+		SelectionRange: d.tokenRange(s.Ident.Token),
+	}
+	if s.Ident.Type != nil {
+		sym.Detail += ":" + s.Ident.Type.String()
+	}
+	switch {
+	case s.Token.Type == token.CONST:
+		sym.Kind = SymbolConstant
+	case member:
+		sym.Kind = SymbolField
+	}
+	if fn, ok := s.Value.(*ast.FunctionLiteral); ok {
+		sym.Detail += " " + functionType(fn)
+		sym.Kind = SymbolFunction
+		if member {
+			sym.Kind = SymbolMethod
+		}
+		// 関数は本体の閉じかっこまで
+		sym.Range.End = d.toPosition(d.functionEnd(fn))
+		sym.Range.End.Character++
+	}
+	return sym
+}
+
+// トークンからその行の終わりまで
+func (d *document) lineRange(t token.Token) Range {
+	line := strings.TrimRight(d.line(t.Row), " \t\r")
+	return Range{
+		Start: d.toPosition(resolve.TokenPos(t)),
+		End:   Position{Line: t.Row - 1, Character: utf16Len(line)},
+	}
+}
+
+/*
+ * 補完
+ * 位置から見える名前（内側のスコープを優先）と組み込み関数
+ */
+func (d *document) completion(p Position) []CompletionItem {
+	at := d.fromPosition(p)
+	items := []CompletionItem{}
+	seen := map[string]bool{}
+	for s := d.info.ScopeAt(at); s != nil; s = s.Parent {
+		for i := len(s.Bindings) - 1; i >= 0; i-- {
+			b := s.Bindings[i]
+			// 内側のスコープではまだ宣言していない名前は使えない
+			if seen[b.Name] || s != d.info.Root && at.Before(resolve.TokenPos(b.Token)) {
+				continue
+			}
+			seen[b.Name] = true
+			items = append(items, CompletionItem{Label: b.Name, Kind: completionKind(b), Detail: signature(b)})
+		}
+	}
+	for _, name := range evaluator.BuiltinNames() {
+		if !seen[name] {
+			items = append(items, CompletionItem{Label: name, Kind: CompletionFunction, Detail: "builtin"})
+		}
+	}
+	return items
+}
+
+func completionKind(b *resolve.Binding) int {
+	switch {
+	case b.Decl == "type":
+		return CompletionClass
+	case b.Decl == "const":
+		return CompletionConstant
+	case b.Function() != nil:
+		return CompletionFunction
+	}
+	return CompletionVariable
+}
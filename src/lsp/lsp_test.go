@@ -0,0 +1,374 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// パイプ越しにサーバーと話すクライアント
+type client struct {
+	t      *testing.T
+	w      io.Writer
+	r      *bufio.Reader
+	nextID int
+	diags  map[string][]Diagnostic // 最後に受け取った診断
+	done   chan error
+}
+
+func newClient(t *testing.T) *client {
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+	c := &client{t: t, w: clientOut, r: bufio.NewReader(clientIn), diags: map[string][]Diagnostic{}, done: make(chan error, 1)}
+	go func() {
+		err := NewServer(serverIn, serverOut).Run()
+		serverOut.Close()
+		c.done <- err
+	}()
+	return c
+}
+
+func (c *client) send(msg interface{}) {
+	if err := WriteMessage(c.w, msg); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *client) notify(method string, params interface{}) {
+	c.send(map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+// 要求を送って応答を待つ（途中の通知は診断として取っておく）
+func (c *client) call(method string, params interface{}, result interface{}) *responseError {
+	c.nextID++
+	c.send(map[string]interface{}{"jsonrpc": "2.0", "id": c.nextID, "method": method, "params": params})
+	for {
+		var msg struct {
+			ID     *int            `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+			Result json.RawMessage `json:"result"`
+			Error  *responseError  `json:"error"`
+		}
+		c.read(&msg)
+		if msg.ID == nil {
+			c.received(msg.Method, msg.Params)
+			continue
+		}
+		if *msg.ID != c.nextID {
+			c.t.Fatalf("response id wrong. got=%d, want=%d", *msg.ID, c.nextID)
+		}
+		if msg.Error != nil {
+			return msg.Error
+		}
+		if result != nil {
+			if err := json.Unmarshal(msg.Result, result); err != nil {
+				c.t.Fatalf("%s: %s", method, err)
+			}
+		}
+		return nil
+	}
+}
+
+func (c *client) read(v interface{}) {
+	body, err := ReadMessage(c.r)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// 次の通知を待つ
+func (c *client) waitNotification() {
+	var msg struct {
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+	}
+	c.read(&msg)
+	c.received(msg.Method, msg.Params)
+}
+
+func (c *client) received(method string, params json.RawMessage) {
+	if method != "textDocument/publishDiagnostics" {
+		c.t.Fatalf("unexpected notification: %s", method)
+	}
+	var p PublishDiagnosticsParams
+	if err := json.Unmarshal(params, &p); err != nil {
+		c.t.Fatal(err)
+	}
+	c.diags[p.URI] = p.Diagnostics
+}
+
+func (c *client) open(uri string, text string) {
+	c.notify("textDocument/didOpen", DidOpenTextDocumentParams{TextDocument: TextDocumentItem{URI: uri, Version: 1, Text: text}})
+	c.waitNotification()
+}
+
+func at(uri string, line int, char int) TextDocumentPositionParams {
+	return TextDocumentPositionParams{TextDocument: TextDocumentIdentifier{URI: uri}, Position: Position{line, char}}
+}
+
+const uri = "file:///test.kk"
+
+const source = `// 点を作る
+imm Point = (x:number, y:number)=>{
+    imm px:number = x
+    mut py = y
+    imm norm = ():number=>{ px * px + py * py }
+}
+type Shape = { area: (n:number) => number }
+mut total:int = 0
+imm p = Point(1, 2)
+loop(imm i = [1, 2]){
+    total = total + len([i])
+}
+imm s = "a${total}b" // 文字列
+`
+
+func initialize(t *testing.T) *client {
+	c := newClient(t)
+	var result struct {
+		Capabilities map[string]json.RawMessage `json:"capabilities"`
+	}
+	if err := c.call("initialize", map[string]interface{}{"capabilities": map[string]interface{}{}}, &result); err != nil {
+		t.Fatalf("initialize: %v", err)
+	}
+	for _, name := range []string{"textDocumentSync", "hoverProvider", "definitionProvider", "documentSymbolProvider", "completionProvider", "semanticTokensProvider"} {
+		if _, ok := result.Capabilities[name]; !ok {
+			t.Errorf("capability %s missing", name)
+		}
+	}
+	c.notify("initialized", map[string]interface{}{})
+	return c
+}
+
+func shutdown(t *testing.T, c *client) {
+	if err := c.call("shutdown", nil, nil); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	c.notify("exit", nil)
+	if err := <-c.done; err != nil {
+		t.Errorf("server error: %s", err)
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	c := initialize(t)
+	c.open(uri, "imm a = 1\nimm = 2\nimm b = )\n")
+	diags := c.diags[uri]
+	if len(diags) != 2 {
+		t.Fatalf("expected 2 diagnostics, got %+v", diags)
+	}
+	want := Range{Start: Position{1, 4}, End: Position{1, 5}}
+	if diags[0].Range != want || diags[0].Severity != SeverityError {
+		t.Errorf("diagnostic wrong. got=%+v", diags[0])
+	}
+	if want := (Range{Start: Position{2, 8}, End: Position{2, 9}}); diags[1].Range != want {
+		t.Errorf("second diagnostic wrong. got=%+v", diags[1])
+	}
+
+	// 直したら診断は空になる
+	c.notify("textDocument/didChange", DidChangeTextDocumentParams{
+		TextDocument:   TextDocumentIdentifier{URI: uri},
+		ContentChanges: []TextDocumentContentChangeEvent{{Text: "imm a = 1\nimm b = 2\n"}},
+	})
+	c.waitNotification()
+	if d, ok := c.diags[uri]; !ok || len(d) != 0 {
+		t.Errorf("diagnostics not cleared. got=%+v", d)
+	}
+	shutdown(t, c)
+}
+
+func TestHoverAndDefinition(t *testing.T) {
+	c := initialize(t)
+	c.open(uri, source)
+
+	hovers := []struct {
+		line, char int
+		want       string
+	}{
+		{2, 9, "imm px:number"},                    // 宣言
+		{4, 30, "imm px:number"},                   // 参照
+		{1, 14, "(param) x:number"},                // 引数
+		{8, 9, "imm Point = (x:number, y:number)"}, // 関数
+		{10, 21, "builtin len"},
+		{6, 6, "type Shape = { area: (n:number) => number }"},
+	}
+	for _, tt := range hovers {
+		var h *Hover
+		if err := c.call("textDocument/hover", at(uri, tt.line, tt.char), &h); err != nil {
+			t.Fatal(err)
+		}
+		if h == nil || !strings.Contains(h.Contents.Value, tt.want+"\n") {
+			t.Errorf("hover at %d:%d wrong. got=%+v, want=%q", tt.line, tt.char, h, tt.want)
+		}
+	}
+	var none *Hover
+	if err := c.call("textDocument/hover", at(uri, 0, 3), &none); err != nil || none != nil {
+		t.Errorf("hover on comment. got=%+v, err=%v", none, err)
+	}
+
+	definitions := []struct {
+		line, char int
+		want       Range
+	}{
+		{4, 39, Range{Position{3, 8}, Position{3, 10}}},  // py
+		{2, 20, Range{Position{1, 13}, Position{1, 14}}}, // x
+		{10, 26, Range{Position{9, 9}, Position{9, 10}}}, // ループの変数 i
+		{10, 14, Range{Position{7, 4}, Position{7, 9}}},  // total
+		{12, 13, Range{Position{7, 4}, Position{7, 9}}},  // 文字列の中の total
+		{8, 10, Range{Position{1, 4}, Position{1, 9}}},   // Point
+	}
+	for _, tt := range definitions {
+		var loc *Location
+		if err := c.call("textDocument/definition", at(uri, tt.line, tt.char), &loc); err != nil {
+			t.Fatal(err)
+		}
+		if loc == nil || loc.URI != uri || loc.Range != tt.want {
+			t.Errorf("definition at %d:%d wrong. got=%+v, want=%+v", tt.line, tt.char, loc, tt.want)
+		}
+	}
+	shutdown(t, c)
+}
+
+func TestDocumentSymbols(t *testing.T) {
+	c := initialize(t)
+	c.open(uri, source)
+	var symbols []DocumentSymbol
+	if err := c.call("textDocument/documentSymbol", map[string]interface{}{"textDocument": TextDocumentIdentifier{URI: uri}}, &symbols); err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, s := range symbols {
+		got = append(got, s.Name)
+	}
+	if strings.Join(got, " ") != "Point Shape total p s" {
+		t.Fatalf("symbols wrong. got=%v", got)
+	}
+	point := symbols[0]
+	if point.Kind != SymbolClass || point.Range.End != (Position{5, 1}) || len(point.Children) != 3 {
+		t.Fatalf("constructor symbol wrong. got=%+v", point)
+	}
+	kinds := []int{point.Children[0].Kind, point.Children[1].Kind, point.Children[2].Kind}
+	if kinds[0] != SymbolField || kinds[1] != SymbolField || kinds[2] != SymbolMethod {
+		t.Errorf("member kinds wrong. got=%v", kinds)
+	}
+	if d := point.Children[2].Detail; d != "imm ():number" {
+		t.Errorf("member detail wrong. got=%q", d)
+	}
+	if symbols[1].Kind != SymbolInterface || symbols[2].Detail != "mut:int" {
+		t.Errorf("symbols wrong. got=%+v", symbols[1:3])
+	}
+	shutdown(t, c)
+}
+
+func TestCompletion(t *testing.T) {
+	c := initialize(t)
+	c.open(uri, source)
+	labels := func(line, char int) map[string]CompletionItem {
+		var list CompletionList
+		if err := c.call("textDocument/completion", at(uri, line, char), &list); err != nil {
+			t.Fatal(err)
+		}
+		items := map[string]CompletionItem{}
+		for _, item := range list.Items {
+			items[item.Label] = item
+		}
+		return items
+	}
+
+	// コンストラクタの中
+	items := labels(4, 4)
+	for _, name := range []string{"x", "y", "px", "py", "Point", "total", "len", "puts"} {
+		if _, ok := items[name]; !ok {
+			t.Errorf("completion missing %s", name)
+		}
+	}
+	if _, ok := items["norm"]; ok {
+		t.Errorf("name declared later is completed")
+	}
+	if _, ok := items["i"]; ok {
+		t.Errorf("loop variable is completed outside the loop")
+	}
+	if items["Point"].Kind != CompletionFunction || items["len"].Detail != "builtin" {
+		t.Errorf("items wrong. got=%+v %+v", items["Point"], items["len"])
+	}
+
+	// ループの中とトップレベル
+	if _, ok := labels(10, 4)["i"]; !ok {
+		t.Errorf("loop variable not completed in the loop")
+	}
+	items = labels(13, 0)
+	if _, ok := items["px"]; ok {
+		t.Errorf("member completed at top level")
+	}
+	if _, ok := items["s"]; !ok {
+		t.Errorf("top level name not completed")
+	}
+	shutdown(t, c)
+}
+
+func TestSemanticTokens(t *testing.T) {
+	c := initialize(t)
+	c.open(uri, "// c\nimm f = (x:number)=>{ x + 1 }\nf(\"s${x}\")\n")
+	var tokens SemanticTokens
+	if err := c.call("textDocument/semanticTokens/full", map[string]interface{}{"textDocument": TextDocumentIdentifier{URI: uri}}, &tokens); err != nil {
+		t.Fatal(err)
+	}
+
+	// 相対位置を戻して読みやすくする
+	got := []string{}
+	line, char := 0, 0
+	data := tokens.Data
+	for i := 0; i+4 < len(data); i += 5 {
+		if data[i] != 0 {
+			char = 0
+		}
+		line += data[i]
+		char += data[i+1]
+		got = append(got, strings.Join([]string{
+			strconv.Itoa(line) + ":" + strconv.Itoa(char), strconv.Itoa(data[i+2]), semanticTokenTypes[data[i+3]], strconv.Itoa(data[i+4]),
+		}, " "))
+	}
+	want := []string{
+		"0:0 4 comment 0",
+		"1:0 3 keyword 0",
+		"1:4 1 function " + strconv.Itoa(modDeclaration|modReadonly),
+		"1:9 1 parameter " + strconv.Itoa(modDeclaration),
+		"1:11 6 type 0",
+		"1:22 1 parameter 0",
+		"1:26 1 number 0",
+		"2:0 1 function " + strconv.Itoa(modReadonly),
+		"2:2 2 string 0",
+		"2:6 1 variable 0",
+		"2:8 1 string 0",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("semantic tokens wrong.\ngot:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	shutdown(t, c)
+}
+
+func TestProtocolErrors(t *testing.T) {
+	c := newClient(t)
+	if err := c.call("textDocument/hover", at(uri, 0, 0), nil); err == nil || err.Code != codeNotInitialized {
+		t.Errorf("request before initialize. got=%v", err)
+	}
+	c.call("initialize", map[string]interface{}{}, nil)
+	if err := c.call("unknown/method", nil, nil); err == nil || err.Code != codeMethodNotFound {
+		t.Errorf("unknown method. got=%v", err)
+	}
+	if err := c.call("textDocument/hover", at("file:///none.kk", 0, 0), nil); err == nil || err.Code != codeInvalidParams {
+		t.Errorf("unknown document. got=%v", err)
+	}
+	// shutdownなしのexitはエラー
+	c.notify("exit", nil)
+	if err := <-c.done; err != ErrExitWithoutShutdown {
+		t.Errorf("exit without shutdown. got=%v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package lsp
+
+import (
+	"monkey/resolve"
+	"monkey/token"
+	"unicode/utf8"
+
+	"github.com/mattn/go-runewidth"
+)
+
+/*
+ * 位置の変換
+ * 字句解析器の列は1オリジンの表示幅、LSPの列は0オリジンのUTF-16の単位
+ */
+
+// 1文字の表示幅（字句解析器と同じ数え方）
+func runeWidth(r rune) int {
+	if r < utf8.RuneSelf {
+		return 1
+	}
+	return runewidth.RuneWidth(r)
+}
+
+func displayWidth(s string) int {
+	w := 0
+	for _, r := range s {
+		w += runeWidth(r)
+	}
+	return w
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+func (d *document) line(row int) string {
+	if row < 1 || row > len(d.lines) {
+		return ""
+	}
+	return d.lines[row-1]
+}
+
+// 字句解析器の位置をLSPの位置にする
+func (d *document) toPosition(p resolve.Pos) Position {
+	col, char := 1, 0
+	for _, r := range d.line(p.Row) {
+		if col >= p.Col {
+			break
+		}
+		col += runeWidth(r)
+		char += utf16Len(string(r))
+	}
+	return Position{Line: p.Row - 1, Character: char}
+}
+
+// LSPの位置を字句解析器の位置にする
+func (d *document) fromPosition(p Position) resolve.Pos {
+	col, char := 1, 0
+	for _, r := range d.line(p.Line + 1) {
+		if char >= p.Character {
+			break
+		}
+		col += runeWidth(r)
+		char += utf16Len(string(r))
+	}
+	return resolve.Pos{Row: p.Line + 1, Col: col}
+}
+
+// トークンの範囲（1行に収まるトークンだけ）
+func (d *document) tokenRange(t token.Token) Range {
+	start := d.toPosition(resolve.TokenPos(t))
+	end := start
+	end.Character += utf16Len(t.Literal)
+	return Range{Start: start, End: end}
+}
@@ -0,0 +1,249 @@
+package lsp
+
+import (
+	"monkey/resolve"
+	"monkey/token"
+	"sort"
+	"strings"
+)
+
+// セマンティックトークンの種類（凡例の順）
+var semanticTokenTypes = []string{"keyword", "type", "function", "parameter", "variable", "property", "string", "number", "comment"}
+
+const (
+	semKeyword = iota
+	semType
+	semFunction
+	semParameter
+	semVariable
+	semProperty
+	semString
+	semNumber
+	semComment
+)
+
+// 修飾子（ビットの位置が凡例の順）
+var semanticTokenModifiers = []string{"declaration", "readonly", "defaultLibrary"}
+
+const (
+	modDeclaration = 1 << iota
+	modReadonly
+	modDefaultLibrary
+)
+
+// 1つのセマンティックトークン
+type semToken struct {
+	line      int
+	char      int
+	length    int
+	kind      int
+	modifiers int
+}
+
+/*
+ * セマンティックトークン
+ * 字句解析のトークンに、名前は束縛をたどって種類をつける
+ * 行をまたぐコメントと文字列は行ごとに分ける
+ */
+func (d *document) semanticTokens() []int {
+	idents := d.identKinds()
+	list := []semToken{}
+	for _, t := range d.tokens {
+		p := d.toPosition(resolve.TokenPos(*t))
+		switch {
+		case t.Type == token.LINE_COMMENT || t.Type == token.BLOCK_COMMENT:
+			list = append(list, d.commentTokens(*t)...)
+		case t.Type == token.STRING:
+			if st, ok := d.stringToken(*t); ok {
+				list = append(list, st)
+			}
+		case t.Type == token.IDENT:
+			k, ok := idents[resolve.TokenPos(*t)]
+			if !ok {
+				k = semToken{kind: semVariable}
+			}
+			k.line, k.char, k.length = p.Line, p.Character, utf16Len(t.Literal)
+			list = append(list, k)
+		case !d.literalAt(*t):
+			// 位置がソースの文字と合わないトークン
+		case t.Type == token.TYPE:
+			list = append(list, semToken{p.Line, p.Character, utf16Len(t.Literal), semType, 0})
+		case isNumber(t.Type):
+			list = append(list, semToken{p.Line, p.Character, utf16Len(t.Literal), semNumber, 0})
+		case isKeyword(t.Type):
+			list = append(list, semToken{p.Line, p.Character, utf16Len(t.Literal), semKeyword, 0})
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].line != list[j].line {
+			return list[i].line < list[j].line
+		}
+		return list[i].char < list[j].char
+	})
+
+	// 前のトークンからの相対位置で並べる
+	data := []int{}
+	line, char := 0, 0
+	for _, st := range list {
+		if st.length <= 0 {
+			continue
+		}
+		if st.line != line {
+			char = 0
+		}
+		data = append(data, st.line-line, st.char-char, st.length, st.kind, st.modifiers)
+		line, char = st.line, st.char
+	}
+	return data
+}
+
+// 名前の種類と修飾子
+func (d *document) identKinds() map[resolve.Pos]semToken {
+	kinds := map[resolve.Pos]semToken{}
+	for _, b := range d.info.Bindings {
+		k := bindingToken(b)
+		k.modifiers |= modDeclaration
+		kinds[resolve.TokenPos(b.Token)] = k
+	}
+	for _, ref := range d.info.Refs {
+		switch {
+		case ref.Binding != nil:
+			kinds[resolve.TokenPos(ref.Token)] = bindingToken(ref.Binding)
+		case isBuiltin(ref.Token.Literal):
+			kinds[resolve.TokenPos(ref.Token)] = semToken{kind: semFunction, modifiers: modDefaultLibrary}
+		}
+	}
+	for _, t := range d.info.Properties {
+		kinds[resolve.TokenPos(t)] = semToken{kind: semProperty}
+	}
+	return kinds
+}
+
+func bindingToken(b *resolve.Binding) semToken {
+	k := semToken{kind: semVariable}
+	switch {
+	case b.Decl == "type":
+		k.kind = semType
+	case b.Decl == "param":
+		k.kind = semParameter
+	case b.Function() != nil:
+		k.kind = semFunction
+	}
+	if b.Decl == "imm" || b.Decl == "const" {
+		k.modifiers |= modReadonly
+	}
+	return k
+}
+
+// トークンがソースにそのまま書かれているか
+func (d *document) literalAt(t token.Token) bool {
+	p := d.toPosition(resolve.TokenPos(t))
+	line := []rune(d.line(t.Row))
+	units := 0
+	for i, r := range line {
+		if units == p.Character {
+			return strings.HasPrefix(string(line[i:]), t.Literal)
+		}
+		units += utf16Len(string(r))
+	}
+	return false
+}
+
+/*
+ * 文字列のトークン
+ * 位置は開きの " か ${ } の直後なので、そこから閉じの " か ${ までにする
+ * 複数行の文字列は最初の行だけ
+ */
+func (d *document) stringToken(t token.Token) (semToken, bool) {
+	p := d.toPosition(resolve.TokenPos(t))
+	line := []rune(d.line(t.Row))
+	start := runeIndex(line, p.Character)
+	end := start
+	if start > 0 && line[start-1] == '"' {
+		start--
+	}
+	for end < len(line) {
+		if line[end] == '\\' {
+			end += 2
+			continue
+		}
+		if line[end] == '"' {
+			end++
+			break
+		}
+		if line[end] == '$' && end+1 < len(line) && line[end+1] == '{' {
+			break
+		}
+		end++
+	}
+	end = min(end, len(line))
+	if start >= end {
+		return semToken{}, false
+	}
+	char := utf16Len(string(line[:start]))
+	return semToken{p.Line, char, utf16Len(string(line[start:end])), semString, 0}, true
+}
+
+// UTF-16の位置を文字の位置にする
+func runeIndex(line []rune, units int) int {
+	n := 0
+	for i, r := range line {
+		if n >= units {
+			return i
+		}
+		n += utf16Len(string(r))
+	}
+	return len(line)
+}
+
+/*
+ * コメントのトークン
+ * 続けて書いた // は1つのトークンになっているので行ごとに探す
+ */
+func (d *document) commentTokens(t token.Token) []semToken {
+	list := []semToken{}
+	p := d.toPosition(resolve.TokenPos(t))
+	if t.Type == token.BLOCK_COMMENT {
+		for i, part := range strings.Split("/*"+t.Literal+"*/", "\n") {
+			char := 0
+			if i == 0 {
+				char = p.Character
+			}
+			list = append(list, semToken{p.Line + i, char, utf16Len(strings.TrimRight(part, "\r")), semComment, 0})
+		}
+		return list
+	}
+	row := t.Row
+	for _, part := range strings.Split(t.Literal, "\n") {
+		// コメントの間に空行があっても次の行を探す
+		for row <= len(d.lines) && !strings.Contains(d.line(row), "//"+part) {
+			row++
+		}
+		line := d.line(row)
+		at := strings.Index(line, "//"+part)
+		if at < 0 {
+			break
+		}
+		list = append(list, semToken{row - 1, utf16Len(line[:at]), utf16Len(strings.TrimRight(line[at:], "\r")), semComment, 0})
+		row++
+	}
+	return list
+}
+
+func isNumber(t token.TokenType) bool {
+	switch t {
+	case token.INTEGER, token.FLOAT, token.IMAGINARY, token.HEXA, token.BINARY, token.OCTAL:
+		return true
+	}
+	return false
+}
+
+// 予約語（true/falseも含める）
+func isKeyword(t token.TokenType) bool {
+	for _, r := range token.Reserved {
+		if r == t {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,220 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// shutdownを受け取らずにexitしたときのエラー
+var ErrExitWithoutShutdown = errors.New("exit without shutdown")
+
+/*
+ * 言語サーバー
+ * 1つのgoroutineで要求を順に処理するので、ドキュメントはロックしない
+ */
+type Server struct {
+	in          *bufio.Reader
+	out         io.Writer
+	docs        map[string]*document
+	initialized bool
+	shutdown    bool
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:   bufio.NewReader(in),
+		out:  out,
+		docs: map[string]*document{},
+	}
+}
+
+/*
+ * exitの通知か入力の終わりまでメッセージを処理する
+ * shutdownの後のexitならnilを返す
+ */
+func (s *Server) Run() error {
+	for {
+		body, err := ReadMessage(s.in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var msg message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			if err := s.replyError(nil, codeParseError, err.Error()); err != nil {
+				return err
+			}
+			continue
+		}
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return ErrExitWithoutShutdown
+			}
+			return nil
+		}
+		if err := s.handle(&msg); err != nil {
+			return err
+		}
+	}
+}
+
+// 要求には応答を返し、通知は処理するだけ
+func (s *Server) handle(msg *message) error {
+	if msg.ID == nil {
+		if s.initialized && !s.shutdown {
+			return s.notified(msg)
+		}
+		return nil
+	}
+
+	switch {
+	case msg.Method == "initialize":
+		s.initialized = true
+		return s.reply(msg.ID, initializeResult())
+	case !s.initialized:
+		return s.replyError(msg.ID, codeNotInitialized, "server not initialized")
+	case s.shutdown:
+		return s.replyError(msg.ID, codeInvalidRequest, "server is shutting down")
+	case msg.Method == "shutdown":
+		s.shutdown = true
+		return s.reply(msg.ID, nil)
+	}
+
+	result, err := s.request(msg.Method, msg.Params)
+	if err != nil {
+		return s.replyError(msg.ID, err.Code, err.Message)
+	}
+	return s.reply(msg.ID, result)
+}
+
+func initializeResult() interface{} {
+	return map[string]interface{}{
+		"capabilities": map[string]interface{}{
+			"textDocumentSync":       1, // 全文を同期する
+			"hoverProvider":          true,
+			"definitionProvider":     true,
+			"documentSymbolProvider": true,
+			"completionProvider":     map[string]interface{}{},
+			"semanticTokensProvider": map[string]interface{}{
+				"legend": map[string]interface{}{
+					"tokenTypes":     semanticTokenTypes,
+					"tokenModifiers": semanticTokenModifiers,
+				},
+				"full": true,
+			},
+		},
+		"serverInfo": map[string]string{"name": "monkey"},
+	}
+}
+
+// ドキュメントの同期
+func (s *Server) notified(msg *message) error {
+	switch msg.Method {
+	case "textDocument/didOpen":
+		var params DidOpenTextDocumentParams
+		if json.Unmarshal(msg.Params, &params) != nil {
+			return nil
+		}
+		return s.update(params.TextDocument.URI, params.TextDocument.Text)
+	case "textDocument/didChange":
+		var params DidChangeTextDocumentParams
+		if json.Unmarshal(msg.Params, &params) != nil || len(params.ContentChanges) == 0 {
+			return nil
+		}
+		changes := params.ContentChanges
+		return s.update(params.TextDocument.URI, changes[len(changes)-1].Text)
+	case "textDocument/didClose":
+		var params DidCloseTextDocumentParams
+		if json.Unmarshal(msg.Params, &params) != nil {
+			return nil
+		}
+		delete(s.docs, params.TextDocument.URI)
+		return s.publish(params.TextDocument.URI, []Diagnostic{})
+	}
+	return nil
+}
+
+// ドキュメントを解析しなおして診断を送る
+func (s *Server) update(uri string, text string) error {
+	doc := analyze(uri, text)
+	s.docs[uri] = doc
+	return s.publish(uri, doc.diagnostics())
+}
+
+func (s *Server) publish(uri string, diags []Diagnostic) error {
+	return WriteMessage(s.out, notification{
+		JSONRPC: "2.0",
+		Method:  "textDocument/publishDiagnostics",
+		Params:  PublishDiagnosticsParams{URI: uri, Diagnostics: diags},
+	})
+}
+
+// ドキュメントについての要求
+func (s *Server) request(method string, raw json.RawMessage) (interface{}, *responseError) {
+	switch method {
+	case "textDocument/hover", "textDocument/definition", "textDocument/completion":
+		var params TextDocumentPositionParams
+		doc, err := s.document(raw, &params, &params.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		switch method {
+		case "textDocument/hover":
+			if h := doc.hover(params.Position); h != nil {
+				return h, nil
+			}
+		case "textDocument/definition":
+			if loc := doc.definition(params.Position); loc != nil {
+				return loc, nil
+			}
+		default:
+			return CompletionList{Items: doc.completion(params.Position)}, nil
+		}
+		return nil, nil
+	case "textDocument/documentSymbol":
+		var params DocumentSymbolParams
+		doc, err := s.document(raw, &params, &params.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		return doc.symbols(), nil
+	case "textDocument/semanticTokens/full":
+		var params SemanticTokensParams
+		doc, err := s.document(raw, &params, &params.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		return SemanticTokens{Data: doc.semanticTokens()}, nil
+	}
+	// $/ で始まるものは無視してよい
+	if strings.HasPrefix(method, "$/") {
+		return nil, nil
+	}
+	return nil, &responseError{Code: codeMethodNotFound, Message: "method not found: " + method}
+}
+
+// 引数を読んで、対象のドキュメントを返す
+func (s *Server) document(raw json.RawMessage, params interface{}, id *TextDocumentIdentifier) (*document, *responseError) {
+	if err := json.Unmarshal(raw, params); err != nil {
+		return nil, &responseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	doc, ok := s.docs[id.URI]
+	if !ok {
+		return nil, &responseError{Code: codeInvalidParams, Message: fmt.Sprintf("unknown document: %s", id.URI)}
+	}
+	return doc, nil
+}
+
+func (s *Server) reply(id *json.RawMessage, result interface{}) error {
+	return WriteMessage(s.out, response{JSONRPC: "2.0", ID: id, Result: result})
+}
+
+func (s *Server) replyError(id *json.RawMessage, code int, msg string) error {
+	return WriteMessage(s.out, errorResponse{JSONRPC: "2.0", ID: id, Error: &responseError{Code: code, Message: msg}})
+}
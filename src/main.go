@@ -8,6 +8,27 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "run":
+			os.Exit(runRun(os.Args[2:], os.Stdout, os.Stderr))
+		case "fmt":
+			os.Exit(runFormat(os.Args[2:], os.Stdout, os.Stderr))
+		case "doc":
+			os.Exit(runDoc(os.Args[2:], os.Stdout, os.Stderr))
+		case "ast":
+			os.Exit(runAST(os.Args[2:], os.Stdout, os.Stderr))
+		case "test":
+			os.Exit(runTest(os.Args[2:], os.Stdout, os.Stderr))
+		case "debug":
+			os.Exit(runDebug(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+		case "lint":
+			os.Exit(runLint(os.Args[2:], os.Stdout, os.Stderr))
+		case "lsp":
+			os.Exit(runLSP(os.Stdin, os.Stdout, os.Stderr))
+		}
+	}
+
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
@@ -14,11 +14,21 @@ type Array struct {
 
 func (ao *Array) Type() ObjectType { return ARRAY_OBJ }
 func (ao *Array) Inspect() string {
+	return ao.inspect(map[Object]bool{})
+}
+
+func (ao *Array) inspect(seen map[Object]bool) string {
+	if seen[ao] {
+		return "[...]"
+	}
+	seen[ao] = true
+	defer delete(seen, ao)
+
 	var out bytes.Buffer
 
 	elements := []string{}
 	for _, e := range ao.Elements {
-		elements = append(elements, e.Inspect())
+		elements = append(elements, inspectIn(e, seen))
 	}
 
 	out.WriteString("[")
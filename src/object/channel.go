@@ -0,0 +1,63 @@
+package object
+
+/*
+ * チャンネル
+ * タスクの間で値を受け渡す。容量が0なら受け取る側が来るまで待つ
+ */
+type Channel struct {
+	ch     chan Object
+	closed bool
+}
+
+func NewChannel(size int) *Channel {
+	return &Channel{ch: make(chan Object, size)}
+}
+
+// 中のGoのチャンネル
+func (c *Channel) Chan() chan Object { return c.ch }
+
+// 閉じられているか
+func (c *Channel) IsClosed() bool { return c.closed }
+
+// 閉じる
+// すでに閉じていたらfalseを返す
+func (c *Channel) Close() bool {
+	if c.closed {
+		return false
+	}
+	c.closed = true
+	close(c.ch)
+	return true
+}
+
+func (c *Channel) Type() ObjectType { return CHANNEL_OBJ }
+func (c *Channel) Inspect() string  { return "channel" }
+
+/*
+ * タスク
+ * spawnで別のgoroutineで実行している関数呼び出し
+ */
+type Task struct {
+	Name   string
+	done   chan struct{}
+	result Object
+}
+
+func NewTask(name string) *Task {
+	return &Task{Name: name, done: make(chan struct{})}
+}
+
+// 実行が終わったことを知らせる
+func (t *Task) Finish(result Object) {
+	t.result = result
+	close(t.done)
+}
+
+// 終わると閉じられるチャンネル
+func (t *Task) Done() <-chan struct{} { return t.done }
+
+// 結果（Doneが閉じられてから呼ぶ）
+func (t *Task) Result() Object { return t.result }
+
+func (t *Task) Type() ObjectType { return TASK_OBJ }
+func (t *Task) Inspect() string  { return "task(" + t.Name + ")" }
@@ -2,34 +2,50 @@ package object
 
 import (
 	"bytes"
+	"monkey/ast"
 	"strings"
 )
 
+/*
+ * メンバの属性
+ * 宣言されたときの情報を覚えておく
+ */
+type Member struct {
+	Mutable  bool          // mut/shareならtrue
+	Public   bool          // pubで公開されたmut
+	Type     *ast.TypeNode // 宣言された型（なければnil）
+	Abstract bool          // 型だけ宣言されて値がない（派生先で実装する）
+}
+
 /*
  * クラス
  */
 type Class struct {
 	Hash
-	name     string
-	children map[string]struct{}
+	members     map[string]*Member // メンバの属性（宣言されていないものはmut扱い）
+	constructor *Function          // このインスタンスを作った関数
+	ancestors   []*Function        // 派生元のコンストラクタ（派生した順）
 }
 
 func NewClass() *Class {
 	return &Class{
-		Hash:     *NewHash(),
-		name:     "$unnamed",
-		children: make(map[string]struct{}),
+		Hash:    *NewHash(),
+		members: make(map[string]*Member),
 	}
 
 }
 
-func (c *Class) InstanceOf(name string) bool {
-	if c.name == name {
+// コンストラクタの識別子で判定する
+// 名前が同じでも別の関数なら別のクラス
+func (c *Class) InstanceOf(fn *Function) bool {
+	if c.constructor != nil && c.constructor.Id == fn.Id {
 		return true
 	}
-	// 子クラスを検索
-	if _, ok := c.children[name]; ok {
-		return true
+	// 派生元を検索
+	for _, a := range c.ancestors {
+		if a.Id == fn.Id {
+			return true
+		}
 	}
 	return false
 }
@@ -38,41 +54,128 @@ func (c *Class) Derive(from *Class) {
 	// パラメータを継承する
 	c.Hash.Merge(&from.Hash)
 
-	// 子クラス名をすべて引き継ぐ
-	for childName, _ := range from.children {
-		c.children[childName] = struct{}{}
+	// 派生元を順番に覚えておく
+	if from.constructor != nil {
+		c.addAncestor(from.constructor)
+	}
+	for _, fn := range from.ancestors {
+		c.addAncestor(fn)
+	}
+
+	// メンバの属性も引き継ぐ
+	for name, m := range from.members {
+		copied := *m
+		c.members[name] = &copied
 	}
-	c.children[from.name] = struct{}{}
 }
 
-func (c *Class) ClassName() string {
-	return c.name
+func (c *Class) addAncestor(fn *Function) {
+	for _, a := range c.ancestors {
+		if a.Id == fn.Id {
+			return
+		}
+	}
+	c.ancestors = append(c.ancestors, fn)
+}
+
+// メンバの属性を返す
+// 宣言されていないメンバ（引数や...で取り込んだハッシュ）はmut扱い
+func (c *Class) Member(name string) *Member {
+	if m, ok := c.members[name]; ok {
+		return m
+	}
+	return &Member{Mutable: true}
+}
+
+// メンバの属性を設定する
+func (c *Class) SetMember(name string, m *Member) {
+	c.members[name] = m
+}
+
+// メンバが書き換え可能か
+func (c *Class) IsMutable(name string) bool {
+	return c.Member(name).Mutable
+}
+
+// メンバが外から見えるか
+// immutableは書き換えられないので常に公開、mutableはpubのときだけ公開
+func (c *Class) IsPublic(name string) bool {
+	m := c.Member(name)
+	return !m.Mutable || m.Public
 }
 
-func (c *Class) SetClassName(className string) bool {
-	if c.name == "$unnamed" {
-		c.name = className
+// 実装されていない抽象メンバを宣言順に探す
+func (c *Class) AbstractMember() (string, bool) {
+	for _, name := range c.MemberNames() {
+		if c.Member(name).Abstract {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// メンバ名を宣言順に返す
+func (c *Class) MemberNames() []string {
+	names := []string{}
+	c.Hash.Range(func(k *Object, v *Object) bool {
+		if s, ok := (*k).(*String); ok {
+			names = append(names, s.Value)
+		}
 		return true
+	})
+	return names
+}
+
+// クラス名はコンストラクタの名前になる
+func (c *Class) ClassName() string {
+	if c.constructor == nil {
+		return "$unnamed"
 	}
-	return false
+	return c.constructor.DisplayName()
+}
+
+// コンストラクタを設定する
+// 既に設定されていたら（作られたインスタンスを返しただけなら）何もしない
+func (c *Class) SetConstructor(fn *Function) bool {
+	if c.constructor != nil {
+		return false
+	}
+	c.constructor = fn
+	return true
+}
+
+// このインスタンスを作った関数
+func (c *Class) Constructor() *Function {
+	return c.constructor
+}
+
+// 派生元のコンストラクタを派生した順に返す
+func (c *Class) Ancestors() []*Function {
+	return c.ancestors
 }
 
 func (c *Class) Type() ObjectType { return CLASS_OBJ }
 func (c *Class) Inspect() string {
+	return c.inspect(map[Object]bool{})
+}
+
+func (c *Class) inspect(seen map[Object]bool) string {
+	if seen[c] {
+		return c.ClassName() + "{...}"
+	}
+	seen[c] = true
+	defer delete(seen, c)
+
 	var out bytes.Buffer
 
-	out.WriteString(c.name)
-	out.WriteString(c.Hash.Inspect())
-	if c.children == nil {
-		out.WriteString("from ()")
-	} else {
-		out.WriteString("from (")
-		from := []string{}
-		for k, _ := range c.children {
-			from = append(from, k)
-		}
-		out.WriteString(strings.Join(from, ","))
-		out.WriteString(")")
+	out.WriteString(c.ClassName())
+	out.WriteString(c.Hash.inspect(seen))
+	out.WriteString("from (")
+	from := []string{}
+	for _, fn := range c.ancestors {
+		from = append(from, fn.DisplayName())
 	}
+	out.WriteString(strings.Join(from, ","))
+	out.WriteString(")")
 	return out.String()
 }
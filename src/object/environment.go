@@ -3,13 +3,42 @@ package object
 func NewEnclosedEnvironment(outer *Environment) *Environment {
 	env := NewEnvironment()
 	env.outer = outer
+	env.runtime = outer.runtime
+	return env
+}
+
+// 関数呼び出し用の環境
+//
+// 関数の静的環境（const/share）を外側に持つ環境を作る。
+// どの関数の呼び出しで作られたかを覚えておく。
+// frameは呼び出し元をたどるための記録。
+func NewCallEnvironment(fn *Function, frame *Frame) *Environment {
+	env := NewEnclosedEnvironment(fn.Statics())
+	env.function = fn
+	env.frame = frame
+	return env
+}
+
+// ブロック用の環境
+//
+// 宣言はこの中だけで有効になる。
+// thisにはならないので this は外側の環境を返す。
+func NewBlockEnvironment(outer *Environment) *Environment {
+	env := NewEnclosedEnvironment(outer)
+	env.block = true
 	return env
 }
 
 type Environment struct {
 	// class map[string]Object
-	class *Class
-	outer *Environment
+	class    *Class
+	outer    *Environment
+	function *Function           // この環境を作った関数（関数呼び出しの環境でなければnil）
+	frame    *Frame              // 関数呼び出しの記録（関数呼び出しの環境でなければnil）
+	block    bool                // ブロック用の環境ならtrue
+	yield    func(Object) Object // ジェネレータの呼び出しならyieldの処理
+	defers   []func() Object     // 関数の終わりに実行する処理（deferの順）
+	runtime  any                 // 評価器の実行の状態（作ったときに外側から引き継ぐ）
 }
 
 func NewEnvironment() *Environment {
@@ -24,6 +53,9 @@ func NewEnvironment() *Environment {
 // このスコープにnameが無かったら外側のスコープを探しに行く。
 func (e *Environment) Get(name string) Object {
 	if name == "this" {
+		if e.block && e.outer != nil {
+			return e.outer.Get(name)
+		}
 		return e.class
 	}
 	val, err := e.class.Hash.Get(&String{Value: name})
@@ -33,12 +65,154 @@ func (e *Environment) Get(name string) Object {
 	return val
 }
 
+// このスコープだけを探す
+func (e *Environment) GetLocal(name string) (Object, bool) {
+	val, err := e.class.Hash.Get(&String{Value: name})
+	if err != nil {
+		return nil, false
+	}
+	return val, true
+}
+
 func (e *Environment) Set(name string, val Object) Object {
+	return e.Declare(name, val, true)
+}
+
+// 変数を宣言する
+// mutableがfalseなら以後の代入はできない（imm/const）
+func (e *Environment) Declare(name string, val Object, mutable bool) Object {
+	return e.DeclareMember(name, val, &Member{Mutable: mutable})
+}
+
+// 属性つきで変数を宣言する
+func (e *Environment) DeclareMember(name string, val Object, m *Member) Object {
 	key := &String{Value: name}
 	e.class.Set(key, val)
+	e.class.SetMember(name, m)
 	return val
 }
 
+// 外側の環境（いちばん外ならnil）
+func (e *Environment) Outer() *Environment {
+	return e.outer
+}
+
+// このスコープの変数名を宣言の順に返す
+func (e *Environment) Names() []string {
+	return e.class.MemberNames()
+}
+
+// この環境がクラスの内側にあるか
+// クラスを作った環境かその内側で作られた関数からならtrue
+func (e *Environment) IsInside(c *Class) bool {
+	for env := e; env != nil; env = env.outer {
+		if env.class == c {
+			return true
+		}
+	}
+	return false
+}
+
+// 既存の変数に代入する
+//
+// 変数が宣言されたスコープまで遡って書き換える。
+// 見つからなければNotFound、イミュータブルならReadOnlyを返す。
+func (e *Environment) Assign(name string, val Object) *HashError {
+	err := e.AssignLocal(name, val)
+	if err != nil && err.Is(NotFound) && e.outer != nil {
+		return e.outer.Assign(name, val)
+	}
+	return err
+}
+
+// このスコープの変数だけに代入する
+func (e *Environment) AssignLocal(name string, val Object) *HashError {
+	if _, ok := e.GetLocal(name); !ok {
+		return NotFound.clone("identifier not found: %s", name)
+	}
+	if !e.class.IsMutable(name) {
+		return ReadOnly.clone("cannot assign to immutable: %s", name)
+	}
+	e.class.Set(&String{Value: name}, val)
+	return nil
+}
+
+// この環境を含む関数呼び出しの関数を返す
+// トップレベルならnil
+func (e *Environment) Function() *Function {
+	for env := e; env != nil; env = env.outer {
+		if env.function != nil {
+			return env.function
+		}
+	}
+	return nil
+}
+
+// この環境を含む関数呼び出しの記録を返す
+// トップレベルならnil
+func (e *Environment) Frame() *Frame {
+	for env := e; env != nil; env = env.outer {
+		if env.function != nil {
+			return env.frame
+		}
+	}
+	return nil
+}
+
+// この環境を含む関数呼び出しにdeferが登録されているか
+func (e *Environment) HasDefers() bool {
+	env := e
+	for env.function == nil && env.outer != nil {
+		env = env.outer
+	}
+	return len(env.defers) > 0
+}
+
+// ジェネレータの呼び出し環境にyieldの処理を設定する
+func (e *Environment) SetYield(yield func(Object) Object) {
+	e.yield = yield
+}
+
+// yieldの処理を返す
+// いちばん内側の関数呼び出しがジェネレータでなければnil
+func (e *Environment) Yield() func(Object) Object {
+	for env := e; env != nil; env = env.outer {
+		if env.function != nil {
+			return env.yield
+		}
+	}
+	return nil
+}
+
+// 関数の終わりに実行する処理を登録する
+// いちばん内側の関数呼び出し（なければトップレベル）の環境に積む
+func (e *Environment) Defer(fn func() Object) {
+	env := e
+	for env.function == nil && env.outer != nil {
+		env = env.outer
+	}
+	env.defers = append(env.defers, fn)
+}
+
+// この環境に登録された処理を取り出す
+// 取り出した処理はこの環境から消える
+func (e *Environment) TakeDefers() []func() Object {
+	defers := e.defers
+	e.defers = nil
+	return defers
+}
+
+// 評価器の実行の状態を返す（なければnil）
+func (e *Environment) Runtime() any {
+	return e.runtime
+}
+
+// 評価器の実行の状態を設定する
+// 関数呼び出しの環境は呼び出し元の実行で動くので、評価器が付け替える
+func (e *Environment) SetRuntime(runtime any) {
+	e.runtime = runtime
+}
+
 // ハッシュで環境を派生させる
 // ... ステートメントで実行される。
 func (e *Environment) DeriveFromHash(from *Hash) {
@@ -0,0 +1,15 @@
+package object
+
+/*
+ * 値としてのエラー
+ * error()やtry()が返す。Errorと違って評価を打ち切らない
+ * throw()でErrorに戻すと、ふつうのエラーとして伝わる
+ */
+type ErrorValue struct {
+	Err *Error
+}
+
+func (ev *ErrorValue) Type() ObjectType { return ERROR_VALUE_OBJ }
+func (ev *ErrorValue) Inspect() string {
+	return "error(" + ev.Err.KindName() + ": " + ev.Err.Message + ")"
+}
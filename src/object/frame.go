@@ -0,0 +1,29 @@
+package object
+
+/*
+ * 呼び出しの記録
+ * 関数呼び出しの環境が持ち、呼び出し元をたどってスタックを作れる
+ */
+type Frame struct {
+	Function *Function
+	Parent   *Frame // 呼び出し元（トップレベルからならnil）
+	Depth    int    // 呼び出しの深さ（トップレベルから呼んだら1）
+}
+
+// 呼び出し元の記録に続けて新しい記録を作る
+func NewFrame(fn *Function, parent *Frame) *Frame {
+	depth := 1
+	if parent != nil {
+		depth = parent.Depth + 1
+	}
+	return &Frame{Function: fn, Parent: parent, Depth: depth}
+}
+
+// 内側から順に関数の名前を返す
+func (f *Frame) Stack() []string {
+	stack := []string{}
+	for frame := f; frame != nil; frame = frame.Parent {
+		stack = append(stack, frame.Function.DisplayName())
+	}
+	return stack
+}
@@ -4,16 +4,52 @@ import (
 	"bytes"
 	"monkey/ast"
 	"strings"
+	"sync/atomic"
 )
 
+// 関数の識別子の払い出し元
+var functionId atomic.Uint64
+
 /*
  * 関数
+ * Nameは表示用の名前、Idはinstanceofで使う識別子
  */
 type Function struct {
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
 	Name       string
+	Id         uint64
+	Generator  bool         // 呼び出すと反復子を返す
+	statics    *Environment // const/shareの置き場所（全インスタンスで共有）
+}
+
+// 新しい関数を作る
+// 関数リテラルが評価されるたびに別のIdになる
+func NewFunction(params []*ast.Identifier, body *ast.BlockStatement, env *Environment) *Function {
+	return &Function{
+		Parameters: params,
+		Body:       body,
+		Env:        env,
+		Id:         functionId.Add(1),
+	}
+}
+
+// 表示用の名前
+func (f *Function) DisplayName() string {
+	if f.Name == "" {
+		return "$unnamed"
+	}
+	return f.Name
+}
+
+// 静的メンバの環境を返す
+// 関数の定義された環境を外側に持つ
+func (f *Function) Statics() *Environment {
+	if f.statics == nil {
+		f.statics = NewEnclosedEnvironment(f.Env)
+	}
+	return f.statics
 }
 
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
@@ -27,11 +63,7 @@ func (f *Function) Inspect() string {
 		params = append(params, p.String())
 	}
 
-	if f.Name == "" {
-		out.WriteString("$unnamed")
-	} else {
-		out.WriteString(f.Name)
-	}
+	out.WriteString(f.DisplayName())
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(") => \n")
@@ -43,7 +75,8 @@ func (f *Function) Inspect() string {
 /*
  * 組み込み
  */
-type BuiltinFunction func(args ...Object) Object
+// envは呼び出し元の環境
+type BuiltinFunction func(env *Environment, args ...Object) Object
 
 type Builtin struct {
 	Fn BuiltinFunction
@@ -18,8 +18,9 @@ type HashError struct {
 func (hr *HashError) clone(format string, args ...interface{}) *HashError {
 	return &HashError{error: hr.error, message: fmt.Sprintf(format, args...)}
 }
-func (hr *HashError) Is(he *HashError) bool {
-	return hr.error == he.error
+func (hr *HashError) Is(err error) bool {
+	he, ok := err.(*HashError)
+	return ok && hr.error == he.error
 }
 
 func (hr *HashError) Error() string {
@@ -29,6 +30,7 @@ func (hr *HashError) Error() string {
 var (
 	NotFound   *HashError = &HashError{error: "NotFound"}
 	InvalidKey *HashError = &HashError{error: "InvalidKey"}
+	ReadOnly   *HashError = &HashError{error: "ReadOnly"}
 )
 
 /*
@@ -70,13 +72,23 @@ type Hash struct {
 
 func (h *Hash) Type() ObjectType { return HASH_OBJ }
 func (h *Hash) Inspect() string {
+	return h.inspect(map[Object]bool{})
+}
+
+func (h *Hash) inspect(seen map[Object]bool) string {
+	if seen[h] {
+		return "{...}"
+	}
+	seen[h] = true
+	defer delete(seen, h)
+
 	var out bytes.Buffer
 
 	pairs := []string{}
 
 	h.pairs.Range(func(k HashKey, v *HashPair) bool {
 		pairs = append(pairs, fmt.Sprintf("%s: %s",
-			v.key.Inspect(), v.value.Inspect()))
+			v.key.Inspect(), inspectIn(v.value, seen)))
 		return true
 	})
 
@@ -0,0 +1,49 @@
+package object
+
+/*
+ * 反復子
+ * ジェネレータやtake/mapなどが返す。値は必要になったときに1つずつ作る
+ *
+ * NextFnは次の値と、値があったかどうかを返す。
+ * エラーは値として返す（値があった扱い）。
+ * CloseFnは途中でやめるときに呼ぶ（なければnil）。
+ */
+type Iterator struct {
+	Name    string
+	NextFn  func() (Object, bool)
+	CloseFn func()
+	done    bool
+}
+
+// 次の値を取り出す
+// 終わっていたら false を返す
+func (it *Iterator) Next() (Object, bool) {
+	if it.done {
+		return nil, false
+	}
+	val, ok := it.NextFn()
+	if !ok {
+		it.done = true
+	}
+	return val, ok
+}
+
+// 途中でやめる
+// 何度呼んでもよい
+func (it *Iterator) Close() {
+	if it.done {
+		return
+	}
+	it.done = true
+	if it.CloseFn != nil {
+		it.CloseFn()
+	}
+}
+
+func (it *Iterator) Type() ObjectType { return ITERATOR_OBJ }
+func (it *Iterator) Inspect() string {
+	if it.Name == "" {
+		return "iterator"
+	}
+	return "iterator(" + it.Name + ")"
+}
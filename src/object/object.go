@@ -1,5 +1,10 @@
 package object
 
+import (
+	"bytes"
+	"strings"
+)
+
 type ObjectType string
 
 /*
@@ -22,6 +27,11 @@ const (
 	CLASS_OBJ        ObjectType = "CLASS"
 	BREAK_OBJ        ObjectType = "BREAK"
 	CONTINUE_OBJ     ObjectType = "CONTINUE"
+	ITERATOR_OBJ     ObjectType = "ITERATOR"
+	TAIL_CALL_OBJ    ObjectType = "TAIL_CALL"
+	CHANNEL_OBJ      ObjectType = "CHANNEL"
+	TASK_OBJ         ObjectType = "TASK"
+	ERROR_VALUE_OBJ  ObjectType = "ERROR_VALUE"
 )
 
 var (
@@ -36,12 +46,86 @@ type Object interface {
 	Inspect() string
 }
 
+/*
+ * 中に値を持つもの（配列・ハッシュ・クラス）の表示
+ * seenは表示している途中の値で、自分を含む値は2回目を ... にする
+ */
+func inspectIn(obj Object, seen map[Object]bool) string {
+	switch o := obj.(type) {
+	case *Array:
+		return o.inspect(seen)
+	case *Hash:
+		return o.inspect(seen)
+	case *Class:
+		return o.inspect(seen)
+	}
+	return obj.Inspect()
+}
+
 /*
  * エラー
  */
 type Error struct {
-	Message string
+	Kind     string // エラーの種類（ふつうのエラーは空）
+	Message  string
+	Cause    *Error   // wrapで包んだ元のエラー
+	Class    *Class   // ユーザー定義のエラークラスのインスタンス
+	Stack    []string // 呼び出しのスタック（内側から）
+	Deferred []*Error // エラーで抜けるときにdeferで起きたエラー（実行した順）
+	Row      int      // エラーを返した組み込み関数の呼び出しの位置（分からなければ0）
+	Col      int
+}
+
+// エラーの種類
+const (
+	ERROR           = "Error"          // 種類のないエラー（すべてのエラーがこれにあたる）
+	NAME_ERROR      = "NameError"      // 識別子が見つからない
+	TYPE_ERROR      = "TypeError"      // 値の型が合わない
+	INDEX_ERROR     = "IndexError"     // インデックスが範囲外
+	ARGUMENT_ERROR  = "ArgumentError"  // 引数の数が合わない
+	ACCESS_ERROR    = "AccessError"    // 非公開のメンバやイミュータブルな変数
+	STACK_OVERFLOW  = "StackOverflow"  // 呼び出しが深すぎる
+	LIMIT_EXCEEDED  = "LimitExceeded"  // 実行の制限を越えた
+	CANCELED        = "Canceled"       // contextで止められた
+	ASSERTION_ERROR = "AssertionError" // assertが失敗した
+)
+
+// エラーの種類の名前（空ならError）
+func (e *Error) KindName() string {
+	if e.Kind == "" {
+		return ERROR
+	}
+	return e.Kind
+}
+
+// エラーか包まれた元のエラーがtargetに当てはまるか
+func (e *Error) Is(match func(*Error) bool) bool {
+	for err := e; err != nil; err = err.Cause {
+		if match(err) {
+			return true
+		}
+	}
+	return false
+}
+
+// メッセージにdeferで起きたエラーを添えたもの
+func (e *Error) Detail() string {
+	if len(e.Deferred) == 0 {
+		return e.Message
+	}
+	messages := make([]string, len(e.Deferred))
+	for i, d := range e.Deferred {
+		messages[i] = d.Message
+	}
+	return e.Message + " (deferred: " + strings.Join(messages, "; ") + ")"
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
-func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
+func (e *Error) Inspect() string {
+	var out bytes.Buffer
+	out.WriteString("ERROR: " + e.Detail())
+	for _, name := range e.Stack {
+		out.WriteString("\n\tat " + name)
+	}
+	return out.String()
+}
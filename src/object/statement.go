@@ -10,18 +10,37 @@ type ReturnValue struct {
 func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
 func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 
+/*
+ * 末尾呼び出し
+ * return f(...) のときReturnValueに入れて返し、呼び出し元で続けて呼び出す
+ */
+type TailCall struct {
+	Function Object
+	Args     []Object
+}
+
+func (tc *TailCall) Type() ObjectType { return TAIL_CALL_OBJ }
+func (tc *TailCall) Inspect() string  { return "tail call" }
+
 /*
  * break
+ * Labelがあればそのループまで抜ける。Valueはループの値になる
  */
-type Break struct{}
+type Break struct {
+	Label string
+	Value Object
+}
 
 func (rv *Break) Type() ObjectType { return BREAK_OBJ }
 func (rv *Break) Inspect() string  { return "break" }
 
 /*
  * continue
+ * Labelがあればそのループの次の繰り返しに進む
  */
-type Continue struct{}
+type Continue struct {
+	Label string
+}
 
 func (rv *Continue) Type() ObjectType { return CONTINUE_OBJ }
 func (rv *Continue) Inspect() string  { return "continue" }
@@ -1,11 +1,20 @@
 package object
 
+import "monkey/ast"
+
 /*
  * 型
+ * Nodeがあればtypeで宣言された型（構造的な型）
  */
 type Type struct {
 	Name string
+	Node *ast.TypeNode
 }
 
 func (t *Type) Type() ObjectType { return TYPE_OBJ }
-func (t *Type) Inspect() string  { return t.Name }
+func (t *Type) Inspect() string {
+	if t.Node != nil {
+		return t.Name + " = " + t.Node.String()
+	}
+	return t.Name
+}
@@ -1,7 +1,6 @@
 package parser
 
 import (
-	"fmt"
 	"monkey/ast"
 	"monkey/token"
 )
@@ -18,7 +17,8 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 	leftExp := prefix()
 
 	// ここは Prattマジックなのであとでしっかり見る
-	for !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() {
+	// エラーのあとは読み飛ばす範囲を広げないように続けない
+	for !p.recovering && !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() {
 		infix := p.infixParseFns[p.peekToken.Type]
 		if infix == nil {
 			return leftExp
@@ -91,6 +91,26 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	// ブロックが始まるか式があるはず
 	expression.Consequence = p.parseBlockStatement()
 
+	// elif か else if が続く限りネストせずに並べる
+	for p.peekTokenIs(token.ELIF) || (p.peekTokenIs(token.ELSE) && p.peek2TokenIs(token.IF)) {
+		p.nextToken() // curは token.ELIF か token.ELSE になる
+		elif := &ast.ElifClause{Token: *p.curToken}
+		if p.curTokenIs(token.ELSE) {
+			p.nextToken() // curは token.IF になる
+		}
+		if !p.expectPeek(token.LPAREN) {
+			return nil
+		}
+		p.nextToken()
+		elif.Condition = p.parseExpression(LOWEST)
+		if !p.expectPeek(token.RPAREN) {
+			return nil
+		}
+		p.nextToken()
+		elif.Consequence = p.parseBlockStatement()
+		expression.Elifs = append(expression.Elifs, elif)
+	}
+
 	// elseがなかったらここで終了
 	if !p.peekTokenIs(token.ELSE) {
 		return expression
@@ -160,9 +180,13 @@ func (p *Parser) parseDotExpression(left ast.Expression) ast.Expression {
 	t := *p.curToken // DOT
 	p.nextToken()    // 名前へ
 
+	// @がついていたらメタプロパティ
+	if p.curToken.Type == token.AT {
+		return p.parseMetaExpression(left)
+	}
+
 	if p.curToken.Type != token.IDENT {
-		msg := fmt.Sprintf("expected property name after '.', got %s", p.curToken.Type)
-		p.errors = append(p.errors, msg)
+		p.addError(*p.curToken, "expected property name after '.', got %s", p.curToken.Type)
 		return nil
 	}
 
@@ -176,3 +200,50 @@ func (p *Parser) parseDotExpression(left ast.Expression) ast.Expression {
 		Right: ident,
 	}
 }
+
+// メタプロパティ（x.@name）
+func (p *Parser) parseMetaExpression(left ast.Expression) ast.Expression {
+	t := *p.curToken // AT
+	p.nextToken()
+
+	// @typeのように予約語も名前として使える
+	if _, reserved := token.Reserved[p.curToken.Literal]; !reserved && !p.curTokenIs(token.IDENT) {
+		p.addError(*p.curToken, "expected meta property name after '@', got %s", p.curToken.Type)
+		return nil
+	}
+	return &ast.MetaExpression{
+		Token: t,
+		Left:  left,
+		Name:  p.curToken.Literal,
+	}
+}
+
+/*
+ * yield
+ * yield 値 （値は同じ行に書く。なければnull）
+ */
+func (p *Parser) parseYieldExpression() ast.Expression {
+	exp := &ast.YieldExpression{Token: *p.curToken}
+	p.yielded = true
+	if p.peekOnSameRow() && p.prefixParseFns[p.peekToken.Type] != nil {
+		p.nextToken()
+		exp.Value = p.parseExpression(LOWEST)
+	}
+	return exp
+}
+
+/*
+ * spawn
+ * spawn 関数呼び出し
+ */
+func (p *Parser) parseSpawnExpression() ast.Expression {
+	exp := &ast.SpawnExpression{Token: *p.curToken}
+	p.nextToken()
+	call, ok := p.parseExpression(PREFIX).(*ast.CallExpression)
+	if !ok {
+		p.addError(exp.Token, "spawn requires a function call")
+		return nil
+	}
+	exp.Call = call
+	return exp
+}
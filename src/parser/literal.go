@@ -1,7 +1,6 @@
 package parser
 
 import (
-	"fmt"
 	"monkey/ast"
 	"monkey/lib"
 	"monkey/token"
@@ -29,8 +28,7 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.addError(*p.curToken, "could not parse %q as integer", p.curToken.Literal)
 		return nil
 	}
 	lit.Value = value
@@ -43,8 +41,7 @@ func (p *Parser) parseFloatLiteral() ast.Expression {
 
 	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as float", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.addError(*p.curToken, "could not parse %q as float", p.curToken.Literal)
 		return nil
 	}
 	lit.Value = value
@@ -57,8 +54,7 @@ func (p *Parser) parseComplexLiteral() ast.Expression {
 
 	value, err := strconv.ParseComplex(p.curToken.Literal, 128)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as complex", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.addError(*p.curToken, "could not parse %q as complex", p.curToken.Literal)
 		return nil
 	}
 	lit.Value = value
@@ -67,9 +63,32 @@ func (p *Parser) parseComplexLiteral() ast.Expression {
 
 // 文字列
 func (p *Parser) parseStringLiteral() ast.Expression {
+	if p.peekTokenIs(token.INLINE_OPEN) {
+		return p.parseTemplateLiteral()
+	}
 	return &ast.StringLiteral{Token: *p.curToken, Value: p.curToken.Literal}
 }
 
+// 式を埋め込んだ文字列
+// 字句解析で 文字列 ${ 式 } 文字列 ... と分かれている
+func (p *Parser) parseTemplateLiteral() ast.Expression {
+	lit := &ast.TemplateLiteral{Token: *p.curToken, Strings: []string{p.curToken.Literal}}
+	for p.peekTokenIs(token.INLINE_OPEN) {
+		p.nextToken() // ${
+		p.nextToken() // 式の先頭へ
+		value := p.parseExpression(LOWEST)
+		if value == nil {
+			return nil
+		}
+		lit.Values = append(lit.Values, value)
+		if !p.expectPeek(token.INLINE_CLOSE) || !p.expectPeek(token.STRING) {
+			return nil
+		}
+		lit.Strings = append(lit.Strings, p.curToken.Literal)
+	}
+	return lit
+}
+
 // 配列
 func (p *Parser) parseArrayLiteral() ast.Expression {
 	array := &ast.ArrayLiteral{Token: *p.curToken}
@@ -87,13 +106,14 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 	}
 	//hash.Pairs = make(map[ast.Expression]ast.Expression)
 
+	p.hashComments(hash)
 	for !p.peekTokenIs(token.RBRACE) {
 		p.nextToken()
 
 		var key ast.Expression
 		if p.curToken.Type == token.IDENT {
 			key = &ast.StringLiteral{
-				Token: token.Token{Type: token.STRING, Literal: p.curToken.Literal},
+				Token: token.Token{Type: token.STRING, Literal: p.curToken.Literal, Row: p.curToken.Row, Col: p.curToken.Col},
 				Value: p.curToken.Literal,
 			}
 		} else {
@@ -112,9 +132,11 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		hash.Pairs.Set(key, value)
 		//hash.Pairs[key] = value
 
+		p.hashComments(hash)
 		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
 			return nil
 		}
+		p.hashComments(hash)
 	}
 
 	if !p.expectPeek(token.RBRACE) {
@@ -124,6 +146,14 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 	return hash
 }
 
+// メンバの間のコメントを読んでおく
+func (p *Parser) hashComments(hash *ast.HashLiteral) {
+	for p.peekTokenIs(token.LINE_COMMENT) || p.peekTokenIs(token.BLOCK_COMMENT) {
+		p.nextToken()
+		hash.Comments = append(hash.Comments, p.parseCommentStatement())
+	}
+}
+
 // 関数リテラル
 func (p *Parser) parseArrowFunctionLiteral() ast.Expression {
 
@@ -140,6 +170,7 @@ func (p *Parser) parseArrowFunctionLiteral() ast.Expression {
 	for !p.peekTokenIs(token.RPAREN) {
 		p.nextToken()
 		if p.curToken.Type != token.IDENT {
+			p.addError(*p.curToken, "expected parameter name, got %s", p.curToken.Type)
 			return nil
 		}
 
@@ -180,7 +211,14 @@ func (p *Parser) parseArrowFunctionLiteral() ast.Expression {
 	}
 
 	lit.Parameters = params
+
+	// 本体にyieldがあればジェネレータ（内側の関数のyieldは数えない）
+	// 外側のループは関数の中からbreakできない
+	outer, loops := p.yielded, p.loops
+	p.yielded, p.loops = false, 0
 	lit.Body = p.parseBlockStatement()
+	lit.Generator = p.yielded
+	p.yielded, p.loops = outer, loops
 
 	return lit
 }
@@ -5,6 +5,7 @@ import (
 	"monkey/ast"
 	"monkey/lexer"
 	"monkey/token"
+	"strings"
 )
 
 const (
@@ -34,6 +35,7 @@ var precedences = map[token.TokenType]int{
 	token.LBRACKET:   INDEX,
 	token.ACCESS:     DOT,
 	token.INSTANCEOF: INSTANCEOF,
+	token.IMPLEMENTS: INSTANCEOF,
 }
 
 type (
@@ -43,6 +45,7 @@ type (
 
 type Parser struct {
 	errors     []string
+	details    []ErrorDetail // errorsと同じ順の位置つきのエラー
 	tokens     []*token.Token
 	position   int
 	curToken   *token.Token
@@ -51,12 +54,18 @@ type Parser struct {
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
+
+	labels     []string // 解析中のループのラベル
+	loops      int      // 解析中の関数の中で囲んでいるループの数
+	yielded    bool     // 解析中の関数にyieldがあったか
+	recovering bool     // エラーのあと、次の文まで読み飛ばしていない
 }
 
 func NewParser(input string) *Parser {
 
 	p := &Parser{
 		errors:   []string{},
+		details:  []ErrorDetail{},
 		tokens:   lexer.GetTokens(input),
 		position: 0,
 	}
@@ -77,6 +86,11 @@ func NewParser(input string) *Parser {
 		token.FALSE:     p.parseBoolean,
 		token.LPAREN:    p.parseGroupedExpression, // 関数リテラルもここで
 		token.IF:        p.parseIfExpression,
+		token.MATCH:     p.parseMatchExpression,
+		token.LOOP:      p.parseLoopExpression,
+		token.YIELD:     p.parseYieldExpression,
+		token.SPAWN:     p.parseSpawnExpression,
+		token.AWAIT:     p.parsePrefixExpression,
 		token.LBRACKET:  p.parseArrayLiteral,
 		token.LBRACE:    p.parseHashLiteral,
 	}
@@ -94,6 +108,7 @@ func NewParser(input string) *Parser {
 		token.LBRACKET:   p.parseIndexExpression,
 		token.ACCESS:     p.parseDotExpression,
 		token.INSTANCEOF: p.parseInfixExpression,
+		token.IMPLEMENTS: p.parseInfixExpression,
 	}
 	// 最初のトークンを準備する
 	p.nextToken()
@@ -145,26 +160,99 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 	}
 }
 
+// 構文エラーを「行:列: メッセージ」で返す
 func (p *Parser) Errors() []string {
 	return p.errors
 }
 
+/*
+ * 位置つきの構文エラー（エディタで範囲を示すのに使う）
+ * 範囲はTokenの位置から EndRow:EndCol の手前まで
+ */
+type ErrorDetail struct {
+	Message    string
+	Token      token.Token // エラーを見つけたトークン
+	EndRow     int
+	EndCol     int
+	Suggestion string // 書き間違いと思われるときの正しい綴り（なければ空）
+}
+
+func (p *Parser) ErrorDetails() []ErrorDetail {
+	return p.details
+}
+
+// 行:列: メッセージ
+func (d ErrorDetail) String() string {
+	return fmt.Sprintf("%d:%d: %s", d.Token.Row, d.Token.Col, d.Message)
+}
+
+// ファイルの構文エラーをすべて「ファイル:行:列: メッセージ」の行にする
+func FormatErrors(file string, details []ErrorDetail) string {
+	lines := []string{}
+	for _, d := range details {
+		lines = append(lines, file+":"+d.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// エラーを見つけたトークンと一緒に記録する
+func (p *Parser) report(t token.Token, msg string) {
+	p.reportDetail(ErrorDetail{Message: msg, Token: t})
+}
+
+// 次の文まで読み飛ばすまでのエラーは最初のエラーの巻き添えなので記録しない
+func (p *Parser) reportDetail(d ErrorDetail) {
+	if p.recovering {
+		return
+	}
+	p.recovering = true
+	d.EndRow, d.EndCol = tokenEnd(d.Token)
+	p.errors = append(p.errors, d.String())
+	p.details = append(p.details, d)
+}
+
 func (p *Parser) addError(t token.Token, format string, a ...interface{}) {
-	a = append(a, t.Row)
-	a = append(a, t.Col)
-	msg := fmt.Sprintf(format+" on line %d colmun %d", a...)
-	p.errors = append(p.errors, msg)
+	p.report(t, fmt.Sprintf(format, a...))
+}
+
+// 直し方のヒントを後ろにつける（ヒントがなければaddErrorと同じ）
+func (p *Parser) addHintedError(t token.Token, hint string, format string, a ...interface{}) {
+	msg := fmt.Sprintf(format, a...)
+	if hint != "" {
+		msg += "; " + hint
+	}
+	p.report(t, msg)
+}
+
+// 書き間違いの候補をつける
+func (p *Parser) addSuggestedError(t token.Token, suggestion string, format string, a ...interface{}) {
+	msg := fmt.Sprintf(format, a...) + fmt.Sprintf("; did you mean %s?", suggestion)
+	p.reportDetail(ErrorDetail{Message: msg, Token: t, Suggestion: suggestion})
 }
 
 func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got %s instead",
-		t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	got := *p.peekToken
+	if got.Type == token.IDENT {
+		// 予約語を書き間違えたのかもしれない
+		if keyword := suggestKeyword(got.Literal, []token.TokenType{t}); keyword != "" {
+			p.addSuggestedError(got, keyword, "expected next token to be %s, got %s instead", t, got.Type)
+			return
+		}
+	}
+	p.addHintedError(got, peekHint(t, got), "expected next token to be %s, got %s instead", t, got.Type)
 }
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.addHintedError(*p.curToken, expressionHint(*p.curToken), "expected an expression, got %s", t)
+}
+
+// 二項演算子と後置の演算子の優先順位
+// 演算子でなければLOWEST（整形でかっこが要るか調べるのに使う）
+func Precedence(t token.TokenType) int {
+	if p, ok := precedences[t]; ok {
+		return p
+	}
+	return LOWEST
 }
 
 func (p *Parser) peekPrecedence() int {
@@ -186,3 +274,8 @@ func (p *Parser) DumpTokens() {
 		fmt.Printf("%q\n", t.String())
 	}
 }
+
+// 字句解析したトークン（JSONにするときなどに使う）
+func (p *Parser) Tokens() []*token.Token {
+	return p.tokens
+}
@@ -1,7 +1,10 @@
 package parser
 
 import (
+	"encoding/json"
 	"fmt"
+	"monkey/ast"
+	"strings"
 	"testing"
 )
 
@@ -76,3 +79,373 @@ func TestParser(t *testing.T) {
 	fmt.Print("--------------------------------------\n")
 	fmt.Printf("%s\n", a.String())
 }
+
+func TestElifAndSwitch(t *testing.T) {
+	p := NewParser(`if (a) 1 elif (b) 2 else if (c) 3 else 4`)
+	program, ok := p.ParseProgram()
+	if !ok {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	ifExp := stmt.Expression.(*ast.IfExpression)
+	if len(ifExp.Elifs) != 2 {
+		t.Fatalf("elif chain wrong. got=%d", len(ifExp.Elifs))
+	}
+	if ifExp.Alternative == nil {
+		t.Fatalf("else is missing")
+	}
+
+	p = NewParser(`switch (x) { case 1, 2: a; fallthrough; default: b; }`)
+	program, ok = p.ParseProgram()
+	if !ok {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	sw := program.Statements[0].(*ast.SwitchStatement)
+	if len(sw.Cases) != 2 || len(sw.Cases[0].Values) != 2 || !sw.Cases[0].Fallthrough || !sw.Cases[1].IsDefault() {
+		t.Fatalf("switch wrong. got=%s", sw.String())
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`switch (x) { case 1: fallthrough; a; }`, "1:22: fallthrough must be the last statement in a case"},
+		{`switch (x) { case 1: fallthrough; }`, "1:22: cannot fallthrough the last case"},
+		{`switch (x) { a }`, "1:14: expected case or default, got IDENT"},
+	}
+	for _, tt := range errors {
+		p := NewParser(tt.input)
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("error wrong. got=%v, want=%q", p.Errors(), tt.expected)
+		}
+	}
+}
+
+func TestLabeledLoop(t *testing.T) {
+	p := NewParser(`outer: loop(imm i = h){ loop(imm j = h){ break outer j; continue outer } }`)
+	program, ok := p.ParseProgram()
+	if !ok {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	loop := program.Statements[0].(*ast.LoopStatement)
+	if loop.Label == nil || loop.Label.Name != "outer" {
+		t.Fatalf("label wrong. got=%s", loop.String())
+	}
+	inner := loop.Block.Statements[0].(*ast.LoopStatement)
+	brk := inner.Block.Statements[0].(*ast.BreakStatement)
+	if brk.Label == nil || brk.Label.Name != "outer" || brk.Value == nil || brk.Value.(*ast.Identifier).Name != "j" {
+		t.Fatalf("break wrong. got=%s", brk.String())
+	}
+	cont := inner.Block.Statements[1].(*ast.ContinueStatement)
+	if cont.Label == nil || cont.Label.Name != "outer" {
+		t.Fatalf("continue wrong. got=%s", cont.String())
+	}
+
+	// ラベルでない識別子は値、改行の後ろは次の文
+	p = NewParser("loop(imm i = h){ break i\n break\n i }")
+	program, ok = p.ParseProgram()
+	if !ok {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	stmts := program.Statements[0].(*ast.LoopStatement).Block.Statements
+	if len(stmts) != 3 || stmts[0].(*ast.BreakStatement).Value == nil || stmts[1].(*ast.BreakStatement).Value != nil {
+		t.Fatalf("break value wrong. got=%v", stmts)
+	}
+}
+
+func TestBareBlock(t *testing.T) {
+	p := NewParser(`{ imm col = 1; color = col }; {a: 1}; {}`)
+	program, ok := p.ParseProgram()
+	if !ok {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	block, ok := program.Statements[0].(*ast.BlockStatement)
+	if !ok || len(block.Statements) != 2 {
+		t.Fatalf("block wrong. got=%s", program.Statements[0].String())
+	}
+	// key: value と {} はハッシュリテラル
+	for _, stmt := range program.Statements[1:] {
+		exp, ok := stmt.(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("not an expression. got=%T", stmt)
+		}
+		if _, ok := exp.Expression.(*ast.HashLiteral); !ok {
+			t.Fatalf("not a hash literal. got=%T", exp.Expression)
+		}
+	}
+}
+
+func TestGeneratorFunction(t *testing.T) {
+	p := NewParser(`imm g = (n:int)=>{ yield n; imm f = ()=>{ 1 }; yield }`)
+	program, ok := p.ParseProgram()
+	if !ok {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	lit := program.Statements[0].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	if !lit.Generator {
+		t.Fatalf("function with yield is not a generator")
+	}
+	inner := lit.Body.Statements[1].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	if inner.Generator {
+		t.Fatalf("function without yield is a generator")
+	}
+}
+
+func TestSpawnAndSelect(t *testing.T) {
+	p := NewParser(`imm t = spawn f(1); await t; select { case v = a.recv(): v; case b.send(1): 1; default: 2; }`)
+	program, ok := p.ParseProgram()
+	if !ok {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	if _, ok := program.Statements[0].(*ast.LetStatement).Value.(*ast.SpawnExpression); !ok {
+		t.Fatalf("spawn wrong. got=%s", program.Statements[0].String())
+	}
+	sel := program.Statements[2].(*ast.SelectStatement)
+	if len(sel.Cases) != 3 || sel.Cases[0].Binding.Name != "v" || sel.Cases[0].Send ||
+		!sel.Cases[1].Send || sel.Cases[1].Value == nil || !sel.Cases[2].IsDefault() {
+		t.Fatalf("select wrong. got=%s", sel.String())
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`spawn f`, "1:1: spawn requires a function call"},
+		{`select { case f(): 1 }`, "1:10: select case must be ch.recv() or ch.send(value)"},
+		{`select { case v = a.send(1): 1 }`, "1:10: select case must be ch.recv() or ch.send(value)"},
+	}
+	for _, tt := range errors {
+		p := NewParser(tt.input)
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("error wrong. got=%v, want=%q", p.Errors(), tt.expected)
+		}
+	}
+}
+
+// エラーには見つけたトークンの位置がつく
+func TestErrorDetails(t *testing.T) {
+	tests := []struct {
+		input string
+		row   int
+		col   int
+	}{
+		{"imm a = 1\nimm = 2", 2, 5},
+		{"imm f = (x:number)=>{\n  x + )\n}", 2, 7},
+		{`switch (x) { a }`, 1, 14},
+	}
+	for _, tt := range tests {
+		p := NewParser(tt.input)
+		p.ParseProgram()
+		details := p.ErrorDetails()
+		if len(details) == 0 || len(details) != len(p.Errors()) {
+			t.Fatalf("%q: details wrong. got=%v, errors=%v", tt.input, details, p.Errors())
+		}
+		if d := details[0]; d.String() != p.Errors()[0] || d.Token.Row != tt.row || d.Token.Col != tt.col {
+			t.Errorf("%q: detail wrong. got=%q at %d:%d, want %d:%d", tt.input, d.Message, d.Token.Row, d.Token.Col, tt.row, tt.col)
+		}
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	input := `
+	// 点
+	imm Point = (x:number, y:number):Point=>{
+		pub mut label:string = "p${x}"
+		imm h = {a: 1, "b": [1.5, 2i, true]}
+		return this
+	}
+	type Shape = { area: (n:number) => number, tags: string[] }
+	outer: loop(imm i=[1, 2]){
+		if (i == 1) { continue outer } elif (i == 2) { break outer 3 } else { ++i }
+	}
+	switch (1) { case 1, 2: defer f() fallthrough; default: 0 }
+	match (x) { 1..3 => { "low" }, [a, ...rest] | {k: _} => { a }, n:number if n > 5 => { spawn g(n) } }
+	select { case v = ch.recv(): v; case ch.send(1): 0; default: 1 }
+	x.@name
+	`
+	p := NewParser(input)
+	program, ok := p.ParseProgram()
+	if !ok {
+		t.Fatalf("parse errors: %v", p.Errors())
+	}
+	data, err := ast.ToJSON(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := ast.ProgramFromJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.String() != program.String() {
+		t.Errorf("decoded tree differs:\n%s\nwant\n%s", decoded.String(), program.String())
+	}
+	again, err := ast.ToJSON(decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(again) != string(data) {
+		t.Errorf("JSON differs after round trip:\n%s\nwant\n%s", again, data)
+	}
+
+	tokens, err := json.Marshal(p.Tokens()[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"type":"//","literal":" 点","row":2,"col":2}]`
+	if string(tokens) != want {
+		t.Errorf("tokens: got %s, want %s", tokens, want)
+	}
+
+	for _, bad := range []string{
+		`{"node": "Nope"}`,
+		`{"node": "Program", "statements": [{"node": "Identifier"}]}`,
+		`{"node": "Program", "statements": 1}`,
+		`{"node": "IntegerLiteral", "value": "1"}`,
+		`[`,
+	} {
+		if _, err := ast.FromJSON([]byte(bad)); err == nil {
+			t.Errorf("%s: expected error", bad)
+		}
+	}
+	if _, err := ast.ProgramFromJSON([]byte(`{"node": "Identifier", "name": "x"}`)); err == nil {
+		t.Error("expected error for a non-program tree")
+	}
+}
+
+// 1つの間違いには1つのエラーで、後ろの文はそのまま読める
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input  string
+		errors int
+		names  []string // 読めたimmの名前
+	}{
+		{"imm a = 1\nimm = 2\nimm b = 3", 1, []string{"a", "b"}},
+		{"imm f = (x:number)=>{\n  x + )\n  imm y = 1\n}\nimm z = 1", 1, []string{"f", "z"}},
+		{"imm x = foo(1, 2\nimm y = 3", 1, []string{"x", "y"}},
+		{"if (x y) {\n  imm a = 1\n}\nimm z = 1", 1, []string{"z"}},
+		{"imm x = \nimm y = 2", 1, []string{"x", "y"}},
+		{"imm a = [1, 2\nimm b = 3\nimm c = )\n", 2, []string{"a", "b", "c"}},
+		{"switch (x) { case 1: foo(; case 2: 3 }\nimm y = 1", 1, []string{"y"}},
+		{"imm f = ()=>{\n  imm x = 1\n", 1, []string{"f"}},
+		{"imm e = (x:number) => { x.\n}\nimm y = 2", 1, []string{"e", "y"}},
+		{"imm f = ()=>{ if (x) { 1 + } }\nimm y = 2", 1, []string{"f", "y"}},
+		{"imm x = 1 + }\nimm y = 2", 1, []string{"x", "y"}},
+	}
+	for _, tt := range tests {
+		p := NewParser(tt.input)
+		program, ok := p.ParseProgram()
+		if ok || len(p.Errors()) != tt.errors || len(p.ErrorDetails()) != tt.errors {
+			t.Errorf("%q: expected %d errors, got %v", tt.input, tt.errors, p.Errors())
+			continue
+		}
+		names := []string{}
+		for _, stmt := range program.Statements {
+			if let, ok := stmt.(*ast.LetStatement); ok {
+				names = append(names, let.Ident.Name)
+			}
+		}
+		if fmt.Sprint(names) != fmt.Sprint(tt.names) {
+			t.Errorf("%q: expected bindings %v, got %v", tt.input, tt.names, names)
+		}
+	}
+}
+
+// エラーには位置と範囲がつく
+func TestErrorSpans(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		span     [4]int
+	}{
+		{"imm x = foo(1 2)", "expected next token to be ), got INTEGER instead; a , or ) may be missing", [4]int{1, 15, 1, 16}},
+		{"imm f = (x:number)=>{\n  x + )\n}", "expected an expression, got ); a value is missing before )", [4]int{2, 7, 2, 8}},
+		{"imm x = 1 +\n", "expected an expression, got EOF; the input ended in the middle of an expression", [4]int{2, 1, 2, 1}},
+		{"if (a = 1) { 2 }", "expected next token to be ), got = instead; = assigns to a name; use == to compare", [4]int{1, 7, 1, 8}},
+		{"imm f = ()=>{\n  1\n", "expected } to close this block, got EOF", [4]int{1, 13, 1, 14}},
+	}
+	for _, tt := range tests {
+		p := NewParser(tt.input)
+		p.ParseProgram()
+		details := p.ErrorDetails()
+		if len(details) != 1 {
+			t.Errorf("%q: expected 1 error, got %v", tt.input, p.Errors())
+			continue
+		}
+		d := details[0]
+		if d.Message != tt.expected {
+			t.Errorf("%q: message wrong. got=%q, want=%q", tt.input, d.Message, tt.expected)
+		}
+		if span := [4]int{d.Token.Row, d.Token.Col, d.EndRow, d.EndCol}; span != tt.span {
+			t.Errorf("%q: span wrong. got=%v, want=%v", tt.input, span, tt.span)
+		}
+	}
+}
+
+// 予約語やラベルの書き間違いには候補がつく
+func TestSuggestions(t *testing.T) {
+	tests := []struct {
+		input      string
+		suggestion string
+		row        int
+		col        int
+	}{
+		{"imn x = 1", "imm", 1, 1},
+		{"retrun 1", "return", 1, 1},
+		{"swich (x) { case 1: 2 }", "switch", 1, 1},
+		{"if (x) { 1 } els { 2 }", "else", 1, 14},
+		{"pub mutt x = 1", "mut", 1, 5},
+		{"switch (x) { cas 1: 2 }", "case", 1, 14},
+		{"outer: loop(imm i=[1]){ continue outr }", "outer", 1, 34},
+		{"outer: loop(imm i=[1]){ break outr 1 }", "outer", 1, 31},
+		{"loop(imm i=[1]){\n  brek\n}", "break", 2, 3},
+		{"loop(imm i=[1]){ if (i) { contniue } }", "continue", 1, 27},
+	}
+	for _, tt := range tests {
+		p := NewParser(tt.input)
+		p.ParseProgram()
+		details := p.ErrorDetails()
+		if len(details) != 1 {
+			t.Errorf("%q: expected 1 error, got %v", tt.input, p.Errors())
+			continue
+		}
+		d := details[0]
+		if d.Suggestion != tt.suggestion || d.Token.Row != tt.row || d.Token.Col != tt.col {
+			t.Errorf("%q: got %q at %d:%d, want %q at %d:%d", tt.input, d.Suggestion, d.Token.Row, d.Token.Col, tt.suggestion, tt.row, tt.col)
+		}
+		if !strings.HasSuffix(d.Message, "; did you mean "+tt.suggestion+"?") {
+			t.Errorf("%q: message wrong. got=%q", tt.input, d.Message)
+		}
+	}
+
+	// 書き間違いに見えない名前はこれまで通り
+	for _, input := range []string{"a b", "imx = 1", "puts(x) {}", "count: loop(imm i=[1]){ break x }", "f(x)\n{ 1 }", "brek", "loop(imm i=[1]){ imm f = ()=>{ brek } }", "loop(imm i=[1]){ brek + 1 }"} {
+		p := NewParser(input)
+		p.ParseProgram()
+		for _, d := range p.ErrorDetails() {
+			if d.Suggestion != "" {
+				t.Errorf("%q: unexpected suggestion %q", input, d.Suggestion)
+			}
+		}
+	}
+}
+
+// エラーがあっても読めたところまでの木を返す
+func TestPartialAST(t *testing.T) {
+	p := NewParser("imm x = 1 +\nswitch (x) { case 1: 2 default 3 }\n")
+	program, ok := p.ParseProgram()
+	if ok || len(program.Statements) != 2 {
+		t.Fatalf("expected 2 partial statements, got %q (errors %v)", program.String(), p.Errors())
+	}
+	let := program.Statements[0].(*ast.LetStatement)
+	if infix, ok := let.Value.(*ast.InfixExpression); !ok || infix.Right != nil {
+		t.Errorf("let value wrong. got=%s", let.String())
+	}
+	if sw := program.Statements[1].(*ast.SwitchStatement); len(sw.Cases) != 1 {
+		t.Errorf("switch wrong. got=%s", sw.String())
+	}
+	if got, want := let.String(), "imm x:<?> = ( 1  + <?>);\n"; got != want {
+		t.Errorf("partial tree string wrong. got=%q, want=%q", got, want)
+	}
+}
@@ -0,0 +1,223 @@
+package parser
+
+import (
+	"monkey/ast"
+	"monkey/token"
+)
+
+// match式
+// match (値) { パターン if 条件 => 式, ... }
+func (p *Parser) parseMatchExpression() ast.Expression {
+	exp := &ast.MatchExpression{Token: *p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+	exp.Subject = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	for !p.peekTokenIs(token.RBRACE) && !p.peekTokenIs(token.EOF) {
+		p.nextToken() // パターンの先頭へ
+		arm := p.parseMatchArm()
+		if arm == nil {
+			return nil
+		}
+		exp.Arms = append(exp.Arms, arm)
+
+		// 腕の区切りはカンマ（なくてもいい）
+		if p.peekTokenIs(token.COMMA) {
+			p.nextToken()
+		}
+	}
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	return exp
+}
+
+// matchの腕
+// 終わったときcurは腕の最後のトークン
+func (p *Parser) parseMatchArm() *ast.MatchArm {
+	arm := &ast.MatchArm{Token: *p.curToken}
+
+	arm.Pattern = p.parsePattern()
+	if arm.Pattern == nil {
+		return nil
+	}
+
+	// ガード
+	if p.peekTokenIs(token.IF) {
+		p.nextToken()
+		p.nextToken()
+		arm.Guard = p.parseExpression(LOWEST)
+	}
+
+	if !p.expectPeek(token.ARROW) {
+		return nil
+	}
+	p.nextToken()
+
+	// { なら複数の文、そうでなければ式がひとつ
+	arm.Body = p.parseBlockStatement()
+	return arm
+}
+
+// パターン
+// | でつなぐとどれかに一致すればよい
+func (p *Parser) parsePattern() ast.Pattern {
+	first := p.parsePatternPrimary()
+	if first == nil || !p.peekTokenIs(token.BIT_OR) {
+		return first
+	}
+
+	or := &ast.OrPattern{Token: *p.peekToken, Alternatives: []ast.Pattern{first}}
+	for p.peekTokenIs(token.BIT_OR) {
+		p.nextToken()
+		p.nextToken()
+		alt := p.parsePatternPrimary()
+		if alt == nil {
+			return nil
+		}
+		or.Alternatives = append(or.Alternatives, alt)
+	}
+	return or
+}
+
+func (p *Parser) parsePatternPrimary() ast.Pattern {
+	switch p.curToken.Type {
+	case token.IDENT:
+		return p.parseBindingPattern()
+	case token.TYPE:
+		return &ast.TypePattern{Token: *p.curToken, Type: p.parseTypeAnnotation()}
+	case token.INTEGER, token.FLOAT, token.IMAGINARY, token.STRING, token.TRUE, token.FALSE, token.MINUS:
+		return p.parseLiteralPattern()
+	case token.LBRACKET:
+		return p.parseArrayPattern()
+	case token.LBRACE:
+		return p.parseHashPattern()
+	case token.LPAREN:
+		p.nextToken()
+		pattern := p.parsePattern()
+		if !p.expectPeek(token.RPAREN) {
+			return nil
+		}
+		return pattern
+	}
+	p.addError(*p.curToken, "unexpected %s in pattern", p.curToken.Type)
+	return nil
+}
+
+// 名前への束縛（_ なら束縛しない）
+// 名前:型 なら型が一致したときだけ束縛する
+func (p *Parser) parseBindingPattern() ast.Pattern {
+	t := *p.curToken
+	ident := &ast.Identifier{Token: t, Name: t.Literal}
+
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken() // curがCOLONに
+		p.nextToken() // 型に入る
+		typ := p.parseTypeAnnotation()
+		if typ == nil {
+			return nil
+		}
+		return &ast.BindingPattern{Token: t, Name: ident, Type: typ}
+	}
+	if t.Literal == "_" {
+		return &ast.WildcardPattern{Token: t}
+	}
+	return &ast.BindingPattern{Token: t, Name: ident}
+}
+
+// 値か範囲
+func (p *Parser) parseLiteralPattern() ast.Pattern {
+	t := *p.curToken
+	low := p.parseExpression(PREFIX)
+	if low == nil {
+		return nil
+	}
+	if !p.peekTokenIs(token.RANGE) {
+		return &ast.LiteralPattern{Token: t, Value: low}
+	}
+	p.nextToken() // curは..
+	p.nextToken() // 上限へ
+	high := p.parseExpression(PREFIX)
+	if high == nil {
+		return nil
+	}
+	return &ast.RangePattern{Token: t, Low: low, High: high}
+}
+
+// [a, b, ...rest]
+func (p *Parser) parseArrayPattern() ast.Pattern {
+	pattern := &ast.ArrayPattern{Token: *p.curToken}
+
+	for !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+
+		// 残りの要素（最後にだけ書ける）
+		if p.curTokenIs(token.PARSE) {
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			pattern.Rest = &ast.Identifier{Token: *p.curToken, Name: p.curToken.Literal}
+			break
+		}
+
+		el := p.parsePattern()
+		if el == nil {
+			return nil
+		}
+		pattern.Elements = append(pattern.Elements, el)
+
+		if !p.peekTokenIs(token.RBRACKET) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+	return pattern
+}
+
+// {name: n, age}
+// 値のパターンを省略するとキーと同じ名前に束縛する
+func (p *Parser) parseHashPattern() ast.Pattern {
+	pattern := &ast.HashPattern{Token: *p.curToken}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		if !p.curTokenIs(token.IDENT) && !p.curTokenIs(token.STRING) {
+			p.addError(*p.curToken, "expected key in hash pattern, got %s", p.curToken.Type)
+			return nil
+		}
+		key := *p.curToken
+
+		var value ast.Pattern
+		if p.peekTokenIs(token.COLON) {
+			p.nextToken()
+			p.nextToken()
+			value = p.parsePattern()
+			if value == nil {
+				return nil
+			}
+		} else {
+			value = &ast.BindingPattern{Token: key, Name: &ast.Identifier{Token: key, Name: key.Literal}}
+		}
+		pattern.Keys = append(pattern.Keys, key.Literal)
+		pattern.Values = append(pattern.Values, value)
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	return pattern
+}
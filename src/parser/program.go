@@ -5,20 +5,22 @@ import (
 	"fmt"
 	"monkey/ast"
 	"monkey/token"
-	"reflect"
 )
 
 // プログラムのパースを開始する
 // プログラムは、Statementの羅列である
+// エラーがあっても読めた文は木に入れて返す（エディタなどで使う）
 func (p *Parser) ParseProgram() (*ast.Program, bool) {
 	program := &ast.Program{}
 	program.Statements = []ast.Statement{}
 
 	for !p.curTokenIs(token.EOF) {
+		start := p.position - 1
 		stmt := p.parseStatement()
-		if !reflect.ValueOf(stmt).IsNil() {
+		if !isNilStatement(stmt) {
 			program.Statements = append(program.Statements, stmt)
 		}
+		p.recover(start)
 		// ブロックステートメントがRPARENで終了するのは、
 		// ここで必ず読み飛しが１つ入るから？
 		p.nextToken()
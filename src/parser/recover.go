@@ -0,0 +1,236 @@
+package parser
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/token"
+	"reflect"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+)
+
+/*
+ * 構文エラーからの回復
+ * エラーを見つけたら文の終わりまで読み飛ばして次の文から解析を続ける
+ * 読み飛ばしている間のエラーは記録しないので、1つの間違いには1つのエラーになる
+ */
+
+// 文の始めにしか書けないキーワード
+var statementStarts = map[token.TokenType]bool{
+	token.IMM:      true,
+	token.MUT:      true,
+	token.CONST:    true,
+	token.SHARE:    true,
+	token.PUB:      true,
+	token.TYPEDEF:  true,
+	token.SWITCH:   true,
+	token.RETURN:   true,
+	token.LOOP:     true,
+	token.BREAK:    true,
+	token.CONTINUE: true,
+	token.DEFER:    true,
+	token.SELECT:   true,
+}
+
+// 文の始めに書き間違えそうなキーワード
+var statementKeywords = []token.TokenType{
+	token.IMM, token.MUT, token.CONST, token.SHARE, token.PUB, token.TYPEDEF,
+	token.IF, token.ELIF, token.ELSE, token.SWITCH, token.MATCH, token.SELECT,
+	token.LOOP, token.RETURN, token.BREAK, token.CONTINUE, token.DEFER,
+	token.YIELD, token.SPAWN, token.AWAIT,
+}
+
+// 構文エラーで欠けた文は型つきのnilになっている
+func isNilStatement(stmt ast.Statement) bool {
+	return stmt == nil || reflect.ValueOf(stmt).IsNil()
+}
+
+// 文の解析でエラーがあれば次の文の手前まで読み飛ばす
+func (p *Parser) recover(start int) {
+	if p.recovering {
+		p.synchronize(start)
+	}
+}
+
+/*
+ * 次の文の手前まで読み飛ばす
+ * startは文の始めのトークンの位置で、そこからのかっこの開き閉じを数える
+ * かっこが閉じているところで
+ *   ; の後ろ、外側のブロックの } やcase/defaultの手前、次の行の手前
+ * のどれかで止まる（curは飛ばす文の最後のトークンになる）
+ * ( や [ が閉じていなくても、次の行が文のキーワードで始まるか
+ * ブロックの } やcase/defaultが来ればそこで止まる
+ * エラーのトークンがブロックの } ならそれは読み飛ばさない
+ */
+func (p *Parser) synchronize(start int) {
+	p.recovering = false
+
+	open := []token.TokenType{}
+	track := func(t *token.Token) {
+		switch t.Type {
+		case token.LPAREN, token.LBRACKET, token.LBRACE:
+			open = append(open, t.Type)
+		case token.RPAREN, token.RBRACKET, token.RBRACE:
+			if len(open) > 0 {
+				open = open[:len(open)-1]
+			}
+		}
+	}
+	inParens := func() bool {
+		return len(open) == 0 || open[len(open)-1] != token.LBRACE
+	}
+	cur := p.position - 1
+	for i := start; i < cur; i++ {
+		track(p.getToken(i))
+	}
+
+	// エラーのトークンが次の文の始めなら、その手前に戻る
+	if cur > start && statementStarts[p.curToken.Type] && inParens() &&
+		p.curToken.Row > p.getToken(cur-1).Row {
+		p.position = cur - 1
+		p.nextToken()
+		return
+	}
+	// エラーのトークンが外側のブロックを閉じる } なら、その手前に戻る
+	if cur > start && p.curTokenIs(token.RBRACE) && len(open) == 0 && p.insideBlock(cur) {
+		p.position = cur - 1
+		p.nextToken()
+		return
+	}
+	track(p.curToken)
+
+	for !p.peekTokenIs(token.EOF) {
+		newRow := p.peekToken.Row > p.curToken.Row
+		if len(open) == 0 {
+			if p.curTokenIs(token.SEMICOLON) || newRow ||
+				p.peekTokenIs(token.RBRACE) || p.peekTokenIs(token.CASE) || p.peekTokenIs(token.DEFAULT) {
+				return
+			}
+		} else if inParens() && (newRow && statementStarts[p.peekToken.Type] ||
+			p.peekTokenIs(token.RBRACE) || p.peekTokenIs(token.CASE) || p.peekTokenIs(token.DEFAULT)) {
+			return
+		}
+		p.nextToken()
+		track(p.curToken)
+	}
+}
+
+// i番目のトークンがブロックの中にあるか（手前の { と } を数える）
+func (p *Parser) insideBlock(i int) bool {
+	depth := 0
+	for j := 0; j < i; j++ {
+		switch p.getToken(j).Type {
+		case token.LBRACE:
+			depth++
+		case token.RBRACE:
+			depth--
+		}
+	}
+	return depth > 0
+}
+
+// 範囲の終わり（行をまたぐトークンと終端は幅0にする）
+func tokenEnd(t token.Token) (int, int) {
+	if t.Type == token.EOF || strings.Contains(t.Literal, "\n") {
+		return t.Row, t.Col
+	}
+	return t.Row, t.Col + runewidth.StringWidth(t.Literal)
+}
+
+/*
+ * 書き間違いの候補
+ * 綴りの距離（入れ替えも1つと数える）が近いものを返す
+ * 3文字未満の名前や、近いものがなければ空
+ */
+func Suggest(name string, candidates []string) string {
+	if len(name) < 3 {
+		return ""
+	}
+	limit := 1
+	if len(name) >= 6 {
+		limit = 2
+	}
+	best, bestDistance := "", limit+1
+	for _, c := range candidates {
+		if c == name {
+			continue
+		}
+		if d := distance(name, c); d < bestDistance {
+			best, bestDistance = c, d
+		}
+	}
+	return best
+}
+
+// 予約語から選ぶ
+func suggestKeyword(name string, types []token.TokenType) string {
+	candidates := []string{}
+	for _, t := range types {
+		for literal, typ := range token.Reserved {
+			if typ == t {
+				candidates = append(candidates, literal)
+			}
+		}
+	}
+	return Suggest(name, candidates)
+}
+
+// 編集距離（隣どうしの入れ替えも1回とする）
+func distance(a string, b string) int {
+	s, t := []rune(a), []rune(b)
+	d := make([][]int, len(s)+1)
+	for i := range d {
+		d[i] = make([]int, len(t)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				d[i][j] = min(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(s)][len(t)]
+}
+
+// 式が来るはずのところに式でないトークンがあったときのヒント
+func expressionHint(t token.Token) string {
+	switch t.Type {
+	case token.EOF:
+		return "the input ended in the middle of an expression"
+	case token.RPAREN, token.RBRACKET, token.RBRACE, token.COMMA, token.SEMICOLON, token.COLON:
+		return fmt.Sprintf("a value is missing before %s", t.Literal)
+	case token.ASTERISK, token.SLASH, token.PLUS, token.EQ, token.NE, token.LT, token.GT, token.ACCESS:
+		return fmt.Sprintf("%s needs a value on its left", t.Literal)
+	case token.ASSIGN:
+		return "= assigns to a name; use == to compare"
+	case token.ELSE, token.ELIF:
+		return fmt.Sprintf("%s must follow the block of an if", t.Literal)
+	}
+	if statementStarts[t.Type] {
+		return fmt.Sprintf("%s starts a statement and cannot be used as a value", t.Literal)
+	}
+	return ""
+}
+
+// 次のトークンが想定と違ったときのヒント
+func peekHint(expected token.TokenType, got token.Token) string {
+	switch {
+	case got.Type == token.EOF:
+		return fmt.Sprintf("the input ended before %s", expected)
+	case expected == token.RPAREN && got.Type == token.ASSIGN:
+		return "= assigns to a name; use == to compare"
+	case (expected == token.RPAREN || expected == token.RBRACKET) && got.Type != token.COMMA:
+		return fmt.Sprintf("a , or %s may be missing", expected)
+	}
+	return ""
+}
@@ -14,6 +14,14 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseLetStatement()
 	case token.MUT:
 		return p.parseLetStatement()
+	case token.CONST, token.SHARE:
+		return p.parseLetStatement()
+	case token.PUB:
+		return p.parsePublicLetStatement()
+	case token.TYPEDEF:
+		return p.parseTypeStatement()
+	case token.SWITCH:
+		return p.parseSwitchStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
 	case token.BLOCK_COMMENT, token.LINE_COMMENT:
@@ -26,6 +34,38 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseBreakStatement()
 	case token.CONTINUE:
 		return p.parseContinueStatement()
+	case token.DEFER:
+		return p.parseDeferStatement()
+	case token.SELECT:
+		return p.parseSelectStatement()
+	case token.LBRACE:
+		if p.isBareBlock() {
+			block := p.parseBlockStatement()
+			if p.peekTokenIs(token.SEMICOLON) {
+				p.nextToken()
+			}
+			return block
+		}
+		return p.parseExpressionStatement()
+	case token.IDENT:
+		if p.peekTokenIs(token.COLON) && p.peek2TokenIs(token.LOOP) {
+			return p.parseLabeledLoopStatement()
+		}
+		// ループの中で名前だけの文はbreak/continueの書き間違い
+		if p.loops > 0 && p.standsAlone() {
+			if keyword := suggestKeyword(p.curToken.Literal, []token.TokenType{token.BREAK, token.CONTINUE}); keyword != "" {
+				p.addSuggestedError(*p.curToken, keyword, "unknown statement %s", p.curToken.Literal)
+				return nil
+			}
+		}
+		// 名前のすぐ後ろに演算子でなく式の始めが続くのはキーワードの書き間違い
+		if p.peekOnSameRow() && p.prefixParseFns[p.peekToken.Type] != nil && p.infixParseFns[p.peekToken.Type] == nil {
+			if keyword := suggestKeyword(p.curToken.Literal, statementKeywords); keyword != "" {
+				p.addSuggestedError(*p.curToken, keyword, "unknown statement %s", p.curToken.Literal)
+				return nil
+			}
+		}
+		return p.parseExpressionStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -41,6 +81,7 @@ func (p *Parser) parseCommentStatement() *ast.CommentStatement {
 
 // Letステートメント
 // LetStatementにはimmとmutの二種類がある
+// 静的メンバのconstとshareも同じ形なのでここで処理する
 func (p *Parser) parseLetStatement() *ast.LetStatement {
 	stmt := &ast.LetStatement{Token: *p.curToken}
 
@@ -66,15 +107,22 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	}
 
 	// 終了しない場合、次はASSIGN(=)でなければエラー
+	// 名前までは読めたので値のない文を返す
 	if !p.expectPeek(token.ASSIGN) {
-		return nil
+		return stmt
 	}
 
 	// トークンを'='から進めて式の先頭に
 	p.nextToken()
 
-	// 式を得る
-	stmt.Value = p.parseExpression(LOWEST)
+	// 式を得る（ラベル付きのループも値にできる）
+	if p.curTokenIs(token.IDENT) && p.peekTokenIs(token.COLON) && p.peek2TokenIs(token.LOOP) {
+		if loop := p.parseLabeledLoopStatement(); loop != nil {
+			stmt.Value = loop
+		}
+	} else {
+		stmt.Value = p.parseExpression(LOWEST)
+	}
 
 	// セミコロンがあれば読み飛ばす（なくてもいい）
 	if p.peekTokenIs(token.SEMICOLON) {
@@ -84,6 +132,49 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	return stmt
 }
 
+// pub付きのLetステートメント
+// mutのメンバを外から読み書きできるようにする
+func (p *Parser) parsePublicLetStatement() *ast.LetStatement {
+	if !p.peekTokenIs(token.MUT) && !p.peekTokenIs(token.IMM) {
+		p.peekError(token.MUT)
+		return nil
+	}
+	p.nextToken() // curはmut/immになる
+	stmt := p.parseLetStatement()
+	if stmt == nil {
+		return nil
+	}
+	stmt.Public = true
+	return stmt
+}
+
+// 型の宣言
+// type 名前 = 型
+func (p *Parser) parseTypeStatement() *ast.TypeStatement {
+	stmt := &ast.TypeStatement{Token: *p.curToken}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Ident = &ast.Identifier{Token: *p.curToken, Name: p.curToken.Literal}
+
+	if !p.expectPeek(token.ASSIGN) {
+		return nil
+	}
+	p.nextToken() // 型の先頭へ
+
+	stmt.Value = p.parseTypeAnnotation()
+	if stmt.Value == nil {
+		return nil
+	}
+
+	// セミコロンがあれば読み飛ばす（なくてもいい）
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
 // 式ステートメント
 // *ast.ExpressionStatement
 func (p *Parser) parseExpressionStatement() ast.Statement {
@@ -95,6 +186,17 @@ func (p *Parser) parseExpressionStatement() ast.Statement {
 	//   式に対する代入文があるときと
 	//   関数呼び出しなどのただの式の実行で処理をわける
 	expr := p.parseExpression(LOWEST)
+
+	// iff (x) { ... } は呼び出しとブロックに読めてしまう
+	if call, ok := expr.(*ast.CallExpression); ok && p.peekOnSameRow() && p.peekTokenIs(token.LBRACE) {
+		if ident, ok := call.Function.(*ast.Identifier); ok {
+			if keyword := suggestKeyword(ident.Name, statementKeywords); keyword != "" {
+				p.addSuggestedError(ident.Token, keyword, "unknown statement %s", ident.Name)
+				return nil
+			}
+		}
+	}
+
 	if p.peekTokenIs(token.ASSIGN) {
 		return p.parseAssignStatement(expr)
 	} else {
@@ -128,34 +230,49 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	return stmt
 }
 
+// 文の始めの { がブロックか
+// {} と { key: ... } はハッシュリテラルとする
+func (p *Parser) isBareBlock() bool {
+	return !p.peekTokenIs(token.RBRACE) && !p.peek2TokenIs(token.COLON)
+}
+
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: *p.curToken}
 	block.Statements = []ast.Statement{}
 
-	// ステートメントを一覧に追加するヘルパー
-	// なんか共通処理としてデバッグしたかった
-	addStatements := func(stmt ast.Statement) {
-		block.Statements = append(block.Statements, stmt)
-	}
-
 	// {～}をブロックとして取得するか、１分だけ取得するか
 	if p.curTokenIs(token.LBRACE) {
 		p.nextToken()
 		for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
-			stmt := p.parseStatement()
-			addStatements(stmt)
+			p.parseBodyStatement(&block.Statements)
 			p.nextToken()
 		}
 		// この時点でcurはRBRACEだけとp.NexeToken()しない
+		if p.curTokenIs(token.EOF) {
+			p.addError(block.Token, "expected } to close this block, got EOF")
+		}
 	} else {
 		//stmt := p.parseExpressionStatement()
 		stmt := p.parseStatement() // continueとか式じゃないのがあり得る
-		addStatements(stmt)
+		if !isNilStatement(stmt) {
+			block.Statements = append(block.Statements, stmt)
+		}
 	}
 	// コンストラクタを示すフラグをセット
 	return block
 }
 
+// ブロックやcase節の中の文を1つ読んで追加する
+// エラーがあれば次の文の手前まで読み飛ばす
+func (p *Parser) parseBodyStatement(stmts *[]ast.Statement) {
+	start := p.position - 1
+	stmt := p.parseStatement()
+	if !isNilStatement(stmt) {
+		*stmts = append(*stmts, stmt)
+	}
+	p.recover(start)
+}
+
 /*
  *	代入
  */
@@ -181,6 +298,11 @@ func (p *Parser) parseEllipsisStatement() ast.Statement {
 	stmt := &ast.DeriveStatement{Token: *p.curToken}
 	p.nextToken()
 	stmt.Right = p.parseExpression(LOWEST)
+
+	// セミコロンがあれば飛ばす（なくてもエラーにならない）
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
 	return stmt
 }
 
@@ -201,18 +323,111 @@ func (p *Parser) parseLoopStatement() *ast.LoopStatement {
 		return nil
 	}
 	p.nextToken() // ")"なのでブロックの先頭に進める
+	p.loops++
 	stmt.Block = p.parseBlockStatement()
+	p.loops--
+
+	// セミコロンがあれば飛ばす（なくてもエラーにならない）
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// 式の位置に書かれたループ
+func (p *Parser) parseLoopExpression() ast.Expression {
+	stmt := p.parseLoopStatement()
+	if stmt == nil {
+		return nil
+	}
+	return stmt
+}
 
+/*
+ * ラベル付きのループ
+ * ラベル: loop(...) {...}
+ */
+func (p *Parser) parseLabeledLoopStatement() *ast.LoopStatement {
+	label := &ast.Identifier{Token: *p.curToken, Name: p.curToken.Literal}
+	p.nextToken() // ":"
+	p.nextToken() // "loop"
+
+	p.labels = append(p.labels, label.Name)
+	stmt := p.parseLoopStatement()
+	p.labels = p.labels[:len(p.labels)-1]
+	if stmt == nil {
+		return nil
+	}
+	stmt.Label = label
 	return stmt
 }
 
+// 解析中のループのラベルか？
+func (p *Parser) isLabel(name string) bool {
+	for _, label := range p.labels {
+		if label == name {
+			return true
+		}
+	}
+	return false
+}
+
+// 今のトークンだけで文が終わるか？（次が別の行か ; か } ）
+func (p *Parser) standsAlone() bool {
+	return !p.peekOnSameRow() || p.peekTokenIs(token.SEMICOLON) || p.peekTokenIs(token.RBRACE) || p.peekTokenIs(token.EOF)
+}
+
+// break/continueの後ろに同じ行で続くトークンか？
+func (p *Parser) peekOnSameRow() bool {
+	return p.peekToken.Row == p.curToken.Row
+}
+
+// break/continueの後ろのラベルを読む
+func (p *Parser) parseJumpLabel() *ast.Identifier {
+	if p.peekOnSameRow() && p.peekTokenIs(token.IDENT) && p.isLabel(p.peekToken.Literal) {
+		p.nextToken()
+		return &ast.Identifier{Token: *p.curToken, Name: p.curToken.Literal}
+	}
+	return nil
+}
+
+// break/continueの後ろの名前がラベルの書き間違いならエラーにする
+func (p *Parser) misspelledLabel() bool {
+	t := *p.peekToken
+	if !p.peekOnSameRow() || t.Type != token.IDENT {
+		return false
+	}
+	label := Suggest(t.Literal, p.labels)
+	if label == "" {
+		return false
+	}
+	p.addSuggestedError(t, label, "unknown label %s", t.Literal)
+	return true
+}
+
 /*
  * break
+ * break ラベル 値
+ * ラベルと値は同じ行に書く
  */
 func (p *Parser) parseBreakStatement() *ast.BreakStatement {
 
 	// リターンステートメントを準備
 	stmt := &ast.BreakStatement{Token: *p.curToken}
+	stmt.Label = p.parseJumpLabel()
+
+	// break outr 1 のように名前の後ろに値が続けばラベルのつもり
+	if stmt.Label == nil && p.peek2Token.Row == p.peekToken.Row &&
+		p.prefixParseFns[p.peek2Token.Type] != nil && p.misspelledLabel() {
+		return nil
+	}
+
+	// 同じ行に式が続けばループの値
+	if p.peekOnSameRow() && p.prefixParseFns[p.peekToken.Type] != nil {
+		p.nextToken()
+		stmt.Value = p.parseExpression(LOWEST)
+	}
 
 	// セミコロンがあれば飛ばす（なくてもエラーにならない）
 	if p.peekTokenIs(token.SEMICOLON) {
@@ -229,6 +444,137 @@ func (p *Parser) parseContinueStatement() *ast.ContinueStatement {
 
 	// リターンステートメントを準備
 	stmt := &ast.ContinueStatement{Token: *p.curToken}
+	stmt.Label = p.parseJumpLabel()
+	if stmt.Label == nil && p.misspelledLabel() {
+		return nil
+	}
+
+	// セミコロンがあれば飛ばす（なくてもエラーにならない）
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+/*
+ * switch
+ * switch(式){ case 値, 値: 文... default: 文... }
+ */
+func (p *Parser) parseSwitchStatement() *ast.SwitchStatement {
+	stmt := &ast.SwitchStatement{Token: *p.curToken}
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+	stmt.Subject = p.parseExpression(LOWEST)
+	if stmt.Subject == nil || !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	p.nextToken() // caseかdefaultに進める
+
+	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
+		clause := p.parseCaseClause()
+		if clause == nil {
+			// 読めたcaseまでを返す
+			return stmt
+		}
+		stmt.Cases = append(stmt.Cases, clause)
+	}
+	// この時点でcurはRBRACE
+	if p.curTokenIs(token.EOF) {
+		p.addError(stmt.Token, "expected } to close this switch, got EOF")
+	}
+	return stmt
+}
+
+// case節
+// 終わったときcurは次のcase/defaultかRBRACEになっている
+func (p *Parser) parseCaseClause() *ast.CaseClause {
+	clause := &ast.CaseClause{Token: *p.curToken}
+
+	switch p.curToken.Type {
+	case token.CASE:
+		// 値はカンマ区切りで複数書ける
+		p.nextToken()
+		clause.Values = append(clause.Values, p.parseExpression(LOWEST))
+		for p.peekTokenIs(token.COMMA) {
+			p.nextToken()
+			p.nextToken()
+			clause.Values = append(clause.Values, p.parseExpression(LOWEST))
+		}
+	case token.DEFAULT:
+	default:
+		p.caseError()
+		return nil
+	}
+
+	if !p.expectPeek(token.COLON) {
+		return nil
+	}
+	p.nextToken() // 文の先頭へ
+
+	clause.Body = &ast.BlockStatement{Token: clause.Token}
+	for !p.caseEnds() {
+		// fallthroughはcaseの最後にだけ書ける
+		if p.curTokenIs(token.FALLTHROUGH) {
+			t := *p.curToken
+			if p.peekTokenIs(token.SEMICOLON) {
+				p.nextToken()
+			}
+			p.nextToken()
+			if !p.caseEnds() || p.curTokenIs(token.EOF) {
+				p.addError(t, "fallthrough must be the last statement in a case")
+				return nil
+			}
+			if p.curTokenIs(token.RBRACE) {
+				p.addError(t, "cannot fallthrough the last case")
+				return nil
+			}
+			clause.Fallthrough = true
+			break
+		}
+		p.parseBodyStatement(&clause.Body.Statements)
+		p.nextToken()
+	}
+	return clause
+}
+
+// case/defaultでないトークンがあった（書き間違いなら候補をつける）
+func (p *Parser) caseError() {
+	t := *p.curToken
+	if t.Type == token.IDENT {
+		if keyword := suggestKeyword(t.Literal, []token.TokenType{token.CASE, token.DEFAULT}); keyword != "" {
+			p.addSuggestedError(t, keyword, "expected case or default, got %s", t.Type)
+			return
+		}
+	}
+	p.addError(t, "expected case or default, got %s", t.Type)
+}
+
+// case節の終わりか
+func (p *Parser) caseEnds() bool {
+	return p.curTokenIs(token.CASE) ||
+		p.curTokenIs(token.DEFAULT) ||
+		p.curTokenIs(token.RBRACE) ||
+		p.curTokenIs(token.EOF)
+}
+
+/*
+ * defer
+ * defer 式
+ */
+func (p *Parser) parseDeferStatement() *ast.DeferStatement {
+	stmt := &ast.DeferStatement{Token: *p.curToken}
+	p.nextToken()
+
+	stmt.Call = p.parseExpression(LOWEST)
+	if stmt.Call == nil {
+		return nil
+	}
 
 	// セミコロンがあれば飛ばす（なくてもエラーにならない）
 	if p.peekTokenIs(token.SEMICOLON) {
@@ -237,3 +583,78 @@ func (p *Parser) parseContinueStatement() *ast.ContinueStatement {
 
 	return stmt
 }
+
+/*
+ * select
+ * select { case v = ch.recv(): 文... case ch.send(x): 文... default: 文... }
+ */
+func (p *Parser) parseSelectStatement() *ast.SelectStatement {
+	stmt := &ast.SelectStatement{Token: *p.curToken}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	p.nextToken() // caseかdefaultに進める
+
+	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
+		clause := p.parseSelectCase()
+		if clause == nil {
+			// 読めたcaseまでを返す
+			return stmt
+		}
+		stmt.Cases = append(stmt.Cases, clause)
+	}
+	// この時点でcurはRBRACE
+	if p.curTokenIs(token.EOF) {
+		p.addError(stmt.Token, "expected } to close this select, got EOF")
+	}
+	return stmt
+}
+
+// selectのcase節
+// 終わったときcurは次のcase/defaultかRBRACEになっている
+func (p *Parser) parseSelectCase() *ast.SelectCase {
+	clause := &ast.SelectCase{Token: *p.curToken}
+
+	switch p.curToken.Type {
+	case token.CASE:
+		p.nextToken()
+		// 受け取った値を束縛する名前
+		if p.curTokenIs(token.IDENT) && p.peekTokenIs(token.ASSIGN) {
+			clause.Binding = &ast.Identifier{Token: *p.curToken, Name: p.curToken.Literal}
+			p.nextToken()
+			p.nextToken()
+		}
+		// ch.recv() か ch.send(値)
+		call, ok := p.parseExpression(LOWEST).(*ast.CallExpression)
+		var dot *ast.DotExpression
+		if ok {
+			dot, ok = call.Function.(*ast.DotExpression)
+		}
+		switch {
+		case ok && dot.Right.Name == "recv" && len(call.Arguments) == 0:
+		case ok && dot.Right.Name == "send" && len(call.Arguments) == 1 && clause.Binding == nil:
+			clause.Send = true
+			clause.Value = call.Arguments[0]
+		default:
+			p.addError(clause.Token, "select case must be ch.recv() or ch.send(value)")
+			return nil
+		}
+		clause.Channel = dot.Left
+	case token.DEFAULT:
+	default:
+		p.caseError()
+		return nil
+	}
+
+	if !p.expectPeek(token.COLON) {
+		return nil
+	}
+	p.nextToken() // 文の先頭へ
+
+	clause.Body = &ast.BlockStatement{Token: clause.Token}
+	for !p.caseEnds() {
+		p.parseBodyStatement(&clause.Body.Statements)
+		p.nextToken()
+	}
+	return clause
+}
@@ -44,7 +44,7 @@ func (p *Parser) parseTypeAnnotation() *ast.TypeNode {
 
 		for !p.curTokenIs(token.RPAREN) {
 			if p.curToken.Type != token.IDENT {
-				p.errors = append(p.errors, "expected identifier in function type params")
+				p.addError(*p.curToken, "expected identifier in function type params")
 				return nil
 			}
 
@@ -71,7 +71,7 @@ func (p *Parser) parseTypeAnnotation() *ast.TypeNode {
 		}
 
 		if !p.expectPeek(token.ARROW) { // '=>'
-			p.errors = append(p.errors, "expected => in function type")
+			p.addError(*p.curToken, "expected => in function type")
 			return nil
 		}
 
@@ -137,7 +137,7 @@ func (p *Parser) parseTypeAnnotation() *ast.TypeNode {
 		for !p.curTokenIs(token.RBRACE) {
 			// プロパティ名（識別子）
 			if p.curToken.Type != token.IDENT {
-				p.errors = append(p.errors, "expected identifier in object type")
+				p.addError(*p.curToken, "expected identifier in object type")
 				return nil
 			}
 			propName := p.curToken.Literal
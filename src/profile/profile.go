@@ -0,0 +1,193 @@
+package profile
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"monkey/evaluator"
+	"sort"
+	"strings"
+)
+
+// 集計する値
+type Value int
+
+const (
+	Time        Value = iota // ナノ秒
+	Allocations              // 作った値の数
+	Statements               // 評価した文の数
+)
+
+func ParseValue(name string) (Value, error) {
+	switch name {
+	case "time":
+		return Time, nil
+	case "alloc", "allocations":
+		return Allocations, nil
+	case "statements":
+		return Statements, nil
+	}
+	return 0, fmt.Errorf("unknown profile value: %s (want time, alloc or statements)", name)
+}
+
+func valueOf(n *evaluator.ProfileNode, v Value) int64 {
+	switch v {
+	case Allocations:
+		return n.Allocations
+	case Statements:
+		return n.Statements
+	}
+	return int64(n.Time)
+}
+
+/*
+ * 表示用の関数の名前
+ * 名前のない関数は cover と同じく $unnamed:行:列 にする
+ */
+func FunctionName(fn evaluator.ProfileFunction) string {
+	if fn.Name == "$unnamed" {
+		return fmt.Sprintf("$unnamed:%d:%d", fn.Row, fn.Col)
+	}
+	return fn.Name
+}
+
+// 根からその段までの関数
+func stack(n *evaluator.ProfileNode) []*evaluator.ProfileNode {
+	nodes := []*evaluator.ProfileNode{}
+	for ; n != nil && n.Parent != nil; n = n.Parent {
+		nodes = append(nodes, n)
+	}
+	for i, j := 0, len(nodes)-1; i < j; i, j = i+1, j-1 {
+		nodes[i], nodes[j] = nodes[j], nodes[i]
+	}
+	return nodes
+}
+
+/*
+ * flame graph用の畳んだスタック
+ * 1行が「外側;...;内側 値」で、行の違いはまとめて関数ごとにする
+ */
+func Folded(p *evaluator.Profile, v Value) string {
+	sums := map[string]int64{}
+	for _, n := range p.Nodes() {
+		val := valueOf(n, v)
+		if val == 0 {
+			continue
+		}
+		names := []string{}
+		for _, s := range stack(n) {
+			names = append(names, FunctionName(s.Function))
+		}
+		sums[strings.Join(names, ";")] += val
+	}
+	keys := make([]string, 0, len(sums))
+	for k := range sums {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var out bytes.Buffer
+	for _, k := range keys {
+		fmt.Fprintf(&out, "%s %d\n", k, sums[k])
+	}
+	return out.String()
+}
+
+/*
+ * pprofの形式（gzipで圧縮したprofile.proto）で書く
+ * 値は statements/count、time/nanoseconds、alloc_objects/count の3つ
+ * 場所は関数と行の組で、関数のファイル名はすべてfileにする
+ */
+func WritePprof(w io.Writer, p *evaluator.Profile, file string) error {
+	strs := map[string]int64{"": 0}
+	table := []string{""}
+	str := func(s string) int64 {
+		if i, ok := strs[s]; ok {
+			return i
+		}
+		strs[s] = int64(len(table))
+		table = append(table, s)
+		return strs[s]
+	}
+
+	var out protobuf
+	valueType := func(tag int, typ string, unit string) {
+		var m protobuf
+		m.int64(1, str(typ))
+		m.int64(2, str(unit))
+		out.message(tag, &m)
+	}
+	valueType(1, "statements", "count")
+	valueType(1, "time", "nanoseconds")
+	valueType(1, "alloc_objects", "count")
+
+	functions := map[evaluator.ProfileFunction]int64{}
+	type loc struct {
+		fn  evaluator.ProfileFunction
+		row int
+	}
+	locations := map[loc]int64{}
+	var funcs, locs protobuf
+
+	for _, n := range p.Nodes() {
+		if n.Statements == 0 && n.Time == 0 && n.Allocations == 0 {
+			continue
+		}
+		ids := []int64{}
+		// 内側から
+		path := stack(n)
+		for i := len(path) - 1; i >= 0; i-- {
+			s := path[i]
+			fid, ok := functions[s.Function]
+			if !ok {
+				fid = int64(len(functions) + 1)
+				functions[s.Function] = fid
+				var m protobuf
+				m.int64(1, fid)
+				m.int64(2, str(FunctionName(s.Function)))
+				m.int64(3, str(FunctionName(s.Function)))
+				m.int64(4, str(file))
+				m.int64(5, int64(s.Function.Row))
+				funcs.message(5, &m)
+			}
+			key := loc{s.Function, s.Row}
+			lid, ok := locations[key]
+			if !ok {
+				lid = int64(len(locations) + 1)
+				locations[key] = lid
+				var line protobuf
+				line.int64(1, fid)
+				line.int64(2, int64(s.Row))
+				var m protobuf
+				m.int64(1, lid)
+				m.message(4, &line)
+				locs.message(4, &m)
+			}
+			ids = append(ids, lid)
+		}
+		var sample protobuf
+		sample.packed(1, ids)
+		sample.packed(2, []int64{n.Statements, int64(n.Time), n.Allocations})
+		out.message(2, &sample)
+	}
+	out.Write(locs.Bytes())
+	out.Write(funcs.Bytes())
+
+	out.int64(9, p.Start.UnixNano())
+	out.int64(10, int64(p.Duration))
+	valueType(11, "time", "nanoseconds")
+	out.int64(12, 1)
+	out.int64(14, str("time"))
+
+	// 文字列の表は最後に書く（空文字列も省略しない）
+	for _, s := range table {
+		out.bytes(6, []byte(s))
+	}
+
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(out.Bytes()); err != nil {
+		return err
+	}
+	return gz.Close()
+}
@@ -0,0 +1,212 @@
+package profile
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"monkey/evaluator"
+	"monkey/object"
+	"monkey/parser"
+	"testing"
+)
+
+const src = `imm double = (n:number)=>{
+  imm x = n * 2
+  return x
+}
+mut total = 0
+loop(imm i=[1, 2, 3]){
+  total = total + double(i.v)
+}
+total
+`
+
+func record(t *testing.T) *evaluator.Profile {
+	t.Helper()
+	program, ok := parser.NewParser(src).ParseProgram()
+	if !ok {
+		t.Fatal("parse error")
+	}
+	p := evaluator.NewProfile()
+	exec := evaluator.NewExecution(context.Background(), evaluator.Options{Observer: p})
+	result := exec.Eval(program, object.NewEnvironment())
+	exec.Close()
+	if result.Inspect() != "12" {
+		t.Fatalf("expected 12, got %s", result.Inspect())
+	}
+	p.Stop()
+	return p
+}
+
+func TestRecord(t *testing.T) {
+	p := record(t)
+	rows := map[string]int64{}
+	for _, n := range p.Nodes() {
+		rows[fmt.Sprintf("%s:%d", FunctionName(n.Function), n.Row)] += n.Statements
+		if n.Time < 0 {
+			t.Errorf("negative time at %s:%d", n.Function.Name, n.Row)
+		}
+	}
+	for key, want := range map[string]int64{"$top:1": 1, "$top:7": 3, "$top:9": 1, "double:2": 3, "double:3": 3} {
+		if rows[key] != want {
+			t.Errorf("%s: expected %d statements, got %d", key, want, rows[key])
+		}
+	}
+	for _, n := range p.Nodes() {
+		if n.Function.Name == "double" && (n.Parent.Function != evaluator.TopLevel || n.Parent.Row != 7) {
+			t.Errorf("double should be called from line 7, got %+v", n.Parent)
+		}
+		if n.Function.Name == "double" && n.Function.Row != 1 {
+			t.Errorf("double should be defined at line 1, got %d", n.Function.Row)
+		}
+	}
+	if p.Duration <= 0 {
+		t.Error("expected a duration")
+	}
+}
+
+// ジェネレータの本体とタスクは呼び出し元の下に入る
+func TestRecordGeneratorsAndTasks(t *testing.T) {
+	program, ok := parser.NewParser(`imm gen = ()=>{
+  yield 1
+  yield 2
+}
+imm use = ()=>{
+  imm xs = collect(gen())
+  return len(xs)
+}
+imm work = (n:number)=>{
+  imm y = n + 1
+  return y
+}
+imm t = spawn work(1)
+use() + await t
+`).ParseProgram()
+	if !ok {
+		t.Fatal("parse error")
+	}
+	p := evaluator.NewProfile()
+	exec := evaluator.NewExecution(context.Background(), evaluator.Options{Observer: p})
+	result := exec.Eval(program, object.NewEnvironment())
+	exec.Close()
+	p.Stop()
+	if result.Inspect() != "4" {
+		t.Fatalf("expected 4, got %s", result.Inspect())
+	}
+
+	parents := map[string]string{}
+	for _, n := range p.Nodes() {
+		key := fmt.Sprintf("%s:%d", FunctionName(n.Function), n.Row)
+		parent := fmt.Sprintf("%s:%d", FunctionName(n.Parent.Function), n.Parent.Row)
+		if n.Parent.Parent == nil {
+			parent = "root"
+		}
+		if old, ok := parents[key]; ok && old != parent {
+			t.Errorf("%s recorded under %s and %s", key, old, parent)
+		}
+		parents[key] = parent
+	}
+	for key, want := range map[string]string{
+		"gen:2": "use:6", "gen:3": "use:6", "use:6": "$top:14", "use:7": "$top:14",
+		"work:10": "$top:14", "work:11": "$top:14",
+	} {
+		if parents[key] != want {
+			t.Errorf("%s: expected parent %s, got %q", key, want, parents[key])
+		}
+	}
+}
+
+func TestFolded(t *testing.T) {
+	p := record(t)
+	if got, want := Folded(p, Statements), "$top 7\n$top;double 6\n"; got != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, got)
+	}
+	if got := Folded(p, Allocations); got == "" {
+		t.Error("expected allocations")
+	}
+	if _, err := ParseValue("bogus"); err == nil {
+		t.Error("expected an error for an unknown value")
+	}
+}
+
+// protobufのフィールドを番号ごとに読む（varintと長さつきだけ）
+func fields(t *testing.T, data []byte) map[int][][]byte {
+	t.Helper()
+	result := map[int][][]byte{}
+	varint := func() uint64 {
+		var x uint64
+		for shift := 0; ; shift += 7 {
+			if len(data) == 0 {
+				t.Fatal("truncated varint")
+			}
+			b := data[0]
+			data = data[1:]
+			x |= uint64(b&0x7f) << shift
+			if b < 0x80 {
+				return x
+			}
+		}
+	}
+	for len(data) > 0 {
+		key := varint()
+		tag, wire := int(key>>3), key&7
+		switch wire {
+		case 0:
+			start := data
+			varint()
+			result[tag] = append(result[tag], start[:len(start)-len(data)])
+		case 2:
+			n := varint()
+			result[tag] = append(result[tag], data[:n])
+			data = data[n:]
+		default:
+			t.Fatalf("unexpected wire type %d", wire)
+		}
+	}
+	return result
+}
+
+func TestWritePprof(t *testing.T) {
+	p := record(t)
+	var buf bytes.Buffer
+	if err := WritePprof(&buf, p, "d.kk"); err != nil {
+		t.Fatal(err)
+	}
+	r, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := fields(t, data)
+	strs := map[string]bool{}
+	for _, s := range f[6] {
+		strs[string(s)] = true
+	}
+	for _, want := range []string{"", "$top", "double", "d.kk", "time", "nanoseconds", "alloc_objects", "statements"} {
+		if !strs[want] {
+			t.Errorf("string table does not contain %q", want)
+		}
+	}
+	if len(f[1]) != 3 {
+		t.Errorf("expected 3 sample types, got %d", len(f[1]))
+	}
+	if len(f[5]) != 2 {
+		t.Errorf("expected 2 functions, got %d", len(f[5]))
+	}
+	// $top の 1,5,6,7,9 行と double の 2,3 行
+	if len(f[4]) != 7 {
+		t.Errorf("expected 7 locations, got %d", len(f[4]))
+	}
+	for _, sample := range f[2] {
+		s := fields(t, sample)
+		if len(s[1]) != 1 || len(s[2]) != 1 {
+			t.Fatalf("expected packed locations and values, got %v", s)
+		}
+	}
+}
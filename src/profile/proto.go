@@ -0,0 +1,59 @@
+package profile
+
+import "bytes"
+
+/*
+ * pprofのprofile.protoを書くための最小限のProtocol Buffersのエンコーダ
+ * 使う型はvarintと長さつきのバイト列だけ
+ */
+type protobuf struct {
+	bytes.Buffer
+}
+
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+func (b *protobuf) varint(x uint64) {
+	for x >= 0x80 {
+		b.WriteByte(byte(x) | 0x80)
+		x >>= 7
+	}
+	b.WriteByte(byte(x))
+}
+
+func (b *protobuf) key(tag int, wire int) {
+	b.varint(uint64(tag)<<3 | uint64(wire))
+}
+
+// 0は既定値なので書かない
+func (b *protobuf) int64(tag int, x int64) {
+	if x == 0 {
+		return
+	}
+	b.key(tag, wireVarint)
+	b.varint(uint64(x))
+}
+
+func (b *protobuf) bytes(tag int, data []byte) {
+	b.key(tag, wireBytes)
+	b.varint(uint64(len(data)))
+	b.Write(data)
+}
+
+func (b *protobuf) message(tag int, m *protobuf) {
+	b.bytes(tag, m.Bytes())
+}
+
+// repeatedの数値はpackedで書く
+func (b *protobuf) packed(tag int, xs []int64) {
+	if len(xs) == 0 {
+		return
+	}
+	var p protobuf
+	for _, x := range xs {
+		p.varint(uint64(x))
+	}
+	b.message(tag, &p)
+}
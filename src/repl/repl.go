@@ -2,6 +2,7 @@ package repl
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
 	"monkey/evaluator"
@@ -14,6 +15,9 @@ const PROMPT = ">> "
 func Start(in io.Reader, out io.Writer) {
 	scanner := bufio.NewScanner(in)
 	env := object.NewEnvironment()
+	// 行をまたいでタスクやジェネレータを使えるように、1つの実行で評価する
+	exec := evaluator.NewExecution(context.Background(), evaluator.Options{})
+	defer exec.Close()
 
 	for {
 		fmt.Fprintf(out, PROMPT)
@@ -25,13 +29,13 @@ func Start(in io.Reader, out io.Writer) {
 		line := scanner.Text()
 		p := parser.NewParser(line)
 
-		program := p.ParseProgram()
+		program, _ := p.ParseProgram()
 		if len(p.Errors()) != 0 {
 			printParserErrors(out, p.Errors())
 			continue
 		}
 
-		evaluated := evaluator.Eval(program, env)
+		evaluated := exec.Eval(program, env)
 		if evaluated != nil {
 			io.WriteString(out, evaluated.Inspect())
 			io.WriteString(out, "\n")
@@ -0,0 +1,457 @@
+package resolve
+
+import (
+	"monkey/ast"
+	"monkey/token"
+)
+
+// 字句解析器の位置（行も列も1オリジン、列は表示幅）
+type Pos struct {
+	Row int
+	Col int
+}
+
+func TokenPos(t token.Token) Pos {
+	return Pos{t.Row, t.Col}
+}
+
+func (a Pos) Before(b Pos) bool {
+	return a.Row < b.Row || a.Row == b.Row && a.Col < b.Col
+}
+
+/*
+ * 名前の束縛
+ * imm/mut/const/shareの宣言、引数、ループやパターンやselectで束縛した名前
+ */
+type Binding struct {
+	Name   string
+	Token  token.Token    // 名前のトークン
+	Decl   string         // imm/mut/const/share/type/param/pattern/select
+	Type   *ast.TypeNode  // 型の指定（なければnil）
+	Value  ast.Expression // 宣言した値（なければnil）
+	Public bool
+	Scope  *Scope
+	Refs   []*Reference // この束縛を指す参照
+}
+
+// 関数の値を持つ束縛なら関数リテラルを返す
+func (b *Binding) Function() *ast.FunctionLiteral {
+	fn, _ := b.Value.(*ast.FunctionLiteral)
+	return fn
+}
+
+// 代入されることがあるか
+func (b *Binding) Assigned() bool {
+	for _, ref := range b.Refs {
+		if ref.Assign {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ * スコープ
+ * 評価器と同じく、プログラム、関数、ブロック、ループ、matchの腕、selectのcaseごとに作る
+ */
+type Scope struct {
+	Parent   *Scope
+	Function *ast.FunctionLiteral // 関数の本体のスコープなら関数
+	Loop     *ast.LoopStatement   // ループの本体のスコープならループ
+	Start    Pos
+	End      Pos
+	Bindings []*Binding
+}
+
+func (s *Scope) Contains(p Pos) bool {
+	return !p.Before(s.Start) && !s.End.Before(p)
+}
+
+// 外側のスコープで同じ名前を束縛しているもの（なければnil）
+func (s *Scope) Outer(name string) *Binding {
+	for o := s.Parent; o != nil; o = o.Parent {
+		for _, b := range o.Bindings {
+			if b.Name == name {
+				return b
+			}
+		}
+	}
+	return nil
+}
+
+// 名前の参照（見つからなければBindingはnilで、組み込み関数かもしれない）
+type Reference struct {
+	Token   token.Token
+	Scope   *Scope
+	Binding *Binding
+	Assign  bool // 代入の左辺か ++ の対象
+}
+
+/*
+ * 解析の結果
+ */
+type Info struct {
+	Root       *Scope
+	Scopes     []*Scope
+	Bindings   []*Binding
+	Refs       []*Reference
+	Properties []token.Token // .の後ろの名前
+}
+
+/*
+ * プログラムの名前を解決する
+ * tokensはスコープの終わりを求めるのに使う（{ と } の対応）
+ * nilならスコープの終わりはプログラムの最後になる
+ */
+func Program(program *ast.Program, tokens []*token.Token) *Info {
+	r := &resolver{info: &Info{}, closers: map[Pos]Pos{}}
+	r.matchBraces(tokens)
+	r.info.Root = &Scope{Start: Pos{1, 1}, End: r.end}
+	r.info.Scopes = []*Scope{r.info.Root}
+	r.cur = r.info.Root
+	func() {
+		// 構文エラーで木が欠けていても、たどれたところまでは使う
+		defer func() { recover() }()
+		if program != nil {
+			r.statements(program.Statements)
+		}
+	}()
+	r.resolve()
+	return r.info
+}
+
+type resolver struct {
+	info    *Info
+	cur     *Scope
+	closers map[Pos]Pos // { の位置から対応する } の位置
+	end     Pos         // 最後のトークンの位置
+}
+
+// { と } の対応を調べる（ブロックの終わりの位置はASTにないため）
+func (r *resolver) matchBraces(tokens []*token.Token) {
+	r.end = Pos{1 << 30, 0}
+	if len(tokens) > 0 {
+		r.end = TokenPos(*tokens[len(tokens)-1])
+	}
+	stack := []Pos{}
+	for _, t := range tokens {
+		switch t.Type {
+		case token.LBRACE:
+			stack = append(stack, TokenPos(*t))
+		case token.RBRACE:
+			if len(stack) > 0 {
+				r.closers[stack[len(stack)-1]] = TokenPos(*t)
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+}
+
+// ブロックの終わり（閉じていなければ最後）
+func (r *resolver) blockEnd(b *ast.BlockStatement) Pos {
+	if b != nil {
+		if end, ok := r.closers[TokenPos(b.Token)]; ok {
+			return end
+		}
+	}
+	return r.end
+}
+
+/*
+ * 参照を束縛に結びつける
+ * 同じスコープでは参照より前の最後の宣言を、なければ後ろの宣言を使う
+ * （関数の中から後で宣言する関数を呼べるように）
+ */
+func (r *resolver) resolve() {
+	for _, ref := range r.info.Refs {
+		at := TokenPos(ref.Token)
+		for s := ref.Scope; s != nil && ref.Binding == nil; s = s.Parent {
+			var later *Binding
+			for _, b := range s.Bindings {
+				if b.Name != ref.Token.Literal {
+					continue
+				}
+				if TokenPos(b.Token).Before(at) {
+					ref.Binding = b
+				} else if later == nil {
+					later = b
+				}
+			}
+			if ref.Binding == nil {
+				ref.Binding = later
+			}
+		}
+		if ref.Binding != nil {
+			ref.Binding.Refs = append(ref.Binding.Refs, ref)
+		}
+	}
+}
+
+// 位置を含むいちばん内側のスコープ
+func (info *Info) ScopeAt(p Pos) *Scope {
+	inner := info.Root
+	for _, s := range info.Scopes {
+		if s.Contains(p) && inner.Contains(s.Start) && inner.Contains(s.End) {
+			inner = s
+		}
+	}
+	return inner
+}
+
+func (r *resolver) push(start Pos, end Pos) *Scope {
+	s := &Scope{Parent: r.cur, Start: start, End: end}
+	r.info.Scopes = append(r.info.Scopes, s)
+	r.cur = s
+	return s
+}
+
+func (r *resolver) pop() {
+	r.cur = r.cur.Parent
+}
+
+func (r *resolver) declare(ident *ast.Identifier, decl string, value ast.Expression) *Binding {
+	b := &Binding{Name: ident.Name, Token: ident.Token, Decl: decl, Type: ident.Type, Value: value, Scope: r.cur}
+	r.cur.Bindings = append(r.cur.Bindings, b)
+	r.info.Bindings = append(r.info.Bindings, b)
+	return b
+}
+
+// ここまでに宣言した名前がtypeの型かコンストラクタか
+func (r *resolver) namesType(name string) bool {
+	for s := r.cur; s != nil; s = s.Parent {
+		for i := len(s.Bindings) - 1; i >= 0; i-- {
+			if b := s.Bindings[i]; b.Name == name {
+				return b.Decl == "type" || b.Function() != nil && b.Function().Body.ReturnsThis()
+			}
+		}
+	}
+	return false
+}
+
+func (r *resolver) use(ident *ast.Identifier, assign bool) {
+	r.info.Refs = append(r.info.Refs, &Reference{Token: ident.Token, Scope: r.cur, Assign: assign})
+}
+
+func (r *resolver) statements(stmts []ast.Statement) {
+	for _, stmt := range stmts {
+		r.statement(stmt)
+	}
+}
+
+// ブロックを新しいスコープで読む
+func (r *resolver) block(b *ast.BlockStatement) {
+	if b == nil {
+		return
+	}
+	r.push(TokenPos(b.Token), r.blockEnd(b))
+	r.statements(b.Statements)
+	r.pop()
+}
+
+func (r *resolver) statement(stmt ast.Statement) {
+	switch s := stmt.(type) {
+	case *ast.LetStatement:
+		r.let(s)
+	case *ast.ExpressionStatement:
+		r.expression(s.Expression)
+	case *ast.ReturnStatement:
+		r.expression(s.ReturnValue)
+	case *ast.BlockStatement:
+		r.block(s)
+	case *ast.AssignStatement:
+		if ident, ok := s.Left.(*ast.Identifier); ok && ident != nil {
+			r.use(ident, true)
+		} else {
+			r.expression(s.Left)
+		}
+		r.expression(s.Right)
+	case *ast.DeriveStatement:
+		r.expression(s.Right)
+	case *ast.LoopStatement:
+		r.loop(s)
+	case *ast.BreakStatement:
+		r.expression(s.Value)
+	case *ast.TypeStatement:
+		if s.Ident != nil {
+			b := r.declare(s.Ident, "type", nil)
+			b.Type = s.Value
+		}
+	case *ast.SwitchStatement:
+		r.expression(s.Subject)
+		for _, c := range s.Cases {
+			for _, v := range c.Values {
+				r.expression(v)
+			}
+			r.block(c.Body)
+		}
+	case *ast.DeferStatement:
+		r.expression(s.Call)
+	case *ast.SelectStatement:
+		for _, c := range s.Cases {
+			r.expression(c.Channel)
+			r.expression(c.Value)
+			if c.Body == nil {
+				continue
+			}
+			r.push(TokenPos(c.Token), r.blockEnd(c.Body))
+			if c.Binding != nil {
+				r.declare(c.Binding, "select", nil)
+			}
+			r.statements(c.Body.Statements)
+			r.pop()
+		}
+	}
+}
+
+func (r *resolver) let(s *ast.LetStatement) {
+	if s.Ident == nil {
+		r.expression(s.Value)
+		return
+	}
+	b := r.declare(s.Ident, s.Token.Literal, s.Value)
+	b.Public = s.Public
+	r.expression(s.Value)
+}
+
+// ループの変数はループの本体だけで見える
+func (r *resolver) loop(s *ast.LoopStatement) {
+	if s.Bind == nil || s.Bind.Ident == nil {
+		r.block(s.Block)
+		return
+	}
+	r.expression(s.Bind.Value)
+	scope := r.push(TokenPos(s.Bind.Ident.Token), r.blockEnd(s.Block))
+	scope.Loop = s
+	r.declare(s.Bind.Ident, s.Bind.Token.Literal, nil)
+	if s.Block != nil {
+		r.statements(s.Block.Statements)
+	}
+	r.pop()
+}
+
+func (r *resolver) expression(e ast.Expression) {
+	switch e := e.(type) {
+	case *ast.Identifier:
+		if e != nil {
+			r.use(e, false)
+		}
+	case *ast.ArrayLiteral:
+		for _, el := range e.Elements {
+			r.expression(el)
+		}
+	case *ast.HashLiteral:
+		if e.Pairs != nil {
+			e.Pairs.Range(func(k, v ast.Expression) bool {
+				r.expression(k)
+				r.expression(v)
+				return true
+			})
+		}
+	case *ast.FunctionLiteral:
+		if e.Body == nil {
+			return
+		}
+		// 引数は関数の本体で見える
+		s := r.push(TokenPos(e.Token), r.blockEnd(e.Body))
+		s.Function = e
+		for _, p := range e.Parameters {
+			r.declare(p, "param", nil)
+		}
+		r.statements(e.Body.Statements)
+		r.pop()
+	case *ast.PrefixExpression:
+		// ++x は x への代入
+		if ident, ok := e.Right.(*ast.Identifier); ok && ident != nil && e.Token.Type == token.INC {
+			r.use(ident, true)
+			return
+		}
+		r.expression(e.Right)
+	case *ast.InfixExpression:
+		r.expression(e.Left)
+		r.expression(e.Right)
+	case *ast.TemplateLiteral:
+		for _, v := range e.Values {
+			r.expression(v)
+		}
+	case *ast.CallExpression:
+		r.expression(e.Function)
+		for _, arg := range e.Arguments {
+			r.expression(arg)
+		}
+	case *ast.IndexExpression:
+		r.expression(e.Left)
+		r.expression(e.Index)
+	case *ast.DotExpression:
+		r.expression(e.Left)
+		if e.Right != nil {
+			r.info.Properties = append(r.info.Properties, e.Right.Token)
+		}
+	case *ast.MetaExpression:
+		r.expression(e.Left)
+	case *ast.IfExpression:
+		r.expression(e.Condition)
+		r.block(e.Consequence)
+		for _, elif := range e.Elifs {
+			r.expression(elif.Condition)
+			r.block(elif.Consequence)
+		}
+		r.block(e.Alternative)
+	case *ast.MatchExpression:
+		r.expression(e.Subject)
+		for _, arm := range e.Arms {
+			if arm.Body == nil {
+				continue
+			}
+			// パターンで束縛した名前はガードと本体で見える
+			r.push(TokenPos(arm.Token), r.blockEnd(arm.Body))
+			r.pattern(arm.Pattern)
+			r.expression(arm.Guard)
+			r.statements(arm.Body.Statements)
+			r.pop()
+		}
+	case *ast.LoopStatement:
+		r.loop(e)
+	case *ast.YieldExpression:
+		r.expression(e.Value)
+	case *ast.SpawnExpression:
+		if e.Call != nil {
+			r.expression(e.Call)
+		}
+	}
+}
+
+func (r *resolver) pattern(p ast.Pattern) {
+	switch p := p.(type) {
+	case *ast.BindingPattern:
+		if p.Name == nil {
+			break
+		}
+		// 型やコンストラクタの名前だけなら束縛でなく参照
+		if p.Type == nil && r.namesType(p.Name.Name) {
+			r.use(p.Name, false)
+			break
+		}
+		b := r.declare(p.Name, "pattern", nil)
+		b.Type = p.Type
+	case *ast.ArrayPattern:
+		for _, el := range p.Elements {
+			r.pattern(el)
+		}
+		if p.Rest != nil {
+			r.declare(p.Rest, "pattern", nil)
+		}
+	case *ast.HashPattern:
+		for _, v := range p.Values {
+			r.pattern(v)
+		}
+	case *ast.OrPattern:
+		for _, a := range p.Alternatives {
+			r.pattern(a)
+		}
+	case *ast.LiteralPattern:
+		r.expression(p.Value)
+	case *ast.RangePattern:
+		r.expression(p.Low)
+		r.expression(p.High)
+	}
+}
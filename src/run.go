@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"monkey/evaluator"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/profile"
+	"os"
+)
+
+/*
+ * run サブコマンド
+ * ファイルを実行し、エラーになったら位置とメッセージを出して1で終わる
+ * -profile はpprofの形式の、-flame はflame graph用の畳んだスタックのプロファイルを書き出す
+ * -flamevalue は畳んだスタックの値（time/alloc/statements）
+ */
+func runRun(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	pprofPath := flags.String("profile", "", "write a pprof profile of time and allocations to this file")
+	flamePath := flags.String("flame", "", "write folded stacks for flame graphs to this file")
+	flameValue := flags.String("flamevalue", "time", "value of the folded stacks: time, alloc or statements")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprintln(stderr, "run: expected one input file")
+		return 2
+	}
+	value, err := profile.ParseValue(*flameValue)
+	if err != nil {
+		fmt.Fprintf(stderr, "run: %s\n", err)
+		return 2
+	}
+
+	path := flags.Arg(0)
+	src, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(stderr, "run: %s\n", err)
+		return 1
+	}
+	p := parser.NewParser(string(src))
+	program, ok := p.ParseProgram()
+	if !ok {
+		fmt.Fprintln(stderr, parser.FormatErrors(path, p.ErrorDetails()))
+		return 1
+	}
+
+	profiling := *pprofPath != "" || *flamePath != ""
+	opts := evaluator.Options{}
+	var prof *evaluator.Profile
+	if profiling {
+		prof = evaluator.NewProfile()
+		opts.Observer = prof
+	}
+	exec := evaluator.NewExecution(context.Background(), opts)
+	result := exec.Eval(program, object.NewEnvironment())
+	exec.Close()
+	status := 0
+	if err, ok := result.(*object.Error); ok {
+		if err.Row == 0 {
+			fmt.Fprintf(stderr, "%s: %s: %s\n", path, err.KindName(), err.Detail())
+		} else {
+			fmt.Fprintf(stderr, "%s:%d:%d: %s: %s\n", path, err.Row, err.Col, err.KindName(), err.Detail())
+		}
+		status = 1
+	}
+	if !profiling {
+		return status
+	}
+
+	prof.Stop()
+	if *pprofPath != "" {
+		if err := writeProfile(*pprofPath, func(w io.Writer) error { return profile.WritePprof(w, prof, path) }); err != nil {
+			fmt.Fprintf(stderr, "run: %s\n", err)
+			status = 1
+		}
+	}
+	if *flamePath != "" {
+		if err := os.WriteFile(*flamePath, []byte(profile.Folded(prof, value)), 0o644); err != nil {
+			fmt.Fprintf(stderr, "run: %s\n", err)
+			status = 1
+		}
+	}
+	return status
+}
+
+func writeProfile(path string, write func(io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
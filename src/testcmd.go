@@ -0,0 +1,124 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"monkey/cover"
+	"monkey/evaluator"
+	"monkey/tester"
+	"os"
+	"regexp"
+	"time"
+)
+
+/*
+ * test サブコマンド
+ * *_test.kk のテストを実行して結果を出し、失敗があれば1で終わる
+ * 引数がなければカレントディレクトリの下を探す
+ * -run は名前を絞る正規表現、-v は成功したテストも出す
+ * -cover はカバレッジの要約を出し、-coverprofile はLCOVを、-coverhtml は注釈つきのHTMLを書き出す
+ */
+func runTest(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	pattern := flags.String("run", "", "run only the tests whose names match this regular expression")
+	verbose := flags.Bool("v", false, "print passing tests too")
+	coverSummary := flags.Bool("cover", false, "print a coverage summary")
+	coverProfile := flags.String("coverprofile", "", "write an LCOV coverage file")
+	coverHTML := flags.String("coverhtml", "", "write an annotated HTML coverage view")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	var filter *regexp.Regexp
+	if *pattern != "" {
+		re, err := regexp.Compile(*pattern)
+		if err != nil {
+			fmt.Fprintf(stderr, "test: invalid -run: %s\n", err)
+			return 2
+		}
+		filter = re
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	files, err := tester.Discover(paths)
+	if err != nil {
+		fmt.Fprintf(stderr, "test: %s\n", err)
+		return 1
+	}
+	if len(files) == 0 {
+		fmt.Fprintln(stderr, "test: no test files")
+		return 0
+	}
+
+	covering := *coverSummary || *coverProfile != "" || *coverHTML != ""
+	profiles := []*cover.Profile{}
+	status := 0
+	for _, file := range files {
+		start := time.Now()
+		src, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %s\n", file, err)
+			status = 1
+			continue
+		}
+		opts := evaluator.Options{}
+		var coverage *evaluator.Coverage
+		if covering {
+			coverage = evaluator.NewCoverage()
+			opts.Observer = coverage
+		}
+		results, err := tester.Run(file, string(src), filter, opts)
+		if covering {
+			if profile, err := cover.Build(file, string(src), coverage); err == nil {
+				profiles = append(profiles, profile)
+			}
+		}
+		if err != nil {
+			fmt.Fprintln(stdout, err)
+			fmt.Fprintf(stdout, "FAIL\t%s\t[setup failed]\n", file)
+			status = 1
+			continue
+		}
+		failed := false
+		for _, r := range results {
+			switch {
+			case !r.Passed:
+				failed = true
+				fmt.Fprintf(stdout, "--- FAIL: %s (%.3fs)\n    %s\n", r.Name, r.Elapsed.Seconds(), r.Failure())
+			case *verbose:
+				fmt.Fprintf(stdout, "--- PASS: %s (%.3fs)\n", r.Name, r.Elapsed.Seconds())
+			}
+		}
+		elapsed := time.Since(start).Seconds()
+		switch {
+		case failed:
+			fmt.Fprintf(stdout, "FAIL\t%s\t%.3fs\n", file, elapsed)
+			status = 1
+		case len(results) == 0:
+			fmt.Fprintf(stdout, "ok  \t%s\t%.3fs [no tests to run]\n", file, elapsed)
+		default:
+			fmt.Fprintf(stdout, "ok  \t%s\t%.3fs\n", file, elapsed)
+		}
+	}
+
+	if *coverSummary {
+		fmt.Fprint(stdout, cover.Text(profiles))
+	}
+	for _, out := range []struct{ path, content string }{
+		{*coverProfile, cover.LCOV(profiles)},
+		{*coverHTML, cover.HTML(profiles)},
+	} {
+		if out.path == "" {
+			continue
+		}
+		if err := os.WriteFile(out.path, []byte(out.content), 0o644); err != nil {
+			fmt.Fprintf(stderr, "test: %s\n", err)
+			status = 1
+		}
+	}
+	return status
+}
@@ -0,0 +1,202 @@
+package tester
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"monkey/ast"
+	"monkey/evaluator"
+	"monkey/object"
+	"monkey/parser"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// テストのファイル名の接尾辞
+const FileSuffix = "_test.kk"
+
+/*
+ * テスト
+ * トップレベルで宣言したtestで始まる名前の関数か、test("名前", 関数)で登録した関数
+ */
+type Test struct {
+	Name string
+	Fn   object.Object
+	Row  int // 宣言か登録の位置
+	Col  int
+}
+
+/*
+ * テストの結果
+ * 失敗したときは、エラーの位置（分からなければテストの位置）とメッセージが入る
+ */
+type Result struct {
+	Name    string
+	File    string
+	Row     int
+	Col     int
+	Passed  bool
+	Message string
+	Elapsed time.Duration
+}
+
+// file:行:列: メッセージ
+func (r Result) Failure() string {
+	return fmt.Sprintf("%s:%d:%d: %s", r.File, r.Row, r.Col, r.Message)
+}
+
+/*
+ * テストのファイルを探す
+ * ディレクトリはその下の *_test.kk を、ファイルはそのまま使う
+ */
+func Discover(paths []string) ([]string, error) {
+	files := []string{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && strings.HasSuffix(d.Name(), FileSuffix) {
+				files = append(files, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+/*
+ * ファイルのテストを実行する
+ * filterがnilでなければ名前が一致するテストだけを実行する
+ * トップレベルとテストはoptsの制限と見るもの（カバレッジなど）をつけた1つの実行で評価する
+ * 構文エラーやトップレベルの評価のエラーはerrorで返す
+ */
+func Run(file string, src string, filter *regexp.Regexp, opts evaluator.Options) ([]Result, error) {
+	p := parser.NewParser(src)
+	program, ok := p.ParseProgram()
+	if !ok {
+		return nil, errors.New(parser.FormatErrors(file, p.ErrorDetails()))
+	}
+
+	env := object.NewEnvironment()
+	registered := []*Test{}
+	env.Set("test", &object.Builtin{Fn: func(env *object.Environment, args ...object.Object) object.Object {
+		if len(args) != 2 {
+			return &object.Error{Kind: object.ARGUMENT_ERROR,
+				Message: fmt.Sprintf("wrong number of arguments. got=%d, want=2", len(args))}
+		}
+		name, ok := args[0].(*object.String)
+		if !ok {
+			return &object.Error{Kind: object.TYPE_ERROR,
+				Message: fmt.Sprintf("argument to `test` must be STRING, got %s", args[0].Type())}
+		}
+		registered = append(registered, &Test{Name: name.Value, Fn: args[1]})
+		return object.NULL
+	}})
+	exec := evaluator.NewExecution(context.Background(), opts)
+	defer exec.Close()
+	if result := exec.Eval(program, env); result != nil && result.Type() == object.ERROR_OBJ {
+		err := result.(*object.Error)
+		if err.Row == 0 {
+			return nil, fmt.Errorf("%s: %s: %s", file, err.KindName(), err.Detail())
+		}
+		return nil, fmt.Errorf("%s:%d:%d: %s: %s", file, err.Row, err.Col, err.KindName(), err.Detail())
+	}
+
+	results := []Result{}
+	for _, t := range collect(program, env, registered) {
+		if filter != nil && !filter.MatchString(t.Name) {
+			continue
+		}
+		results = append(results, run(exec, file, t))
+	}
+	return results, nil
+}
+
+// 宣言と登録のテストを位置の順に並べる
+func collect(program *ast.Program, env *object.Environment, registered []*Test) []*Test {
+	tests := []*Test{}
+	for _, stmt := range program.Statements {
+		let, ok := stmt.(*ast.LetStatement)
+		if !ok || let.Ident == nil || !isTestName(let.Ident.Name) {
+			continue
+		}
+		if _, ok := let.Value.(*ast.FunctionLiteral); !ok {
+			continue
+		}
+		tests = append(tests, &Test{
+			Name: let.Ident.Name,
+			Fn:   env.Get(let.Ident.Name),
+			Row:  let.Ident.Token.Row,
+			Col:  let.Ident.Token.Col,
+		})
+	}
+
+	// 登録したテストの位置は test("名前", ...) の呼び出しから探す
+	calls := map[string][]*ast.CallExpression{}
+	ast.Inspect(program, func(n ast.Node) bool {
+		if call, ok := n.(*ast.CallExpression); ok && len(call.Arguments) == 2 {
+			ident, ok := call.Function.(*ast.Identifier)
+			name, isString := call.Arguments[0].(*ast.StringLiteral)
+			if ok && isString && ident.Name == "test" {
+				calls[name.Value] = append(calls[name.Value], call)
+			}
+		}
+		return true
+	})
+	for _, t := range registered {
+		if list := calls[t.Name]; len(list) > 0 {
+			pos := list[0].Function.(*ast.Identifier).Token
+			t.Row, t.Col = pos.Row, pos.Col
+			calls[t.Name] = list[1:]
+		}
+		tests = append(tests, t)
+	}
+
+	sort.SliceStable(tests, func(i, j int) bool {
+		if tests[i].Row != tests[j].Row {
+			return tests[i].Row < tests[j].Row
+		}
+		return tests[i].Col < tests[j].Col
+	})
+	return tests
+}
+
+// testAdd や test_add（test だけの名前は登録の関数なので除く）
+func isTestName(name string) bool {
+	return strings.HasPrefix(name, "test") && len(name) > len("test")
+}
+
+func run(exec *evaluator.Execution, file string, t *Test) Result {
+	r := Result{Name: t.Name, File: file, Row: t.Row, Col: t.Col}
+	start := time.Now()
+	result := exec.Call(t.Fn)
+	r.Elapsed = time.Since(start)
+
+	err, ok := result.(*object.Error)
+	if !ok {
+		r.Passed = true
+		return r
+	}
+	if err.Row != 0 {
+		r.Row, r.Col = err.Row, err.Col
+	}
+	r.Message = err.KindName() + ": " + err.Detail()
+	return r
+}
@@ -0,0 +1,122 @@
+package tester
+
+import (
+	"monkey/evaluator"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var source = `imm add = (a:number, b:number)=>{ a + b }
+
+imm testAdd = ()=>{
+  assertEq(add(1, 2), 3)
+}
+
+imm testFails = ()=>{
+  assertEq(add(1, 2), 4, "sum")
+}
+
+test("throws", ()=>{
+  assertThrows(()=>{ 1 + "a" }, "TypeError")
+})
+
+imm testName = 1
+imm helper = ()=>{ 0 }
+`
+
+// 結果を「名前 ok」か「名前 位置: メッセージ」の並びにする
+func summary(results []Result) string {
+	out := []string{}
+	for _, r := range results {
+		if r.Passed {
+			out = append(out, r.Name+" ok")
+		} else {
+			out = append(out, r.Name+" "+r.Failure())
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+func TestRun(t *testing.T) {
+	results, err := Run("math_test.kk", source, nil, evaluator.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		"testAdd ok",
+		`testFails math_test.kk:8:3: AssertionError: sum: expected 4, got 3`,
+		"throws ok",
+	}, "\n")
+	if got := summary(results); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRunFilter(t *testing.T) {
+	results, err := Run("math_test.kk", source, regexp.MustCompile("^test[AF]"), evaluator.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Name != "testAdd" || results[1].Name != "testFails" {
+		t.Errorf("unexpected results: %v", results)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"imm = 1", "bad_test.kk:1:5: "},
+		// 構文エラーはすべて並べる
+		{"imm = 1\nimm y = )", "bad_test.kk:1:5: expected next token to be IDENT, got = instead\nbad_test.kk:2:9: "},
+		{"imm x = 1\nlen(1, 2)", "bad_test.kk:2:1: ArgumentError: wrong number of arguments. got=2, want=1"},
+		{"test(1, 2)", "bad_test.kk:1:1: TypeError: argument to `test` must be STRING, got INTEGER"},
+		{"imm value = 1\nputs(valeu)", "bad_test.kk:2:6: NameError: identifier not found: valeu; did you mean value?"},
+	}
+	for _, tt := range tests {
+		_, err := Run("bad_test.kk", tt.input, nil, evaluator.Options{})
+		if err == nil || !strings.HasPrefix(err.Error(), tt.want) {
+			t.Errorf("%q: got %v, want prefix %q", tt.input, err, tt.want)
+		}
+	}
+
+	// テストの中の評価のエラーは失敗になり、位置はテストの宣言
+	results, err := Run("x_test.kk", "imm testBad = ()=>{\n  1 + \"a\"\n}", nil, evaluator.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `testBad x_test.kk:1:5: TypeError: type mismatch: INTEGER + STRING`
+	if got := summary(results); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a_test.kk", "b.kk", "sub/c_test.kk", "sub/d_test.txt"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, err := Discover([]string{dir, filepath.Join(dir, "b.kk")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, f := range files {
+		files[i], _ = filepath.Rel(dir, f)
+	}
+	if got, want := strings.Join(files, " "), "a_test.kk sub/c_test.kk b.kk"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if _, err := Discover([]string{filepath.Join(dir, "missing")}); err == nil {
+		t.Error("expected error for a missing path")
+	}
+}
@@ -55,12 +55,14 @@ const (
 	DOUBLE_QUOTE  TokenType = "\""
 	SINGLE_QUOTE  TokenType = "'"
 	INSTANCEOF    TokenType = "instanceof"
+	AT            TokenType = "@"
 
-	INLINE_OPEN TokenType = "${"
-	YEN_R       TokenType = "\\r"
-	YEN_N       TokenType = "\\n"
-	YEN_T       TokenType = "\\t"
-	YEN_DQ      TokenType = "\\\""
+	INLINE_OPEN  TokenType = "${"
+	INLINE_CLOSE TokenType = "INLINE_CLOSE" // 文字列に埋め込んだ式の終わりの }
+	YEN_R        TokenType = "\\r"
+	YEN_N        TokenType = "\\n"
+	YEN_T        TokenType = "\\t"
+	YEN_DQ       TokenType = "\\\""
 
 	// Identifiers + literals + Type
 	IDENT     TokenType = "IDENT"     // add, foobar, x, y, ...
@@ -74,18 +76,32 @@ const (
 	STRING    TokenType = "STRING"
 
 	// 予約語
-	TRUE     TokenType = "TRUE"
-	FALSE    TokenType = "FALSE"
-	IF       TokenType = "IF"
-	ELSE     TokenType = "ELSE"
-	LOOP     TokenType = "LOOP"
-	RETURN   TokenType = "RETURN"
-	CONTINUE TokenType = "CONTINUE"
-	BREAK    TokenType = "BREAK"
-	SHARE    TokenType = "SHARE"
-	CONST    TokenType = "CONST"
-	IMM      TokenType = "IMM"
-	MUT      TokenType = "MUT"
+	TRUE        TokenType = "TRUE"
+	FALSE       TokenType = "FALSE"
+	IF          TokenType = "IF"
+	ELIF        TokenType = "ELIF"
+	ELSE        TokenType = "ELSE"
+	SWITCH      TokenType = "SWITCH"
+	MATCH       TokenType = "MATCH"
+	CASE        TokenType = "CASE"
+	DEFAULT     TokenType = "DEFAULT"
+	LOOP        TokenType = "LOOP"
+	RETURN      TokenType = "RETURN"
+	CONTINUE    TokenType = "CONTINUE"
+	BREAK       TokenType = "BREAK"
+	YIELD       TokenType = "YIELD"
+	DEFER       TokenType = "DEFER"
+	SPAWN       TokenType = "SPAWN"
+	AWAIT       TokenType = "AWAIT"
+	SELECT      TokenType = "SELECT"
+	FALLTHROUGH TokenType = "FALLTHROUGH"
+	SHARE       TokenType = "SHARE"
+	CONST       TokenType = "CONST"
+	IMM         TokenType = "IMM"
+	MUT         TokenType = "MUT"
+	PUB         TokenType = "PUB"
+	TYPEDEF     TokenType = "TYPEDEF"
+	IMPLEMENTS  TokenType = "IMPLEMENTS"
 )
 
 // オペレータの配列
@@ -132,6 +148,7 @@ var NormalOperators = []TokenType{
 	DOUBLE_QUOTE,
 	SINGLE_QUOTE,
 	INSTANCEOF,
+	AT,
 }
 
 var StringOperators = []TokenType{
@@ -148,10 +165,10 @@ var CommentOperators = []TokenType{
 }
 
 type Token struct {
-	Type    TokenType
-	Literal string
-	Row     int
-	Col     int
+	Type    TokenType `json:"type"`
+	Literal string    `json:"literal"`
+	Row     int       `json:"row"`
+	Col     int       `json:"col"`
 }
 
 func (t *Token) String() string {
@@ -159,18 +176,32 @@ func (t *Token) String() string {
 }
 
 var Reserved = map[string]TokenType{
-	"true":     TRUE,
-	"false":    FALSE,
-	"if":       IF,
-	"else":     ELSE,
-	"loop":     LOOP,
-	"return":   RETURN,
-	"continue": CONTINUE,
-	"break":    BREAK,
-	"share":    SHARE,
-	"const":    CONST,
-	"imm":      IMM,
-	"mut":      MUT,
+	"true":        TRUE,
+	"false":       FALSE,
+	"if":          IF,
+	"elif":        ELIF,
+	"else":        ELSE,
+	"switch":      SWITCH,
+	"match":       MATCH,
+	"case":        CASE,
+	"default":     DEFAULT,
+	"loop":        LOOP,
+	"return":      RETURN,
+	"continue":    CONTINUE,
+	"break":       BREAK,
+	"yield":       YIELD,
+	"defer":       DEFER,
+	"spawn":       SPAWN,
+	"await":       AWAIT,
+	"select":      SELECT,
+	"fallthrough": FALLTHROUGH,
+	"share":       SHARE,
+	"const":       CONST,
+	"imm":         IMM,
+	"mut":         MUT,
+	"pub":         PUB,
+	"type":        TYPEDEF,
+	"implements":  IMPLEMENTS,
 }
 
 var Types = map[string]bool{